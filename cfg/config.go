@@ -26,6 +26,8 @@ import (
 type Config struct {
 	AppName string `yaml:"app-name"`
 
+	BucketOverrides map[string]BucketOverrideConfig `yaml:"bucket-overrides"`
+
 	CacheDir ResolvedPath `yaml:"cache-dir"`
 
 	Debug DebugConfig `yaml:"debug"`
@@ -58,12 +60,18 @@ type Config struct {
 
 	OnlyDir string `yaml:"only-dir"`
 
+	OnlyDirs []string `yaml:"only-dirs"`
+
 	Write WriteConfig `yaml:"write"`
 }
 
 type DebugConfig struct {
 	ExitOnInvariantViolation bool `yaml:"exit-on-invariant-violation"`
 
+	ExperimentalFaultInjectionRules []string `yaml:"experimental-fault-injection-rules"`
+
+	ExperimentalGcsTraceFile string `yaml:"experimental-gcs-trace-file"`
+
 	Fuse bool `yaml:"fuse"`
 
 	Gcs bool `yaml:"gcs"`
@@ -96,6 +104,24 @@ type FileSystemConfig struct {
 
 	DisableParallelDirops bool `yaml:"disable-parallel-dirops"`
 
+	ExperimentalEnableStableInodeIds bool `yaml:"experimental-enable-stable-inode-ids"`
+
+	ExperimentalEnableTrash bool `yaml:"experimental-enable-trash"`
+
+	ExperimentalEnableVersionsDir bool `yaml:"experimental-enable-versions-dir"`
+
+	ExperimentalNameConflictStrategy string `yaml:"experimental-name-conflict-strategy"`
+
+	ExperimentalNameEncoding string `yaml:"experimental-name-encoding"`
+
+	ExperimentalSnapshotTime string `yaml:"experimental-snapshot-time"`
+
+	ExperimentalTrashPrefix string `yaml:"experimental-trash-prefix"`
+
+	ExperimentalTrashRetention time.Duration `yaml:"experimental-trash-retention"`
+
+	ExperimentalUnionLowerLayers []string `yaml:"experimental-union-lower-layers"`
+
 	FileMode Octal `yaml:"file-mode"`
 
 	FuseOptions []string `yaml:"fuse-options"`
@@ -134,8 +160,28 @@ type GcsConnectionConfig struct {
 
 	CustomEndpoint string `yaml:"custom-endpoint"`
 
+	ExperimentalAdaptiveConcurrencyMax int64 `yaml:"experimental-adaptive-concurrency-max"`
+
+	ExperimentalCircuitBreakerCooldown time.Duration `yaml:"experimental-circuit-breaker-cooldown"`
+
+	ExperimentalCircuitBreakerThreshold int64 `yaml:"experimental-circuit-breaker-threshold"`
+
+	ExperimentalEnableHedging bool `yaml:"experimental-enable-hedging"`
+
 	ExperimentalEnableJsonRead bool `yaml:"experimental-enable-json-read"`
 
+	ExperimentalFairShareBy string `yaml:"experimental-fair-share-by"`
+
+	ExperimentalHedgingBudgetPercent float64 `yaml:"experimental-hedging-budget-percent"`
+
+	ExperimentalHedgingPercentile float64 `yaml:"experimental-hedging-percentile"`
+
+	ExperimentalPerCallerLimitBytesPerSec float64 `yaml:"experimental-per-caller-limit-bytes-per-sec"`
+
+	ExperimentalPerCallerLimitOpsPerSec float64 `yaml:"experimental-per-caller-limit-ops-per-sec"`
+
+	ExperimentalSchedulerMaxInFlight int64 `yaml:"experimental-scheduler-max-in-flight"`
+
 	GrpcConnPoolSize int64 `yaml:"grpc-conn-pool-size"`
 
 	HttpClientTimeout time.Duration `yaml:"http-client-timeout"`
@@ -165,6 +211,12 @@ type GcsRetriesConfig struct {
 
 type ListConfig struct {
 	EnableEmptyManagedFolders bool `yaml:"enable-empty-managed-folders"`
+
+	ExperimentalBucketsFilter string `yaml:"experimental-buckets-filter"`
+
+	ExperimentalBucketsProject string `yaml:"experimental-buckets-project"`
+
+	ExperimentalBucketsTtl time.Duration `yaml:"experimental-buckets-ttl"`
 }
 
 type LogRotateLoggingConfig struct {
@@ -194,6 +246,8 @@ type MetadataCacheConfig struct {
 
 	EnableNonexistentTypeCache bool `yaml:"enable-nonexistent-type-cache"`
 
+	ExperimentalEnableRequestCoalescing bool `yaml:"experimental-enable-request-coalescing"`
+
 	ExperimentalMetadataPrefetchOnMount string `yaml:"experimental-metadata-prefetch-on-mount"`
 
 	StatCacheMaxSizeMb int64 `yaml:"stat-cache-max-size-mb"`
@@ -269,7 +323,7 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 
 	flagSet.BoolP("create-empty-file", "", false, "For a new file, it creates an empty file in Cloud Storage bucket as a hold.")
 
-	flagSet.StringP("custom-endpoint", "", "", "Specifies an alternative custom endpoint for fetching data. Should only be used for testing.  The custom endpoint must support the equivalent resources and operations as the GCS  JSON endpoint, https://storage.googleapis.com/storage/v1. If a custom endpoint is not specified,  GCSFuse uses the global GCS JSON API endpoint, https://storage.googleapis.com/storage/v1.")
+	flagSet.StringP("custom-endpoint", "", "", "Specifies an alternative custom endpoint for fetching data. Should only be used for testing.  The custom endpoint must support the equivalent resources and operations as the GCS  JSON endpoint, https://storage.googleapis.com/storage/v1. If a custom endpoint is not specified,  GCSFuse uses the global GCS JSON API endpoint, https://storage.googleapis.com/storage/v1. A file:// URL instead serves buckets from the subdirectories of a local directory, with no server, and an s3:// (or s3+http://) URL serves them from an S3-compatible store.")
 
 	flagSet.BoolP("debug_fs", "", false, "This flag is unused.")
 
@@ -339,36 +393,168 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	flagSet.IntP("experimental-adaptive-concurrency-max", "", 0, "The most GCS requests allowed in flight at once per bucket. The limit is lowered when GCS is overloaded or slow, and raised again as it recovers. 0 disables the limit.")
+
+	if err := flagSet.MarkHidden("experimental-adaptive-concurrency-max"); err != nil {
+		return err
+	}
+
+	flagSet.DurationP("experimental-circuit-breaker-cooldown", "", 30000000000*time.Nanosecond, "How long requests fail fast once the circuit breaker opens, before one is let through to see whether GCS has recovered.")
+
+	if err := flagSet.MarkHidden("experimental-circuit-breaker-cooldown"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("experimental-circuit-breaker-threshold", "", 0, "The number of GCS requests in a row that must fail because GCS is overloaded or unavailable for later requests to fail fast with EHOSTDOWN. 0 disables the circuit breaker.")
+
+	if err := flagSet.MarkHidden("experimental-circuit-breaker-threshold"); err != nil {
+		return err
+	}
+
+	flagSet.BoolP("experimental-enable-hedging", "", false, "Issues a duplicate of a stat or small range read that is slower than most recent ones, and takes whichever returns first, to cut tail latency.")
+
+	if err := flagSet.MarkHidden("experimental-enable-hedging"); err != nil {
+		return err
+	}
+
 	flagSet.BoolP("experimental-enable-json-read", "", false, "By default, GCSFuse uses the GCS XML API to get and read objects. When this flag is specified, GCSFuse uses the GCS JSON API instead.\"")
 
 	if err := flagSet.MarkDeprecated("experimental-enable-json-read", "Experimental flag: could be dropped even in a minor release."); err != nil {
 		return err
 	}
 
+	flagSet.BoolP("experimental-enable-request-coalescing", "", false, "Lets concurrent identical stat, get-folder and list requests share a single call to GCS and its result.")
+
+	if err := flagSet.MarkHidden("experimental-enable-request-coalescing"); err != nil {
+		return err
+	}
+
+	flagSet.BoolP("experimental-enable-stable-inode-ids", "", false, "Derives inode numbers from the bucket and object name instead of handing them out in order, so that an object keeps its inode number across remounts, as backup tools expect.")
+
+	if err := flagSet.MarkHidden("experimental-enable-stable-inode-ids"); err != nil {
+		return err
+	}
+
 	flagSet.BoolP("experimental-enable-streaming-writes", "", false, "Enables streaming uploads during write file operation.")
 
 	if err := flagSet.MarkHidden("experimental-enable-streaming-writes"); err != nil {
 		return err
 	}
 
+	flagSet.BoolP("experimental-enable-trash", "", false, "Moves files and directories removed through the mount under experimental-trash-prefix instead of deleting them. The trash can be browsed in a .trash directory at the root of the bucket, and files are restored by renaming them out of it.")
+
+	if err := flagSet.MarkHidden("experimental-enable-trash"); err != nil {
+		return err
+	}
+
+	flagSet.BoolP("experimental-enable-versions-dir", "", false, "Serves a virtual .gcsfuse-versions directory inside every directory of a bucket with object versioning enabled, listing the past generations of each file read-only. Renaming a generation onto a file restores it.")
+
+	if err := flagSet.MarkHidden("experimental-enable-versions-dir"); err != nil {
+		return err
+	}
+
+	flagSet.StringP("experimental-fair-share-by", "", "", "Shares the limit-ops-per-sec and limit-bytes-per-sec limits equally among the callers using the mount at the time, told apart by \"uid\" or \"pid\". Empty accounts all requests together.")
+
+	if err := flagSet.MarkHidden("experimental-fair-share-by"); err != nil {
+		return err
+	}
+
+	flagSet.StringSliceP("experimental-fault-injection-rules", "", []string{}, "Injects faults into the calls made to the buckets, for testing how gcsfuse copes with them. Each rule is given as <methods>:<glob>:<fault>[@<probability>], where the fault is one of latency=<duration>, stall=<duration>, 429, 503, precondition or truncate[=<bytes>]. See package internal/storage/faults for details.")
+
+	if err := flagSet.MarkHidden("experimental-fault-injection-rules"); err != nil {
+		return err
+	}
+
+	flagSet.StringP("experimental-gcs-trace-file", "", "", "Records every call made to the buckets, with its latency, bytes and outcome, to this file for replaying with gcsfuse-replay. The trace is compressed if the file name ends in .gz.")
+
+	if err := flagSet.MarkHidden("experimental-gcs-trace-file"); err != nil {
+		return err
+	}
+
 	flagSet.IntP("experimental-grpc-conn-pool-size", "", 1, "The number of gRPC channel in grpc client.")
 
 	if err := flagSet.MarkDeprecated("experimental-grpc-conn-pool-size", "Experimental flag: can be removed in a minor release."); err != nil {
 		return err
 	}
 
+	flagSet.Float64P("experimental-hedging-budget-percent", "", 5, "The most duplicate requests that hedging may issue, as a percentage of the requests that could be hedged.")
+
+	if err := flagSet.MarkHidden("experimental-hedging-budget-percent"); err != nil {
+		return err
+	}
+
+	flagSet.Float64P("experimental-hedging-percentile", "", 95, "The percentile of recent latencies after which a request is hedged.")
+
+	if err := flagSet.MarkHidden("experimental-hedging-percentile"); err != nil {
+		return err
+	}
+
+	flagSet.StringP("experimental-list-buckets-filter", "", "", "A regular expression that the names of the buckets listed at the root of a dynamic mount must match. Buckets that don't match can still be visited by name.")
+
+	if err := flagSet.MarkHidden("experimental-list-buckets-filter"); err != nil {
+		return err
+	}
+
+	flagSet.StringP("experimental-list-buckets-project", "", "", "The project whose buckets are listed at the root of a dynamic mount. If empty, the root of a dynamic mount can't be listed.")
+
+	if err := flagSet.MarkHidden("experimental-list-buckets-project"); err != nil {
+		return err
+	}
+
+	flagSet.DurationP("experimental-list-buckets-ttl", "", 60000000000*time.Nanosecond, "How long the list of buckets at the root of a dynamic mount is cached for.")
+
+	if err := flagSet.MarkHidden("experimental-list-buckets-ttl"); err != nil {
+		return err
+	}
+
 	flagSet.StringP("experimental-metadata-prefetch-on-mount", "", "disabled", "Experimental: This indicates whether or not to prefetch the metadata (prefilling of metadata caches and creation of inodes) of the mounted bucket at the time of mounting the bucket. Supported values: \"disabled\", \"sync\" and \"async\". Any other values will return error on mounting. This is applicable only to static mounting, and not to dynamic mounting.")
 
 	if err := flagSet.MarkDeprecated("experimental-metadata-prefetch-on-mount", "Experimental flag: could be removed even in a minor release."); err != nil {
 		return err
 	}
 
+	flagSet.StringP("experimental-name-conflict-strategy", "", "newline", "How to show a file and a directory with the same name, i.e. both foo and foo/ in the bucket. newline lists the file as foo followed by a newline, marker lists it as foo.gcsfuse-file, prefer-dir hides the file and prefer-file hides the directory. Supported values: newline, marker, prefer-dir, prefer-file.")
+
+	if err := flagSet.MarkHidden("experimental-name-conflict-strategy"); err != nil {
+		return err
+	}
+
+	flagSet.StringP("experimental-name-encoding", "", "none", "Exposes objects whose names aren't valid paths, such as a//b, dir/./x, names with control characters or objects ending in a slash that have content, under escaped file names that map back to them on writes and renames. Supported values: none, percent.")
+
+	if err := flagSet.MarkHidden("experimental-name-encoding"); err != nil {
+		return err
+	}
+
 	flagSet.StringP("experimental-opentelemetry-collector-address", "", "", "Experimental: Export metrics to the OpenTelemetry collector at this address.")
 
 	if err := flagSet.MarkDeprecated("experimental-opentelemetry-collector-address", "Experimental flag: could be dropped even in a minor release."); err != nil {
 		return err
 	}
 
+	flagSet.Float64P("experimental-per-caller-limit-bytes-per-sec", "", -1, "Bandwidth limit for reading data for each caller, as told apart by experimental-fair-share-by. (use -1 for no limit)")
+
+	if err := flagSet.MarkHidden("experimental-per-caller-limit-bytes-per-sec"); err != nil {
+		return err
+	}
+
+	flagSet.Float64P("experimental-per-caller-limit-ops-per-sec", "", -1, "Operations per second limit for each caller, as told apart by experimental-fair-share-by. (use -1 for no limit)")
+
+	if err := flagSet.MarkHidden("experimental-per-caller-limit-ops-per-sec"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("experimental-scheduler-max-in-flight", "", 0, "The most GCS requests let through at once per bucket, the ones users are waiting on first, ahead of file cache downloads and garbage collection. 0 disables scheduling.")
+
+	if err := flagSet.MarkHidden("experimental-scheduler-max-in-flight"); err != nil {
+		return err
+	}
+
+	flagSet.StringP("experimental-snapshot-time", "", "", "Mounts the bucket read-only as it was at this RFC 3339 timestamp, serving for each object the generation that was live then. Requires object versioning to have been enabled on the bucket since that time.")
+
+	if err := flagSet.MarkHidden("experimental-snapshot-time"); err != nil {
+		return err
+	}
+
 	flagSet.StringP("experimental-tracing-mode", "", "", "Experimental: specify tracing mode")
 
 	if err := flagSet.MarkHidden("experimental-tracing-mode"); err != nil {
@@ -381,6 +567,24 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	flagSet.StringP("experimental-trash-prefix", "", ".gcsfuse-trash/", "The top-level prefix that removed objects are moved under when experimental-enable-trash is set. It must end with a slash.")
+
+	if err := flagSet.MarkHidden("experimental-trash-prefix"); err != nil {
+		return err
+	}
+
+	flagSet.DurationP("experimental-trash-retention", "", 604800000000000*time.Nanosecond, "How long removed objects stay in the trash before being purged.")
+
+	if err := flagSet.MarkHidden("experimental-trash-retention"); err != nil {
+		return err
+	}
+
+	flagSet.StringSliceP("experimental-union-lower-layers", "", []string{}, "Layers the mounted bucket over these read-only lower layers, each given as a bucket name optionally followed by a slash and a prefix, topmost first. Names resolve to the topmost layer that has them, writes go to the mounted bucket, and removing a lower layer's entry leaves a whiteout object in the mounted bucket. Not supported with dynamic mounting.")
+
+	if err := flagSet.MarkHidden("experimental-union-lower-layers"); err != nil {
+		return err
+	}
+
 	flagSet.BoolP("file-cache-cache-file-for-range-read", "", false, "Whether to cache file for range reads.")
 
 	flagSet.IntP("file-cache-download-chunk-size-mb", "", 50, "Size of chunks in MiB that each concurrent request downloads.")
@@ -469,6 +673,8 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 
 	flagSet.StringP("only-dir", "", "", "Mount only a specific directory within the bucket. See docs/mounting for more information")
 
+	flagSet.StringSliceP("only-dirs", "", []string{}, "Mount several directories within the bucket, each as a subdirectory of the mount point. Each entry is a prefix optionally followed by = and the name of its subdirectory, which defaults to the last component of the prefix. Cannot be combined with only-dir.")
+
 	flagSet.BoolP("precondition-errors", "", false, "Throw Stale NFS file handle error in case the object being synced or read  from is modified by some other concurrent process. This helps prevent  silent data loss or data corruption.")
 
 	if err := flagSet.MarkHidden("precondition-errors"); err != nil {
@@ -656,26 +862,114 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("gcs-connection.experimental-adaptive-concurrency-max", flagSet.Lookup("experimental-adaptive-concurrency-max")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("gcs-connection.experimental-circuit-breaker-cooldown", flagSet.Lookup("experimental-circuit-breaker-cooldown")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("gcs-connection.experimental-circuit-breaker-threshold", flagSet.Lookup("experimental-circuit-breaker-threshold")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("gcs-connection.experimental-enable-hedging", flagSet.Lookup("experimental-enable-hedging")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("gcs-connection.experimental-enable-json-read", flagSet.Lookup("experimental-enable-json-read")); err != nil {
 		return err
 	}
 
+	if err := v.BindPFlag("metadata-cache.experimental-enable-request-coalescing", flagSet.Lookup("experimental-enable-request-coalescing")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("file-system.experimental-enable-stable-inode-ids", flagSet.Lookup("experimental-enable-stable-inode-ids")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("write.experimental-enable-streaming-writes", flagSet.Lookup("experimental-enable-streaming-writes")); err != nil {
 		return err
 	}
 
+	if err := v.BindPFlag("file-system.experimental-enable-trash", flagSet.Lookup("experimental-enable-trash")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("file-system.experimental-enable-versions-dir", flagSet.Lookup("experimental-enable-versions-dir")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("gcs-connection.experimental-fair-share-by", flagSet.Lookup("experimental-fair-share-by")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("debug.experimental-fault-injection-rules", flagSet.Lookup("experimental-fault-injection-rules")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("debug.experimental-gcs-trace-file", flagSet.Lookup("experimental-gcs-trace-file")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("gcs-connection.grpc-conn-pool-size", flagSet.Lookup("experimental-grpc-conn-pool-size")); err != nil {
 		return err
 	}
 
+	if err := v.BindPFlag("gcs-connection.experimental-hedging-budget-percent", flagSet.Lookup("experimental-hedging-budget-percent")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("gcs-connection.experimental-hedging-percentile", flagSet.Lookup("experimental-hedging-percentile")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("list.experimental-buckets-filter", flagSet.Lookup("experimental-list-buckets-filter")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("list.experimental-buckets-project", flagSet.Lookup("experimental-list-buckets-project")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("list.experimental-buckets-ttl", flagSet.Lookup("experimental-list-buckets-ttl")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("metadata-cache.experimental-metadata-prefetch-on-mount", flagSet.Lookup("experimental-metadata-prefetch-on-mount")); err != nil {
 		return err
 	}
 
+	if err := v.BindPFlag("file-system.experimental-name-conflict-strategy", flagSet.Lookup("experimental-name-conflict-strategy")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("file-system.experimental-name-encoding", flagSet.Lookup("experimental-name-encoding")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("monitoring.experimental-opentelemetry-collector-address", flagSet.Lookup("experimental-opentelemetry-collector-address")); err != nil {
 		return err
 	}
 
+	if err := v.BindPFlag("gcs-connection.experimental-per-caller-limit-bytes-per-sec", flagSet.Lookup("experimental-per-caller-limit-bytes-per-sec")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("gcs-connection.experimental-per-caller-limit-ops-per-sec", flagSet.Lookup("experimental-per-caller-limit-ops-per-sec")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("gcs-connection.experimental-scheduler-max-in-flight", flagSet.Lookup("experimental-scheduler-max-in-flight")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("file-system.experimental-snapshot-time", flagSet.Lookup("experimental-snapshot-time")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("monitoring.experimental-tracing-mode", flagSet.Lookup("experimental-tracing-mode")); err != nil {
 		return err
 	}
@@ -684,6 +978,18 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("file-system.experimental-trash-prefix", flagSet.Lookup("experimental-trash-prefix")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("file-system.experimental-trash-retention", flagSet.Lookup("experimental-trash-retention")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("file-system.experimental-union-lower-layers", flagSet.Lookup("experimental-union-lower-layers")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("file-cache.cache-file-for-range-read", flagSet.Lookup("file-cache-cache-file-for-range-read")); err != nil {
 		return err
 	}
@@ -816,6 +1122,10 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("only-dirs", flagSet.Lookup("only-dirs")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("file-system.precondition-errors", flagSet.Lookup("precondition-errors")); err != nil {
 		return err
 	}
@@ -16,7 +16,9 @@ package cfg
 
 import (
 	"fmt"
+	"path"
 	"runtime"
+	"strings"
 	"time"
 )
 
@@ -55,3 +57,33 @@ func ListCacheTTLSecsToDuration(secs int64) time.Duration {
 func IsMetricsEnabled(c *MetricsConfig) bool {
 	return c.CloudMetricsExportIntervalSecs > 0 || c.PrometheusPort > 0
 }
+
+// ParseOnlyDirs maps the subdirectory names of only-dirs entries to their
+// prefixes, which have no trailing slash.
+func ParseOnlyDirs(entries []string) (map[string]string, error) {
+	dirs := make(map[string]string, len(entries))
+	for _, e := range entries {
+		prefix, name := e, ""
+		if i := strings.LastIndex(e, "="); i >= 0 {
+			prefix, name = e[:i], e[i+1:]
+		}
+
+		prefix = strings.Trim(prefix, "/")
+		if prefix == "" {
+			return nil, fmt.Errorf("only-dirs entry %q has no prefix", e)
+		}
+		if name == "" {
+			name = path.Base(prefix)
+		}
+		if name == "." || name == ".." || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("only-dirs entry %q has invalid subdirectory name %q", e, name)
+		}
+		if _, ok := dirs[name]; ok {
+			return nil, fmt.Errorf("only-dirs has more than one entry for subdirectory %q", name)
+		}
+
+		dirs[name] = prefix
+	}
+
+	return dirs, nil
+}
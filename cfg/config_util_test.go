@@ -203,3 +203,37 @@ func TestIsMetricsEnabled(t *testing.T) {
 		})
 	}
 }
+
+func TestParseOnlyDirs(t *testing.T) {
+	t.Parallel()
+	var testCases = []struct {
+		testName string
+		entries  []string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{"none", nil, map[string]string{}, false},
+		{"default_names", []string{"teams/a/", "b"}, map[string]string{"a": "teams/a", "b": "b"}, false},
+		{"explicit_name", []string{"teams/a=team-a"}, map[string]string{"team-a": "teams/a"}, false},
+		{"empty_prefix", []string{"=a"}, nil, true},
+		{"slash_in_name", []string{"teams/a=x/y"}, nil, true},
+		{"dot_name", []string{"teams/a=.."}, nil, true},
+		{"duplicate_name", []string{"x/a", "y/a"}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			t.Parallel()
+
+			dirs, err := ParseOnlyDirs(tc.entries)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.want, dirs)
+			}
+		})
+	}
+}
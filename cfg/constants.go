@@ -41,6 +41,27 @@ const (
 	ExperimentalMetadataPrefetchOnMountAsynchronous = "async"
 )
 
+const (
+	// NameEncodingNone exposes only objects whose names are valid paths.
+	NameEncodingNone = "none"
+	// NameEncodingPercent exposes every object, escaping the parts of its name
+	// that aren't valid in a path as %XX.
+	NameEncodingPercent = "percent"
+)
+
+const (
+	// NameConflictNewline lists a file that conflicts with a directory under
+	// its name followed by a newline.
+	NameConflictNewline = "newline"
+	// NameConflictMarker lists a file that conflicts with a directory under its
+	// name followed by a readable marker.
+	NameConflictMarker = "marker"
+	// NameConflictPreferDir hides a file that conflicts with a directory.
+	NameConflictPreferDir = "prefer-dir"
+	// NameConflictPreferFile hides a directory that conflicts with a file.
+	NameConflictPreferFile = "prefer-file"
+)
+
 const (
 	// maxSequentialReadSizeMb is the max value supported by sequential-read-size-mb flag.
 	maxSequentialReadSizeMB = 1024
@@ -19,6 +19,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 )
@@ -86,3 +87,19 @@ func (p *ResolvedPath) UnmarshalText(text []byte) error {
 	*p = ResolvedPath(path)
 	return nil
 }
+
+// BucketOverrideConfig overrides parts of the config for a single bucket; see
+// bucket-overrides. Nil fields keep the mount-wide value.
+type BucketOverrideConfig struct {
+	BillingProject *string `yaml:"billing-project"`
+
+	EnableFileCache *bool `yaml:"enable-file-cache"`
+
+	LimitBytesPerSec *float64 `yaml:"limit-bytes-per-sec"`
+
+	LimitOpsPerSec *float64 `yaml:"limit-ops-per-sec"`
+
+	ReadOnly *bool `yaml:"read-only"`
+
+	StatCacheTtl *time.Duration `yaml:"stat-cache-ttl"`
+}
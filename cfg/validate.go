@@ -17,8 +17,13 @@ package cfg
 import (
 	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"time"
 
 	"math"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/faults"
 )
 
 const (
@@ -200,6 +205,141 @@ func isValidChunkTransferTimeoutForRetriesConfig(chunkTransferTimeoutSecs int64)
 	return nil
 }
 
+func isValidSnapshotTime(t string) error {
+	if t == "" {
+		return nil
+	}
+	if _, err := time.Parse(time.RFC3339, t); err != nil {
+		return fmt.Errorf("experimental-snapshot-time should be an RFC 3339 timestamp: %w", err)
+	}
+	return nil
+}
+
+func isValidTrashConfig(fsc *FileSystemConfig) error {
+	if !fsc.ExperimentalEnableTrash {
+		return nil
+	}
+	p := fsc.ExperimentalTrashPrefix
+	if p == "/" || !strings.HasSuffix(p, "/") || strings.Count(p, "/") != 1 {
+		return fmt.Errorf("experimental-trash-prefix should be a single path component followed by a slash, got %q", p)
+	}
+	if fsc.ExperimentalTrashRetention <= 0 {
+		return fmt.Errorf("experimental-trash-retention should be positive when the trash is enabled")
+	}
+	return nil
+}
+
+func isValidUnionLowerLayers(layers []string) error {
+	for _, l := range layers {
+		if bucket, _, _ := strings.Cut(l, "/"); bucket == "" {
+			return fmt.Errorf("experimental-union-lower-layers should name a bucket in every layer, got %q", l)
+		}
+	}
+	return nil
+}
+
+func isValidOnlyDirs(config *Config) error {
+	if len(config.OnlyDirs) == 0 {
+		return nil
+	}
+	if config.OnlyDir != "" {
+		return fmt.Errorf("only-dir and only-dirs can't both be set")
+	}
+	_, err := ParseOnlyDirs(config.OnlyDirs)
+	return err
+}
+
+func isValidBucketListConfig(lc *ListConfig) error {
+	if _, err := regexp.Compile(lc.ExperimentalBucketsFilter); err != nil {
+		return fmt.Errorf("experimental-list-buckets-filter should be a regular expression: %w", err)
+	}
+	if lc.ExperimentalBucketsTtl < 0 {
+		return fmt.Errorf("experimental-list-buckets-ttl can't be negative")
+	}
+	return nil
+}
+
+func isValidNameEncoding(encoding string) error {
+	switch encoding {
+	case "", NameEncodingNone, NameEncodingPercent:
+		return nil
+	default:
+		return fmt.Errorf("unsupported experimental-name-encoding: %q; supported values: none, percent", encoding)
+	}
+}
+
+func isValidNameConflictStrategy(strategy string) error {
+	switch strategy {
+	case "", NameConflictNewline, NameConflictMarker, NameConflictPreferDir, NameConflictPreferFile:
+		return nil
+	default:
+		return fmt.Errorf("unsupported experimental-name-conflict-strategy: %q; supported values: newline, marker, prefer-dir, prefer-file", strategy)
+	}
+}
+
+func isValidBucketOverrides(overrides map[string]BucketOverrideConfig) error {
+	for name, o := range overrides {
+		if name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("bucket-overrides should be keyed by bucket name, got %q", name)
+		}
+		if o.StatCacheTtl != nil && *o.StatCacheTtl < 0 {
+			return fmt.Errorf("stat-cache-ttl for bucket %q can't be negative", name)
+		}
+	}
+	return nil
+}
+
+func isValidHedgingConfig(gc *GcsConnectionConfig) error {
+	if !gc.ExperimentalEnableHedging {
+		return nil
+	}
+	if gc.ExperimentalHedgingPercentile <= 0 || gc.ExperimentalHedgingPercentile >= 100 {
+		return fmt.Errorf("experimental-hedging-percentile should be between 0 and 100")
+	}
+	if gc.ExperimentalHedgingBudgetPercent < 0 || gc.ExperimentalHedgingBudgetPercent > 100 {
+		return fmt.Errorf("experimental-hedging-budget-percent should be between 0 and 100")
+	}
+	return nil
+}
+
+func isValidAdaptiveConcurrencyConfig(gc *GcsConnectionConfig) error {
+	if gc.ExperimentalAdaptiveConcurrencyMax < 0 {
+		return fmt.Errorf("experimental-adaptive-concurrency-max can't be negative")
+	}
+	if gc.ExperimentalCircuitBreakerThreshold < 0 {
+		return fmt.Errorf("experimental-circuit-breaker-threshold can't be negative")
+	}
+	if gc.ExperimentalCircuitBreakerThreshold > 0 && gc.ExperimentalCircuitBreakerCooldown <= 0 {
+		return fmt.Errorf("experimental-circuit-breaker-cooldown should be positive")
+	}
+	return nil
+}
+
+func isValidSchedulerConfig(gc *GcsConnectionConfig) error {
+	if gc.ExperimentalSchedulerMaxInFlight < 0 {
+		return fmt.Errorf("experimental-scheduler-max-in-flight can't be negative")
+	}
+	return nil
+}
+
+func isValidFairShareConfig(gc *GcsConnectionConfig) error {
+	switch gc.ExperimentalFairShareBy {
+	case "", "uid", "pid":
+	default:
+		return fmt.Errorf("experimental-fair-share-by must be one of \"uid\" or \"pid\", got %q", gc.ExperimentalFairShareBy)
+	}
+
+	if gc.ExperimentalFairShareBy == "" && (gc.ExperimentalPerCallerLimitOpsPerSec > 0 || gc.ExperimentalPerCallerLimitBytesPerSec > 0) {
+		return fmt.Errorf("per-caller limits require experimental-fair-share-by to be set")
+	}
+	return nil
+}
+
+func isValidFaultInjectionRules(rules []string) error {
+	_, err := faults.ParseRules(rules)
+	return err
+}
+
 // ValidateConfig returns a non-nil error if the config is invalid.
 func ValidateConfig(v isSet, config *Config) error {
 	var err error
@@ -256,5 +396,57 @@ func ValidateConfig(v isSet, config *Config) error {
 		return fmt.Errorf("error parsing parallel download config: %w", err)
 	}
 
+	if err = isValidSnapshotTime(config.FileSystem.ExperimentalSnapshotTime); err != nil {
+		return fmt.Errorf("error parsing experimental-snapshot-time config: %w", err)
+	}
+
+	if err = isValidTrashConfig(&config.FileSystem); err != nil {
+		return fmt.Errorf("error parsing trash config: %w", err)
+	}
+
+	if err = isValidUnionLowerLayers(config.FileSystem.ExperimentalUnionLowerLayers); err != nil {
+		return fmt.Errorf("error parsing experimental-union-lower-layers config: %w", err)
+	}
+
+	if err = isValidOnlyDirs(config); err != nil {
+		return fmt.Errorf("error parsing only-dirs config: %w", err)
+	}
+
+	if err = isValidBucketListConfig(&config.List); err != nil {
+		return fmt.Errorf("error parsing bucket list config: %w", err)
+	}
+
+	if err = isValidNameEncoding(config.FileSystem.ExperimentalNameEncoding); err != nil {
+		return fmt.Errorf("error parsing experimental-name-encoding config: %w", err)
+	}
+
+	if err = isValidNameConflictStrategy(config.FileSystem.ExperimentalNameConflictStrategy); err != nil {
+		return fmt.Errorf("error parsing experimental-name-conflict-strategy config: %w", err)
+	}
+
+	if err = isValidBucketOverrides(config.BucketOverrides); err != nil {
+		return fmt.Errorf("error parsing bucket-overrides config: %w", err)
+	}
+
+	if err = isValidHedgingConfig(&config.GcsConnection); err != nil {
+		return fmt.Errorf("error parsing hedging config: %w", err)
+	}
+
+	if err = isValidAdaptiveConcurrencyConfig(&config.GcsConnection); err != nil {
+		return fmt.Errorf("error parsing adaptive concurrency config: %w", err)
+	}
+
+	if err = isValidSchedulerConfig(&config.GcsConnection); err != nil {
+		return fmt.Errorf("error parsing scheduler config: %w", err)
+	}
+
+	if err = isValidFairShareConfig(&config.GcsConnection); err != nil {
+		return fmt.Errorf("error parsing fair share config: %w", err)
+	}
+
+	if err = isValidFaultInjectionRules(config.Debug.ExperimentalFaultInjectionRules); err != nil {
+		return fmt.Errorf("error parsing experimental-fault-injection-rules config: %w", err)
+	}
+
 	return nil
 }
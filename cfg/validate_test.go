@@ -655,3 +655,723 @@ func TestValidateMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateSnapshotTime(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name         string
+		snapshotTime string
+		wantErr      bool
+	}{
+		{
+			name:         "unset",
+			snapshotTime: "",
+			wantErr:      false,
+		},
+		{
+			name:         "rfc3339",
+			snapshotTime: "2024-05-01T10:00:00Z",
+			wantErr:      false,
+		},
+		{
+			name:         "rfc3339_with_offset",
+			snapshotTime: "2024-05-01T10:00:00.5+02:00",
+			wantErr:      false,
+		},
+		{
+			name:         "date_only",
+			snapshotTime: "2024-05-01",
+			wantErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.FileSystem.ExperimentalSnapshotTime = tc.snapshotTime
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateTrash(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name      string
+		enabled   bool
+		prefix    string
+		retention time.Duration
+		wantErr   bool
+	}{
+		{
+			name:      "disabled_empty_prefix",
+			enabled:   false,
+			prefix:    "",
+			retention: 0,
+			wantErr:   false,
+		},
+		{
+			name:      "enabled",
+			enabled:   true,
+			prefix:    ".gcsfuse-trash/",
+			retention: time.Hour,
+			wantErr:   false,
+		},
+		{
+			name:      "enabled_no_trailing_slash",
+			enabled:   true,
+			prefix:    ".gcsfuse-trash",
+			retention: time.Hour,
+			wantErr:   true,
+		},
+		{
+			name:      "enabled_nested_prefix",
+			enabled:   true,
+			prefix:    "a/trash/",
+			retention: time.Hour,
+			wantErr:   true,
+		},
+		{
+			name:      "enabled_slash_only",
+			enabled:   true,
+			prefix:    "/",
+			retention: time.Hour,
+			wantErr:   true,
+		},
+		{
+			name:      "enabled_zero_retention",
+			enabled:   true,
+			prefix:    ".gcsfuse-trash/",
+			retention: 0,
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.FileSystem.ExperimentalEnableTrash = tc.enabled
+			c.FileSystem.ExperimentalTrashPrefix = tc.prefix
+			c.FileSystem.ExperimentalTrashRetention = tc.retention
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateUnionLowerLayers(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		layers  []string
+		wantErr bool
+	}{
+		{
+			name:    "none",
+			layers:  nil,
+			wantErr: false,
+		},
+		{
+			name:    "buckets_and_prefixes",
+			layers:  []string{"bucket", "other-bucket/some/prefix/"},
+			wantErr: false,
+		},
+		{
+			name:    "empty_layer",
+			layers:  []string{"bucket", ""},
+			wantErr: true,
+		},
+		{
+			name:    "prefix_without_bucket",
+			layers:  []string{"/prefix/"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.FileSystem.ExperimentalUnionLowerLayers = tc.layers
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateOnlyDirs(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		onlyDir  string
+		onlyDirs []string
+		wantErr  bool
+	}{
+		{
+			name:     "only_dirs",
+			onlyDirs: []string{"teams/a", "teams/b=b"},
+			wantErr:  false,
+		},
+		{
+			name:     "with_only_dir",
+			onlyDir:  "teams",
+			onlyDirs: []string{"teams/a"},
+			wantErr:  true,
+		},
+		{
+			name:     "duplicate_names",
+			onlyDirs: []string{"x/a", "y/a"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.OnlyDir = tc.onlyDir
+			c.OnlyDirs = tc.onlyDirs
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateBucketList(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		filter  string
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "no_filter",
+			filter:  "",
+			ttl:     time.Minute,
+			wantErr: false,
+		},
+		{
+			name:    "filter",
+			filter:  "^team-.*$",
+			ttl:     0,
+			wantErr: false,
+		},
+		{
+			name:    "invalid_filter",
+			filter:  "team-(",
+			ttl:     time.Minute,
+			wantErr: true,
+		},
+		{
+			name:    "negative_ttl",
+			filter:  "",
+			ttl:     -time.Second,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.List.ExperimentalBucketsFilter = tc.filter
+			c.List.ExperimentalBucketsTtl = tc.ttl
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateBucketOverrides(t *testing.T) {
+	t.Parallel()
+	ttl := time.Minute
+	negativeTtl := -time.Second
+	readOnly := true
+	testCases := []struct {
+		name      string
+		overrides map[string]BucketOverrideConfig
+		wantErr   bool
+	}{
+		{
+			name:      "none",
+			overrides: nil,
+			wantErr:   false,
+		},
+		{
+			name: "valid",
+			overrides: map[string]BucketOverrideConfig{
+				"archive": {ReadOnly: &readOnly, StatCacheTtl: &ttl},
+				"scratch": {},
+			},
+			wantErr: false,
+		},
+		{
+			name: "empty_bucket_name",
+			overrides: map[string]BucketOverrideConfig{
+				"": {ReadOnly: &readOnly},
+			},
+			wantErr: true,
+		},
+		{
+			name: "bucket_name_with_prefix",
+			overrides: map[string]BucketOverrideConfig{
+				"archive/2020": {ReadOnly: &readOnly},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative_stat_cache_ttl",
+			overrides: map[string]BucketOverrideConfig{
+				"archive": {StatCacheTtl: &negativeTtl},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.BucketOverrides = tc.overrides
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateNameEncoding(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		encoding string
+		wantErr  bool
+	}{
+		{
+			name:     "none",
+			encoding: "none",
+			wantErr:  false,
+		},
+		{
+			name:     "percent",
+			encoding: "percent",
+			wantErr:  false,
+		},
+		{
+			name:     "unset",
+			encoding: "",
+			wantErr:  false,
+		},
+		{
+			name:     "unsupported",
+			encoding: "base64",
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.FileSystem.ExperimentalNameEncoding = tc.encoding
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateNameConflictStrategy(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		strategy string
+		wantErr  bool
+	}{
+		{
+			name:     "newline",
+			strategy: "newline",
+			wantErr:  false,
+		},
+		{
+			name:     "marker",
+			strategy: "marker",
+			wantErr:  false,
+		},
+		{
+			name:     "prefer-dir",
+			strategy: "prefer-dir",
+			wantErr:  false,
+		},
+		{
+			name:     "prefer-file",
+			strategy: "prefer-file",
+			wantErr:  false,
+		},
+		{
+			name:     "unset",
+			strategy: "",
+			wantErr:  false,
+		},
+		{
+			name:     "unsupported",
+			strategy: "prefer-newest",
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.FileSystem.ExperimentalNameConflictStrategy = tc.strategy
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateFaultInjectionRules(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		rules   []string
+		wantErr bool
+	}{
+		{
+			name:    "none",
+			rules:   nil,
+			wantErr: false,
+		},
+		{
+			name:    "valid_rules",
+			rules:   []string{"NewReader:*.bin:stall=5s@0.1", "*:*:503@0.01"},
+			wantErr: false,
+		},
+		{
+			name:    "unknown_fault",
+			rules:   []string{"*:*:500"},
+			wantErr: true,
+		},
+		{
+			name:    "missing_glob",
+			rules:   []string{"StatObject:429"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.Debug.ExperimentalFaultInjectionRules = tc.rules
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateHedgingConfig(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		enable        bool
+		percentile    float64
+		budgetPercent float64
+		wantErr       bool
+	}{
+		{
+			name:          "disabled",
+			enable:        false,
+			percentile:    0,
+			budgetPercent: 5,
+			wantErr:       false,
+		},
+		{
+			name:          "valid",
+			enable:        true,
+			percentile:    95,
+			budgetPercent: 5,
+			wantErr:       false,
+		},
+		{
+			name:          "percentile_out_of_range",
+			enable:        true,
+			percentile:    100,
+			budgetPercent: 5,
+			wantErr:       true,
+		},
+		{
+			name:          "negative_budget",
+			enable:        true,
+			percentile:    95,
+			budgetPercent: -1,
+			wantErr:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.GcsConnection.ExperimentalEnableHedging = tc.enable
+			c.GcsConnection.ExperimentalHedgingPercentile = tc.percentile
+			c.GcsConnection.ExperimentalHedgingBudgetPercent = tc.budgetPercent
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateAdaptiveConcurrencyConfig(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name      string
+		max       int64
+		threshold int64
+		cooldown  time.Duration
+		wantErr   bool
+	}{
+		{
+			name:      "disabled",
+			max:       0,
+			threshold: 0,
+			cooldown:  0,
+			wantErr:   false,
+		},
+		{
+			name:      "valid",
+			max:       64,
+			threshold: 5,
+			cooldown:  30 * time.Second,
+			wantErr:   false,
+		},
+		{
+			name:      "negative_max",
+			max:       -1,
+			threshold: 0,
+			cooldown:  30 * time.Second,
+			wantErr:   true,
+		},
+		{
+			name:      "negative_threshold",
+			max:       0,
+			threshold: -1,
+			cooldown:  30 * time.Second,
+			wantErr:   true,
+		},
+		{
+			name:      "no_cooldown",
+			max:       0,
+			threshold: 5,
+			cooldown:  0,
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.GcsConnection.ExperimentalAdaptiveConcurrencyMax = tc.max
+			c.GcsConnection.ExperimentalCircuitBreakerThreshold = tc.threshold
+			c.GcsConnection.ExperimentalCircuitBreakerCooldown = tc.cooldown
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateSchedulerConfig(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name        string
+		maxInFlight int64
+		wantErr     bool
+	}{
+		{
+			name:        "disabled",
+			maxInFlight: 0,
+			wantErr:     false,
+		},
+		{
+			name:        "valid",
+			maxInFlight: 64,
+			wantErr:     false,
+		},
+		{
+			name:        "negative",
+			maxInFlight: -1,
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.GcsConnection.ExperimentalSchedulerMaxInFlight = tc.maxInFlight
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateFairShareConfig(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name            string
+		by              string
+		perCallerOps    float64
+		perCallerEgress float64
+		wantErr         bool
+	}{
+		{
+			name:            "disabled",
+			by:              "",
+			perCallerOps:    -1,
+			perCallerEgress: -1,
+			wantErr:         false,
+		},
+		{
+			name:            "by_uid",
+			by:              "uid",
+			perCallerOps:    -1,
+			perCallerEgress: -1,
+			wantErr:         false,
+		},
+		{
+			name:            "by_pid_with_caps",
+			by:              "pid",
+			perCallerOps:    100,
+			perCallerEgress: 1 << 20,
+			wantErr:         false,
+		},
+		{
+			name:            "unknown_key",
+			by:              "gid",
+			perCallerOps:    -1,
+			perCallerEgress: -1,
+			wantErr:         true,
+		},
+		{
+			name:            "ops_cap_without_key",
+			by:              "",
+			perCallerOps:    100,
+			perCallerEgress: -1,
+			wantErr:         true,
+		},
+		{
+			name:            "egress_cap_without_key",
+			by:              "",
+			perCallerOps:    -1,
+			perCallerEgress: 1 << 20,
+			wantErr:         true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.GcsConnection.ExperimentalFairShareBy = tc.by
+			c.GcsConnection.ExperimentalPerCallerLimitOpsPerSec = tc.perCallerOps
+			c.GcsConnection.ExperimentalPerCallerLimitBytesPerSec = tc.perCallerEgress
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -445,17 +445,22 @@ func TestValidateConfigFile_GCSConnectionConfigSuccessful(t *testing.T) {
 			configFile: "testdata/empty_file.yaml",
 			expectedConfig: &cfg.Config{
 				GcsConnection: cfg.GcsConnectionConfig{
-					BillingProject:             "",
-					ClientProtocol:             "http1",
-					CustomEndpoint:             "",
-					ExperimentalEnableJsonRead: false,
-					GrpcConnPoolSize:           1,
-					HttpClientTimeout:          0,
-					LimitBytesPerSec:           -1,
-					LimitOpsPerSec:             -1,
-					MaxConnsPerHost:            0,
-					MaxIdleConnsPerHost:        100,
-					SequentialReadSizeMb:       200,
+					BillingProject:                        "",
+					ClientProtocol:                        "http1",
+					CustomEndpoint:                        "",
+					ExperimentalCircuitBreakerCooldown:    30 * time.Second,
+					ExperimentalEnableJsonRead:            false,
+					ExperimentalHedgingBudgetPercent:      5,
+					ExperimentalHedgingPercentile:         95,
+					ExperimentalPerCallerLimitBytesPerSec: -1,
+					ExperimentalPerCallerLimitOpsPerSec:   -1,
+					GrpcConnPoolSize:                      1,
+					HttpClientTimeout:                     0,
+					LimitBytesPerSec:                      -1,
+					LimitOpsPerSec:                        -1,
+					MaxConnsPerHost:                       0,
+					MaxIdleConnsPerHost:                   100,
+					SequentialReadSizeMb:                  200,
 				},
 			},
 		},
@@ -464,17 +469,22 @@ func TestValidateConfigFile_GCSConnectionConfigSuccessful(t *testing.T) {
 			configFile: "testdata/valid_config.yaml",
 			expectedConfig: &cfg.Config{
 				GcsConnection: cfg.GcsConnectionConfig{
-					BillingProject:             "abc",
-					ClientProtocol:             "http2",
-					CustomEndpoint:             "www.abc.com",
-					ExperimentalEnableJsonRead: true,
-					GrpcConnPoolSize:           200,
-					HttpClientTimeout:          400 * time.Second,
-					LimitBytesPerSec:           20,
-					LimitOpsPerSec:             30,
-					MaxConnsPerHost:            400,
-					MaxIdleConnsPerHost:        20,
-					SequentialReadSizeMb:       450,
+					BillingProject:                        "abc",
+					ClientProtocol:                        "http2",
+					CustomEndpoint:                        "www.abc.com",
+					ExperimentalCircuitBreakerCooldown:    30 * time.Second,
+					ExperimentalEnableJsonRead:            true,
+					ExperimentalHedgingBudgetPercent:      5,
+					ExperimentalHedgingPercentile:         95,
+					ExperimentalPerCallerLimitBytesPerSec: -1,
+					ExperimentalPerCallerLimitOpsPerSec:   -1,
+					GrpcConnPoolSize:                      200,
+					HttpClientTimeout:                     400 * time.Second,
+					LimitBytesPerSec:                      20,
+					LimitOpsPerSec:                        30,
+					MaxConnsPerHost:                       400,
+					MaxIdleConnsPerHost:                   20,
+					SequentialReadSizeMb:                  450,
 				},
 			},
 		},
@@ -505,18 +515,23 @@ func TestValidateConfigFile_FileSystemConfigSuccessful(t *testing.T) {
 			configFile: "testdata/empty_file.yaml",
 			expectedConfig: &cfg.Config{
 				FileSystem: cfg.FileSystemConfig{
-					DirMode:                0755,
-					DisableParallelDirops:  false,
-					FileMode:               0644,
-					FuseOptions:            []string{},
-					Gid:                    -1,
-					IgnoreInterrupts:       true,
-					KernelListCacheTtlSecs: 0,
-					RenameDirLimit:         0,
-					TempDir:                "",
-					PreconditionErrors:     false,
-					Uid:                    -1,
-					HandleSigterm:          true,
+					DirMode:                          0755,
+					DisableParallelDirops:            false,
+					ExperimentalNameConflictStrategy: "newline",
+					ExperimentalNameEncoding:         "none",
+					ExperimentalTrashPrefix:          ".gcsfuse-trash/",
+					ExperimentalTrashRetention:       168 * time.Hour,
+					ExperimentalUnionLowerLayers:     []string{},
+					FileMode:                         0644,
+					FuseOptions:                      []string{},
+					Gid:                              -1,
+					IgnoreInterrupts:                 true,
+					KernelListCacheTtlSecs:           0,
+					RenameDirLimit:                   0,
+					TempDir:                          "",
+					PreconditionErrors:               false,
+					Uid:                              -1,
+					HandleSigterm:                    true,
 				},
 			},
 		},
@@ -525,18 +540,23 @@ func TestValidateConfigFile_FileSystemConfigSuccessful(t *testing.T) {
 			configFile: "testdata/file_system_config/unset_file_system_config.yaml",
 			expectedConfig: &cfg.Config{
 				FileSystem: cfg.FileSystemConfig{
-					DirMode:                0755,
-					DisableParallelDirops:  false,
-					FileMode:               0644,
-					FuseOptions:            []string{},
-					Gid:                    -1,
-					IgnoreInterrupts:       true,
-					KernelListCacheTtlSecs: 0,
-					RenameDirLimit:         0,
-					TempDir:                "",
-					PreconditionErrors:     false,
-					Uid:                    -1,
-					HandleSigterm:          true,
+					DirMode:                          0755,
+					DisableParallelDirops:            false,
+					ExperimentalNameConflictStrategy: "newline",
+					ExperimentalNameEncoding:         "none",
+					ExperimentalTrashPrefix:          ".gcsfuse-trash/",
+					ExperimentalTrashRetention:       168 * time.Hour,
+					ExperimentalUnionLowerLayers:     []string{},
+					FileMode:                         0644,
+					FuseOptions:                      []string{},
+					Gid:                              -1,
+					IgnoreInterrupts:                 true,
+					KernelListCacheTtlSecs:           0,
+					RenameDirLimit:                   0,
+					TempDir:                          "",
+					PreconditionErrors:               false,
+					Uid:                              -1,
+					HandleSigterm:                    true,
 				},
 			},
 		},
@@ -545,18 +565,23 @@ func TestValidateConfigFile_FileSystemConfigSuccessful(t *testing.T) {
 			configFile: "testdata/valid_config.yaml",
 			expectedConfig: &cfg.Config{
 				FileSystem: cfg.FileSystemConfig{
-					DirMode:                0777,
-					DisableParallelDirops:  true,
-					FileMode:               0666,
-					FuseOptions:            []string{"ro"},
-					Gid:                    7,
-					IgnoreInterrupts:       false,
-					KernelListCacheTtlSecs: 300,
-					RenameDirLimit:         10,
-					TempDir:                cfg.ResolvedPath(path.Join(hd, "temp")),
-					PreconditionErrors:     true,
-					Uid:                    8,
-					HandleSigterm:          true,
+					DirMode:                          0777,
+					DisableParallelDirops:            true,
+					ExperimentalNameConflictStrategy: "newline",
+					ExperimentalNameEncoding:         "none",
+					ExperimentalTrashPrefix:          ".gcsfuse-trash/",
+					ExperimentalTrashRetention:       168 * time.Hour,
+					ExperimentalUnionLowerLayers:     []string{},
+					FileMode:                         0666,
+					FuseOptions:                      []string{"ro"},
+					Gid:                              7,
+					IgnoreInterrupts:                 false,
+					KernelListCacheTtlSecs:           300,
+					RenameDirLimit:                   10,
+					TempDir:                          cfg.ResolvedPath(path.Join(hd, "temp")),
+					PreconditionErrors:               true,
+					Uid:                              8,
+					HandleSigterm:                    true,
 				},
 			},
 		},
@@ -584,14 +609,14 @@ func TestValidateConfigFile_ListConfigSuccessful(t *testing.T) {
 			name:       "empty_config_file",
 			configFile: "testdata/empty_file.yaml",
 			expectedConfig: &cfg.Config{
-				List: cfg.ListConfig{EnableEmptyManagedFolders: false},
+				List: cfg.ListConfig{EnableEmptyManagedFolders: false, ExperimentalBucketsTtl: time.Minute},
 			},
 		},
 		{
 			name:       "valid_config_file",
 			configFile: "testdata/valid_config.yaml",
 			expectedConfig: &cfg.Config{
-				List: cfg.ListConfig{EnableEmptyManagedFolders: true},
+				List: cfg.ListConfig{EnableEmptyManagedFolders: true, ExperimentalBucketsTtl: time.Minute},
 			},
 		},
 	}
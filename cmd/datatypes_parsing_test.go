@@ -743,6 +743,18 @@ func TestConfigPassing(t *testing.T) {
 				assert.Equal(t, cfg.ResolvedPath("/home"), c.CacheDir)
 			},
 		},
+		{
+			name: "bucketoverrides1",
+			file: "bucketoverrides1.yaml",
+			testFn: func(t *testing.T, c *cfg.Config) {
+				readOnly, enableFileCache, ttl := true, false, time.Hour
+				billingProject, opsPerSec := "scratch-project", 20.0
+				assert.Equal(t, map[string]cfg.BucketOverrideConfig{
+					"archive": {ReadOnly: &readOnly, StatCacheTtl: &ttl, EnableFileCache: &enableFileCache},
+					"scratch": {BillingProject: &billingProject, LimitOpsPerSec: &opsPerSec},
+				}, c.BucketOverrides)
+			},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -39,6 +39,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/trace"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 	"github.com/jacobsa/daemonize"
 	"github.com/jacobsa/fuse"
@@ -145,7 +146,7 @@ func createStorageHandle(newConfig *cfg.Config, userAgent string) (storageHandle
 ////////////////////////////////////////////////////////////////////////
 
 // Mount the file system according to arguments in the supplied context.
-func mountWithArgs(bucketName string, mountPoint string, newConfig *cfg.Config, metricHandle common.MetricHandle) (mfs *fuse.MountedFileSystem, err error) {
+func mountWithArgs(bucketName string, mountPoint string, newConfig *cfg.Config, metricHandle common.MetricHandle, traceRecorder *trace.Recorder) (mfs *fuse.MountedFileSystem, err error) {
 	// Enable invariant checking if requested.
 	if newConfig.Debug.ExitOnInvariantViolation {
 		locker.EnableInvariantsCheck()
@@ -177,7 +178,8 @@ func mountWithArgs(bucketName string, mountPoint string, newConfig *cfg.Config,
 		mountPoint,
 		newConfig,
 		storageHandle,
-		metricHandle)
+		metricHandle,
+		traceRecorder)
 
 	if err != nil {
 		err = fmt.Errorf("mountWithStorageHandle: %w", err)
@@ -391,11 +393,22 @@ func Mount(newConfig *cfg.Config, bucketName, mountPoint string) (err error) {
 	shutdownTracingFn := monitor.SetupTracing(ctx, newConfig)
 	shutdownFn := common.JoinShutdownFunc(metricExporterShutdownFn, shutdownTracingFn)
 
+	var traceRecorder *trace.Recorder
+	if newConfig.Debug.ExperimentalGcsTraceFile != "" {
+		if traceRecorder, err = trace.CreateRecorder(newConfig.Debug.ExperimentalGcsTraceFile); err != nil {
+			return fmt.Errorf("creating GCS trace: %w", err)
+		}
+
+		shutdownFn = common.JoinShutdownFunc(shutdownFn, func(context.Context) error {
+			return traceRecorder.Close()
+		})
+	}
+
 	// Mount, writing information about our progress to the writer that package
 	// daemonize gives us and telling it about the outcome.
 	var mfs *fuse.MountedFileSystem
 	{
-		mfs, err = mountWithArgs(bucketName, mountPoint, newConfig, metricHandle)
+		mfs, err = mountWithArgs(bucketName, mountPoint, newConfig, metricHandle, traceRecorder)
 
 		// This utility is to absorb the error
 		// returned by daemonize.SignalOutcome calls by simply
@@ -17,18 +17,23 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/mount"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/faults"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/hedging"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/trace"
 	"golang.org/x/net/context"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/perms"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/ratelimit"
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fsutil"
 	"github.com/jacobsa/timeutil"
@@ -42,7 +47,8 @@ func mountWithStorageHandle(
 	mountPoint string,
 	newConfig *cfg.Config,
 	storageHandle storage.StorageHandle,
-	metricHandle common.MetricHandle) (mfs *fuse.MountedFileSystem, err error) {
+	metricHandle common.MetricHandle,
+	traceRecorder *trace.Recorder) (mfs *fuse.MountedFileSystem, err error) {
 	// Sanity check: make sure the temporary directory exists and is writable
 	// currently. This gives a better user experience than harder to debug EIO
 	// errors when reading files in the future.
@@ -86,18 +92,94 @@ be interacting with the file system.`)
 		gid = uint32(newConfig.FileSystem.Gid)
 	}
 
+	var snapshotTime time.Time
+	if newConfig.FileSystem.ExperimentalSnapshotTime != "" {
+		// Already validated, see cfg.ValidateConfig.
+		snapshotTime, err = time.Parse(time.RFC3339, newConfig.FileSystem.ExperimentalSnapshotTime)
+		if err != nil {
+			err = fmt.Errorf("parsing experimental-snapshot-time: %w", err)
+			return
+		}
+	}
+
+	var trashPrefix string
+	if newConfig.FileSystem.ExperimentalEnableTrash {
+		trashPrefix = newConfig.FileSystem.ExperimentalTrashPrefix
+	}
+
+	// Already validated, see cfg.ValidateConfig.
+	onlyDirs, err := cfg.ParseOnlyDirs(newConfig.OnlyDirs)
+	if err != nil {
+		err = fmt.Errorf("parsing only-dirs: %w", err)
+		return
+	}
+
+	if len(onlyDirs) > 0 && isDynamicMount(bucketName) {
+		err = fmt.Errorf("only-dirs needs a bucket name")
+		return
+	}
+
+	var bucketsFilter *regexp.Regexp
+	if newConfig.List.ExperimentalBucketsFilter != "" {
+		// Already validated, see cfg.ValidateConfig.
+		bucketsFilter, err = regexp.Compile(newConfig.List.ExperimentalBucketsFilter)
+		if err != nil {
+			err = fmt.Errorf("parsing experimental-list-buckets-filter: %w", err)
+			return
+		}
+	}
+
+	// Already validated, see cfg.ValidateConfig.
+	faultRules, err := faults.ParseRules(newConfig.Debug.ExperimentalFaultInjectionRules)
+	if err != nil {
+		err = fmt.Errorf("parsing experimental-fault-injection-rules: %w", err)
+		return
+	}
+
+	hedgingCfg := hedging.Config{
+		Percentile:    newConfig.GcsConnection.ExperimentalHedgingPercentile,
+		BudgetPercent: newConfig.GcsConnection.ExperimentalHedgingBudgetPercent,
+		MinDelay:      hedging.DefaultMinDelay,
+		MaxReadSize:   hedging.DefaultMaxReadSize,
+	}
+
+	adaptiveCfg := ratelimit.AdaptiveConfig{
+		MaxInFlight:      int(newConfig.GcsConnection.ExperimentalAdaptiveConcurrencyMax),
+		BreakerThreshold: int(newConfig.GcsConnection.ExperimentalCircuitBreakerThreshold),
+		BreakerCooldown:  newConfig.GcsConnection.ExperimentalCircuitBreakerCooldown,
+	}
+
 	bucketCfg := gcsx.BucketConfig{
 		BillingProject:                     newConfig.GcsConnection.BillingProject,
 		OnlyDir:                            newConfig.OnlyDir,
 		EgressBandwidthLimitBytesPerSecond: newConfig.GcsConnection.LimitBytesPerSec,
 		OpRateLimitHz:                      newConfig.GcsConnection.LimitOpsPerSec,
+		FairShareBy:                        newConfig.GcsConnection.ExperimentalFairShareBy,
+		PerCallerOpRateLimitHz:             newConfig.GcsConnection.ExperimentalPerCallerLimitOpsPerSec,
+		PerCallerEgressLimitBytesPerSec:    newConfig.GcsConnection.ExperimentalPerCallerLimitBytesPerSec,
 		StatCacheMaxSizeMB:                 uint64(newConfig.MetadataCache.StatCacheMaxSizeMb),
 		StatCacheTTL:                       time.Duration(newConfig.MetadataCache.TtlSecs) * time.Second,
 		EnableMonitoring:                   cfg.IsMetricsEnabled(&newConfig.Metrics),
 		AppendThreshold:                    1 << 21, // 2 MiB, a total guess.
 		ChunkTransferTimeoutSecs:           newConfig.GcsRetries.ChunkTransferTimeoutSecs,
 		TmpObjectPrefix:                    ".gcsfuse_tmp/",
+		SnapshotTime:                       snapshotTime,
+		TrashPrefix:                        trashPrefix,
+		TrashRetention:                     newConfig.FileSystem.ExperimentalTrashRetention,
+		LowerLayers:                        newConfig.FileSystem.ExperimentalUnionLowerLayers,
+		EncodeNames:                        newConfig.FileSystem.ExperimentalNameEncoding == cfg.NameEncodingPercent,
+		BucketsProject:                     newConfig.List.ExperimentalBucketsProject,
+		BucketsFilter:                      bucketsFilter,
+		BucketsTTL:                         newConfig.List.ExperimentalBucketsTtl,
+		EnableRequestCoalescing:            newConfig.MetadataCache.ExperimentalEnableRequestCoalescing,
+		Adaptive:                           adaptiveCfg,
+		SchedulerMaxInFlight:               int(newConfig.GcsConnection.ExperimentalSchedulerMaxInFlight),
+		EnableHedging:                      newConfig.GcsConnection.ExperimentalEnableHedging,
+		Hedging:                            hedgingCfg,
+		FaultRules:                         faultRules,
+		TraceRecorder:                      traceRecorder,
 	}
+	bucketCfg.PerBucket = applyBucketOverrides(bucketCfg, newConfig.BucketOverrides)
 	bm := gcsx.NewBucketManager(bucketCfg, storageHandle)
 
 	// Create a file system server.
@@ -105,6 +187,7 @@ be interacting with the file system.`)
 		CacheClock:                 timeutil.RealClock(),
 		BucketManager:              bm,
 		BucketName:                 bucketName,
+		OnlyDirs:                   onlyDirs,
 		LocalFileCache:             false,
 		TempDir:                    string(newConfig.FileSystem.TempDir),
 		ImplicitDirectories:        newConfig.ImplicitDirs,
@@ -147,6 +230,43 @@ be interacting with the file system.`)
 	return
 }
 
+// Return the config for each bucket with overrides, which is the mount-wide
+// config with the fields they set replaced.
+func applyBucketOverrides(
+	mountCfg gcsx.BucketConfig,
+	overrides map[string]cfg.BucketOverrideConfig) map[string]gcsx.BucketConfig {
+	if len(overrides) == 0 {
+		return nil
+	}
+
+	configs := make(map[string]gcsx.BucketConfig, len(overrides))
+	for name, o := range overrides {
+		c := mountCfg
+		c.PerBucket = nil
+		if o.BillingProject != nil {
+			c.BillingProject = *o.BillingProject
+		}
+		if o.EnableFileCache != nil {
+			c.DisableFileCache = !*o.EnableFileCache
+		}
+		if o.LimitBytesPerSec != nil {
+			c.EgressBandwidthLimitBytesPerSecond = *o.LimitBytesPerSec
+		}
+		if o.LimitOpsPerSec != nil {
+			c.OpRateLimitHz = *o.LimitOpsPerSec
+		}
+		if o.ReadOnly != nil {
+			c.ReadOnly = *o.ReadOnly
+		}
+		if o.StatCacheTtl != nil {
+			c.StatCacheTTL = *o.StatCacheTtl
+		}
+		configs[name] = c
+	}
+
+	return configs
+}
+
 func getFuseMountConfig(fsName string, newConfig *cfg.Config) *fuse.MountConfig {
 	// Handle the repeated "-o" flag.
 	parsedOptions := make(map[string]string)
@@ -168,6 +288,8 @@ func getFuseMountConfig(fsName string, newConfig *cfg.Config) *fuse.MountConfig
 		// access two files under same directory parallely, then the lookups also
 		// happen parallely.
 		EnableParallelDirOps: !(newConfig.FileSystem.DisableParallelDirops),
+		// A point-in-time view of the bucket can't be written to.
+		ReadOnly: newConfig.FileSystem.ExperimentalSnapshotTime != "",
 	}
 
 	mountCfg.ErrorLogger = logger.NewLegacyLogger(logger.LevelError, "fuse: ")
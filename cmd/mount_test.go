@@ -16,8 +16,10 @@ package cmd
 
 import (
 	"testing"
+	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -66,3 +68,47 @@ func TestGetFuseMountConfig_MountOptionsFormattedCorrectly(t *testing.T) {
 		assert.True(t, fuseMountCfg.EnableParallelDirOps) // Default true unless explicitly disabled
 	}
 }
+
+func TestGetFuseMountConfig_SnapshotMountIsReadOnly(t *testing.T) {
+	newConfig := &cfg.Config{
+		FileSystem: cfg.FileSystemConfig{
+			ExperimentalSnapshotTime: "2024-05-01T10:00:00Z",
+		},
+	}
+
+	fuseMountCfg := getFuseMountConfig("mybucket", newConfig)
+
+	assert.True(t, fuseMountCfg.ReadOnly)
+	assert.False(t, getFuseMountConfig("mybucket", &cfg.Config{}).ReadOnly)
+}
+
+func TestApplyBucketOverrides(t *testing.T) {
+	mountCfg := gcsx.BucketConfig{
+		BillingProject: "project",
+		OpRateLimitHz:  -1,
+		StatCacheTTL:   time.Minute,
+	}
+	readOnly, enableFileCache, ttl := true, false, time.Hour
+	opsPerSec := 20.0
+
+	configs := applyBucketOverrides(mountCfg, map[string]cfg.BucketOverrideConfig{
+		"archive": {ReadOnly: &readOnly, EnableFileCache: &enableFileCache, StatCacheTtl: &ttl},
+		"scratch": {LimitOpsPerSec: &opsPerSec},
+	})
+
+	assert.Equal(t, map[string]gcsx.BucketConfig{
+		"archive": {
+			BillingProject:   "project",
+			OpRateLimitHz:    -1,
+			StatCacheTTL:     time.Hour,
+			ReadOnly:         true,
+			DisableFileCache: true,
+		},
+		"scratch": {
+			BillingProject: "project",
+			OpRateLimitHz:  20,
+			StatCacheTTL:   time.Minute,
+		},
+	}, configs)
+	assert.Nil(t, applyBucketOverrides(mountCfg, nil))
+}
@@ -539,17 +539,22 @@ func TestArgsParsing_GCSConnectionFlags(t *testing.T) {
 			args: []string{"gcsfuse", "--billing-project=abc", "--client-protocol=http2", "--custom-endpoint=www.abc.com", "--experimental-enable-json-read", "--experimental-grpc-conn-pool-size=20", "--http-client-timeout=20s", "--limit-bytes-per-sec=30", "--limit-ops-per-sec=10", "--max-conns-per-host=1000", "--max-idle-conns-per-host=20", "--sequential-read-size-mb=70", "abc", "pqr"},
 			expectedConfig: &cfg.Config{
 				GcsConnection: cfg.GcsConnectionConfig{
-					BillingProject:             "abc",
-					ClientProtocol:             "http2",
-					CustomEndpoint:             "www.abc.com",
-					ExperimentalEnableJsonRead: true,
-					GrpcConnPoolSize:           20,
-					HttpClientTimeout:          20 * time.Second,
-					LimitBytesPerSec:           30,
-					LimitOpsPerSec:             10,
-					MaxConnsPerHost:            1000,
-					MaxIdleConnsPerHost:        20,
-					SequentialReadSizeMb:       70,
+					BillingProject:                        "abc",
+					ClientProtocol:                        "http2",
+					CustomEndpoint:                        "www.abc.com",
+					ExperimentalCircuitBreakerCooldown:    30 * time.Second,
+					ExperimentalEnableJsonRead:            true,
+					ExperimentalHedgingBudgetPercent:      5,
+					ExperimentalHedgingPercentile:         95,
+					ExperimentalPerCallerLimitBytesPerSec: -1,
+					ExperimentalPerCallerLimitOpsPerSec:   -1,
+					GrpcConnPoolSize:                      20,
+					HttpClientTimeout:                     20 * time.Second,
+					LimitBytesPerSec:                      30,
+					LimitOpsPerSec:                        10,
+					MaxConnsPerHost:                       1000,
+					MaxIdleConnsPerHost:                   20,
+					SequentialReadSizeMb:                  70,
 				},
 			},
 		},
@@ -558,17 +563,22 @@ func TestArgsParsing_GCSConnectionFlags(t *testing.T) {
 			args: []string{"gcsfuse", "abc", "pqr"},
 			expectedConfig: &cfg.Config{
 				GcsConnection: cfg.GcsConnectionConfig{
-					BillingProject:             "",
-					ClientProtocol:             "http1",
-					CustomEndpoint:             "",
-					ExperimentalEnableJsonRead: false,
-					GrpcConnPoolSize:           1,
-					HttpClientTimeout:          0,
-					LimitBytesPerSec:           -1,
-					LimitOpsPerSec:             -1,
-					MaxConnsPerHost:            0,
-					MaxIdleConnsPerHost:        100,
-					SequentialReadSizeMb:       200,
+					BillingProject:                        "",
+					ClientProtocol:                        "http1",
+					CustomEndpoint:                        "",
+					ExperimentalCircuitBreakerCooldown:    30 * time.Second,
+					ExperimentalEnableJsonRead:            false,
+					ExperimentalHedgingBudgetPercent:      5,
+					ExperimentalHedgingPercentile:         95,
+					ExperimentalPerCallerLimitBytesPerSec: -1,
+					ExperimentalPerCallerLimitOpsPerSec:   -1,
+					GrpcConnPoolSize:                      1,
+					HttpClientTimeout:                     0,
+					LimitBytesPerSec:                      -1,
+					LimitOpsPerSec:                        -1,
+					MaxConnsPerHost:                       0,
+					MaxIdleConnsPerHost:                   100,
+					SequentialReadSizeMb:                  200,
 				},
 			},
 		},
@@ -645,18 +655,23 @@ func TestArgsParsing_FileSystemFlags(t *testing.T) {
 			args: []string{"gcsfuse", "--dir-mode=0777", "--disable-parallel-dirops", "--file-mode=0666", "--o", "ro", "--gid=7", "--ignore-interrupts=false", "--kernel-list-cache-ttl-secs=300", "--rename-dir-limit=10", "--temp-dir=~/temp", "--uid=8", "--precondition-errors=true", "abc", "pqr"},
 			expectedConfig: &cfg.Config{
 				FileSystem: cfg.FileSystemConfig{
-					DirMode:                0777,
-					DisableParallelDirops:  true,
-					FileMode:               0666,
-					FuseOptions:            []string{"ro"},
-					Gid:                    7,
-					IgnoreInterrupts:       false,
-					KernelListCacheTtlSecs: 300,
-					RenameDirLimit:         10,
-					TempDir:                cfg.ResolvedPath(path.Join(hd, "temp")),
-					PreconditionErrors:     true,
-					Uid:                    8,
-					HandleSigterm:          true,
+					DirMode:                          0777,
+					DisableParallelDirops:            true,
+					ExperimentalNameConflictStrategy: "newline",
+					ExperimentalNameEncoding:         "none",
+					ExperimentalTrashPrefix:          ".gcsfuse-trash/",
+					ExperimentalTrashRetention:       168 * time.Hour,
+					ExperimentalUnionLowerLayers:     []string{},
+					FileMode:                         0666,
+					FuseOptions:                      []string{"ro"},
+					Gid:                              7,
+					IgnoreInterrupts:                 false,
+					KernelListCacheTtlSecs:           300,
+					RenameDirLimit:                   10,
+					TempDir:                          cfg.ResolvedPath(path.Join(hd, "temp")),
+					PreconditionErrors:               true,
+					Uid:                              8,
+					HandleSigterm:                    true,
 				},
 			},
 		},
@@ -665,18 +680,23 @@ func TestArgsParsing_FileSystemFlags(t *testing.T) {
 			args: []string{"gcsfuse", "--dir-mode=777", "--file-mode=666", "abc", "pqr"},
 			expectedConfig: &cfg.Config{
 				FileSystem: cfg.FileSystemConfig{
-					DirMode:                0777,
-					DisableParallelDirops:  false,
-					FileMode:               0666,
-					FuseOptions:            []string{},
-					Gid:                    -1,
-					IgnoreInterrupts:       true,
-					KernelListCacheTtlSecs: 0,
-					RenameDirLimit:         0,
-					TempDir:                "",
-					PreconditionErrors:     false,
-					Uid:                    -1,
-					HandleSigterm:          true,
+					DirMode:                          0777,
+					DisableParallelDirops:            false,
+					ExperimentalNameConflictStrategy: "newline",
+					ExperimentalNameEncoding:         "none",
+					ExperimentalTrashPrefix:          ".gcsfuse-trash/",
+					ExperimentalTrashRetention:       168 * time.Hour,
+					ExperimentalUnionLowerLayers:     []string{},
+					FileMode:                         0666,
+					FuseOptions:                      []string{},
+					Gid:                              -1,
+					IgnoreInterrupts:                 true,
+					KernelListCacheTtlSecs:           0,
+					RenameDirLimit:                   0,
+					TempDir:                          "",
+					PreconditionErrors:               false,
+					Uid:                              -1,
+					HandleSigterm:                    true,
 				},
 			},
 		},
@@ -685,18 +705,23 @@ func TestArgsParsing_FileSystemFlags(t *testing.T) {
 			args: []string{"gcsfuse", "abc", "pqr"},
 			expectedConfig: &cfg.Config{
 				FileSystem: cfg.FileSystemConfig{
-					DirMode:                0755,
-					DisableParallelDirops:  false,
-					FileMode:               0644,
-					FuseOptions:            []string{},
-					Gid:                    -1,
-					IgnoreInterrupts:       true,
-					KernelListCacheTtlSecs: 0,
-					RenameDirLimit:         0,
-					TempDir:                "",
-					PreconditionErrors:     false,
-					Uid:                    -1,
-					HandleSigterm:          true,
+					DirMode:                          0755,
+					DisableParallelDirops:            false,
+					ExperimentalNameConflictStrategy: "newline",
+					ExperimentalNameEncoding:         "none",
+					ExperimentalTrashPrefix:          ".gcsfuse-trash/",
+					ExperimentalTrashRetention:       168 * time.Hour,
+					ExperimentalUnionLowerLayers:     []string{},
+					FileMode:                         0644,
+					FuseOptions:                      []string{},
+					Gid:                              -1,
+					IgnoreInterrupts:                 true,
+					KernelListCacheTtlSecs:           0,
+					RenameDirLimit:                   0,
+					TempDir:                          "",
+					PreconditionErrors:               false,
+					Uid:                              -1,
+					HandleSigterm:                    true,
 				},
 			},
 		},
@@ -771,14 +796,25 @@ func TestArgsParsing_ListFlags(t *testing.T) {
 			name: "normal",
 			args: []string{"gcsfuse", "--enable-empty-managed-folders", "abc", "pqr"},
 			expectedConfig: &cfg.Config{
-				List: cfg.ListConfig{EnableEmptyManagedFolders: true},
+				List: cfg.ListConfig{EnableEmptyManagedFolders: true, ExperimentalBucketsTtl: time.Minute},
+			},
+		},
+		{
+			name: "list_buckets",
+			args: []string{"gcsfuse", "--experimental-list-buckets-project=some-project", "--experimental-list-buckets-filter=^team-", "--experimental-list-buckets-ttl=5m", "abc", "pqr"},
+			expectedConfig: &cfg.Config{
+				List: cfg.ListConfig{
+					ExperimentalBucketsFilter:  "^team-",
+					ExperimentalBucketsProject: "some-project",
+					ExperimentalBucketsTtl:     5 * time.Minute,
+				},
 			},
 		},
 		{
 			name: "default",
 			args: []string{"gcsfuse", "abc", "pqr"},
 			expectedConfig: &cfg.Config{
-				List: cfg.ListConfig{EnableEmptyManagedFolders: false},
+				List: cfg.ListConfig{EnableEmptyManagedFolders: false, ExperimentalBucketsTtl: time.Minute},
 			},
 		},
 	}
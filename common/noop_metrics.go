@@ -23,16 +23,23 @@ func NewNoopMetrics() MetricHandle {
 
 type noopMetrics struct{}
 
-func (*noopMetrics) GCSReadBytesCount(_ context.Context, _ int64, _ []MetricAttr)       {}
-func (*noopMetrics) GCSReaderCount(_ context.Context, _ int64, _ []MetricAttr)          {}
-func (*noopMetrics) GCSRequestCount(_ context.Context, _ int64, _ []MetricAttr)         {}
-func (*noopMetrics) GCSRequestLatency(_ context.Context, value float64, _ []MetricAttr) {}
-func (*noopMetrics) GCSReadCount(_ context.Context, _ int64, _ []MetricAttr)            {}
-func (*noopMetrics) GCSDownloadBytesCount(_ context.Context, _ int64, _ []MetricAttr)   {}
+func (*noopMetrics) GCSReadBytesCount(_ context.Context, _ int64, _ []MetricAttr)            {}
+func (*noopMetrics) GCSReaderCount(_ context.Context, _ int64, _ []MetricAttr)               {}
+func (*noopMetrics) GCSRequestCount(_ context.Context, _ int64, _ []MetricAttr)              {}
+func (*noopMetrics) GCSRequestLatency(_ context.Context, value float64, _ []MetricAttr)      {}
+func (*noopMetrics) GCSReadCount(_ context.Context, _ int64, _ []MetricAttr)                 {}
+func (*noopMetrics) GCSDownloadBytesCount(_ context.Context, _ int64, _ []MetricAttr)        {}
+func (*noopMetrics) GCSHedgeCount(_ context.Context, _ int64, _ []MetricAttr)                {}
+func (*noopMetrics) GCSHedgeWinCount(_ context.Context, _ int64, _ []MetricAttr)             {}
+func (*noopMetrics) GCSCoalescedCount(_ context.Context, _ int64, _ []MetricAttr)            {}
+func (*noopMetrics) GCSConcurrencyLimit(_ context.Context, _ int64, _ []MetricAttr)          {}
+func (*noopMetrics) GCSCircuitBreakerTripCount(_ context.Context, _ int64, _ []MetricAttr)   {}
+func (*noopMetrics) GCSCircuitBreakerRejectCount(_ context.Context, _ int64, _ []MetricAttr) {}
 
 func (*noopMetrics) OpsCount(_ context.Context, _ int64, _ []MetricAttr)         {}
 func (*noopMetrics) OpsLatency(_ context.Context, value float64, _ []MetricAttr) {}
 func (*noopMetrics) OpsErrorCount(_ context.Context, _ int64, _ []MetricAttr)    {}
+func (*noopMetrics) EncodedNameCount(_ context.Context, _ int64, _ []MetricAttr) {}
 
 func (*noopMetrics) FileCacheReadCount(_ context.Context, _ int64, _ []MetricAttr)         {}
 func (*noopMetrics) FileCacheReadBytesCount(_ context.Context, _ int64, _ []MetricAttr)    {}
@@ -55,11 +55,18 @@ type ocMetrics struct {
 	gcsRequestLatency     *stats.Float64Measure
 	gcsReadCount          *stats.Int64Measure
 	gcsDownloadBytesCount *stats.Int64Measure
+	gcsHedgeCount         *stats.Int64Measure
+	gcsHedgeWinCount      *stats.Int64Measure
+	gcsCoalescedCount     *stats.Int64Measure
+	gcsConcurrencyLimit   *stats.Int64Measure
+	gcsBreakerTripCount   *stats.Int64Measure
+	gcsBreakerRejectCount *stats.Int64Measure
 
 	// Ops measures
-	opsCount      *stats.Int64Measure
-	opsErrorCount *stats.Int64Measure
-	opsLatency    *stats.Float64Measure
+	opsCount         *stats.Int64Measure
+	opsErrorCount    *stats.Int64Measure
+	opsLatency       *stats.Float64Measure
+	encodedNameCount *stats.Int64Measure
 
 	// File cache measures
 	fileCacheReadCount      *stats.Int64Measure
@@ -113,6 +120,30 @@ func (o *ocMetrics) GCSDownloadBytesCount(ctx context.Context, inc int64, attrs
 	recordOCMetric(ctx, o.gcsDownloadBytesCount, inc, attrs, "GCS download bytes count")
 }
 
+func (o *ocMetrics) GCSHedgeCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.gcsHedgeCount, inc, attrs, "GCS hedge count")
+}
+
+func (o *ocMetrics) GCSHedgeWinCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.gcsHedgeWinCount, inc, attrs, "GCS hedge win count")
+}
+
+func (o *ocMetrics) GCSCoalescedCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.gcsCoalescedCount, inc, attrs, "GCS coalesced count")
+}
+
+func (o *ocMetrics) GCSConcurrencyLimit(ctx context.Context, value int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.gcsConcurrencyLimit, value, attrs, "GCS concurrency limit")
+}
+
+func (o *ocMetrics) GCSCircuitBreakerTripCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.gcsBreakerTripCount, inc, attrs, "GCS circuit breaker trip count")
+}
+
+func (o *ocMetrics) GCSCircuitBreakerRejectCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.gcsBreakerRejectCount, inc, attrs, "GCS circuit breaker reject count")
+}
+
 func (o *ocMetrics) OpsCount(ctx context.Context, inc int64, attrs []MetricAttr) {
 	recordOCMetric(ctx, o.opsCount, inc, attrs, "file system op count")
 }
@@ -123,6 +154,10 @@ func (o *ocMetrics) OpsErrorCount(ctx context.Context, inc int64, attrs []Metric
 	recordOCMetric(ctx, o.opsErrorCount, inc, attrs, "file system op error count")
 }
 
+func (o *ocMetrics) EncodedNameCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.encodedNameCount, inc, attrs, "encoded name count")
+}
+
 func (o *ocMetrics) FileCacheReadCount(ctx context.Context, inc int64, attrs []MetricAttr) {
 	recordOCMetric(ctx, o.fileCacheReadCount, inc, attrs, "file cache read count")
 }
@@ -160,10 +195,17 @@ func NewOCMetrics() (MetricHandle, error) {
 	gcsRequestLatency := stats.Float64("gcs/request_latency", "The latency of a GCS request.", stats.UnitMilliseconds)
 	gcsReadCount := stats.Int64("gcs/read_count", "Specifies the number of gcs reads made along with type - Sequential/Random", stats.UnitDimensionless)
 	gcsDownloadBytesCount := stats.Int64("gcs/download_bytes_count", "The cumulative number of bytes downloaded from GCS along with type - Sequential/Random", stats.UnitBytes)
+	gcsHedgeCount := stats.Int64("gcs/hedge_count", "The number of duplicate GCS requests issued because the original was slow.", stats.UnitDimensionless)
+	gcsHedgeWinCount := stats.Int64("gcs/hedge_win_count", "The number of duplicate GCS requests that returned before the original.", stats.UnitDimensionless)
+	gcsCoalescedCount := stats.Int64("gcs/coalesced_count", "The number of GCS requests that shared the result of an identical request already in flight.", stats.UnitDimensionless)
+	gcsConcurrencyLimit := stats.Int64("gcs/concurrency_limit", "The number of GCS requests currently allowed in flight by the adaptive concurrency limiter.", stats.UnitDimensionless)
+	gcsBreakerTripCount := stats.Int64("gcs/circuit_breaker_trip_count", "The number of times the circuit breaker opened because GCS was unhealthy.", stats.UnitDimensionless)
+	gcsBreakerRejectCount := stats.Int64("gcs/circuit_breaker_reject_count", "The number of GCS requests failed fast because the circuit breaker was open.", stats.UnitDimensionless)
 
 	opsCount := stats.Int64("fs/ops_count", "The number of ops processed by the file system.", stats.UnitDimensionless)
 	opsLatency := stats.Float64("fs/ops_latency", "The latency of a file system operation.", "us")
 	opsErrorCount := stats.Int64("fs/ops_error_count", "The number of errors generated by file system operation.", stats.UnitDimensionless)
+	encodedNameCount := stats.Int64("fs/encoded_name_count", "The number of object names that were escaped because they aren't valid paths.", stats.UnitDimensionless)
 
 	fileCacheReadCount := stats.Int64("file_cache/read_count", "Specifies the number of read requests made via file cache along with type - Sequential/Random and cache hit - true/false", stats.UnitDimensionless)
 	fileCacheReadBytesCount := stats.Int64("file_cache/read_bytes_count", "The cumulative number of bytes read from file cache along with read type - Sequential/Random", stats.UnitBytes)
@@ -211,6 +253,46 @@ func NewOCMetrics() (MetricHandle, error) {
 			Aggregation: view.Sum(),
 			TagKeys:     []tag.Key{tag.MustNewKey(ReadType)},
 		},
+		&view.View{
+			Name:        "gcs/hedge_count",
+			Measure:     gcsHedgeCount,
+			Description: "The cumulative number of duplicate GCS requests issued because the original was slow.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tag.MustNewKey(GCSMethod)},
+		},
+		&view.View{
+			Name:        "gcs/hedge_win_count",
+			Measure:     gcsHedgeWinCount,
+			Description: "The cumulative number of duplicate GCS requests that returned before the original.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tag.MustNewKey(GCSMethod)},
+		},
+		&view.View{
+			Name:        "gcs/coalesced_count",
+			Measure:     gcsCoalescedCount,
+			Description: "The cumulative number of GCS requests that shared the result of an identical request already in flight.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tag.MustNewKey(GCSMethod)},
+		},
+		&view.View{
+			Name:        "gcs/concurrency_limit",
+			Measure:     gcsConcurrencyLimit,
+			Description: "The number of GCS requests currently allowed in flight by the adaptive concurrency limiter.",
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "gcs/circuit_breaker_trip_count",
+			Measure:     gcsBreakerTripCount,
+			Description: "The cumulative number of times the circuit breaker opened because GCS was unhealthy.",
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "gcs/circuit_breaker_reject_count",
+			Measure:     gcsBreakerRejectCount,
+			Description: "The cumulative number of GCS requests failed fast because the circuit breaker was open.",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tag.MustNewKey(GCSMethod)},
+		},
 		&view.View{
 			Name:        "fs/ops_count",
 			Measure:     opsCount,
@@ -232,6 +314,12 @@ func NewOCMetrics() (MetricHandle, error) {
 			Aggregation: ochttp.DefaultLatencyDistribution,
 			TagKeys:     []tag.Key{tag.MustNewKey(FSOp)},
 		},
+		&view.View{
+			Name:        "fs/encoded_name_count",
+			Measure:     encodedNameCount,
+			Description: "The cumulative number of object names that were escaped because they aren't valid paths.",
+			Aggregation: view.Sum(),
+		},
 		// File cache related metrics
 		&view.View{
 			Name:        "file_cache/read_count",
@@ -263,10 +351,17 @@ func NewOCMetrics() (MetricHandle, error) {
 		gcsRequestLatency:     gcsRequestLatency,
 		gcsReadCount:          gcsReadCount,
 		gcsDownloadBytesCount: gcsDownloadBytesCount,
+		gcsHedgeCount:         gcsHedgeCount,
+		gcsHedgeWinCount:      gcsHedgeWinCount,
+		gcsCoalescedCount:     gcsCoalescedCount,
+		gcsConcurrencyLimit:   gcsConcurrencyLimit,
+		gcsBreakerTripCount:   gcsBreakerTripCount,
+		gcsBreakerRejectCount: gcsBreakerRejectCount,
 
-		opsCount:      opsCount,
-		opsErrorCount: opsErrorCount,
-		opsLatency:    opsLatency,
+		opsCount:         opsCount,
+		opsErrorCount:    opsErrorCount,
+		opsLatency:       opsLatency,
+		encodedNameCount: encodedNameCount,
 
 		fileCacheReadCount:      fileCacheReadCount,
 		fileCacheReadBytesCount: fileCacheReadBytesCount,
@@ -30,9 +30,10 @@ var (
 
 // otelMetrics maintains the list of all metrics computed in GCSFuse.
 type otelMetrics struct {
-	fsOpsCount      metric.Int64Counter
-	fsOpsErrorCount metric.Int64Counter
-	fsOpsLatency    metric.Float64Histogram
+	fsOpsCount       metric.Int64Counter
+	fsOpsErrorCount  metric.Int64Counter
+	fsOpsLatency     metric.Float64Histogram
+	encodedNameCount metric.Int64Counter
 
 	gcsReadCount          metric.Int64Counter
 	gcsReadBytesCount     metric.Int64Counter
@@ -40,6 +41,12 @@ type otelMetrics struct {
 	gcsRequestCount       metric.Int64Counter
 	gcsRequestLatency     metric.Float64Histogram
 	gcsDownloadBytesCount metric.Int64Counter
+	gcsHedgeCount         metric.Int64Counter
+	gcsHedgeWinCount      metric.Int64Counter
+	gcsCoalescedCount     metric.Int64Counter
+	gcsConcurrencyLimit   metric.Int64Gauge
+	gcsBreakerTripCount   metric.Int64Counter
+	gcsBreakerRejectCount metric.Int64Counter
 
 	fileCacheReadCount      metric.Int64Counter
 	fileCacheReadBytesCount metric.Int64Counter
@@ -70,6 +77,30 @@ func (o *otelMetrics) GCSDownloadBytesCount(ctx context.Context, inc int64, attr
 	o.gcsDownloadBytesCount.Add(ctx, inc, attrsToAddOption(attrs)...)
 }
 
+func (o *otelMetrics) GCSHedgeCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	o.gcsHedgeCount.Add(ctx, inc, attrsToAddOption(attrs)...)
+}
+
+func (o *otelMetrics) GCSHedgeWinCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	o.gcsHedgeWinCount.Add(ctx, inc, attrsToAddOption(attrs)...)
+}
+
+func (o *otelMetrics) GCSCoalescedCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	o.gcsCoalescedCount.Add(ctx, inc, attrsToAddOption(attrs)...)
+}
+
+func (o *otelMetrics) GCSConcurrencyLimit(ctx context.Context, value int64, attrs []MetricAttr) {
+	o.gcsConcurrencyLimit.Record(ctx, value, attrsToRecordOption(attrs)...)
+}
+
+func (o *otelMetrics) GCSCircuitBreakerTripCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	o.gcsBreakerTripCount.Add(ctx, inc, attrsToAddOption(attrs)...)
+}
+
+func (o *otelMetrics) GCSCircuitBreakerRejectCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	o.gcsBreakerRejectCount.Add(ctx, inc, attrsToAddOption(attrs)...)
+}
+
 func (o *otelMetrics) OpsCount(ctx context.Context, inc int64, attrs []MetricAttr) {
 	o.fsOpsCount.Add(ctx, inc, attrsToAddOption(attrs)...)
 }
@@ -82,6 +113,10 @@ func (o *otelMetrics) OpsErrorCount(ctx context.Context, inc int64, attrs []Metr
 	o.fsOpsErrorCount.Add(ctx, inc, attrsToAddOption(attrs)...)
 }
 
+func (o *otelMetrics) EncodedNameCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	o.encodedNameCount.Add(ctx, inc, attrsToAddOption(attrs)...)
+}
+
 func (o *otelMetrics) FileCacheReadCount(ctx context.Context, inc int64, attrs []MetricAttr) {
 	o.fileCacheReadCount.Add(ctx, inc, attrsToAddOption(attrs)...)
 }
@@ -119,19 +154,42 @@ func NewOTelMetrics() (MetricHandle, error) {
 		metric.WithUnit("us"),
 		defaultLatencyDistribution)
 
-	if err := errors.Join(err1, err2, err3, err4, err5, err6, err7, err8, err9, err10, err11, err12); err != nil {
+	encodedNameCount, err13 := fsOpsMeter.Int64Counter("fs/encoded_name_count",
+		metric.WithDescription("The number of object names that were escaped because they aren't valid paths."))
+
+	gcsHedgeCount, err14 := gcsMeter.Int64Counter("gcs/hedge_count",
+		metric.WithDescription("The number of duplicate GCS requests issued because the original was slow."))
+	gcsHedgeWinCount, err15 := gcsMeter.Int64Counter("gcs/hedge_win_count",
+		metric.WithDescription("The number of duplicate GCS requests that returned before the original."))
+	gcsCoalescedCount, err16 := gcsMeter.Int64Counter("gcs/coalesced_count",
+		metric.WithDescription("The number of GCS requests that shared the result of an identical request already in flight."))
+	gcsConcurrencyLimit, err17 := gcsMeter.Int64Gauge("gcs/concurrency_limit",
+		metric.WithDescription("The number of GCS requests currently allowed in flight by the adaptive concurrency limiter."))
+	gcsBreakerTripCount, err18 := gcsMeter.Int64Counter("gcs/circuit_breaker_trip_count",
+		metric.WithDescription("The number of times the circuit breaker opened because GCS was unhealthy."))
+	gcsBreakerRejectCount, err19 := gcsMeter.Int64Counter("gcs/circuit_breaker_reject_count",
+		metric.WithDescription("The number of GCS requests failed fast because the circuit breaker was open."))
+
+	if err := errors.Join(err1, err2, err3, err4, err5, err6, err7, err8, err9, err10, err11, err12, err13, err14, err15, err16, err17, err18, err19); err != nil {
 		return nil, err
 	}
 	return &otelMetrics{
 		fsOpsCount:              fsOpsCount,
 		fsOpsErrorCount:         fsOpsErrorCount,
 		fsOpsLatency:            fsOpsLatency,
+		encodedNameCount:        encodedNameCount,
 		gcsReadCount:            gcsReadCount,
 		gcsReadBytesCount:       gcsReadBytesCount,
 		gcsReaderCount:          gcsReaderCount,
 		gcsRequestCount:         gcsRequestCount,
 		gcsRequestLatency:       gcsRequestLatency,
 		gcsDownloadBytesCount:   gcsDownloadBytesCount,
+		gcsHedgeCount:           gcsHedgeCount,
+		gcsHedgeWinCount:        gcsHedgeWinCount,
+		gcsCoalescedCount:       gcsCoalescedCount,
+		gcsConcurrencyLimit:     gcsConcurrencyLimit,
+		gcsBreakerTripCount:     gcsBreakerTripCount,
+		gcsBreakerRejectCount:   gcsBreakerRejectCount,
 		fileCacheReadCount:      fileCacheReadCount,
 		fileCacheReadBytesCount: fileCacheReadBytesCount,
 		fileCacheReadLatency:    fileCacheReadLatency,
@@ -58,12 +58,19 @@ type GCSMetricHandle interface {
 	GCSRequestLatency(ctx context.Context, value float64, attrs []MetricAttr)
 	GCSReadCount(ctx context.Context, inc int64, attrs []MetricAttr)
 	GCSDownloadBytesCount(ctx context.Context, inc int64, attrs []MetricAttr)
+	GCSHedgeCount(ctx context.Context, inc int64, attrs []MetricAttr)
+	GCSHedgeWinCount(ctx context.Context, inc int64, attrs []MetricAttr)
+	GCSCoalescedCount(ctx context.Context, inc int64, attrs []MetricAttr)
+	GCSConcurrencyLimit(ctx context.Context, value int64, attrs []MetricAttr)
+	GCSCircuitBreakerTripCount(ctx context.Context, inc int64, attrs []MetricAttr)
+	GCSCircuitBreakerRejectCount(ctx context.Context, inc int64, attrs []MetricAttr)
 }
 
 type OpsMetricHandle interface {
 	OpsCount(ctx context.Context, inc int64, attrs []MetricAttr)
 	OpsLatency(ctx context.Context, value float64, attrs []MetricAttr)
 	OpsErrorCount(ctx context.Context, inc int64, attrs []MetricAttr)
+	EncodedNameCount(ctx context.Context, inc int64, attrs []MetricAttr)
 }
 
 type FileCacheMetricHandle interface {
@@ -33,6 +33,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/priority"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 	"golang.org/x/net/context"
 	"golang.org/x/sync/semaphore"
@@ -480,9 +481,9 @@ func (job *Job) Download(ctx context.Context, offset int64, waitForDownload bool
 		defer job.mu.Unlock()
 		return job.status, nil
 	} else if job.status.Name == NotStarted {
-		// Start the async download
+		// Start the async download, behind the reads users are waiting on.
 		job.status.Name = Downloading
-		job.cancelCtx, job.cancelFunc = context.WithCancel(context.Background())
+		job.cancelCtx, job.cancelFunc = context.WithCancel(priority.WithClass(context.Background(), priority.Background))
 		go job.downloadObjectAsync()
 	} else if job.status.Name == Failed || job.status.Name == Invalid || job.status.Offset >= offset {
 		defer job.mu.Unlock()
@@ -63,6 +63,10 @@ type ServerConfig struct {
 	// all accessible GCS buckets are mounted as subdirectories of the FS root.
 	BucketName string
 
+	// If non-empty, only these prefixes of the bucket, keyed by name, are
+	// mounted as subdirectories of the FS root.
+	OnlyDirs map[string]string
+
 	// LocalFileCache
 	LocalFileCache bool
 
@@ -174,6 +178,8 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 		localFileCache:             serverCfg.LocalFileCache,
 		contentCache:               contentCache,
 		implicitDirs:               serverCfg.ImplicitDirectories,
+		nameConflictStrategy:       inode.NameConflictStrategy(serverCfg.NewConfig.FileSystem.ExperimentalNameConflictStrategy),
+		stableInodeIDs:             serverCfg.NewConfig.FileSystem.ExperimentalEnableStableInodeIds,
 		enableNonexistentTypeCache: serverCfg.EnableNonexistentTypeCache,
 		inodeAttributeCacheTTL:     serverCfg.InodeAttributeCacheTTL,
 		dirTypeCacheTTL:            serverCfg.DirTypeCacheTTL,
@@ -190,6 +196,8 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 		implicitDirInodes:          make(map[inode.Name]inode.DirInode),
 		folderInodes:               make(map[inode.Name]inode.DirInode),
 		localFileInodes:            make(map[inode.Name]inode.Inode),
+		versionsDirInodes:          make(map[inode.Name]inode.DirInode),
+		noncurrentInodes:           make(map[fuseops.InodeID]*inode.FileInode),
 		handles:                    make(map[fuseops.HandleID]interface{}),
 		newConfig:                  serverCfg.NewConfig,
 		fileCacheHandler:           fileCacheHandler,
@@ -203,6 +211,9 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 	if serverCfg.BucketName == "" || serverCfg.BucketName == "_" {
 		logger.Info("Set up root directory for all accessible buckets")
 		root = makeRootForAllBuckets(fs)
+	} else if len(serverCfg.OnlyDirs) > 0 {
+		logger.Info("Set up root directory for directories of bucket " + serverCfg.BucketName)
+		root = makeRootForOnlyDirs(fs, serverCfg.BucketName, serverCfg.OnlyDirs)
 	} else {
 		logger.Info("Set up root directory for bucket " + serverCfg.BucketName)
 		syncerBucket, err := fs.bucketManager.SetUpBucket(ctx, serverCfg.BucketName, false, fs.metricHandle)
@@ -211,6 +222,7 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 		}
 		root = makeRootForBucket(ctx, fs, syncerBucket)
 	}
+
 	root.Lock()
 	root.IncrementLookupCount()
 	fs.inodes[fuseops.RootInodeID] = root
@@ -279,6 +291,7 @@ func makeRootForBucket(
 		fs.cacheClock,
 		fs.newConfig.MetadataCache.TypeCacheMaxSizeMb,
 		fs.newConfig.EnableHns,
+		fs.nameConflictStrategy,
 	)
 }
 
@@ -301,6 +314,27 @@ func makeRootForAllBuckets(fs *fileSystem) inode.DirInode {
 	)
 }
 
+func makeRootForOnlyDirs(fs *fileSystem, bucketName string, onlyDirs map[string]string) inode.DirInode {
+	return inode.NewOnlyDirsBaseDirInode(
+		fuseops.RootInodeID,
+		inode.NewRootName(""),
+		fuseops.InodeAttributes{
+			Uid:  fs.uid,
+			Gid:  fs.gid,
+			Mode: fs.dirMode,
+
+			// We guarantee only that directory times be "reasonable".
+			Atime: fs.mtimeClock.Now(),
+			Ctime: fs.mtimeClock.Now(),
+			Mtime: fs.mtimeClock.Now(),
+		},
+		fs.bucketManager,
+		bucketName,
+		onlyDirs,
+		fs.metricHandle,
+	)
+}
+
 ////////////////////////////////////////////////////////////////////////
 // fileSystem type
 ////////////////////////////////////////////////////////////////////////
@@ -345,6 +379,8 @@ type fileSystem struct {
 	localFileCache             bool
 	contentCache               *contentcache.ContentCache
 	implicitDirs               bool
+	nameConflictStrategy       inode.NameConflictStrategy
+	stableInodeIDs             bool
 	enableNonexistentTypeCache bool
 	inodeAttributeCacheTTL     time.Duration
 	dirTypeCacheTTL            time.Duration
@@ -373,9 +409,9 @@ type fileSystem struct {
 	// from per-inode locks). Make sure to see the notes on lock ordering above.
 	mu locker.Locker
 
-	// The next inode ID to hand out. We assume that this will never overflow,
-	// since even if we were handing out inode IDs at 4 GHz, it would still take
-	// over a century to do so.
+	// The next inode ID to hand out, unless stableInodeIDs is set. We assume
+	// that this will never overflow, since even if we were handing out inode
+	// IDs at 4 GHz, it would still take over a century to do so.
 	//
 	// GUARDED_BY(mu)
 	nextInodeID fuseops.InodeID
@@ -383,7 +419,8 @@ type fileSystem struct {
 	// The collection of live inodes, keyed by inode ID. No ID less than
 	// fuseops.RootInodeID is ever used.
 	//
-	// INVARIANT: For all keys k, fuseops.RootInodeID <= k < nextInodeID
+	// INVARIANT: For all keys k, fuseops.RootInodeID <= k
+	// INVARIANT: If !stableInodeIDs, for all keys k, k < nextInodeID
 	// INVARIANT: For all keys k, inodes[k].ID() == k
 	// INVARIANT: inodes[fuseops.RootInodeID] is missing or of type inode.DirInode
 	// INVARIANT: For all v, if v.Name().IsDir() then v is inode.DirInode
@@ -460,6 +497,26 @@ type fileSystem struct {
 	// GUARDED_BY(mu)
 	localFileInodes map[inode.Name]inode.Inode
 
+	// A map from name to the virtual directory of that name listing the
+	// generations of objects. See inode.VersionsDirInode.
+	//
+	// INVARIANT: For each k/v, v.Name() == k
+	// INVARIANT: For each value v, inodes[v.ID()] == v
+	// INVARIANT: For each value v, v is inode.VersionsDirInode
+	//
+	// GUARDED_BY(mu)
+	versionsDirInodes map[inode.Name]inode.DirInode
+
+	// The read-only file inodes for past generations of objects, found through
+	// versions directories. They are named after the live object, but unlike
+	// file inodes for live objects are not indexed by name, so a fresh one is
+	// minted for each lookup.
+	//
+	// INVARIANT: For each k/v, inodes[k] == v
+	//
+	// GUARDED_BY(mu)
+	noncurrentInodes map[fuseops.InodeID]*inode.FileInode
+
 	// The collection of live handles, keyed by handle ID.
 	//
 	// INVARIANT: All values are of type *dirHandle or *handle.FileHandle
@@ -639,10 +696,33 @@ func (fs *fileSystem) checkInvariantsForGenerationBackedInodes() {
 	}
 }
 
+func (fs *fileSystem) checkInvariantsForVersionsInodes() {
+	// INVARIANT: For each k/v, v.Name() == k
+	// INVARIANT: For each value v, inodes[v.ID()] == v
+	// INVARIANT: For each value v, v is inode.VersionsDirInode
+	for k, v := range fs.versionsDirInodes {
+		if v.Name() != k || fs.inodes[v.ID()] != v {
+			panic(fmt.Sprintf("Unexpected versions dir inode for %q: %v", k, v))
+		}
+
+		if _, ok := v.(inode.VersionsDirInode); !ok {
+			panic(fmt.Sprintf("Unexpected type for %q: %v", k, reflect.TypeOf(v)))
+		}
+	}
+
+	// INVARIANT: For each k/v, inodes[k] == v
+	for k, v := range fs.noncurrentInodes {
+		if fs.inodes[k] != v {
+			panic(fmt.Sprintf("Mismatch for noncurrent ID %v: %v %v", k, fs.inodes[k], v))
+		}
+	}
+}
+
 func (fs *fileSystem) checkInvariantsForInodes() {
-	// INVARIANT: For all keys k, fuseops.RootInodeID <= k < nextInodeID
+	// INVARIANT: For all keys k, fuseops.RootInodeID <= k
+	// INVARIANT: If !stableInodeIDs, for all keys k, k < nextInodeID
 	for id := range fs.inodes {
-		if id < fuseops.RootInodeID || id >= fs.nextInodeID {
+		if id < fuseops.RootInodeID || (!fs.stableInodeIDs && id >= fs.nextInodeID) {
 			panic(fmt.Sprintf("Illegal inode ID: %v", id))
 		}
 	}
@@ -686,6 +766,7 @@ func (fs *fileSystem) checkInvariants() {
 	fs.checkInvariantsForImplicitDirs()
 	fs.checkInvariantsForFolderInodes()
 	fs.checkInvariantsForLocalFileInodes()
+	fs.checkInvariantsForVersionsInodes()
 
 	//////////////////////////////////
 	// handles
@@ -728,7 +809,7 @@ func (fs *fileSystem) createExplicitDirInode(inodeID fuseops.InodeID, ic inode.C
 			Ctime: fs.mtimeClock.Now(),
 			Mtime: fs.mtimeClock.Now(),
 		},
-		fs.implicitDirs,
+		fs.implicitDirsFor(ic.FullName),
 		fs.newConfig.List.EnableEmptyManagedFolders,
 		fs.enableNonexistentTypeCache,
 		fs.dirTypeCacheTTL,
@@ -736,19 +817,39 @@ func (fs *fileSystem) createExplicitDirInode(inodeID fuseops.InodeID, ic inode.C
 		fs.mtimeClock,
 		fs.cacheClock,
 		fs.newConfig.MetadataCache.TypeCacheMaxSizeMb,
-		fs.newConfig.EnableHns)
+		fs.newConfig.EnableHns,
+		fs.nameConflictStrategy)
 
 	return in
 }
 
+// Choose the ID for a new inode. IDs are handed out in order, unless stable
+// inode IDs are enabled. Then they are derived from the key, which says what
+// the inode stands for, so that it gets the same ID on every mount. If another
+// live inode has that ID already, the next free one is used instead.
+//
+// LOCKS_REQUIRED(fs.mu)
+func (fs *fileSystem) newInodeID(key string) fuseops.InodeID {
+	if !fs.stableInodeIDs {
+		id := fs.nextInodeID
+		fs.nextInodeID++
+		return id
+	}
+
+	id := inode.StableID(key)
+	for id <= fuseops.RootInodeID || fs.inodes[id] != nil {
+		id++
+	}
+	return id
+}
+
 // Implementation detail of lookUpOrCreateInodeIfNotStale; do not use outside
 // of that function.
 //
 // LOCKS_REQUIRED(fs.mu)
 func (fs *fileSystem) mintInode(ic inode.Core) (in inode.Inode) {
 	// Choose an ID.
-	id := fs.nextInodeID
-	fs.nextInodeID++
+	id := fs.newInodeID(inode.ObjectKey(ic.Bucket.Name(), ic.FullName.GcsObjectName()))
 
 	// Create the inode.
 	switch {
@@ -771,7 +872,7 @@ func (fs *fileSystem) mintInode(ic inode.Core) (in inode.Inode) {
 				Ctime: fs.mtimeClock.Now(),
 				Mtime: fs.mtimeClock.Now(),
 			},
-			fs.implicitDirs,
+			fs.implicitDirsFor(ic.FullName),
 			fs.newConfig.List.EnableEmptyManagedFolders,
 			fs.enableNonexistentTypeCache,
 			fs.dirTypeCacheTTL,
@@ -780,6 +881,7 @@ func (fs *fileSystem) mintInode(ic inode.Core) (in inode.Inode) {
 			fs.cacheClock,
 			fs.newConfig.MetadataCache.TypeCacheMaxSizeMb,
 			fs.newConfig.EnableHns,
+			fs.nameConflictStrategy,
 		)
 
 	case inode.IsSymlink(ic.MinObject):
@@ -975,6 +1077,17 @@ func (fs *fileSystem) lookUpOrCreateChildInode(
 	ctx context.Context,
 	parent inode.DirInode,
 	childName string) (child inode.Inode, err error) {
+	// Versions directories and their contents are virtual.
+	if fs.isVersionsEntry(parent, childName) {
+		return fs.lookUpOrCreateVersionsInode(ctx, parent, childName)
+	}
+
+	// The trash is reached through .trash, and not the prefix it is stored
+	// under.
+	if fs.isTrashDir(parent, childName) {
+		return fs.lookUpOrCreateTrashDirInode(parent, childName)
+	}
+
 	// First check if the requested child is a localFileInode.
 	child = fs.lookUpLocalFileInode(parent, childName)
 	if child != nil {
@@ -1040,11 +1153,17 @@ func (fs *fileSystem) lookUpLocalFileInode(parent inode.DirInode, childName stri
 		fs.mu.Unlock()
 	}()
 
-	// Trim the suffix assigned to fix conflicting names.
-	childName = strings.TrimSuffix(childName, inode.ConflictingFileNameSuffix)
+	fs.mu.Lock()
+
+	// Trim the suffix assigned to fix conflicting names, unless it is part of
+	// the name of a local file.
 	fileName := inode.NewFileName(parent.Name(), childName)
+	if suffix := fs.nameConflictStrategy.FileSuffix(); suffix != "" && fs.localFileInodes[fileName] == nil {
+		if stripped, ok := strings.CutSuffix(childName, suffix); ok {
+			fileName = inode.NewFileName(parent.Name(), stripped)
+		}
+	}
 
-	fs.mu.Lock()
 	var maxTriesToLookupInode = 3
 	for n := 0; n < maxTriesToLookupInode; n++ {
 		child = fs.localFileInodes[fileName]
@@ -1113,6 +1232,295 @@ func (fs *fileSystem) lookUpOrCreateChildDirInode(
 	return child, nil
 }
 
+// Return true if childName within parent is either a versions directory or
+// lies within one, in which case it can't be modified.
+func (fs *fileSystem) isVersionsEntry(parent inode.DirInode, childName string) bool {
+	if !fs.newConfig.FileSystem.ExperimentalEnableVersionsDir {
+		return false
+	}
+
+	if _, ok := parent.(inode.VersionsDirInode); ok {
+		return true
+	}
+
+	_, ok := parent.(inode.BucketOwnedDirInode)
+	return ok && childName == inode.VersionsDirName
+}
+
+// Look up the child with the given name within parent, where
+// isVersionsEntry(parent, childName). Return ENOENT if the child doesn't exist.
+//
+// Return the child locked, incrementing its lookup count.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(parent)
+// LOCK_FUNCTION(child)
+func (fs *fileSystem) lookUpOrCreateVersionsInode(
+	ctx context.Context,
+	parent inode.DirInode,
+	childName string) (child inode.Inode, err error) {
+	bucket := parent.(inode.BucketOwnedDirInode).Bucket()
+
+	// Generations and directories of them are read-only.
+	fileAttrs := fuseops.InodeAttributes{
+		Uid:  fs.uid,
+		Gid:  fs.gid,
+		Mode: fs.fileMode &^ 0222,
+	}
+	dirAttrs := fuseops.InodeAttributes{
+		Uid:   fs.uid,
+		Gid:   fs.gid,
+		Mode:  fs.dirMode &^ 0222,
+		Atime: fs.mtimeClock.Now(),
+		Ctime: fs.mtimeClock.Now(),
+		Mtime: fs.mtimeClock.Now(),
+	}
+
+	// The versions directory of a regular one always exists.
+	versionsParent, ok := parent.(inode.VersionsDirInode)
+	if !ok {
+		name := inode.NewDirName(parent.Name(), childName)
+		child = fs.lookUpOrCreateVersionsDirInode(name, func(id fuseops.InodeID) inode.DirInode {
+			return inode.NewVersionsDirInode(id, name, parent.Name(), "", dirAttrs, bucket)
+		})
+		return
+	}
+
+	parent.LockForChildLookup()
+	core, err := parent.LookUpChild(ctx, childName)
+	parent.UnlockForChildLookup()
+
+	if err != nil {
+		return
+	}
+
+	if core == nil {
+		err = fuse.ENOENT
+		return
+	}
+
+	// A file listed at the top level, whose generations are in a directory.
+	if core.FullName.IsDir() {
+		objectName := inode.NewFileName(versionsParent.Dir(), childName).GcsObjectName()
+		child = fs.lookUpOrCreateVersionsDirInode(core.FullName, func(id fuseops.InodeID) inode.DirInode {
+			return inode.NewVersionsDirInode(id, core.FullName, versionsParent.Dir(), objectName, dirAttrs, bucket)
+		})
+		return
+	}
+
+	// A generation, served by a file inode of its own that is never synced.
+	fs.mu.Lock()
+	// Object names can't contain a newline, so the generation is kept apart.
+	id := fs.newInodeID(fmt.Sprintf("%s\n%d", inode.ObjectKey(core.Bucket.Name(), core.FullName.GcsObjectName()), core.MinObject.Generation))
+
+	f := inode.NewFileInode(
+		id,
+		core.FullName,
+		core.MinObject,
+		fileAttrs,
+		core.Bucket,
+		false, // localFileCache
+		fs.contentCache,
+		fs.mtimeClock,
+		false, // localFile
+		&fs.newConfig.Write,
+		fs.globalMaxBlocksSem)
+
+	fs.inodes[id] = f
+	fs.noncurrentInodes[id] = f
+	fs.mu.Unlock()
+
+	f.Lock()
+	f.IncrementLookupCount()
+	child = f
+	return
+}
+
+// Find the versions directory with the given name, calling mint to create it
+// if there is none.
+//
+// Return the child locked, incrementing its lookup count.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCK_FUNCTION(in)
+func (fs *fileSystem) lookUpOrCreateVersionsDirInode(
+	name inode.Name,
+	mint func(id fuseops.InodeID) inode.DirInode) (in inode.Inode) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for {
+		existing, ok := fs.versionsDirInodes[name]
+		if !ok {
+			// Versions directories aren't objects, so their keys start with a
+			// character that the keys of objects never start with.
+			d := mint(fs.newInodeID(":versions/" + name.LocalName()))
+			fs.inodes[d.ID()] = d
+			fs.versionsDirInodes[name] = d
+
+			d.Lock()
+			d.IncrementLookupCount()
+			return d
+		}
+
+		// Acquire the inode's lock in accordance with the lock ordering, then
+		// check that it wasn't destroyed in the meantime.
+		fs.mu.Unlock()
+		existing.Lock()
+		fs.mu.Lock()
+
+		if fs.versionsDirInodes[name] != existing {
+			existing.Unlock()
+			continue
+		}
+
+		existing.IncrementLookupCount()
+		return existing
+	}
+}
+
+// Fail with EROFS if name within the parent can be neither created nor
+// removed: a virtual entry, namely a versions entry or the trash directory, or
+// any entry of a bucket set up read-only.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) checkMutableEntry(parentID fuseops.InodeID, name string) error {
+	fs.mu.Lock()
+	parent := fs.dirInodeOrDie(parentID)
+	fs.mu.Unlock()
+
+	if isInReadOnlyBucket(parent) {
+		return fmt.Errorf("%q is in a read-only bucket: %w", name, syscall.EROFS)
+	}
+
+	if fs.isVersionsEntry(parent, name) {
+		return fmt.Errorf("%q is a versions entry: %w", name, syscall.EROFS)
+	}
+
+	if fs.isTrashDir(parent, name) {
+		return fmt.Errorf("%q is the trash directory: %w", name, syscall.EROFS)
+	}
+
+	return nil
+}
+
+// Return true if the inode belongs to a bucket set up read-only.
+func isInReadOnlyBucket(in inode.Inode) bool {
+	b, ok := in.(inode.BucketOwnedInode)
+	return ok && b.Bucket() != nil && b.Bucket().ReadOnly
+}
+
+// Return the file cache handler for reads of the given file, or nil if its
+// bucket opted out of the file cache.
+func (fs *fileSystem) fileCacheHandlerFor(in *inode.FileInode) *file.CacheHandler {
+	if in.Bucket().DisableFileCache {
+		return nil
+	}
+	return fs.fileCacheHandler
+}
+
+// Return true if the inode is for a past generation of an object.
+//
+// LOCKS_REQUIRED(fs.mu)
+func (fs *fileSystem) isNoncurrent(id fuseops.InodeID) bool {
+	_, ok := fs.noncurrentInodes[id]
+	return ok
+}
+
+// The name of the directory at the root of each bucket in which the trash can
+// be browsed.
+const trashDirName = ".trash"
+
+// Return the prefix that removed objects are moved under, or the empty string
+// if the trash is disabled.
+func (fs *fileSystem) trashPrefix() string {
+	if !fs.newConfig.FileSystem.ExperimentalEnableTrash {
+		return ""
+	}
+
+	return fs.newConfig.FileSystem.ExperimentalTrashPrefix
+}
+
+// Return true if the named object lies within the trash.
+func (fs *fileSystem) isInTrash(name inode.Name) bool {
+	p := fs.trashPrefix()
+	return p != "" && strings.HasPrefix(name.GcsObjectName(), p)
+}
+
+// Return true if childName within parent is either the .trash directory or the
+// name of the prefix it is stored under, which is hidden.
+func (fs *fileSystem) isTrashDir(parent inode.DirInode, childName string) bool {
+	p := fs.trashPrefix()
+	if p == "" || !parent.Name().IsBucketRoot() {
+		return false
+	}
+
+	if _, ok := parent.(inode.BucketOwnedDirInode); !ok {
+		return false
+	}
+
+	return childName == trashDirName || childName+"/" == p
+}
+
+// Directories within the trash list implicit directories regardless of
+// configuration, since only files are moved there and their parents usually
+// have no backing objects.
+func (fs *fileSystem) implicitDirsFor(name inode.Name) bool {
+	return fs.implicitDirs || fs.isInTrash(name)
+}
+
+// Look up the trash directory within the bucket root parent, where
+// isTrashDir(parent, childName). Return ENOENT for the hidden prefix.
+//
+// Return the child locked, incrementing its lookup count.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(parent)
+// LOCK_FUNCTION(child)
+func (fs *fileSystem) lookUpOrCreateTrashDirInode(
+	parent inode.DirInode,
+	childName string) (child inode.Inode, err error) {
+	if childName != trashDirName {
+		err = fuse.ENOENT
+		return
+	}
+
+	// The trash always exists, whether or not anything is in it.
+	core := inode.Core{
+		Bucket:   parent.(inode.BucketOwnedDirInode).Bucket(),
+		FullName: inode.NewDirName(parent.Name(), strings.TrimSuffix(fs.trashPrefix(), "/")),
+	}
+
+	child = fs.lookUpOrCreateInodeIfNotStale(core)
+	if child == nil {
+		err = fmt.Errorf("cannot create the trash directory in %q", parent.Name())
+	}
+
+	return
+}
+
+// If the trash is enabled and the named object isn't already in it, move the
+// object to the trash, returning the generation that the caller should then
+// delete. Otherwise return zero, for the latest generation.
+//
+// LOCKS_REQUIRED(parent)
+func (fs *fileSystem) moveToTrash(
+	ctx context.Context,
+	parent inode.DirInode,
+	name inode.Name) (generation int64, err error) {
+	if fs.trashPrefix() == "" || fs.isInTrash(name) {
+		return
+	}
+
+	bucket := parent.(inode.BucketOwnedDirInode).Bucket()
+	generation, err = gcsx.MoveToTrash(ctx, bucket, fs.trashPrefix(), name.GcsObjectName(), fs.mtimeClock.Now())
+	if err != nil {
+		err = fmt.Errorf("MoveToTrash: %w", err)
+	}
+
+	return
+}
+
 // Synchronize the supplied file inode to GCS, updating the index as
 // appropriate.
 //
@@ -1200,6 +1608,10 @@ func (fs *fileSystem) unlockAndDecrementLookupCount(in inode.Inode, N uint64) {
 		if fs.folderInodes[name] == in {
 			delete(fs.folderInodes, name)
 		}
+		if fs.versionsDirInodes[name] == in {
+			delete(fs.versionsDirInodes, name)
+		}
+		delete(fs.noncurrentInodes, in.ID())
 		fs.mu.Unlock()
 	}
 
@@ -1265,6 +1677,15 @@ func (fs *fileSystem) getAttributes(
 		return
 	}
 
+	// A past generation looks clobbered by the live object, but isn't unlinked.
+	if _, ok := in.(*inode.FileInode); ok && attr.Nlink == 0 {
+		fs.mu.Lock()
+		if fs.isNoncurrent(in.ID()) {
+			attr.Nlink = 1
+		}
+		fs.mu.Unlock()
+	}
+
 	// Set up the expiration time.
 	if fs.inodeAttributeCacheTTL > 0 {
 		expiration = time.Now().Add(fs.inodeAttributeCacheTTL)
@@ -1464,8 +1885,14 @@ func (fs *fileSystem) SetInodeAttributes(
 	// Find the inode.
 	fs.mu.Lock()
 	in := fs.inodeOrDie(op.Inode)
+	noncurrent := fs.isNoncurrent(op.Inode)
 	fs.mu.Unlock()
 
+	// Past generations can't be modified.
+	if noncurrent && (op.Mtime != nil || op.Size != nil) {
+		return syscall.EROFS
+	}
+
 	in.Lock()
 	defer in.Unlock()
 	file, isFile := in.(*inode.FileInode)
@@ -1527,6 +1954,10 @@ func (fs *fileSystem) MkDir(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
+	if err = fs.checkMutableEntry(op.Parent, op.Name); err != nil {
+		return err
+	}
+
 	// Find the parent.
 	fs.mu.Lock()
 	parent := fs.dirInodeOrDie(op.Parent)
@@ -1590,6 +2021,10 @@ func (fs *fileSystem) MkNode(
 		return syscall.ENOTSUP
 	}
 
+	if err = fs.checkMutableEntry(op.Parent, op.Name); err != nil {
+		return err
+	}
+
 	// Create the child.
 	child, err := fs.createFile(ctx, op.Parent, op.Name, op.Mode)
 	if err != nil {
@@ -1724,6 +2159,10 @@ func (fs *fileSystem) CreateFile(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
+	if err = fs.checkMutableEntry(op.Parent, op.Name); err != nil {
+		return err
+	}
+
 	// Create the child.
 	var child inode.Inode
 	if fs.newConfig.Write.CreateEmptyFile {
@@ -1744,7 +2183,7 @@ func (fs *fileSystem) CreateFile(
 	handleID := fs.nextHandleID
 	fs.nextHandleID++
 
-	fs.handles[handleID] = handle.NewFileHandle(child.(*inode.FileInode), fs.fileCacheHandler, fs.cacheFileForRangeRead, fs.metricHandle)
+	fs.handles[handleID] = handle.NewFileHandle(child.(*inode.FileInode), fs.fileCacheHandlerFor(child.(*inode.FileInode)), fs.cacheFileForRangeRead, fs.metricHandle)
 	op.Handle = handleID
 
 	fs.mu.Unlock()
@@ -1773,6 +2212,10 @@ func (fs *fileSystem) CreateSymlink(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
+	if err = fs.checkMutableEntry(op.Parent, op.Name); err != nil {
+		return err
+	}
+
 	// Find the parent.
 	fs.mu.Lock()
 	parent := fs.dirInodeOrDie(op.Parent)
@@ -1843,6 +2286,10 @@ func (fs *fileSystem) RmDir(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
+	if err = fs.checkMutableEntry(op.Parent, op.Name); err != nil {
+		return err
+	}
+
 	// Find the parent.
 	fs.mu.Lock()
 	parent := fs.dirInodeOrDie(op.Parent)
@@ -1929,8 +2376,22 @@ func (fs *fileSystem) RmDir(
 	_, isImplicitDir := fs.implicitDirInodes[child.Name()]
 	fs.mu.Unlock()
 	parent.Lock()
+	defer parent.Unlock()
+
+	// Keep the backing object in the trash too, if enabled, so that empty
+	// directories can be restored. Hierarchical buckets may have none.
+	if !isImplicitDir {
+		_, err = fs.moveToTrash(ctx, parent, child.Name())
+		var notFoundErr *gcs.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	err = parent.DeleteChildDir(ctx, op.Name, isImplicitDir, childDir)
-	parent.Unlock()
 
 	if err != nil {
 		err = fmt.Errorf("DeleteChildDir: %w", err)
@@ -1970,6 +2431,22 @@ func (fs *fileSystem) Rename(
 		}
 	}
 
+	// Renaming a generation onto a file restores it. Nothing else may be moved
+	// into or out of versions directories.
+	if versionsParent, ok := oldParent.(inode.VersionsDirInode); ok &&
+		versionsParent.ObjectName() != "" &&
+		!fs.isVersionsEntry(newParent, op.NewName) {
+		return fs.restoreGeneration(ctx, oldParent, op.OldName, newParent, op.NewName)
+	}
+
+	if fs.isVersionsEntry(oldParent, op.OldName) || fs.isVersionsEntry(newParent, op.NewName) {
+		return fmt.Errorf("rename versions entry: %w", syscall.EROFS)
+	}
+
+	if fs.isTrashDir(oldParent, op.OldName) || fs.isTrashDir(newParent, op.NewName) {
+		return fmt.Errorf("rename trash directory: %w", syscall.EROFS)
+	}
+
 	// If object to be renamed is a local file inode (un-synced), rename operation is not supported.
 	localChild := fs.lookUpLocalFileInode(oldParent, op.OldName)
 	if localChild != nil {
@@ -2000,7 +2477,45 @@ func (fs *fileSystem) Rename(
 		}
 		return fs.renameNonHierarchicalDir(ctx, oldParent, op.OldName, newParent, op.NewName)
 	}
-	return fs.renameFile(ctx, oldParent, op.OldName, child.MinObject, newParent, op.NewName)
+
+	// The file may have been looked up under the suffixed name of a
+	// conflicting file, which is not the name of its object. The same goes for
+	// the destination, replacing the conflicting file shown there.
+	oldName := path.Base(child.FullName.LocalName())
+	newName, err := fs.resolveConflictingFileName(ctx, newParent, op.NewName)
+	if err != nil {
+		return err
+	}
+	return fs.renameFile(ctx, oldParent, oldName, child.MinObject, newParent, newName)
+}
+
+// Return the name of the file that name refers to in parent: name itself,
+// unless it carries the suffix under which the file of a conflicting (file,
+// directory) pair is listed and that directory exists.
+//
+// LOCKS_EXCLUDED(parent)
+func (fs *fileSystem) resolveConflictingFileName(
+	ctx context.Context,
+	parent inode.DirInode,
+	name string) (string, error) {
+	suffix := fs.nameConflictStrategy.FileSuffix()
+	stripped, ok := strings.CutSuffix(name, suffix)
+	if suffix == "" || !ok {
+		return name, nil
+	}
+
+	parent.Lock()
+	child, err := parent.LookUpChild(ctx, stripped)
+	parent.Unlock()
+
+	if err != nil {
+		return "", fmt.Errorf("LookUpChild: %w", err)
+	}
+
+	if child != nil && child.FullName.IsDir() {
+		return stripped, nil
+	}
+	return name, nil
 }
 
 // LOCKS_EXCLUDED(fs.mu)
@@ -2046,6 +2561,41 @@ func (fs *fileSystem) renameFile(
 	return nil
 }
 
+// Copy the generation named oldName in a versions directory over newName,
+// making it live again. Unlike a rename, the generation is left in place.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(oldParent)
+// LOCKS_EXCLUDED(newParent)
+func (fs *fileSystem) restoreGeneration(
+	ctx context.Context,
+	oldParent inode.DirInode,
+	oldName string,
+	newParent inode.DirInode,
+	newName string) error {
+	oldParent.Lock()
+	child, err := oldParent.LookUpChild(ctx, oldName)
+	oldParent.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("LookUpChild: %w", err)
+	}
+
+	if child == nil {
+		return fuse.ENOENT
+	}
+
+	newParent.Lock()
+	_, err = newParent.CloneToChildFile(ctx, newName, child.MinObject)
+	newParent.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("CloneToChildFile: %w", err)
+	}
+
+	return nil
+}
+
 func (fs *fileSystem) releaseInodes(inodes *[]inode.DirInode) {
 	for _, in := range *inodes {
 		fs.unlockAndDecrementLookupCount(in, 1)
@@ -2255,6 +2805,10 @@ func (fs *fileSystem) Unlink(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
+	if err = fs.checkMutableEntry(op.Parent, op.Name); err != nil {
+		return err
+	}
+
 	// Find the parent.
 	fs.mu.Lock()
 	parent := fs.dirInodeOrDie(op.Parent)
@@ -2278,11 +2832,18 @@ func (fs *fileSystem) Unlink(
 	parent.Lock()
 	defer parent.Unlock()
 
+	// Keep a copy in the trash, if enabled, deleting exactly the generation
+	// that was copied.
+	generation, err := fs.moveToTrash(ctx, parent, fileName)
+	if err != nil {
+		return err
+	}
+
 	// Delete the backing object.
 	err = parent.DeleteChildFile(
 		ctx,
 		op.Name,
-		0,   // Latest generation
+		generation,
 		nil) // No meta-generation precondition
 
 	if err != nil {
@@ -2312,7 +2873,7 @@ func (fs *fileSystem) OpenDir(
 	handleID := fs.nextHandleID
 	fs.nextHandleID++
 
-	fs.handles[handleID] = handle.NewDirHandle(in, fs.implicitDirs)
+	fs.handles[handleID] = handle.NewDirHandle(in, fs.implicitDirs, fs.nameConflictStrategy, fs.stableInodeIDs)
 	op.Handle = handleID
 
 	fs.mu.Unlock()
@@ -2384,11 +2945,17 @@ func (fs *fileSystem) OpenFile(
 	// Find the inode.
 	in := fs.fileInodeOrDie(op.Inode)
 
+	// Past generations and read-only buckets can't be modified.
+	if (fs.isNoncurrent(op.Inode) || isInReadOnlyBucket(in)) && !op.OpenFlags.IsReadOnly() {
+		err = syscall.EROFS
+		return
+	}
+
 	// Allocate a handle.
 	handleID := fs.nextHandleID
 	fs.nextHandleID++
 
-	fs.handles[handleID] = handle.NewFileHandle(in, fs.fileCacheHandler, fs.cacheFileForRangeRead, fs.metricHandle)
+	fs.handles[handleID] = handle.NewFileHandle(in, fs.fileCacheHandlerFor(in), fs.cacheFileForRangeRead, fs.metricHandle)
 	op.Handle = handleID
 
 	// When we observe object generations that we didn't create, we assign them
@@ -2554,6 +3121,29 @@ func (fs *fileSystem) ReleaseFileHandle(
 	return
 }
 
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) (err error) {
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+	// Find the inode.
+	fs.mu.Lock()
+	in := fs.fileInodeOrDie(op.Inode)
+	fs.mu.Unlock()
+
+	in.Lock()
+	defer in.Unlock()
+
+	// Serve the request.
+	return in.Fallocate(ctx, op.Mode, int64(op.Offset), int64(op.Length))
+}
+
 func (fs *fileSystem) GetXattr(
 	ctx context.Context,
 	op *fuseops.GetXattrOp) (err error) {
@@ -26,6 +26,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -372,6 +373,10 @@ type fakeBucketManager struct {
 
 func (bm *fakeBucketManager) ShutDown() {}
 
+func (bm *fakeBucketManager) ListBuckets(ctx context.Context) ([]string, error) {
+	return nil, syscall.ENOTSUP
+}
+
 func (bm *fakeBucketManager) SetUpBucket(
 	ctx context.Context,
 	name string, isMultibucketMount bool, _ common.MetricHandle) (sb gcsx.SyncerBucket, err error) {
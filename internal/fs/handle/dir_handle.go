@@ -26,14 +26,21 @@ import (
 	"golang.org/x/net/context"
 )
 
+// The maximum number of listing states a DirHandle remembers for seeks behind
+// its window. Older ones are dropped, and seeking before the oldest restarts
+// the listing.
+const maxListingCheckpoints = 64
+
 // DirHandle is the state required for reading from directories.
 type DirHandle struct {
 	/////////////////////////
 	// Constant data
 	/////////////////////////
 
-	in           inode.DirInode
-	implicitDirs bool
+	in                   inode.DirInode
+	implicitDirs         bool
+	nameConflictStrategy inode.NameConflictStrategy
+	stableInodeIDs       bool
 
 	/////////////////////////
 	// Mutable state
@@ -41,29 +48,68 @@ type DirHandle struct {
 
 	Mu locker.Locker
 
-	// All entries in the directory. Populated the first time we need one.
+	// A window of consecutive entries of the directory: the latest batch read
+	// from the inode, the first of which is at offset entriesStart. Kernels
+	// read directories sequentially, so earlier batches aren't kept.
 	//
-	// INVARIANT: For each i, entries[i+1].Offset == entries[i].Offset + 1
+	// INVARIANT: For each i, entries[i].Offset == entriesStart + i + 1
 	//
 	// GUARDED_BY(Mu)
-	entries []fuseutil.Dirent
+	entries      []fuseutil.Dirent
+	entriesStart fuseops.DirOffset
 
-	// Has entries yet been populated?
+	// Where the listing continues after entries.
+	//
+	// INVARIANT: next.offset == entriesStart + len(entries)
 	//
-	// INVARIANT: If !entriesValid, then len(entries) == 0
+	// GUARDED_BY(Mu)
+	next listingState
+
+	// States at the start of earlier batches, by increasing offset, to resume
+	// the listing from on a seek behind the window.
 	//
 	// GUARDED_BY(Mu)
-	entriesValid bool
+	checkpoints []listingState
+
+	// Local file entries (not synced to GCS) as of the start of the listing, by
+	// name and sorted by name.
+	//
+	// GUARDED_BY(Mu)
+	localEntries       map[string]fuseutil.Dirent
+	sortedLocalEntries []fuseutil.Dirent
+}
+
+// The state of a listing between two batches of entries.
+type listingState struct {
+	// The offset of the first entry of the next batch.
+	offset fuseops.DirOffset
+
+	// The continuation token for the next page of the inode's entries.
+	tok string
+
+	// Whether the inode has no more entries.
+	done bool
+
+	// File entries held back because a conflicting directory may be in the next
+	// page. Never modified once set.
+	pending []fuseutil.Dirent
+
+	// The number of sortedLocalEntries merged so far.
+	localMerged int
 }
 
 // NewDirHandle creates a directory handle that obtains listings from the supplied inode.
 func NewDirHandle(
 	in inode.DirInode,
-	implicitDirs bool) (dh *DirHandle) {
+	implicitDirs bool,
+	nameConflictStrategy inode.NameConflictStrategy,
+	stableInodeIDs bool) (dh *DirHandle) {
 	// Set up the basic struct.
 	dh = &DirHandle{
-		in:           in,
-		implicitDirs: implicitDirs,
+		in:                   in,
+		implicitDirs:         implicitDirs,
+		nameConflictStrategy: nameConflictStrategy,
+		stableInodeIDs:       stableInodeIDs,
 	}
 
 	// Set up invariant checking.
@@ -76,37 +122,76 @@ func NewDirHandle(
 // Helpers
 ////////////////////////////////////////////////////////////////////////
 
-// Directory entries, sorted by name.
+// Return the stable inode ID of the entry's object, a directory's object
+// name ending in a slash. Directories not backed by a bucket, whose entries
+// aren't objects, get a bogus ID as without stable inode IDs.
+func (dh *DirHandle) stableInodeID(e fuseutil.Dirent) fuseops.InodeID {
+	b, ok := dh.in.(inode.BucketOwnedInode)
+	if !ok {
+		return fuseops.RootInodeID + 1
+	}
+
+	name := dh.in.Name().GcsObjectName() + e.Name
+	if e.Type == fuseutil.DT_Directory {
+		name += "/"
+	}
+
+	return inode.StableID(inode.ObjectKey(b.Bucket().Name(), name))
+}
+
+// Directory entries, sorted by name, with a directory before a file or
+// symlink of the same name.
 type sortedDirents []fuseutil.Dirent
 
-func (p sortedDirents) Len() int           { return len(p) }
-func (p sortedDirents) Less(i, j int) bool { return p[i].Name < p[j].Name }
-func (p sortedDirents) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p sortedDirents) Len() int      { return len(p) }
+func (p sortedDirents) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p sortedDirents) Less(i, j int) bool {
+	if p[i].Name != p[j].Name {
+		return p[i].Name < p[j].Name
+	}
+	return p[i].Type == fuseutil.DT_Directory && p[j].Type != fuseutil.DT_Directory
+}
 
 func (dh *DirHandle) checkInvariants() {
-	// INVARIANT: For each i, entries[i+1].Offset == entries[i].Offset + 1
-	for i := 0; i < len(dh.entries)-1; i++ {
-		if !(dh.entries[i+1].Offset == dh.entries[i].Offset+1) {
+	// INVARIANT: For each i, entries[i].Offset == entriesStart + i + 1
+	for i, e := range dh.entries {
+		if e.Offset != dh.entriesStart+fuseops.DirOffset(i)+1 {
 			panic(
 				fmt.Sprintf(
-					"Unexpected offset sequence: %v, %v",
-					dh.entries[i].Offset,
-					dh.entries[i+1].Offset))
+					"Unexpected offset %v at index %d of window starting at %v",
+					e.Offset,
+					i,
+					dh.entriesStart))
 		}
 	}
 
-	// INVARIANT: If !entriesValid, then len(entries) == 0
-	if !dh.entriesValid && len(dh.entries) != 0 {
-		panic("Unexpected non-empty entries slice")
+	// INVARIANT: next.offset == entriesStart + len(entries)
+	if dh.next.offset != dh.entriesStart+fuseops.DirOffset(len(dh.entries)) {
+		panic(
+			fmt.Sprintf(
+				"Unexpected next offset %v for window of %d entries starting at %v",
+				dh.next.offset,
+				len(dh.entries),
+				dh.entriesStart))
 	}
 }
 
+// The position of an entry among the object names in a listing of the
+// directory, relative to its prefix.
+func listingKey(e fuseutil.Dirent) string {
+	if e.Type == fuseutil.DT_Directory {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
 // Resolve name conflicts between file objects and directory objects (e.g. the
-// objects "foo/bar" and "foo/bar/") by appending U+000A, which is illegal in
-// GCS object names, to conflicting file names.
+// objects "foo/bar" and "foo/bar/") as the strategy says: by appending its
+// FileSuffix to conflicting file names, or by dropping whichever of the pair it
+// hides.
 //
 // Input must be sorted by name.
-func fixConflictingNames(entries []fuseutil.Dirent, localEntries map[string]fuseutil.Dirent) (output []fuseutil.Dirent, err error) {
+func fixConflictingNames(entries []fuseutil.Dirent, localEntries map[string]fuseutil.Dirent, strategy inode.NameConflictStrategy) (output []fuseutil.Dirent, err error) {
 	// Sanity check.
 	if !sort.IsSorted(sortedDirents(entries)) {
 		err = fmt.Errorf("expected sorted input")
@@ -151,11 +236,18 @@ func fixConflictingNames(entries []fuseutil.Dirent, localEntries map[string]fuse
 			}
 		}
 
-		// Repair whichever is not the directory.
-		if eIsDir {
-			prev.Name += inode.ConflictingFileNameSuffix
-		} else {
-			e.Name += inode.ConflictingFileNameSuffix
+		// Repair whichever is not the directory, or keep only the preferred one.
+		suffix := strategy.FileSuffix()
+		switch {
+		case suffix == "":
+			if eIsDir != strategy.PrefersFile() {
+				*prev = *e
+			}
+			continue
+		case eIsDir:
+			prev.Name += suffix
+		default:
+			e.Name += suffix
 		}
 
 		output = append(output, *e)
@@ -164,62 +256,126 @@ func fixConflictingNames(entries []fuseutil.Dirent, localEntries map[string]fuse
 	return
 }
 
-// Read all entries for the directory, fix up conflicting names, and fill in
-// offset fields.
+// Start the listing over, as of the supplied local file entries.
 //
-// LOCKS_REQUIRED(in)
-func readAllEntries(
-	ctx context.Context,
-	in inode.DirInode,
-	localEntries map[string]fuseutil.Dirent) (entries []fuseutil.Dirent, err error) {
-	// Read entries from GCS.
-	// Read one batch at a time.
-	var tok string
-	for {
-		// Read a batch.
-		var batch []fuseutil.Dirent
-
-		batch, tok, err = in.ReadEntries(ctx, tok)
-		if err != nil {
-			err = fmt.Errorf("ReadEntries: %w", err)
-			return
+// LOCKS_REQUIRED(dh.Mu)
+func (dh *DirHandle) resetListing(localFileEntries map[string]fuseutil.Dirent) {
+	dh.entries = nil
+	dh.entriesStart = 0
+	dh.next = listingState{}
+	dh.checkpoints = nil
+
+	dh.localEntries = localFileEntries
+	dh.sortedLocalEntries = make([]fuseutil.Dirent, 0, len(localFileEntries))
+	for _, e := range localFileEntries {
+		dh.sortedLocalEntries = append(dh.sortedLocalEntries, e)
+	}
+	sort.Sort(sortedDirents(dh.sortedLocalEntries))
+}
+
+// Go back to the latest checkpoint at or before the offset, leaving an empty
+// window there.
+//
+// LOCKS_REQUIRED(dh.Mu)
+func (dh *DirHandle) rewind(offset fuseops.DirOffset) {
+	state := listingState{}
+	for len(dh.checkpoints) > 0 {
+		last := dh.checkpoints[len(dh.checkpoints)-1]
+		if last.offset <= offset {
+			state = last
+			break
 		}
+		dh.checkpoints = dh.checkpoints[:len(dh.checkpoints)-1]
+	}
+
+	dh.entries = nil
+	dh.entriesStart = state.offset
+	dh.next = state
+}
 
-		// Accumulate.
-		entries = append(entries, batch...)
+// Replace the window with the next batch of entries: a page of the inode's
+// entries merged with the local file entries that sort among them, with
+// conflicting names fixed up and offset fields filled in.
+//
+// Objects are listed in name order, so a page holds every name up to the
+// greatest one in it. A file whose directory would sort after that is held
+// back for the next batch, so that the pair can be fixed up together.
+//
+// LOCKS_REQUIRED(dh.Mu)
+// LOCKS_EXCLUDED(dh.in)
+func (dh *DirHandle) readNextBatch(ctx context.Context) (err error) {
+	state := dh.next
 
-		// Are we done?
-		if tok == "" {
+	dh.in.Lock()
+	page, tok, err := dh.in.ReadEntries(ctx, state.tok)
+	dh.in.Unlock()
+	if err != nil {
+		err = fmt.Errorf("ReadEntries: %w", err)
+		return
+	}
+	done := tok == ""
+
+	var bound string
+	for _, e := range page {
+		if k := listingKey(e); k > bound {
+			bound = k
+		}
+	}
+
+	// Gather the batch, sorted for use in fixConflictingNames below.
+	entries := append(append([]fuseutil.Dirent(nil), state.pending...), page...)
+	localMerged := state.localMerged
+	for ; localMerged < len(dh.sortedLocalEntries); localMerged++ {
+		e := dh.sortedLocalEntries[localMerged]
+		if !done && listingKey(e) > bound {
 			break
 		}
+		entries = append(entries, e)
 	}
+	sort.Sort(sortedDirents(entries))
 
-	// Append local file entries (not synced to GCS).
-	for _, localEntry := range localEntries {
-		entries = append(entries, localEntry)
+	var pending []fuseutil.Dirent
+	if !done {
+		var kept []fuseutil.Dirent
+		for i, e := range entries {
+			hasDir := (i > 0 && entries[i-1].Name == e.Name && entries[i-1].Type == fuseutil.DT_Directory) ||
+				(i+1 < len(entries) && entries[i+1].Name == e.Name && entries[i+1].Type == fuseutil.DT_Directory)
+			if e.Type != fuseutil.DT_Directory && !hasDir && e.Name+"/" > bound {
+				pending = append(pending, e)
+				continue
+			}
+			kept = append(kept, e)
+		}
+		entries = kept
 	}
 
-	// Ensure that the entries are sorted, for use in fixConflictingNames
-	// below.
-	sort.Sort(sortedDirents(entries))
+	// With stable inode IDs, return the ID each entry's inode gets unless it
+	// collides with another, derived from the entry's name before conflicting
+	// names are changed below.
+	if dh.stableInodeIDs {
+		for i := range entries {
+			entries[i].Inode = dh.stableInodeID(entries[i])
+		}
+	}
 
 	// Fix name conflicts.
 	// When a local file is synced to GCS but not removed from the local file map,
 	// the entries list will have two duplicate entries.
 	// To handle this scenario, we are removing the duplicate entry before
 	// returning the response to kernel.
-	entries, err = fixConflictingNames(entries, localEntries)
+	entries, err = fixConflictingNames(entries, dh.localEntries, dh.nameConflictStrategy)
 	if err != nil {
 		err = fmt.Errorf("fixConflictingNames: %w", err)
 		return
 	}
 
 	// Fix up offset fields.
-	for i := 0; i < len(entries); i++ {
-		entries[i].Offset = fuseops.DirOffset(i) + 1
+	for i := range entries {
+		entries[i].Offset = state.offset + fuseops.DirOffset(i) + 1
 	}
 
-	// Return a bogus inode ID for each entry, but not the root inode ID.
+	// Otherwise return a bogus inode ID for each entry, but not the root inode
+	// ID.
 	//
 	// NOTE: As far as I can tell this is harmless. Minting and
 	// returning a real inode ID is difficult because fuse does not count
@@ -232,30 +388,58 @@ func readAllEntries(
 	// about the birthday problem? And more importantly, what about our
 	// semantic of not minting a new inode ID when the generation changes due
 	// to a local action?
-	for i := range entries {
-		entries[i].Inode = fuseops.RootInodeID + 1
+	if !dh.stableInodeIDs {
+		for i := range entries {
+			entries[i].Inode = fuseops.RootInodeID + 1
+		}
+	}
+
+	// Remember where this batch started, for seeks back into it.
+	if n := len(dh.checkpoints); n == 0 || dh.checkpoints[n-1].offset < state.offset {
+		dh.checkpoints = append(dh.checkpoints, state)
+		if len(dh.checkpoints) > maxListingCheckpoints {
+			dh.checkpoints = dh.checkpoints[1:]
+		}
+	}
+
+	// Update state.
+	dh.entries = entries
+	dh.entriesStart = state.offset
+	dh.next = listingState{
+		offset:      state.offset + fuseops.DirOffset(len(entries)),
+		tok:         tok,
+		done:        done,
+		pending:     pending,
+		localMerged: localMerged,
 	}
 
 	return
 }
 
+// Start the listing over and read its first batch of entries.
+//
 // LOCKS_REQUIRED(dh.Mu)
 // LOCKS_EXCLUDED(dh.in)
 func (dh *DirHandle) ensureEntries(ctx context.Context, localFileEntries map[string]fuseutil.Dirent) (err error) {
-	dh.in.Lock()
-	defer dh.in.Unlock()
+	dh.resetListing(localFileEntries)
+	return dh.fillWindow(ctx, 0)
+}
 
-	// Read entries.
-	var entries []fuseutil.Dirent
-	entries, err = readAllEntries(ctx, dh.in, localFileEntries)
-	if err != nil {
-		err = fmt.Errorf("readAllEntries: %w", err)
-		return
+// Read batches until the window holds the entry at the offset or the listing
+// ends.
+//
+// LOCKS_REQUIRED(dh.Mu)
+// LOCKS_EXCLUDED(dh.in)
+func (dh *DirHandle) fillWindow(ctx context.Context, offset fuseops.DirOffset) (err error) {
+	if offset < dh.entriesStart {
+		dh.rewind(offset)
 	}
 
-	// Update state.
-	dh.entries = entries
-	dh.entriesValid = true
+	for offset >= dh.next.offset && !dh.next.done {
+		if err = dh.readNextBatch(ctx); err != nil {
+			return
+		}
+	}
 
 	return
 }
@@ -265,6 +449,8 @@ func (dh *DirHandle) ensureEntries(ctx context.Context, localFileEntries map[str
 ////////////////////////////////////////////////////////////////////////
 
 // ReadDir handles a request to read from the directory, without responding.
+// Entries are read from the inode a page at a time as the kernel asks for
+// them.
 //
 // Special case: we assume that a zero offset indicates that rewinddir has been
 // called (since fuse gives us no way to intercept and know for sure), and
@@ -279,28 +465,24 @@ func (dh *DirHandle) ReadDir(
 	// If the request is for offset zero, we assume that either this is the first
 	// call or rewinddir has been called. Reset state.
 	if op.Offset == 0 {
-		dh.entries = nil
-		dh.entriesValid = false
+		dh.resetListing(localFileEntries)
 	}
 
 	// Do we need to read entries from GCS?
-	if !dh.entriesValid {
-		err = dh.ensureEntries(ctx, localFileEntries)
-		if err != nil {
-			return
-		}
+	err = dh.fillWindow(ctx, op.Offset)
+	if err != nil {
+		return
 	}
 
-	// Is the offset past the end of what we have buffered? If so, this must be
-	// an invalid seekdir according to posix.
-	index := int(op.Offset)
-	if index > len(dh.entries) {
+	// Is the offset past the end of the listing? If so, this must be an invalid
+	// seekdir according to posix.
+	if op.Offset > dh.next.offset {
 		err = fuse.EINVAL
 		return
 	}
 
 	// We copy out entries until we run out of entries or space.
-	for i := index; i < len(dh.entries); i++ {
+	for i := int(op.Offset - dh.entriesStart); i < len(dh.entries); i++ {
 		n := fuseutil.WriteDirent(op.Dst[op.BytesRead:], dh.entries[i])
 		if n == 0 {
 			break
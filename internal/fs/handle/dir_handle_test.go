@@ -17,16 +17,21 @@ package handle
 import (
 	"context"
 	"math"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
 	. "github.com/jacobsa/ogletest"
@@ -83,11 +88,14 @@ func (t *DirHandleTest) resetDirHandle() {
 		&t.clock,
 		&t.clock,
 		0,
-		false)
+		false,
+		cfg.NameConflictNewline)
 
 	t.dh = NewDirHandle(
 		dirInode,
 		true,
+		cfg.NameConflictNewline,
+		false,
 	)
 }
 
@@ -232,6 +240,48 @@ func (t *DirHandleTest) EnsureEntriesWithSameNameLocalFileAndGCSDirectory() {
 	t.validateEntry(t.dh.entries[1], localFileName+inode.ConflictingFileNameSuffix, fuseutil.DT_File)
 }
 
+func (t *DirHandleTest) EnsureEntriesWithSameNameLocalFileAndGCSDirectory_Strategies() {
+	// DirHandle holds a DirInode pointing to "testDir".
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "testDir/file1/", nil)
+	AssertEq(nil, err)
+	localFileName := "file1"
+	localFileEntries := map[string]fuseutil.Dirent{
+		localFileName: {Offset: 0, Inode: 10, Name: localFileName, Type: fuseutil.DT_File},
+	}
+
+	for _, tc := range []struct {
+		strategy inode.NameConflictStrategy
+		want     []fuseutil.Dirent
+	}{
+		{
+			strategy: cfg.NameConflictMarker,
+			want: []fuseutil.Dirent{
+				{Name: localFileName, Type: fuseutil.DT_Directory},
+				{Name: localFileName + inode.ConflictingFileNameMarker, Type: fuseutil.DT_File},
+			},
+		},
+		{
+			strategy: cfg.NameConflictPreferDir,
+			want:     []fuseutil.Dirent{{Name: localFileName, Type: fuseutil.DT_Directory}},
+		},
+		{
+			strategy: cfg.NameConflictPreferFile,
+			want:     []fuseutil.Dirent{{Name: localFileName, Type: fuseutil.DT_File}},
+		},
+	} {
+		t.resetDirHandle()
+		t.dh.nameConflictStrategy = tc.strategy
+
+		err = t.dh.ensureEntries(t.ctx, localFileEntries)
+
+		AssertEq(nil, err)
+		AssertEq(len(tc.want), len(t.dh.entries), "strategy %q", tc.strategy)
+		for i, e := range tc.want {
+			t.validateEntry(t.dh.entries[i], e.Name, e.Type)
+		}
+	}
+}
+
 func (t *DirHandleTest) EnsureEntriesWithNoFiles() {
 	// Setup localFileEntries.
 	localFileEntries := map[string]fuseutil.Dirent{}
@@ -278,3 +328,228 @@ func (t *DirHandleTest) EnsureEntriesWithOneLocalFile() {
 	AssertEq(1, len(t.dh.entries))
 	t.validateEntry(t.dh.entries[0], localFileName1, fuseutil.DT_File)
 }
+
+// A directory inode whose entries come in fixed pages.
+type pagedDirInode struct {
+	inode.DirInode
+	pages [][]fuseutil.Dirent
+	reads []string
+}
+
+func (in *pagedDirInode) Name() inode.Name {
+	return inode.NewDirName(inode.NewRootName(""), "pagedDir")
+}
+
+func (in *pagedDirInode) Lock()   {}
+func (in *pagedDirInode) Unlock() {}
+
+func (in *pagedDirInode) ReadEntries(_ context.Context, tok string) (entries []fuseutil.Dirent, newTok string, err error) {
+	in.reads = append(in.reads, tok)
+	i := 0
+	if tok != "" {
+		i, err = strconv.Atoi(tok)
+		if err != nil {
+			return
+		}
+	}
+
+	entries = append(entries, in.pages[i]...)
+	if i+1 < len(in.pages) {
+		newTok = strconv.Itoa(i + 1)
+	}
+	return
+}
+
+func fileEntry(name string) fuseutil.Dirent {
+	return fuseutil.Dirent{Name: name, Type: fuseutil.DT_File}
+}
+
+func dirEntry(name string) fuseutil.Dirent {
+	return fuseutil.Dirent{Name: name, Type: fuseutil.DT_Directory}
+}
+
+// Read the directory from the offset to the end, returning the entries served.
+func (t *DirHandleTest) readDirFrom(offset fuseops.DirOffset, localFileEntries map[string]fuseutil.Dirent) (entries []fuseutil.Dirent) {
+	for {
+		op := &fuseops.ReadDirOp{Offset: offset, Dst: make([]byte, 4096)}
+		err := t.dh.ReadDir(t.ctx, op, localFileEntries)
+		AssertEq(nil, err)
+		if op.BytesRead == 0 {
+			return
+		}
+
+		served := t.dh.entries[offset-t.dh.entriesStart:]
+		entries = append(entries, served...)
+		offset += fuseops.DirOffset(len(served))
+	}
+}
+
+func (t *DirHandleTest) ReadDirReadsOnePageAtATime() {
+	in := &pagedDirInode{pages: [][]fuseutil.Dirent{
+		{fileEntry("a"), fileEntry("b")},
+		{fileEntry("c")},
+		{fileEntry("d")},
+	}}
+	t.dh = NewDirHandle(in, false, cfg.NameConflictNewline, false)
+
+	op := &fuseops.ReadDirOp{Dst: make([]byte, 4096)}
+	err := t.dh.ReadDir(t.ctx, op, nil)
+
+	// The last file of a page waits for the next one, which may hold a
+	// directory with the same name.
+	AssertEq(nil, err)
+	ExpectEq(1, len(in.reads))
+	AssertEq(1, len(t.dh.entries))
+	t.validateEntry(t.dh.entries[0], "a", fuseutil.DT_File)
+	ExpectEq(1, t.dh.entries[0].Offset)
+
+	entries := t.readDirFrom(1, nil)
+
+	AssertEq(3, len(entries))
+	t.validateEntry(entries[0], "b", fuseutil.DT_File)
+	ExpectEq(2, entries[0].Offset)
+	t.validateEntry(entries[2], "d", fuseutil.DT_File)
+	ExpectEq(4, entries[2].Offset)
+	ExpectEq(3, len(in.reads))
+	ExpectEq(2, len(t.dh.entries))
+}
+
+func (t *DirHandleTest) ReadDirFixesConflictsAcrossPages() {
+	// The file "foo" sorts before "foo-bar", and the directory "foo/" after it.
+	in := &pagedDirInode{pages: [][]fuseutil.Dirent{
+		{fileEntry("foo"), fileEntry("foo-bar")},
+		{dirEntry("foo")},
+	}}
+	t.dh = NewDirHandle(in, false, cfg.NameConflictNewline, false)
+
+	entries := t.readDirFrom(0, nil)
+
+	AssertEq(3, len(entries))
+	t.validateEntry(entries[0], "foo", fuseutil.DT_Directory)
+	t.validateEntry(entries[1], "foo"+inode.ConflictingFileNameSuffix, fuseutil.DT_File)
+	t.validateEntry(entries[2], "foo-bar", fuseutil.DT_File)
+	for i, e := range entries {
+		ExpectEq(i+1, e.Offset)
+	}
+}
+
+func (t *DirHandleTest) ReadDirMergesLocalFilesInOrder() {
+	in := &pagedDirInode{pages: [][]fuseutil.Dirent{
+		{fileEntry("a"), fileEntry("b")},
+		{dirEntry("c")},
+	}}
+	t.dh = NewDirHandle(in, false, cfg.NameConflictNewline, false)
+	localFileEntries := map[string]fuseutil.Dirent{
+		"b0": fileEntry("b0"),
+		"c":  fileEntry("c"),
+		"z":  fileEntry("z"),
+	}
+
+	entries := t.readDirFrom(0, localFileEntries)
+
+	AssertEq(6, len(entries))
+	t.validateEntry(entries[0], "a", fuseutil.DT_File)
+	t.validateEntry(entries[1], "b", fuseutil.DT_File)
+	t.validateEntry(entries[2], "b0", fuseutil.DT_File)
+	t.validateEntry(entries[3], "c", fuseutil.DT_Directory)
+	t.validateEntry(entries[4], "c"+inode.ConflictingFileNameSuffix, fuseutil.DT_File)
+	t.validateEntry(entries[5], "z", fuseutil.DT_File)
+}
+
+func (t *DirHandleTest) ReadDirSeeksBehindWindow() {
+	in := &pagedDirInode{pages: [][]fuseutil.Dirent{
+		{fileEntry("a"), fileEntry("b")},
+		{fileEntry("c")},
+		{fileEntry("d")},
+	}}
+	t.dh = NewDirHandle(in, false, cfg.NameConflictNewline, false)
+	AssertEq(4, len(t.readDirFrom(0, nil)))
+	reads := len(in.reads)
+
+	entries := t.readDirFrom(1, nil)
+
+	AssertEq(3, len(entries))
+	t.validateEntry(entries[0], "b", fuseutil.DT_File)
+	ExpectEq(2, entries[0].Offset)
+	t.validateEntry(entries[2], "d", fuseutil.DT_File)
+	ExpectEq(4, entries[2].Offset)
+	// Only the pages from the one holding offset 1 are read again.
+	ExpectEq(reads+2, len(in.reads))
+}
+
+func (t *DirHandleTest) ReadDirPastEndIsInvalid() {
+	in := &pagedDirInode{pages: [][]fuseutil.Dirent{{fileEntry("a")}}}
+	t.dh = NewDirHandle(in, false, cfg.NameConflictNewline, false)
+	AssertEq(1, len(t.readDirFrom(0, nil)))
+
+	err := t.dh.ReadDir(t.ctx, &fuseops.ReadDirOp{Offset: 2, Dst: make([]byte, 4096)}, nil)
+
+	ExpectEq(fuse.EINVAL, err)
+}
+
+func (t *DirHandleTest) ReadDirReportsStableInodeIDs() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "testDir/foo", nil)
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, "testDir/sub/", nil)
+	AssertEq(nil, err)
+	in := t.dh.in
+	t.dh = NewDirHandle(in, true, cfg.NameConflictNewline, true)
+
+	entries := t.readDirFrom(0, nil)
+
+	AssertEq(2, len(entries))
+	t.validateEntry(entries[0], "foo", fuseutil.DT_File)
+	ExpectEq(inode.StableID(inode.ObjectKey("some_bucket", "testDir/foo")), entries[0].Inode)
+	t.validateEntry(entries[1], "sub", fuseutil.DT_Directory)
+	ExpectEq(inode.StableID(inode.ObjectKey("some_bucket", "testDir/sub/")), entries[1].Inode)
+}
+
+// statCountingBucket counts the objects stat'ed through it.
+type statCountingBucket struct {
+	gcs.Bucket
+	stats int
+}
+
+func (b *statCountingBucket) StatObject(ctx context.Context, req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	b.stats++
+	return b.Bucket.StatObject(ctx, req)
+}
+
+func (t *DirHandleTest) ReadDirPrimesLookUps() {
+	counter := &statCountingBucket{Bucket: fake.NewFakeBucket(&t.clock, "some_bucket", gcs.NonHierarchical)}
+	statCache := metadata.NewStatCacheBucketView(lru.NewCache(1<<20), "")
+	bucket := gcsx.NewSyncerBucket(
+		1, 10, ".gcsfuse_tmp/", caching.NewFastStatBucket(time.Hour, statCache, &t.clock, counter))
+	in := inode.NewDirInode(
+		17,
+		inode.NewDirName(inode.NewRootName(""), "testDir"),
+		fuseops.InodeAttributes{},
+		false, // implicitDirs,
+		true,  // enableManagedFoldersListing
+		false, // enableNonExistentTypeCache
+		time.Hour,
+		&bucket,
+		&t.clock,
+		&t.clock,
+		4,
+		false,
+		cfg.NameConflictNewline)
+	for _, name := range []string{"testDir/foo", "testDir/sub/"} {
+		_, err := storageutil.CreateObject(t.ctx, bucket, name, nil)
+		AssertEq(nil, err)
+	}
+	t.dh = NewDirHandle(in, false, cfg.NameConflictNewline, false)
+	AssertEq(2, len(t.readDirFrom(0, nil)))
+	counter.stats = 0
+
+	// Each page of the listing records the children's types and objects, so
+	// looking them up afterwards needs no stats.
+	in.Lock()
+	defer in.Unlock()
+	for _, name := range []string{"foo", "sub"} {
+		core, err := in.LookUpChild(t.ctx, name)
+		AssertEq(nil, err)
+		ExpectNe(nil, core, name)
+	}
+	ExpectEq(0, counter.stats)
+}
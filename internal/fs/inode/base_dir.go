@@ -15,7 +15,6 @@
 package inode
 
 import (
-	"syscall"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
@@ -62,6 +61,10 @@ type baseDirInode struct {
 	// GUARDED_BY(mu)
 	buckets map[string]gcsx.SyncerBucket
 
+	// If non-nil, the only children, mapped to the names their buckets are set
+	// up with. Otherwise any accessible bucket is a child of the same name.
+	subtrees map[string]string
+
 	metricHandle common.MetricHandle
 }
 
@@ -88,6 +91,27 @@ func NewBaseDirInode(
 	return
 }
 
+// NewOnlyDirsBaseDirInode returns a baseDirInode whose only children are the
+// supplied prefixes of one bucket, keyed by subdirectory name.
+func NewOnlyDirsBaseDirInode(
+	id fuseops.InodeID,
+	name Name,
+	attrs fuseops.InodeAttributes,
+	bm gcsx.BucketManager,
+	bucketName string,
+	prefixes map[string]string,
+	metricHandle common.MetricHandle) (d DirInode) {
+	d = NewBaseDirInode(id, name, attrs, bm, metricHandle)
+
+	typed := d.(*baseDirInode)
+	typed.subtrees = make(map[string]string, len(prefixes))
+	for n, p := range prefixes {
+		typed.subtrees[n] = bucketName + "/" + p
+	}
+
+	return
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Public interface
 ////////////////////////////////////////////////////////////////////////
@@ -157,10 +181,18 @@ func (d *baseDirInode) Attributes(
 
 // LOCKS_REQUIRED(d)
 func (d *baseDirInode) LookUpChild(ctx context.Context, name string) (*Core, error) {
+	bucketName := name
+	if d.subtrees != nil {
+		var ok bool
+		if bucketName, ok = d.subtrees[name]; !ok {
+			return nil, nil
+		}
+	}
+
 	var err error
 	bucket, ok := d.buckets[name]
 	if !ok {
-		bucket, err = d.bucketManager.SetUpBucket(ctx, name, true, d.metricHandle)
+		bucket, err = d.bucketManager.SetUpBucket(ctx, bucketName, true, d.metricHandle)
 		if err != nil {
 			return nil, err
 		}
@@ -183,12 +215,33 @@ func (d *baseDirInode) ReadDescendants(ctx context.Context, limit int) (map[Name
 func (d *baseDirInode) ReadEntries(
 	ctx context.Context,
 	tok string) (entries []fuseutil.Dirent, newTok string, err error) {
+	// A fixed set of subdirectories can be listed cheaply.
+	if d.subtrees != nil {
+		for n := range d.subtrees {
+			entries = append(entries, fuseutil.Dirent{
+				Name: n,
+				Type: fuseutil.DT_Directory,
+			})
+		}
+		return
+	}
 
-	// The subdirectories of the base directory should be all the accessible
-	// buckets. Although the user is allowed to visit each individual
-	// subdirectory, listing all the subdirectories (i.e. the buckets) can be
-	// very expensive and currently not supported.
-	return nil, "", syscall.ENOTSUP
+	// The subdirectories of the base directory are all the accessible buckets,
+	// each of which can be visited by name. Listing them is only supported for
+	// the buckets of a configured project, which the bucket manager caches.
+	names, err := d.bucketManager.ListBuckets(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, n := range names {
+		entries = append(entries, fuseutil.Dirent{
+			Name: n,
+			Type: fuseutil.DT_Directory,
+		})
+	}
+
+	return
 }
 
 ////////////////////////////////////////////////////////////////////////
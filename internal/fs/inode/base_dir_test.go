@@ -17,6 +17,7 @@ package inode
 import (
 	"fmt"
 	"os"
+	"syscall"
 	"testing"
 	"time"
 
@@ -28,6 +29,8 @@ import (
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/ogletest"
 	"github.com/jacobsa/timeutil"
 )
@@ -88,6 +91,9 @@ func (t *BaseDirTest) TearDown() {
 type fakeBucketManager struct {
 	buckets    map[string]gcsx.SyncerBucket
 	setupTimes int
+
+	// The names returned by ListBuckets, if non-nil.
+	listable []string
 }
 
 func (bm *fakeBucketManager) SetUpBucket(
@@ -104,6 +110,13 @@ func (bm *fakeBucketManager) SetUpBucket(
 	return
 }
 
+func (bm *fakeBucketManager) ListBuckets(ctx context.Context) ([]string, error) {
+	if bm.listable == nil {
+		return nil, syscall.ENOTSUP
+	}
+	return bm.listable, nil
+}
+
 func (bm *fakeBucketManager) ShutDown() {}
 
 func (bm *fakeBucketManager) SetUpTimes() int {
@@ -207,6 +220,27 @@ func (t *BaseDirTest) LookUpChild_BucketCached() {
 	ExpectEq(3, t.bm.SetUpTimes())
 }
 
+func (t *BaseDirTest) ReadEntries_NotSupported() {
+	_, _, err := t.in.ReadEntries(t.ctx, "")
+
+	ExpectEq(syscall.ENOTSUP, err)
+}
+
+func (t *BaseDirTest) ReadEntries_ListsBuckets() {
+	t.bm.listable = []string{"bucketA", "bucketB"}
+
+	entries, tok, err := t.in.ReadEntries(t.ctx, "")
+
+	AssertEq(nil, err)
+	ExpectEq("", tok)
+	AssertEq(2, len(entries))
+	ExpectEq("bucketA", entries[0].Name)
+	ExpectEq(fuseutil.DT_Directory, entries[0].Type)
+	ExpectEq("bucketB", entries[1].Name)
+	// Listing doesn't set up the buckets.
+	ExpectEq(0, t.bm.SetUpTimes())
+}
+
 func (t *BaseDirTest) Test_ShouldInvalidateKernelListCache() {
 	ttl := time.Second
 	AssertEq(true, t.in.ShouldInvalidateKernelListCache(ttl))
@@ -218,3 +252,57 @@ func (t *BaseDirTest) Test_ShouldInvalidateKernelListCache_TtlExpired() {
 
 	AssertEq(true, t.in.ShouldInvalidateKernelListCache(ttl))
 }
+
+func (t *BaseDirTest) resetOnlyDirsInode() {
+	t.in.Unlock()
+	t.bm.buckets["bucketA/teams/a"] = t.bm.buckets["bucketA"]
+
+	t.in = NewOnlyDirsBaseDirInode(
+		dirInodeID,
+		NewRootName(""),
+		fuseops.InodeAttributes{
+			Uid:  uid,
+			Gid:  gid,
+			Mode: dirMode,
+		},
+		t.bm,
+		"bucketA",
+		map[string]string{"team-a": "teams/a", "team-b": "teams/b"},
+		common.NewNoopMetrics())
+
+	t.in.Lock()
+}
+
+func (t *BaseDirTest) LookUpChild_OnlyDirs() {
+	t.resetOnlyDirsInode()
+
+	result, err := t.in.LookUpChild(t.ctx, "team-a")
+
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectTrue(result.FullName.IsBucketRoot())
+	ExpectEq(1, t.bm.SetUpTimes())
+
+	// Only the configured directories are children, even if there's a bucket
+	// of the same name.
+	result, err = t.in.LookUpChild(t.ctx, "bucketB")
+
+	AssertEq(nil, err)
+	ExpectEq(nil, result)
+	ExpectEq(1, t.bm.SetUpTimes())
+}
+
+func (t *BaseDirTest) ReadEntries_OnlyDirs() {
+	t.resetOnlyDirsInode()
+
+	entries, tok, err := t.in.ReadEntries(t.ctx, "")
+
+	AssertEq(nil, err)
+	ExpectEq("", tok)
+	AssertEq(2, len(entries))
+	names := []string{entries[0].Name, entries[1].Name}
+	ExpectThat(names, Contains("team-a"))
+	ExpectThat(names, Contains("team-b"))
+	ExpectEq(fuseutil.DT_Directory, entries[0].Type)
+	ExpectEq(0, t.bm.SetUpTimes())
+}
@@ -21,6 +21,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
@@ -50,10 +51,11 @@ type DirInode interface {
 	// Look up the direct child with the given relative name, returning
 	// information about the object backing the child or whether it exists as an
 	// implicit directory. If a file/symlink and a directory with the given name
-	// both exist, the directory is preferred. Return nil result and a nil error
+	// both exist, the directory is preferred unless the inode was created with
+	// the cfg.NameConflictPreferFile strategy. Return nil result and a nil error
 	// if neither is found.
 	//
-	// Special case: if the name ends in ConflictingFileNameSuffix, we strip the
+	// Special case: if the name ends in the strategy's FileSuffix, we strip the
 	// suffix, confirm that a conflicting directory exists, then return a result
 	// for the file/symlink.
 	//
@@ -222,6 +224,9 @@ type dirInode struct {
 	prevDirListingTimeStamp time.Time
 	isHNSEnabled            bool
 
+	// How a file/symlink and a directory with conflicting names are exposed.
+	nameConflictStrategy NameConflictStrategy
+
 	// Represents if folder has been unlinked in hierarchical bucket. This is not getting used in
 	// non-hierarchical bucket.
 	unlinked bool
@@ -245,6 +250,9 @@ var _ DirInode = &dirInode{}
 // child is removed and recreated with a different type before the expiration,
 // we may fail to find it.
 //
+// nameConflictStrategy controls which of a file/symlink and a directory with
+// conflicting names LookUpChild returns. See NameConflictStrategy.
+//
 // The initial lookup count is zero.
 //
 // REQUIRES: name.IsDir()
@@ -261,6 +269,7 @@ func NewDirInode(
 	cacheClock timeutil.Clock,
 	typeCacheMaxSizeMB int64,
 	isHNSEnabled bool,
+	nameConflictStrategy NameConflictStrategy,
 ) (d DirInode) {
 
 	if !name.IsDir() {
@@ -279,6 +288,7 @@ func NewDirInode(
 		attrs:                      attrs,
 		cache:                      metadata.NewTypeCache(typeCacheMaxSizeMB, typeCacheTTL),
 		isHNSEnabled:               isHNSEnabled,
+		nameConflictStrategy:       nameConflictStrategy,
 		unlinked:                   false,
 	}
 
@@ -322,9 +332,9 @@ func (d *dirInode) lookUpChildDir(ctx context.Context, name string) (*Core, erro
 // the default behavior. If the file doesn't exist, return a nil record with a
 // nil error. If the directory doesn't exist, pretend the file doesn't exist.
 //
-// REQUIRES: strings.HasSuffix(name, ConflictingFileNameSuffix)
-func (d *dirInode) lookUpConflicting(ctx context.Context, name string) (*Core, error) {
-	strippedName := strings.TrimSuffix(name, ConflictingFileNameSuffix)
+// REQUIRES: strings.HasSuffix(name, suffix)
+func (d *dirInode) lookUpConflicting(ctx context.Context, name string, suffix string) (*Core, error) {
+	strippedName := strings.TrimSuffix(name, suffix)
 
 	// In order to a marked name to be accepted, we require the conflicting
 	// directory to exist.
@@ -529,11 +539,46 @@ func (d *dirInode) Bucket() *gcsx.SyncerBucket {
 // See also the notes on DirInode.LookUpChild.
 const ConflictingFileNameSuffix = "\n"
 
+// A readable suffix used instead of ConflictingFileNameSuffix by the
+// cfg.NameConflictMarker strategy. Object names may end in it too, so a name
+// carrying it refers to the conflicting file/symlink only if the directory
+// exists.
+const ConflictingFileNameMarker = ".gcsfuse-file"
+
+// NameConflictStrategy is one of the cfg.NameConflict* values, saying how a
+// file/symlink and a directory with conflicting object names (e.g. "foo" and
+// "foo/") are exposed. The empty value behaves like cfg.NameConflictNewline.
+type NameConflictStrategy string
+
+// FileSuffix returns the suffix under which the file/symlink of a conflicting
+// pair is exposed, or "" if the strategy hides one of them.
+func (s NameConflictStrategy) FileSuffix() string {
+	switch s {
+	case cfg.NameConflictMarker:
+		return ConflictingFileNameMarker
+	case cfg.NameConflictPreferDir, cfg.NameConflictPreferFile:
+		return ""
+	default:
+		return ConflictingFileNameSuffix
+	}
+}
+
+// PrefersFile reports whether the unsuffixed name of a conflicting pair
+// refers to the file/symlink rather than the directory.
+func (s NameConflictStrategy) PrefersFile() bool {
+	return s == cfg.NameConflictPreferFile
+}
+
 // LOCKS_REQUIRED(d)
 func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error) {
 	// Is this a conflict marker name?
-	if strings.HasSuffix(name, ConflictingFileNameSuffix) {
-		return d.lookUpConflicting(ctx, name)
+	if suffix := d.nameConflictStrategy.FileSuffix(); suffix != "" && strings.HasSuffix(name, suffix) {
+		result, err := d.lookUpConflicting(ctx, name, suffix)
+		// Unlike a newline, the marker may end a real object name, which is
+		// looked up as usual when it doesn't name a conflicting file.
+		if err != nil || result != nil || suffix == ConflictingFileNameSuffix {
+			return result, err
+		}
 	}
 
 	group, ctx := errgroup.WithContext(ctx)
@@ -594,7 +639,7 @@ func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error)
 	}
 
 	var result *Core
-	if dirResult != nil {
+	if dirResult != nil && (fileResult == nil || !d.nameConflictStrategy.PrefersFile()) {
 		result = dirResult
 	} else if fileResult != nil {
 		result = fileResult
@@ -684,9 +729,16 @@ func (d *dirInode) readObjects(
 
 	cores = make(map[Name]*Core)
 	defer func() {
+		// Insert the type that LookUpChild prefers last, so that it wins when a
+		// file and a directory share a name.
 		now := d.cacheClock.Now()
-		for fullName, c := range cores {
-			d.cache.Insert(now, path.Base(fullName.LocalName()), c.Type())
+		preferDirs := !d.nameConflictStrategy.PrefersFile()
+		for _, preferred := range []bool{false, true} {
+			for fullName, c := range cores {
+				if (fullName.IsDir() == preferDirs) == preferred {
+					d.cache.Insert(now, path.Base(fullName.LocalName()), c.Type())
+				}
+			}
 		}
 	}()
 
@@ -123,6 +123,7 @@ func (t *DirTest) resetInodeWithTypeCacheConfigs(implicitDirs, enableNonexistent
 		&t.clock,
 		typeCacheMaxSizeMB,
 		false,
+		cfg.NameConflictNewline,
 	)
 
 	d := t.in.(*dirInode)
@@ -151,6 +152,7 @@ func (t *DirTest) createDirInode(dirInodeName string) DirInode {
 		&t.clock,
 		4,
 		false,
+		cfg.NameConflictNewline,
 	)
 }
 
@@ -408,6 +410,100 @@ func (t *DirTest) LookUpChild_FileAndDir() {
 	ExpectEq(fileObj.Size, result.MinObject.Size)
 }
 
+func (t *DirTest) LookUpChild_FileAndDir_MarkerStrategy() {
+	const name = "qux"
+	fileObjName := path.Join(dirInodeName, name)
+	dirObjName := path.Join(dirInodeName, name) + "/"
+	markedObjName := path.Join(dirInodeName, "taco") + ConflictingFileNameMarker
+	t.in.(*dirInode).nameConflictStrategy = cfg.NameConflictMarker
+
+	// Create backing objects.
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, fileObjName, []byte("taco"))
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, dirObjName, []byte(""))
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, markedObjName, []byte("burrito"))
+	AssertEq(nil, err)
+
+	// The proper name refers to the directory.
+	result, err := t.in.LookUpChild(t.ctx, name)
+
+	AssertEq(nil, err)
+	ExpectEq(dirObjName, result.FullName.GcsObjectName())
+
+	// The marker name refers to the file.
+	result, err = t.in.LookUpChild(t.ctx, name+ConflictingFileNameMarker)
+
+	AssertEq(nil, err)
+	ExpectEq(fileObjName, result.FullName.GcsObjectName())
+
+	// An object whose name ends in the marker, without a conflicting
+	// directory, is found under its own name.
+	result, err = t.in.LookUpChild(t.ctx, "taco"+ConflictingFileNameMarker)
+
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(markedObjName, result.FullName.GcsObjectName())
+
+	// The newline suffix isn't special.
+	result, err = t.in.LookUpChild(t.ctx, name+ConflictingFileNameSuffix)
+
+	AssertEq(nil, err)
+	ExpectEq(nil, result)
+}
+
+func (t *DirTest) LookUpChild_FileAndDir_PreferFileStrategy() {
+	const name = "qux"
+	fileObjName := path.Join(dirInodeName, name)
+	dirObjName := path.Join(dirInodeName, name) + "/"
+	t.in.(*dirInode).nameConflictStrategy = cfg.NameConflictPreferFile
+
+	// Create backing objects.
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, fileObjName, []byte("taco"))
+	AssertEq(nil, err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, dirObjName, []byte(""))
+	AssertEq(nil, err)
+
+	// The proper name refers to the file.
+	result, err := t.in.LookUpChild(t.ctx, name)
+
+	AssertEq(nil, err)
+	ExpectEq(metadata.RegularFileType, t.getTypeFromCache(name))
+	ExpectEq(fileObjName, result.FullName.GcsObjectName())
+
+	// There is no name for the directory.
+	result, err = t.in.LookUpChild(t.ctx, name+ConflictingFileNameSuffix)
+
+	AssertEq(nil, err)
+	ExpectEq(nil, result)
+}
+
+func (t *DirTest) ReadEntries_FileAndDir_CachesPreferredType() {
+	const name = "qux"
+	err := storageutil.CreateObjects(t.ctx, t.bucket, map[string][]byte{
+		path.Join(dirInodeName, name):       []byte("taco"),
+		path.Join(dirInodeName, name) + "/": []byte(""),
+	})
+	AssertEq(nil, err)
+
+	for _, tc := range []struct {
+		strategy NameConflictStrategy
+		want     metadata.Type
+	}{
+		{cfg.NameConflictNewline, metadata.ExplicitDirType},
+		{cfg.NameConflictPreferDir, metadata.ExplicitDirType},
+		{cfg.NameConflictPreferFile, metadata.RegularFileType},
+	} {
+		t.resetInode(false, false, true)
+		t.in.(*dirInode).nameConflictStrategy = tc.strategy
+
+		_, _, err = t.in.ReadEntries(t.ctx, "")
+
+		AssertEq(nil, err)
+		ExpectEq(tc.want, t.getTypeFromCache(name), "strategy %q", tc.strategy)
+	}
+}
+
 func (t *DirTest) LookUpChild_SymlinkAndDir() {
 	const name = "qux"
 	linkObjName := path.Join(dirInodeName, name)
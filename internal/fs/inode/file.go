@@ -20,6 +20,7 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
@@ -716,6 +717,35 @@ func (f *FileInode) Truncate(
 	return
 }
 
+// Fallocate allocates, punches out or zeroes a range of the file, with the
+// semantics of fallocate(2).
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) Fallocate(
+	ctx context.Context,
+	mode uint32,
+	offset int64,
+	length int64) (err error) {
+	// Buffered writes stream the content straight to GCS, so there is no local
+	// copy to allocate into.
+	if f.bwh != nil {
+		err = syscall.ENOTSUP
+		return
+	}
+
+	// Make sure f.content != nil.
+	err = f.ensureContent(ctx)
+	if err != nil {
+		err = fmt.Errorf("ensureContent: %w", err)
+		return
+	}
+
+	// Call through.
+	err = f.content.Fallocate(mode, offset, length)
+
+	return
+}
+
 // Ensures cache content on read if content cache enabled
 func (f *FileInode) CacheEnsureContent(ctx context.Context) (err error) {
 	if f.localFileCache {
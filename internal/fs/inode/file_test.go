@@ -35,6 +35,7 @@ import (
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/net/context"
 	"golang.org/x/sync/semaphore"
+	"golang.org/x/sys/unix"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
@@ -624,6 +625,23 @@ func (t *FileTest) TestTruncateUpwardThenSync() {
 	assert.Equal(t.T(), attrs.Mtime, truncateTime.UTC())
 }
 
+func (t *FileTest) TestFallocateThenSync() {
+	// Punch out the middle of the file and preallocate past its end.
+	err := t.in.Fallocate(t.ctx, unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, 1, 2)
+	assert.Nil(t.T(), err)
+	err = t.in.Fallocate(t.ctx, 0, 4, 2)
+	assert.Nil(t.T(), err)
+
+	// Sync.
+	err = t.in.Sync(t.ctx)
+	assert.Nil(t.T(), err)
+
+	// The holes should have been uploaded as zeros.
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, t.in.Name().GcsObjectName())
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "t\x00\x00o\x00\x00", string(contents))
+}
+
 func (t *FileTest) TestTruncateUpwardForLocalFileShouldUpdateLocalFileAttributes() {
 	var err error
 	var attrs fuseops.InodeAttributes
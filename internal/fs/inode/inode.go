@@ -15,6 +15,8 @@
 package inode
 
 import (
+	"fmt"
+	"hash/fnv"
 	"sync"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
@@ -57,6 +59,25 @@ type Inode interface {
 	Destroy() (err error)
 }
 
+// StableID derives an inode ID from a key saying what the inode stands for,
+// such as one made by ObjectKey. It is never the root inode's ID.
+func StableID(key string) fuseops.InodeID {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	id := fuseops.InodeID(h.Sum64())
+	if id <= fuseops.RootInodeID {
+		id = fuseops.RootInodeID + 1
+	}
+	return id
+}
+
+// ObjectKey returns the StableID key of the named object of the named bucket.
+// Bucket names of views of a prefix contain a slash, so the bucket name is
+// prefixed by its length to keep the key unambiguous.
+func ObjectKey(bucketName, objectName string) string {
+	return fmt.Sprintf("%d:%s/%s", len(bucketName), bucketName, objectName)
+}
+
 // An inode owned by a gcs bucket.
 type BucketOwnedInode interface {
 	Inode
@@ -0,0 +1,450 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"golang.org/x/net/context"
+)
+
+// The name of the virtual directory, present in each directory of the bucket
+// when enabled, through which the generations of the files in that directory
+// can be browsed.
+const VersionsDirName = ".gcsfuse-versions"
+
+// A read-only directory listing the generations of objects in a bucket with
+// object versioning enabled. Such directories come in two flavours:
+//
+//   - dir/.gcsfuse-versions/ holds a subdirectory for each file in dir that
+//     has at least one generation, live or noncurrent.
+//   - dir/.gcsfuse-versions/file/ holds an entry for each generation of
+//     dir/file, named after the generation number.
+type VersionsDirInode interface {
+	BucketOwnedDirInode
+
+	// The directory whose files are being browsed. Does not require the lock.
+	Dir() Name
+
+	// The name of the object whose generations are listed, or the empty string
+	// for the top-level directory that lists files. Does not require the lock.
+	ObjectName() string
+}
+
+type versionsDirInode struct {
+	/////////////////////////
+	// Dependencies
+	/////////////////////////
+
+	bucket *gcsx.SyncerBucket
+
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	id fuseops.InodeID
+
+	// INVARIANT: name.IsDir()
+	name Name
+
+	// INVARIANT: dir.IsDir()
+	dir Name
+
+	// INVARIANT: objectName == "" || dir is the parent of objectName
+	objectName string
+
+	attrs fuseops.InodeAttributes
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	// A mutex that must be held when calling certain methods. See documentation
+	// for each method.
+	mu locker.RWLocker
+
+	// GUARDED_BY(mu)
+	lc lookupCount
+}
+
+var _ VersionsDirInode = &versionsDirInode{}
+
+// NewVersionsDirInode returns a directory named name that lists the files in
+// dir having generations in the bucket, or, if objectName is non-empty, the
+// generations of that object.
+//
+// REQUIRES: name.IsDir()
+// REQUIRES: dir.IsDir()
+func NewVersionsDirInode(
+	id fuseops.InodeID,
+	name Name,
+	dir Name,
+	objectName string,
+	attrs fuseops.InodeAttributes,
+	bucket *gcsx.SyncerBucket) (d VersionsDirInode) {
+	if !name.IsDir() || !dir.IsDir() {
+		panic(fmt.Sprintf("Unexpected names: %s, %s", name, dir))
+	}
+
+	typed := &versionsDirInode{
+		bucket:     bucket,
+		id:         id,
+		name:       name,
+		dir:        dir,
+		objectName: objectName,
+		attrs:      attrs,
+	}
+
+	typed.lc.Init(id)
+	typed.mu = locker.NewRW("VersionsDirInode"+name.GcsObjectName(), typed.checkInvariants)
+
+	d = typed
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+func (d *versionsDirInode) checkInvariants() {
+	// INVARIANT: name.IsDir()
+	if !d.name.IsDir() {
+		panic(fmt.Sprintf("Unexpected name: %s", d.name))
+	}
+
+	// INVARIANT: dir.IsDir()
+	if !d.dir.IsDir() {
+		panic(fmt.Sprintf("Unexpected dir: %s", d.dir))
+	}
+
+	// INVARIANT: objectName == "" || dir is the parent of objectName
+	if d.objectName != "" && !NewDescendantName(d.dir, d.objectName).IsDirectChildOf(d.dir) {
+		panic(fmt.Sprintf("Object %q is not in %s", d.objectName, d.dir))
+	}
+}
+
+// List every generation of the objects whose names begin with prefix, not
+// descending into subdirectories.
+func (d *versionsDirInode) listGenerations(
+	ctx context.Context,
+	prefix string) (objects []*gcs.MinObject, err error) {
+	req := &gcs.ListObjectsRequest{
+		Prefix:        prefix,
+		Delimiter:     "/",
+		Versions:      true,
+		MaxResults:    MaxResultsForListObjectsCall,
+		ProjectionVal: gcs.NoAcl,
+	}
+
+	for {
+		var listing *gcs.Listing
+		listing, err = d.bucket.ListObjects(ctx, req)
+		if err != nil {
+			err = fmt.Errorf("ListObjects: %w", err)
+			return
+		}
+
+		objects = append(objects, listing.MinObjects...)
+
+		if listing.ContinuationToken == "" {
+			return
+		}
+		req.ContinuationToken = listing.ContinuationToken
+	}
+}
+
+// List the generations of d.objectName, in increasing order.
+func (d *versionsDirInode) objectGenerations(ctx context.Context) (gens []*gcs.MinObject, err error) {
+	objects, err := d.listGenerations(ctx, d.objectName)
+	if err != nil {
+		return
+	}
+
+	// The prefix also matches longer names, such as "foobar" for "foo".
+	for _, o := range objects {
+		if o.Name == d.objectName {
+			gens = append(gens, o)
+		}
+	}
+
+	return
+}
+
+// The name of a file in d.dir that objects listed under d.dir have, or the
+// empty string if the object stands for a directory.
+func (d *versionsDirInode) fileName(o *gcs.MinObject) string {
+	if o.Name == "" || strings.HasSuffix(o.Name, "/") {
+		return ""
+	}
+
+	return path.Base(o.Name)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Public interface
+////////////////////////////////////////////////////////////////////////
+
+func (d *versionsDirInode) Lock() {
+	d.mu.Lock()
+}
+
+func (d *versionsDirInode) Unlock() {
+	d.mu.Unlock()
+}
+
+func (d *versionsDirInode) RLock() {
+	d.mu.RLock()
+}
+
+func (d *versionsDirInode) RUnlock() {
+	d.mu.RUnlock()
+}
+
+// LockForChildLookup takes a read-only lock, since looking up a child does not
+// modify the inode.
+func (d *versionsDirInode) LockForChildLookup() {
+	d.mu.RLock()
+}
+
+func (d *versionsDirInode) UnlockForChildLookup() {
+	d.mu.RUnlock()
+}
+
+func (d *versionsDirInode) ID() fuseops.InodeID {
+	return d.id
+}
+
+func (d *versionsDirInode) Name() Name {
+	return d.name
+}
+
+func (d *versionsDirInode) Dir() Name {
+	return d.dir
+}
+
+func (d *versionsDirInode) ObjectName() string {
+	return d.objectName
+}
+
+func (d *versionsDirInode) Bucket() *gcsx.SyncerBucket {
+	return d.bucket
+}
+
+// LOCKS_REQUIRED(d)
+func (d *versionsDirInode) IncrementLookupCount() {
+	d.lc.Inc()
+}
+
+// LOCKS_REQUIRED(d)
+func (d *versionsDirInode) DecrementLookupCount(n uint64) (destroy bool) {
+	destroy = d.lc.Dec(n)
+	return
+}
+
+// LOCKS_REQUIRED(d)
+func (d *versionsDirInode) Destroy() (err error) {
+	// Nothing interesting to do.
+	return
+}
+
+// LOCKS_REQUIRED(d)
+func (d *versionsDirInode) Attributes(
+	ctx context.Context) (attrs fuseops.InodeAttributes, err error) {
+	attrs = d.attrs
+	attrs.Nlink = 1
+
+	return
+}
+
+// Look up a file of d.dir at the top level, returning a directory for its
+// generations, or a generation of d.objectName, returning the object backing
+// it. The full name of a generation is that of the live file it belongs to.
+//
+// LOCKS_REQUIRED(d)
+func (d *versionsDirInode) LookUpChild(ctx context.Context, name string) (*Core, error) {
+	if d.objectName == "" {
+		objects, err := d.listGenerations(ctx, NewFileName(d.dir, name).GcsObjectName())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range objects {
+			if d.fileName(o) == name {
+				return &Core{
+					Bucket:   d.Bucket(),
+					FullName: NewDirName(d.name, name),
+				}, nil
+			}
+		}
+
+		return nil, nil
+	}
+
+	generation, err := strconv.ParseInt(name, 10, 64)
+	if err != nil || strconv.FormatInt(generation, 10) != name {
+		return nil, nil
+	}
+
+	gens, err := d.objectGenerations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range gens {
+		if o.Generation == generation {
+			return &Core{
+				Bucket:    d.Bucket(),
+				FullName:  NewDescendantName(d.dir, o.Name),
+				MinObject: o,
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Not implemented
+func (d *versionsDirInode) ReadDescendants(ctx context.Context, limit int) (map[Name]*Core, error) {
+	return nil, syscall.ENOTSUP
+}
+
+// Read all entries in one go, since a name may recur across pages of a
+// listing of generations.
+//
+// LOCKS_REQUIRED(d)
+func (d *versionsDirInode) ReadEntries(
+	ctx context.Context,
+	tok string) (entries []fuseutil.Dirent, newTok string, err error) {
+	if d.objectName == "" {
+		var objects []*gcs.MinObject
+		objects, err = d.listGenerations(ctx, d.dir.GcsObjectName())
+		if err != nil {
+			return
+		}
+
+		seen := make(map[string]bool)
+		for _, o := range objects {
+			name := d.fileName(o)
+			if name == "" || seen[name] {
+				continue
+			}
+
+			seen[name] = true
+			entries = append(entries, fuseutil.Dirent{
+				Name: name,
+				Type: fuseutil.DT_Directory,
+			})
+		}
+
+		return
+	}
+
+	gens, err := d.objectGenerations(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, o := range gens {
+		entries = append(entries, fuseutil.Dirent{
+			Name: strconv.FormatInt(o.Generation, 10),
+			Type: fuseutil.DT_File,
+		})
+	}
+
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Forbidden Public interface
+////////////////////////////////////////////////////////////////////////
+
+// Generations can't be modified, so mutating the directory fails with EROFS.
+// A generation is restored by the file system renaming it over a live file.
+
+func (d *versionsDirInode) CreateChildFile(ctx context.Context, name string) (*Core, error) {
+	return nil, syscall.EROFS
+}
+
+func (d *versionsDirInode) InsertFileIntoTypeCache(_ string) {}
+
+func (d *versionsDirInode) EraseFromTypeCache(_ string) {}
+
+func (d *versionsDirInode) CreateLocalChildFileCore(_ string) (Core, error) {
+	return Core{}, syscall.EROFS
+}
+
+func (d *versionsDirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject) (*Core, error) {
+	return nil, syscall.EROFS
+}
+
+func (d *versionsDirInode) CreateChildSymlink(ctx context.Context, name string, target string) (*Core, error) {
+	return nil, syscall.EROFS
+}
+
+func (d *versionsDirInode) CreateChildDir(ctx context.Context, name string) (*Core, error) {
+	return nil, syscall.EROFS
+}
+
+func (d *versionsDirInode) DeleteChildFile(
+	ctx context.Context,
+	name string,
+	generation int64,
+	metaGeneration *int64) (err error) {
+	err = syscall.EROFS
+	return
+}
+
+func (d *versionsDirInode) DeleteChildDir(
+	ctx context.Context,
+	name string,
+	isImplicitDir bool,
+	dirInode DirInode) (err error) {
+	err = syscall.EROFS
+	return
+}
+
+func (d *versionsDirInode) LocalFileEntries(localFileInodes map[Name]Inode) (localEntries map[string]fuseutil.Dirent) {
+	// Generations are never local.
+	return nil
+}
+
+func (d *versionsDirInode) ShouldInvalidateKernelListCache(ttl time.Duration) bool {
+	// New generations may appear at any time.
+	return true
+}
+
+func (d *versionsDirInode) InvalidateKernelListCache() {}
+
+func (d *versionsDirInode) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (op *gcs.Folder, err error) {
+	err = syscall.EROFS
+	return
+}
+
+func (d *versionsDirInode) IsUnlinked() bool {
+	return false
+}
+
+func (d *versionsDirInode) Unlink() {
+}
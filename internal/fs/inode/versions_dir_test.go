@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"path"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type VersionsDirTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcsx.SyncerBucket
+	dir    Name
+}
+
+func TestVersionsDirTestSuite(t *testing.T) {
+	suite.Run(t, new(VersionsDirTest))
+}
+
+func (t *VersionsDirTest) SetupTest() {
+	t.ctx = context.Background()
+	clock := &timeutil.SimulatedClock{}
+	clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	t.bucket = gcsx.NewSyncerBucket(
+		1, // Append threshold
+		ChunkTransferTimeoutSecs,
+		".gcsfuse_tmp/",
+		fake.NewFakeVersionedBucket(clock, "some_bucket", gcs.NonHierarchical))
+	t.dir = NewDirName(NewRootName(""), "dir")
+}
+
+func (t *VersionsDirTest) newInode(objectName string) VersionsDirInode {
+	name := NewDirName(t.dir, VersionsDirName)
+	if objectName != "" {
+		name = NewDirName(name, path.Base(objectName))
+	}
+
+	in := NewVersionsDirInode(fuseops.RootInodeID+1, name, t.dir, objectName, fuseops.InodeAttributes{}, &t.bucket)
+	in.Lock()
+	t.T().Cleanup(in.Unlock)
+	return in
+}
+
+func (t *VersionsDirTest) create(name, contents string) *gcs.Object {
+	o, err := storageutil.CreateObject(t.ctx, &t.bucket, name, []byte(contents))
+	require.NoError(t.T(), err)
+	return o
+}
+
+func (t *VersionsDirTest) TestReadEntriesListsFilesOnce() {
+	t.create("dir/foo", "taco")
+	t.create("dir/foo", "burrito")
+	t.create("dir/bar", "enchilada")
+	t.create("dir/sub/baz", "queso")
+	t.create("other", "salsa")
+	in := t.newInode("")
+
+	entries, tok, err := in.ReadEntries(t.ctx, "")
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "", tok)
+	assert.Equal(t.T(), []fuseutil.Dirent{
+		{Name: "bar", Type: fuseutil.DT_Directory},
+		{Name: "foo", Type: fuseutil.DT_Directory},
+	}, entries)
+}
+
+func (t *VersionsDirTest) TestReadEntriesListsGenerations() {
+	o1 := t.create("dir/foo", "taco")
+	o2 := t.create("dir/foo", "burrito")
+	t.create("dir/foobar", "enchilada")
+	in := t.newInode("dir/foo")
+
+	entries, _, err := in.ReadEntries(t.ctx, "")
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), []fuseutil.Dirent{
+		{Name: strconv.FormatInt(o1.Generation, 10), Type: fuseutil.DT_File},
+		{Name: strconv.FormatInt(o2.Generation, 10), Type: fuseutil.DT_File},
+	}, entries)
+}
+
+func (t *VersionsDirTest) TestLookUpFile() {
+	t.create("dir/foo", "taco")
+	in := t.newInode("")
+
+	core, err := in.LookUpChild(t.ctx, "foo")
+
+	require.NoError(t.T(), err)
+	require.NotNil(t.T(), core)
+	assert.Equal(t.T(), "dir/.gcsfuse-versions/foo/", core.FullName.GcsObjectName())
+	assert.Nil(t.T(), core.MinObject)
+}
+
+func (t *VersionsDirTest) TestLookUpMissingFile() {
+	t.create("dir/foobar", "taco")
+	in := t.newInode("")
+
+	core, err := in.LookUpChild(t.ctx, "foo")
+
+	require.NoError(t.T(), err)
+	assert.Nil(t.T(), core)
+}
+
+func (t *VersionsDirTest) TestLookUpGeneration() {
+	o1 := t.create("dir/foo", "taco")
+	t.create("dir/foo", "burrito")
+	in := t.newInode("dir/foo")
+
+	core, err := in.LookUpChild(t.ctx, strconv.FormatInt(o1.Generation, 10))
+
+	require.NoError(t.T(), err)
+	require.NotNil(t.T(), core)
+	assert.Equal(t.T(), "dir/foo", core.FullName.GcsObjectName())
+	assert.Equal(t.T(), o1.Generation, core.MinObject.Generation)
+	assert.NoError(t.T(), core.SanityCheck())
+}
+
+func (t *VersionsDirTest) TestLookUpInvalidGeneration() {
+	t.create("dir/foo", "taco")
+	in := t.newInode("dir/foo")
+
+	for _, name := range []string{"17", "taco", "01"} {
+		core, err := in.LookUpChild(t.ctx, name)
+
+		require.NoError(t.T(), err)
+		assert.Nil(t.T(), core, name)
+	}
+}
+
+func (t *VersionsDirTest) TestMutationsAreRejected() {
+	in := t.newInode("dir/foo")
+
+	_, err := in.CreateChildFile(t.ctx, "bar")
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	err = in.DeleteChildFile(t.ctx, "1", 0, nil)
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+}
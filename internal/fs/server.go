@@ -31,6 +31,9 @@ func NewServer(ctx context.Context, cfg *ServerConfig) (fuse.Server, error) {
 		return nil, fmt.Errorf("create file system: %w", err)
 	}
 
+	if cfg.NewConfig.GcsConnection.ExperimentalFairShareBy != "" {
+		fs = wrappers.WithCallers(fs)
+	}
 	fs = wrappers.WithErrorMapping(fs, cfg.NewConfig.FileSystem.PreconditionErrors)
 	if newcfg.IsTracingEnabled(cfg.NewConfig) {
 		fs = wrappers.WithTracing(fs)
@@ -0,0 +1,121 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for inode numbers derived from object names.
+
+package fs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	. "github.com/jacobsa/ogletest"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type StableInodeIDsTest struct {
+	fsTest
+}
+
+func init() {
+	RegisterTestSuite(&StableInodeIDsTest{})
+}
+
+func (t *StableInodeIDsTest) SetUpTestSuite() {
+	t.serverCfg.NewConfig = &cfg.Config{
+		FileCache: defaultFileCacheConfig(),
+		MetadataCache: cfg.MetadataCacheConfig{
+			TypeCacheMaxSizeMb: 4,
+		},
+		FileSystem: cfg.FileSystemConfig{
+			ExperimentalEnableStableInodeIds: true,
+		},
+	}
+	t.fsTest.SetUpTestSuite()
+}
+
+func stableInodeID(objectName string) uint64 {
+	return uint64(inode.StableID(inode.ObjectKey("some_bucket", objectName)))
+}
+
+// Return the inode numbers reported by readdir for the entries of the
+// directory, other than "." and "..".
+func direntInodeNumbers(dir string) map[string]uint64 {
+	f, err := os.Open(dir)
+	AssertEq(nil, err)
+	defer f.Close()
+
+	buf := make([]byte, 4096)
+	n, err := syscall.Getdents(int(f.Fd()), buf)
+	AssertEq(nil, err)
+
+	// Each record is a struct linux_dirent64.
+	inos := make(map[string]uint64)
+	for off := 0; off < n; {
+		reclen := int(binary.NativeEndian.Uint16(buf[off+16:]))
+		name := buf[off+19 : off+reclen]
+		name = name[:bytes.IndexByte(name, 0)]
+		if string(name) != "." && string(name) != ".." {
+			inos[string(name)] = binary.NativeEndian.Uint64(buf[off:])
+		}
+		off += reclen
+	}
+
+	return inos
+}
+
+func (t *StableInodeIDsTest) inodeNumber(name string) uint64 {
+	fi, err := os.Stat(path.Join(mntDir, name))
+	AssertEq(nil, err)
+	return fi.Sys().(*syscall.Stat_t).Ino
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *StableInodeIDsTest) InodeNumbersDerivedFromObjectNames() {
+	err := storageutil.CreateObjects(ctx, bucket, map[string][]byte{
+		"foo":     []byte("taco"),
+		"dir/":    nil,
+		"dir/bar": []byte("burrito"),
+	})
+	AssertEq(nil, err)
+
+	ExpectEq(stableInodeID("dir/bar"), t.inodeNumber("dir/bar"))
+	ExpectEq(stableInodeID("dir/"), t.inodeNumber("dir"))
+	ExpectEq(stableInodeID("foo"), t.inodeNumber("foo"))
+}
+
+func (t *StableInodeIDsTest) ReadDirReportsInodeNumbers() {
+	err := storageutil.CreateObjects(ctx, bucket, map[string][]byte{
+		"foo":  []byte("taco"),
+		"dir/": nil,
+	})
+	AssertEq(nil, err)
+
+	inos := direntInodeNumbers(mntDir)
+	AssertEq(2, len(inos))
+	ExpectEq(t.inodeNumber("foo"), inos["foo"])
+	ExpectEq(t.inodeNumber("dir"), inos["dir"])
+}
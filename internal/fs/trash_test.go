@@ -0,0 +1,169 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for moving removed files and directories to the trash.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fusetesting"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+const trashPrefix = ".gcsfuse-trash/"
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type TrashTest struct {
+	fsTest
+}
+
+func init() {
+	RegisterTestSuite(&TrashTest{})
+}
+
+func (t *TrashTest) SetUpTestSuite() {
+	// The bucket manager hides the trash from the bucket root in production.
+	bucket = gcsx.NewHidingBucket(
+		trashPrefix,
+		fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical))
+	t.serverCfg.NewConfig = &cfg.Config{
+		FileCache: defaultFileCacheConfig(),
+		MetadataCache: cfg.MetadataCacheConfig{
+			TypeCacheMaxSizeMb: 4,
+		},
+		FileSystem: cfg.FileSystemConfig{
+			ExperimentalEnableTrash:    true,
+			ExperimentalTrashPrefix:    trashPrefix,
+			ExperimentalTrashRetention: time.Hour,
+		},
+	}
+	t.fsTest.SetUpTestSuite()
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *TrashTest) UnlinkMovesToTrash() {
+	_, err := storageutil.CreateObject(ctx, bucket, "unlinked", []byte("taco"))
+	AssertEq(nil, err)
+
+	err = os.Remove(path.Join(mntDir, "unlinked"))
+	AssertEq(nil, err)
+
+	_, err = storageutil.ReadObject(ctx, bucket, "unlinked")
+	ExpectThat(err, HasSameTypeAs(&gcs.NotFoundError{}))
+
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: trashPrefix + "unlinked"})
+	AssertEq(nil, err)
+	ExpectEq("unlinked", m.Metadata[gcsx.TrashOriginalNameMetadataKey])
+
+	contents, err := os.ReadFile(path.Join(mntDir, ".trash/unlinked"))
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+}
+
+func (t *TrashTest) TrashKeepsPath() {
+	_, err := storageutil.CreateObject(ctx, bucket, "nested/dir/file", []byte("taco"))
+	AssertEq(nil, err)
+
+	err = os.Remove(path.Join(mntDir, "nested/dir/file"))
+	AssertEq(nil, err)
+
+	// Parents in the trash are listed even without implicit directories.
+	entries, err := fusetesting.ReadDirPicky(path.Join(mntDir, ".trash/nested/dir"))
+	AssertEq(nil, err)
+	AssertEq(1, len(entries))
+	ExpectEq("file", entries[0].Name())
+}
+
+func (t *TrashTest) RmDirMovesToTrash() {
+	err := os.Mkdir(path.Join(mntDir, "removed"), 0700)
+	AssertEq(nil, err)
+
+	err = os.Remove(path.Join(mntDir, "removed"))
+	AssertEq(nil, err)
+
+	fi, err := os.Stat(path.Join(mntDir, ".trash/removed"))
+	AssertEq(nil, err)
+	ExpectTrue(fi.IsDir())
+}
+
+func (t *TrashTest) RemovingFromTrashIsPermanent() {
+	_, err := storageutil.CreateObject(ctx, bucket, "twice", []byte("taco"))
+	AssertEq(nil, err)
+	err = os.Remove(path.Join(mntDir, "twice"))
+	AssertEq(nil, err)
+
+	err = os.Remove(path.Join(mntDir, ".trash/twice"))
+	AssertEq(nil, err)
+
+	l, err := bucket.ListObjects(ctx, &gcs.ListObjectsRequest{Prefix: trashPrefix + "twice"})
+	AssertEq(nil, err)
+	ExpectEq(0, len(l.MinObjects))
+}
+
+func (t *TrashTest) RestoreByRename() {
+	_, err := storageutil.CreateObject(ctx, bucket, "restored", []byte("taco"))
+	AssertEq(nil, err)
+	err = os.Remove(path.Join(mntDir, "restored"))
+	AssertEq(nil, err)
+
+	err = os.Rename(path.Join(mntDir, ".trash/restored"), path.Join(mntDir, "restored"))
+	AssertEq(nil, err)
+
+	contents, err := os.ReadFile(path.Join(mntDir, "restored"))
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+
+	_, err = os.Stat(path.Join(mntDir, ".trash/restored"))
+	ExpectTrue(os.IsNotExist(err), "err: %v", err)
+}
+
+func (t *TrashTest) PrefixIsHidden() {
+	_, err := storageutil.CreateObject(ctx, bucket, trashPrefix+"hidden", []byte("taco"))
+	AssertEq(nil, err)
+
+	entries, err := fusetesting.ReadDirPicky(mntDir)
+	AssertEq(nil, err)
+	for _, e := range entries {
+		ExpectNe(".gcsfuse-trash", e.Name())
+		ExpectNe(".trash", e.Name())
+	}
+
+	_, err = os.Stat(path.Join(mntDir, ".gcsfuse-trash"))
+	ExpectTrue(os.IsNotExist(err), "err: %v", err)
+}
+
+func (t *TrashTest) TrashDirCannotBeRemoved() {
+	err := os.Remove(path.Join(mntDir, ".trash"))
+	ExpectThat(err, Error(HasSubstr("read-only")))
+
+	err = os.Rename(path.Join(mntDir, ".trash"), path.Join(mntDir, "elsewhere"))
+	ExpectThat(err, Error(HasSubstr("read-only")))
+}
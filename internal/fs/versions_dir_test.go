@@ -0,0 +1,184 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tests for the virtual directories listing past generations of objects.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fusetesting"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type VersionsDirTest struct {
+	fsTest
+}
+
+func init() {
+	RegisterTestSuite(&VersionsDirTest{})
+}
+
+func (t *VersionsDirTest) SetUpTestSuite() {
+	bucket = fake.NewFakeVersionedBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	t.serverCfg.ImplicitDirectories = true
+	t.serverCfg.NewConfig = &cfg.Config{
+		FileCache: defaultFileCacheConfig(),
+		MetadataCache: cfg.MetadataCacheConfig{
+			TypeCacheMaxSizeMb: 4,
+		},
+		FileSystem: cfg.FileSystemConfig{
+			ExperimentalEnableVersionsDir: true,
+		},
+	}
+	t.fsTest.SetUpTestSuite()
+}
+
+// Create the named object twice, returning the two generations.
+func (t *VersionsDirTest) createTwice(name, first, second string) (o1, o2 *gcs.Object) {
+	o1, err := storageutil.CreateObject(ctx, bucket, name, []byte(first))
+	AssertEq(nil, err)
+
+	o2, err = storageutil.CreateObject(ctx, bucket, name, []byte(second))
+	AssertEq(nil, err)
+
+	return
+}
+
+func generationName(o *gcs.Object) string {
+	return strconv.FormatInt(o.Generation, 10)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *VersionsDirTest) NotListedInParent() {
+	_, err := storageutil.CreateObject(ctx, bucket, "listed", []byte("taco"))
+	AssertEq(nil, err)
+
+	entries, err := fusetesting.ReadDirPicky(mntDir)
+
+	AssertEq(nil, err)
+	for _, e := range entries {
+		ExpectNe(".gcsfuse-versions", e.Name())
+	}
+}
+
+func (t *VersionsDirTest) ListFilesWithGenerations() {
+	t.createTwice("dir/foo", "taco", "burrito")
+	_, err := storageutil.CreateObject(ctx, bucket, "dir/bar", []byte("enchilada"))
+	AssertEq(nil, err)
+	err = t.deleteObject("dir/bar")
+	AssertEq(nil, err)
+
+	entries, err := fusetesting.ReadDirPicky(path.Join(mntDir, "dir/.gcsfuse-versions"))
+
+	AssertEq(nil, err)
+	AssertEq(2, len(entries))
+	ExpectEq("bar", entries[0].Name())
+	ExpectTrue(entries[0].IsDir())
+	ExpectEq("foo", entries[1].Name())
+	ExpectTrue(entries[1].IsDir())
+}
+
+func (t *VersionsDirTest) ReadPastGeneration() {
+	o1, o2 := t.createTwice("read", "taco", "burrito")
+	versionsDir := path.Join(mntDir, ".gcsfuse-versions/read")
+
+	entries, err := fusetesting.ReadDirPicky(versionsDir)
+	AssertEq(nil, err)
+	AssertEq(2, len(entries))
+	ExpectEq(generationName(o1), entries[0].Name())
+	ExpectEq(generationName(o2), entries[1].Name())
+
+	contents, err := os.ReadFile(path.Join(versionsDir, generationName(o1)))
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+
+	contents, err = os.ReadFile(path.Join(mntDir, "read"))
+	AssertEq(nil, err)
+	ExpectEq("burrito", string(contents))
+}
+
+func (t *VersionsDirTest) UnknownGeneration() {
+	t.createTwice("unknown", "taco", "burrito")
+
+	_, err := os.Stat(path.Join(mntDir, ".gcsfuse-versions/unknown/17"))
+
+	ExpectTrue(os.IsNotExist(err), "err: %v", err)
+}
+
+func (t *VersionsDirTest) GenerationIsReadOnly() {
+	o1, _ := t.createTwice("readonly", "taco", "burrito")
+	p := path.Join(mntDir, ".gcsfuse-versions/readonly", generationName(o1))
+
+	_, err := os.OpenFile(p, os.O_RDWR, 0)
+	ExpectThat(err, Error(HasSubstr("read-only")))
+
+	err = os.Truncate(p, 0)
+	ExpectThat(err, Error(HasSubstr("read-only")))
+
+	err = os.Remove(p)
+	ExpectThat(err, Error(HasSubstr("read-only")))
+
+	err = os.WriteFile(path.Join(mntDir, ".gcsfuse-versions/readonly/new"), []byte{}, 0600)
+	ExpectThat(err, Error(HasSubstr("read-only")))
+}
+
+func (t *VersionsDirTest) RestoreByRename() {
+	o1, _ := t.createTwice("restore", "taco", "burrito")
+	p := path.Join(mntDir, ".gcsfuse-versions/restore", generationName(o1))
+
+	err := os.Rename(p, path.Join(mntDir, "restore"))
+	AssertEq(nil, err)
+
+	contents, err := storageutil.ReadObject(ctx, bucket, "restore")
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+
+	// The restored generation is still listed, along with the one it replaced.
+	entries, err := fusetesting.ReadDirPicky(path.Join(mntDir, ".gcsfuse-versions/restore"))
+	AssertEq(nil, err)
+	ExpectEq(3, len(entries))
+}
+
+func (t *VersionsDirTest) RestoreDeletedFile() {
+	o, err := storageutil.CreateObject(ctx, bucket, "deleted", []byte("taco"))
+	AssertEq(nil, err)
+	err = t.deleteObject("deleted")
+	AssertEq(nil, err)
+
+	err = os.Rename(
+		path.Join(mntDir, ".gcsfuse-versions/deleted", generationName(o)),
+		path.Join(mntDir, "deleted"))
+	AssertEq(nil, err)
+
+	contents, err := os.ReadFile(path.Join(mntDir, "deleted"))
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+}
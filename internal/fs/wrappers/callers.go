@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrappers
+
+import (
+	"context"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/ratelimit"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+type callers struct {
+	wrapped fuseutil.FileSystem
+}
+
+// WithCallers wraps a FileSystem so that the requests each op makes are
+// accounted to the process the kernel says invoked it. Ops that don't say
+// are passed through as they are.
+func WithCallers(wrapped fuseutil.FileSystem) fuseutil.FileSystem {
+	return &callers{wrapped: wrapped}
+}
+
+func withCaller(ctx context.Context, opCtx fuseops.OpContext) context.Context {
+	return ratelimit.WithCaller(ctx, ratelimit.Caller{Uid: opCtx.Uid, Pid: opCtx.Pid})
+}
+
+func (fs *callers) Destroy() {
+	fs.wrapped.Destroy()
+}
+
+func (fs *callers) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
+	return fs.wrapped.StatFS(ctx, op)
+}
+
+func (fs *callers) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) error {
+	return fs.wrapped.LookUpInode(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	return fs.wrapped.GetInodeAttributes(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) SetInodeAttributes(ctx context.Context, op *fuseops.SetInodeAttributesOp) error {
+	return fs.wrapped.SetInodeAttributes(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) ForgetInode(ctx context.Context, op *fuseops.ForgetInodeOp) error {
+	return fs.wrapped.ForgetInode(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) BatchForget(ctx context.Context, op *fuseops.BatchForgetOp) error {
+	return fs.wrapped.BatchForget(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) MkDir(ctx context.Context, op *fuseops.MkDirOp) error {
+	return fs.wrapped.MkDir(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) MkNode(ctx context.Context, op *fuseops.MkNodeOp) error {
+	return fs.wrapped.MkNode(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) CreateFile(ctx context.Context, op *fuseops.CreateFileOp) error {
+	return fs.wrapped.CreateFile(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) CreateLink(ctx context.Context, op *fuseops.CreateLinkOp) error {
+	return fs.wrapped.CreateLink(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) CreateSymlink(ctx context.Context, op *fuseops.CreateSymlinkOp) error {
+	return fs.wrapped.CreateSymlink(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) Rename(ctx context.Context, op *fuseops.RenameOp) error {
+	return fs.wrapped.Rename(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) RmDir(ctx context.Context, op *fuseops.RmDirOp) error {
+	return fs.wrapped.RmDir(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) Unlink(ctx context.Context, op *fuseops.UnlinkOp) error {
+	return fs.wrapped.Unlink(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) OpenDir(ctx context.Context, op *fuseops.OpenDirOp) error {
+	return fs.wrapped.OpenDir(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
+	return fs.wrapped.ReadDir(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) ReleaseDirHandle(ctx context.Context, op *fuseops.ReleaseDirHandleOp) error {
+	return fs.wrapped.ReleaseDirHandle(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) OpenFile(ctx context.Context, op *fuseops.OpenFileOp) error {
+	return fs.wrapped.OpenFile(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	return fs.wrapped.ReadFile(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) WriteFile(ctx context.Context, op *fuseops.WriteFileOp) error {
+	return fs.wrapped.WriteFile(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) SyncFile(ctx context.Context, op *fuseops.SyncFileOp) error {
+	return fs.wrapped.SyncFile(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) FlushFile(ctx context.Context, op *fuseops.FlushFileOp) error {
+	return fs.wrapped.FlushFile(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) ReleaseFileHandle(ctx context.Context, op *fuseops.ReleaseFileHandleOp) error {
+	return fs.wrapped.ReleaseFileHandle(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) ReadSymlink(ctx context.Context, op *fuseops.ReadSymlinkOp) error {
+	return fs.wrapped.ReadSymlink(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) RemoveXattr(ctx context.Context, op *fuseops.RemoveXattrOp) error {
+	return fs.wrapped.RemoveXattr(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) GetXattr(ctx context.Context, op *fuseops.GetXattrOp) error {
+	return fs.wrapped.GetXattr(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) ListXattr(ctx context.Context, op *fuseops.ListXattrOp) error {
+	return fs.wrapped.ListXattr(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) SetXattr(ctx context.Context, op *fuseops.SetXattrOp) error {
+	return fs.wrapped.SetXattr(withCaller(ctx, op.OpContext), op)
+}
+
+func (fs *callers) Fallocate(ctx context.Context, op *fuseops.FallocateOp) error {
+	return fs.wrapped.Fallocate(withCaller(ctx, op.OpContext), op)
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrappers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/ratelimit"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A file system recording the caller of the last read or stat.
+type callerFS struct {
+	dummyFS
+	caller    ratelimit.Caller
+	hasCaller bool
+}
+
+func (fs *callerFS) ReadFile(ctx context.Context, _ *fuseops.ReadFileOp) error {
+	fs.caller, fs.hasCaller = ratelimit.CallerFrom(ctx)
+	return nil
+}
+
+func (fs *callerFS) GetInodeAttributes(ctx context.Context, _ *fuseops.GetInodeAttributesOp) error {
+	fs.caller, fs.hasCaller = ratelimit.CallerFrom(ctx)
+	return nil
+}
+
+func (fs *callerFS) StatFS(ctx context.Context, _ *fuseops.StatFSOp) error {
+	fs.caller, fs.hasCaller = ratelimit.CallerFrom(ctx)
+	return nil
+}
+
+func TestWithCallersAccountsOpsToTheirCaller(t *testing.T) {
+	wrapped := &callerFS{}
+	fs := WithCallers(wrapped)
+
+	err := fs.ReadFile(context.Background(), &fuseops.ReadFileOp{OpContext: fuseops.OpContext{Uid: 1000, Pid: 42}})
+
+	require.NoError(t, err)
+	assert.True(t, wrapped.hasCaller)
+	assert.Equal(t, ratelimit.Caller{Uid: 1000, Pid: 42}, wrapped.caller)
+}
+
+func TestWithCallersAccountsAttributeOpsToTheirCaller(t *testing.T) {
+	wrapped := &callerFS{}
+	fs := WithCallers(wrapped)
+
+	err := fs.GetInodeAttributes(context.Background(), &fuseops.GetInodeAttributesOp{OpContext: fuseops.OpContext{Uid: 1000, Pid: 42}})
+
+	require.NoError(t, err)
+	assert.True(t, wrapped.hasCaller)
+	assert.Equal(t, ratelimit.Caller{Uid: 1000, Pid: 42}, wrapped.caller)
+}
+
+func TestWithCallersPassesThroughOpsWithoutCaller(t *testing.T) {
+	wrapped := &callerFS{}
+	fs := WithCallers(wrapped)
+
+	err := fs.StatFS(context.Background(), &fuseops.StatFSOp{})
+
+	require.NoError(t, err)
+	assert.False(t, wrapped.hasCaller)
+}
@@ -19,17 +19,26 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/canned"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/ratelimit"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/faults"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/hedging"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/priority"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/trace"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 	"github.com/jacobsa/timeutil"
 )
@@ -62,14 +71,98 @@ type BucketConfig struct {
 	AppendThreshold          int64
 	ChunkTransferTimeoutSecs int64
 	TmpObjectPrefix          string
+
+	// If non-zero, serve a read-only view of the bucket as it was at this time.
+	// See NewSnapshotBucket.
+	SnapshotTime time.Time
+
+	// If set, deleted objects are moved under this prefix, which is hidden from
+	// the bucket root, and purged once they have been there for TrashRetention.
+	// See MoveToTrash.
+	TrashPrefix    string
+	TrashRetention time.Duration
+
+	// If set, the bucket is layered over these read-only lower layers, topmost
+	// first, each a bucket name optionally followed by a slash and a prefix.
+	// See NewUnionBucket.
+	LowerLayers []string
+
+	// If set, ListBuckets lists the buckets in this project whose names match
+	// BucketsFilter, if any, caching the list for BucketsTTL.
+	BucketsProject string
+	BucketsFilter  *regexp.Regexp
+	BucketsTTL     time.Duration
+
+	// If set, objects whose names aren't valid paths are exposed under escaped
+	// names. See NewNameEncodingBucket.
+	EncodeNames bool
+
+	// If set, every attempt to modify the bucket fails with EROFS. See
+	// NewReadOnlyBucket.
+	ReadOnly bool
+
+	// If set, reads of the bucket bypass the file cache.
+	DisableFileCache bool
+
+	// If set, the rate limits above are shared equally among the callers using
+	// the bucket at the time, told apart by "uid" or "pid", and each caller's
+	// share is capped at the per-caller limits, if positive. See
+	// ratelimit.NewFairThrottle.
+	FairShareBy                     string
+	PerCallerOpRateLimitHz          float64
+	PerCallerEgressLimitBytesPerSec float64
+
+	// If positive, the most requests let through at once, by priority class.
+	// See priority.NewSchedulingBucket.
+	SchedulerMaxInFlight int
+
+	// If set, concurrent identical metadata requests share one call. See
+	// caching.NewCoalescingBucket.
+	EnableRequestCoalescing bool
+
+	// Adaptive limits on the requests in flight to each bucket, and when to
+	// fail them fast. See ratelimit.NewAdaptiveBucket.
+	Adaptive ratelimit.AdaptiveConfig
+
+	// If set, slow stats and small reads are duplicated according to Hedging.
+	// See hedging.NewHedgingBucket.
+	EnableHedging bool
+	Hedging       hedging.Config
+
+	// Faults to inject into the calls made to the bucket. See
+	// faults.NewFaultInjectingBucket.
+	FaultRules []faults.Rule
+
+	// If set, every call made to the bucket is recorded to this recorder. See
+	// trace.NewRecordingBucket.
+	TraceRecorder *trace.Recorder
+
+	// Configs that replace this one when setting up particular buckets, keyed
+	// by bucket name.
+	PerBucket map[string]BucketConfig
+}
+
+// Return the config for setting up the named bucket.
+func (c *BucketConfig) forBucket(name string) *BucketConfig {
+	if pc, ok := c.PerBucket[name]; ok {
+		return &pc
+	}
+	return c
 }
 
 // BucketManager manages the lifecycle of buckets.
 type BucketManager interface {
+	// Sets up the named bucket. A name of the form "bucket/prefix" sets up a
+	// view of just that prefix of the bucket, in place of any configured
+	// OnlyDir, whose Name is the whole of the supplied name.
 	SetUpBucket(
 		ctx context.Context,
 		name string, isMultibucketMount bool, metricHandle common.MetricHandle) (b SyncerBucket, err error)
 
+	// Lists the names of the buckets that a mount of all buckets shows at its
+	// root, or returns syscall.ENOTSUP if no project was configured.
+	ListBuckets(ctx context.Context) (names []string, err error)
+
 	// Shuts down the bucket manager and its buckets
 	ShutDown()
 }
@@ -82,6 +175,15 @@ type bucketManager struct {
 	// Garbage collector
 	gcCtx                 context.Context
 	stopGarbageCollecting func()
+
+	clock timeutil.Clock
+
+	// The last list of buckets, and when it expires.
+	//
+	// GUARDED_BY(bucketsMu)
+	bucketsMu         sync.Mutex
+	buckets           []string
+	bucketsExpiration time.Time
 }
 
 func NewBucketManager(config BucketConfig, storageHandle storage.StorageHandle) BucketManager {
@@ -94,17 +196,21 @@ func NewBucketManager(config BucketConfig, storageHandle storage.StorageHandle)
 		config:          config,
 		storageHandle:   storageHandle,
 		sharedStatCache: c,
+		clock:           timeutil.RealClock(),
 	}
-	bm.gcCtx, bm.stopGarbageCollecting = context.WithCancel(context.Background())
+	bm.gcCtx, bm.stopGarbageCollecting = context.WithCancel(priority.WithClass(context.Background(), priority.GC))
 	return bm
 }
 
 func setUpRateLimiting(
 	in gcs.Bucket,
 	opRateLimitHz float64,
-	egressBandwidthLimit float64) (out gcs.Bucket, err error) {
+	egressBandwidthLimit float64,
+	fairShareBy string,
+	perCallerOpRateLimitHz float64,
+	perCallerEgressBandwidthLimit float64) (out gcs.Bucket, err error) {
 	// If no rate limiting has been requested, just return the bucket.
-	if !(opRateLimitHz > 0 || egressBandwidthLimit > 0) {
+	if !(opRateLimitHz > 0 || egressBandwidthLimit > 0 || fairShareBy != "") {
 		out = in
 		return
 	}
@@ -140,9 +246,21 @@ func setUpRateLimiting(
 		return
 	}
 
-	// Create the throttles.
-	opThrottle := ratelimit.NewThrottle(opRateLimitHz, opCapacity)
-	egressThrottle := ratelimit.NewThrottle(egressBandwidthLimit, egressCapacity)
+	// Create the throttles, shared among callers if requested.
+	var opThrottle, egressThrottle ratelimit.Throttle
+	if fairShareBy == "" {
+		opThrottle = ratelimit.NewThrottle(opRateLimitHz, opCapacity)
+		egressThrottle = ratelimit.NewThrottle(egressBandwidthLimit, egressCapacity)
+	} else {
+		var key ratelimit.CallerKey
+		key, err = ratelimit.NewCallerKey(fairShareBy)
+		if err != nil {
+			return
+		}
+
+		opThrottle = ratelimit.NewFairThrottle(opRateLimitHz, opCapacity, perCallerOpRateLimitHz, key)
+		egressThrottle = ratelimit.NewFairThrottle(egressBandwidthLimit, egressCapacity, perCallerEgressBandwidthLimit, key)
+	}
 
 	// And the bucket.
 	out = ratelimit.NewThrottledBucket(
@@ -153,18 +271,33 @@ func setUpRateLimiting(
 	return
 }
 
-func (bm *bucketManager) SetUpBucket(
+// Set up the appropriate backing bucket for the given name, with monitoring
+// and gcs logs.
+func (bm *bucketManager) newBackingBucket(
 	ctx context.Context,
 	name string,
-	isMultibucketMount bool,
-	metricHandle common.MetricHandle,
-) (sb SyncerBucket, err error) {
-	var b gcs.Bucket
-	// Set up the appropriate backing bucket.
+	metricHandle common.MetricHandle) (b gcs.Bucket) {
 	if name == canned.FakeBucketName {
 		b = canned.MakeFakeBucket(ctx)
 	} else {
-		b = bm.storageHandle.BucketHandle(ctx, name, bm.config.BillingProject)
+		b = bm.storageHandle.BucketHandle(ctx, name, bm.config.forBucket(name).BillingProject)
+	}
+
+	// Inject faults beneath the other layers, as though GCS misbehaved.
+	if len(bm.config.FaultRules) > 0 {
+		b = faults.NewFaultInjectingBucket(b, bm.config.FaultRules)
+	}
+
+	// Adapt to the health of GCS, beneath hedging so that every request sent
+	// is limited, and above the injected faults so that they're reacted to.
+	if bm.config.Adaptive.MaxInFlight > 0 || bm.config.Adaptive.BreakerThreshold > 0 {
+		b = ratelimit.NewAdaptiveBucket(b, bm.config.Adaptive, timeutil.RealClock(), metricHandle)
+	}
+
+	// Hedge slow requests, above the injected faults so that they can be
+	// exercised with injected latency.
+	if bm.config.EnableHedging {
+		b = hedging.NewHedgingBucket(b, bm.config.Hedging, metricHandle)
 	}
 
 	// Enable monitoring.
@@ -172,31 +305,137 @@ func (bm *bucketManager) SetUpBucket(
 		b = monitor.NewMonitoringBucket(b, metricHandle)
 	}
 
+	// Record calls for replaying.
+	if bm.config.TraceRecorder != nil {
+		b = trace.NewRecordingBucket(b, bm.config.TraceRecorder)
+	}
+
 	// Enable gcs logs.
 	b = storage.NewDebugBucket(b)
+	return
+}
+
+// Set up a lower layer of a union mount from "bucket" or "bucket/prefix".
+func (bm *bucketManager) setUpLowerLayer(
+	ctx context.Context,
+	layer string,
+	metricHandle common.MetricHandle) (b gcs.Bucket, err error) {
+	name, prefix, _ := strings.Cut(layer, "/")
+	b = bm.newBackingBucket(ctx, name, metricHandle)
+
+	if prefix != "" {
+		b, err = NewPrefixBucket(path.Clean(prefix)+"/", b)
+		if err != nil {
+			err = fmt.Errorf("NewPrefixBucket: %w", err)
+			return
+		}
+	}
+
+	return
+}
+
+func (bm *bucketManager) SetUpBucket(
+	ctx context.Context,
+	name string,
+	isMultibucketMount bool,
+	metricHandle common.MetricHandle,
+) (sb SyncerBucket, err error) {
+	bucketName, onlyDir, _ := strings.Cut(name, "/")
+	config := bm.config.forBucket(bucketName)
+	if onlyDir == "" {
+		onlyDir = config.OnlyDir
+	}
+
+	b := bm.newBackingBucket(ctx, bucketName, metricHandle)
+
+	// Pin to a point in time, if requested.
+	if !config.SnapshotTime.IsZero() {
+		b = NewSnapshotBucket(config.SnapshotTime, b)
+	}
+
+	// Refuse modifications, if requested.
+	if config.ReadOnly {
+		b = NewReadOnlyBucket(b)
+	}
 
 	// Limit to a requested prefix of the bucket, if any.
-	if bm.config.OnlyDir != "" {
-		b, err = NewPrefixBucket(path.Clean(bm.config.OnlyDir)+"/", b)
+	if onlyDir != "" {
+		b, err = NewPrefixBucket(path.Clean(onlyDir)+"/", b)
 		if err != nil {
 			err = fmt.Errorf("NewPrefixBucket: %w", err)
 			return
 		}
 	}
 
+	// Keep views of different prefixes of one bucket apart in the file system
+	// and its caches.
+	if bucketName != name {
+		b = namedBucket{Bucket: b, name: name}
+	}
+
+	// Layer over the lower layers, if any. Mounts of several buckets or
+	// prefixes have no one bucket to put on top.
+	if len(config.LowerLayers) > 0 {
+		if isMultibucketMount {
+			logger.Warnf("Ignoring lower layers for %q: only a single mounted bucket can be layered.", name)
+		} else {
+			layers := []gcs.Bucket{b}
+			for _, l := range config.LowerLayers {
+				var lower gcs.Bucket
+				lower, err = bm.setUpLowerLayer(ctx, l, metricHandle)
+				if err != nil {
+					err = fmt.Errorf("lower layer %q: %w", l, err)
+					return
+				}
+				layers = append(layers, lower)
+			}
+
+			b, err = NewUnionBucket(layers)
+			if err != nil {
+				err = fmt.Errorf("NewUnionBucket: %w", err)
+				return
+			}
+		}
+	}
+
+	// Hide the trash, if any.
+	if config.TrashPrefix != "" {
+		b = NewHidingBucket(config.TrashPrefix, b)
+	}
+
+	// Escape names that aren't valid paths, if requested.
+	if config.EncodeNames {
+		b = NewNameEncodingBucket(metricHandle, b)
+	}
+
 	// Enable rate limiting, if requested.
 	b, err = setUpRateLimiting(
 		b,
-		bm.config.OpRateLimitHz,
-		bm.config.EgressBandwidthLimitBytesPerSecond)
+		config.OpRateLimitHz,
+		config.EgressBandwidthLimitBytesPerSecond,
+		config.FairShareBy,
+		config.PerCallerOpRateLimitHz,
+		config.PerCallerEgressLimitBytesPerSec)
 
 	if err != nil {
 		err = fmt.Errorf("setUpRateLimiting: %w", err)
 		return
 	}
 
+	// Schedule requests by class, if requested, ahead of the rate limits so
+	// that background traffic doesn't take the tokens users are waiting on.
+	if config.SchedulerMaxInFlight > 0 {
+		b = priority.NewSchedulingBucket(b, config.SchedulerMaxInFlight)
+	}
+
+	// Share the calls of concurrent identical metadata requests, if requested,
+	// such as those missing the stat cache at once.
+	if config.EnableRequestCoalescing {
+		b = caching.NewCoalescingBucket(b, metricHandle)
+	}
+
 	// Enable cached StatObject results, if appropriate.
-	if bm.config.StatCacheTTL != 0 && bm.sharedStatCache != nil {
+	if config.StatCacheTTL != 0 && bm.sharedStatCache != nil {
 		var statCache metadata.StatCache
 		if isMultibucketMount {
 			statCache = metadata.NewStatCacheBucketView(bm.sharedStatCache, name)
@@ -205,7 +444,7 @@ func (bm *bucketManager) SetUpBucket(
 		}
 
 		b = caching.NewFastStatBucket(
-			bm.config.StatCacheTTL,
+			config.StatCacheTTL,
 			statCache,
 			timeutil.RealClock(),
 			b)
@@ -215,15 +454,17 @@ func (bm *bucketManager) SetUpBucket(
 	b = NewContentTypeBucket(b)
 
 	// Enable Syncer
-	if bm.config.TmpObjectPrefix == "" {
+	if config.TmpObjectPrefix == "" {
 		err = errors.New("you must set TmpObjectPrefix")
 		return
 	}
 	sb = NewSyncerBucket(
-		bm.config.AppendThreshold,
-		bm.config.ChunkTransferTimeoutSecs,
-		bm.config.TmpObjectPrefix,
+		config.AppendThreshold,
+		config.ChunkTransferTimeoutSecs,
+		config.TmpObjectPrefix,
 		b)
+	sb.ReadOnly = config.ReadOnly
+	sb.DisableFileCache = config.DisableFileCache
 
 	// Fetch bucket type from storage layout api and set bucket type.
 	b.BucketType()
@@ -237,12 +478,70 @@ func (bm *bucketManager) SetUpBucket(
 		}
 	}
 
-	// Periodically garbage collect temporary objects
-	go garbageCollect(bm.gcCtx, bm.config.TmpObjectPrefix, sb)
+	// Periodically garbage collect temporary objects. A snapshot or read-only
+	// bucket can't have any of its own, and couldn't delete them anyway.
+	writable := config.SnapshotTime.IsZero() && !config.ReadOnly
+	if writable {
+		go garbageCollect(bm.gcCtx, config.TmpObjectPrefix, sb)
+	}
 
+	// Periodically purge the trash of objects past their retention.
+	if config.TrashPrefix != "" && writable {
+		go purgeTrash(bm.gcCtx, config.TrashPrefix, config.TrashRetention, sb)
+	}
+
+	return
+}
+
+func (bm *bucketManager) ListBuckets(ctx context.Context) (names []string, err error) {
+	if bm.config.BucketsProject == "" {
+		err = syscall.ENOTSUP
+		return
+	}
+
+	bm.bucketsMu.Lock()
+	now := bm.clock.Now()
+	names = bm.buckets
+	fresh := names != nil && now.Before(bm.bucketsExpiration)
+	bm.bucketsMu.Unlock()
+
+	if fresh {
+		return
+	}
+
+	// Fetch without holding the lock, so that a slow listing doesn't hold up
+	// others. Concurrent callers with an expired list each fetch their own.
+	all, err := bm.storageHandle.ListBuckets(ctx, bm.config.BucketsProject)
+	if err != nil {
+		names = nil
+		err = fmt.Errorf("ListBuckets: %w", err)
+		return
+	}
+
+	names = make([]string, 0, len(all))
+	for _, n := range all {
+		if bm.config.BucketsFilter == nil || bm.config.BucketsFilter.MatchString(n) {
+			names = append(names, n)
+		}
+	}
+
+	bm.bucketsMu.Lock()
+	bm.buckets = names
+	bm.bucketsExpiration = now.Add(bm.config.BucketsTTL)
+	bm.bucketsMu.Unlock()
 	return
 }
 
 func (bm *bucketManager) ShutDown() {
 	bm.stopGarbageCollecting()
 }
+
+// A bucket presented under a name other than that of the bucket it wraps.
+type namedBucket struct {
+	gcs.Bucket
+	name string
+}
+
+func (b namedBucket) Name() string {
+	return b.name
+}
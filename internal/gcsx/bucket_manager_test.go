@@ -16,13 +16,20 @@ package gcsx
 
 import (
 	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	. "github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
 )
 
 func TestBucketManager(t *testing.T) { RunTests(t) }
@@ -124,6 +131,153 @@ func (t *BucketManagerTest) TestSetUpBucketMethod_IsMultiBucketMountTrue() {
 	ExpectEq(nil, err)
 }
 
+func (t *BucketManagerTest) TestSetUpBucketMethod_Prefix() {
+	var bm bucketManager
+	bucketConfig := BucketConfig{
+		BillingProject:     "BillingProject",
+		StatCacheMaxSizeMB: 1,
+		StatCacheTTL:       20 * time.Second,
+		AppendThreshold:    2,
+		TmpObjectPrefix:    "TmpObjectPrefix",
+	}
+	ctx := context.Background()
+	bm.storageHandle = t.storageHandle
+	bm.config = bucketConfig
+	bm.gcCtx = ctx
+
+	bucket, err := bm.SetUpBucket(context.Background(), TestBucketName+"/teams/a", true, common.NewNoopMetrics())
+
+	AssertEq(nil, err)
+	ExpectNe(nil, bucket.Syncer)
+	ExpectEq(TestBucketName+"/teams/a", bucket.Name())
+}
+
+func (t *BucketManagerTest) TestSetUpBucketMethod_PerBucketConfig() {
+	var bm bucketManager
+	bucketConfig := BucketConfig{
+		AppendThreshold: 2,
+		TmpObjectPrefix: "TmpObjectPrefix",
+		PerBucket: map[string]BucketConfig{
+			TestBucketName: {
+				AppendThreshold:  2,
+				TmpObjectPrefix:  "TmpObjectPrefix",
+				ReadOnly:         true,
+				DisableFileCache: true,
+			},
+		},
+	}
+	ctx := context.Background()
+	bm.storageHandle = t.storageHandle
+	bm.config = bucketConfig
+	bm.gcCtx = ctx
+
+	bucket, err := bm.SetUpBucket(context.Background(), TestBucketName, true, common.NewNoopMetrics())
+
+	AssertEq(nil, err)
+	ExpectTrue(bucket.ReadOnly)
+	ExpectTrue(bucket.DisableFileCache)
+	_, err = bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:     "foo",
+		Contents: strings.NewReader("taco"),
+	})
+	ExpectTrue(errors.Is(err, syscall.EROFS), "%v", err)
+}
+
+func (t *BucketManagerTest) TestSetUpBucketMethod_PerBucketConfigForOtherBucket() {
+	var bm bucketManager
+	bucketConfig := BucketConfig{
+		AppendThreshold: 2,
+		TmpObjectPrefix: "TmpObjectPrefix",
+		PerBucket: map[string]BucketConfig{
+			"other-bucket": {ReadOnly: true},
+		},
+	}
+	ctx := context.Background()
+	bm.storageHandle = t.storageHandle
+	bm.config = bucketConfig
+	bm.gcCtx = ctx
+
+	bucket, err := bm.SetUpBucket(context.Background(), TestBucketName, true, common.NewNoopMetrics())
+
+	AssertEq(nil, err)
+	ExpectFalse(bucket.ReadOnly)
+	ExpectFalse(bucket.DisableFileCache)
+}
+
+func (t *BucketManagerTest) TestListBucketsWithoutProject() {
+	bm := NewBucketManager(BucketConfig{}, t.storageHandle)
+
+	_, err := bm.ListBuckets(context.Background())
+
+	ExpectEq(syscall.ENOTSUP, err)
+}
+
+func (t *BucketManagerTest) TestListBucketsFiltersAndCaches() {
+	clock := &timeutil.SimulatedClock{}
+	clock.SetTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	bm := NewBucketManager(BucketConfig{
+		BucketsProject: "some-project",
+		BucketsFilter:  regexp.MustCompile("^gcsfuse-"),
+		BucketsTTL:     time.Minute,
+	}, t.storageHandle).(*bucketManager)
+	bm.clock = clock
+
+	names, err := bm.ListBuckets(context.Background())
+
+	AssertEq(nil, err)
+	ExpectThat(names, ElementsAre(TestBucketName))
+
+	// The list is cached until it expires.
+	bm.config.BucketsFilter = regexp.MustCompile("^other-")
+	names, err = bm.ListBuckets(context.Background())
+	AssertEq(nil, err)
+	ExpectThat(names, ElementsAre(TestBucketName))
+
+	clock.AdvanceTime(time.Minute)
+	names, err = bm.ListBuckets(context.Background())
+	AssertEq(nil, err)
+	ExpectThat(names, ElementsAre())
+}
+
+// blockingStorageHandle holds up the first listing of buckets until release
+// is closed.
+type blockingStorageHandle struct {
+	storage.StorageHandle
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (sh *blockingStorageHandle) ListBuckets(ctx context.Context, projectID string) ([]string, error) {
+	if sh.calls.Add(1) == 1 {
+		<-sh.release
+	}
+	return sh.StorageHandle.ListBuckets(ctx, projectID)
+}
+
+func (t *BucketManagerTest) TestListBucketsDoesNotHoldLockWhileFetching() {
+	sh := &blockingStorageHandle{StorageHandle: t.storageHandle, release: make(chan struct{})}
+	bm := NewBucketManager(BucketConfig{
+		BucketsProject: "some-project",
+		BucketsTTL:     time.Minute,
+	}, sh)
+	firstDone := make(chan error)
+	go func() {
+		_, err := bm.ListBuckets(context.Background())
+		firstDone <- err
+	}()
+	for sh.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Another caller gets its list while the first fetch is held up.
+	names, err := bm.ListBuckets(context.Background())
+	AssertEq(nil, err)
+	ExpectThat(names, ElementsAre(TestBucketName))
+
+	close(sh.release)
+	ExpectEq(nil, <-firstDone)
+}
+
 func (t *BucketManagerTest) TestSetUpBucketMethodWhenBucketDoesNotExist() {
 	var bm bucketManager
 	bucketConfig := BucketConfig{
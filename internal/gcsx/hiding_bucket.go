@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// NewHidingBucket creates a view on the wrapped bucket that leaves the objects
+// under prefix out of listings of the bucket root, so that gcsfuse's own
+// bookkeeping, such as the trash, isn't part of the file system tree. Listings
+// within the prefix are unaffected.
+func NewHidingBucket(prefix string, wrapped gcs.Bucket) gcs.Bucket {
+	return hidingBucket{
+		Bucket: wrapped,
+		prefix: prefix,
+	}
+}
+
+type hidingBucket struct {
+	gcs.Bucket
+	prefix string
+}
+
+func (b hidingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (l *gcs.Listing, err error) {
+	l, err = b.Bucket.ListObjects(ctx, req)
+	if err != nil || req.Prefix != "" {
+		return
+	}
+
+	minObjects := l.MinObjects[:0]
+	for _, o := range l.MinObjects {
+		if !strings.HasPrefix(o.Name, b.prefix) {
+			minObjects = append(minObjects, o)
+		}
+	}
+	l.MinObjects = minObjects
+
+	collapsedRuns := l.CollapsedRuns[:0]
+	for _, p := range l.CollapsedRuns {
+		if p != b.prefix {
+			collapsedRuns = append(collapsedRuns, p)
+		}
+	}
+	l.CollapsedRuns = collapsedRuns
+
+	return
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A half-open byte range [start, limit) of a temp file.
+type hole struct {
+	start int64
+	limit int64
+}
+
+// holeSet records the byte ranges of a temp file that are known to read as
+// zeros without having been written, e.g. because they were punched out or
+// because the file was extended past them.
+//
+// INVARIANT: Sorted by start, non-empty and non-adjacent (so non-overlapping).
+type holeSet []hole
+
+func (hs holeSet) checkInvariants(size int64) {
+	for i, h := range hs {
+		if h.start >= h.limit {
+			panic(fmt.Sprintf("empty hole: %v", h))
+		}
+
+		if i > 0 && hs[i-1].limit >= h.start {
+			panic(fmt.Sprintf("unmerged holes: %v, %v", hs[i-1], h))
+		}
+
+		if h.limit > size {
+			panic(fmt.Sprintf("hole %v extends past size %d", h, size))
+		}
+	}
+}
+
+// Return the index of the first hole whose limit is greater than offset, or
+// len(hs) if there is none.
+func (hs holeSet) search(offset int64) int {
+	return sort.Search(len(hs), func(i int) bool { return hs[i].limit > offset })
+}
+
+// find returns the hole containing offset, if any.
+func (hs holeSet) find(offset int64) (h hole, ok bool) {
+	i := hs.search(offset)
+	if i < len(hs) && hs[i].start <= offset {
+		return hs[i], true
+	}
+
+	return
+}
+
+// next returns the first hole starting after offset, if any.
+func (hs holeSet) next(offset int64) (h hole, ok bool) {
+	i := hs.search(offset)
+	if i < len(hs) && hs[i].start <= offset {
+		i++
+	}
+
+	if i < len(hs) {
+		return hs[i], true
+	}
+
+	return
+}
+
+// add marks [start, limit) as a hole, merging it with its neighbours.
+func (hs *holeSet) add(start, limit int64) {
+	if start >= limit {
+		return
+	}
+
+	// Find the holes that touch the new one; they are absorbed into it.
+	i := sort.Search(len(*hs), func(i int) bool { return (*hs)[i].limit >= start })
+	j := i
+	for j < len(*hs) && (*hs)[j].start <= limit {
+		start = min(start, (*hs)[j].start)
+		limit = max(limit, (*hs)[j].limit)
+		j++
+	}
+
+	*hs = append((*hs)[:i], append(holeSet{{start, limit}}, (*hs)[j:]...)...)
+}
+
+// remove marks [start, limit) as data, splitting any hole that spans it.
+func (hs *holeSet) remove(start, limit int64) {
+	if start >= limit {
+		return
+	}
+
+	var out holeSet
+	for _, h := range *hs {
+		if h.limit <= start || h.start >= limit {
+			out = append(out, h)
+			continue
+		}
+
+		if h.start < start {
+			out = append(out, hole{h.start, start})
+		}
+
+		if h.limit > limit {
+			out = append(out, hole{limit, h.limit})
+		}
+	}
+
+	*hs = out
+}
@@ -0,0 +1,475 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"io"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// NewNameEncodingBucket creates a view on the wrapped bucket under which every
+// object has a name that is a valid path, so that none is hidden from the file
+// system. Each segment of a name that isn't a valid file name is escaped:
+//
+//   - an empty segment, as in "a//b" or "/a", becomes "%",
+//   - the segments "." and ".." become "%2E" and "%2E%2E",
+//   - control characters become %XX, with XX in upper case hex.
+//
+// An object whose name ends in a slash and that has content is listed, in
+// listings with a delimiter, both as the directory it implies and as a file
+// whose name ends in "%2F" instead, so that its content can be read and
+// written.
+//
+// The escaping is reversed for every name passed to the wrapped bucket, so
+// writes and renames under escaped names land on the original objects. To keep
+// it reversible, a literal '%' is escaped as "%25" wherever it would otherwise
+// be read as an escape; every other name is exposed unchanged.
+func NewNameEncodingBucket(
+	metricHandle common.MetricHandle,
+	wrapped gcs.Bucket) gcs.Bucket {
+	return &nameEncodingBucket{
+		metricHandle: metricHandle,
+		wrapped:      wrapped,
+	}
+}
+
+type nameEncodingBucket struct {
+	metricHandle common.MetricHandle
+	wrapped      gcs.Bucket
+}
+
+// A writer for an object created under an escaped name, which it reports as
+// its object name.
+type nameEncodingWriter struct {
+	gcs.Writer
+	name string
+}
+
+func (w *nameEncodingWriter) ObjectName() string {
+	return w.name
+}
+
+const upperHex = "0123456789ABCDEF"
+
+func isControl(c byte) bool {
+	return c < 0x20 || c == 0x7f
+}
+
+func unhex(c byte) (v byte, ok bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// If s has an escape of '%' or a control character at i, return the byte it
+// stands for.
+func escapeAt(s string, i int) (c byte, ok bool) {
+	if i+3 > len(s) || s[i] != '%' {
+		return
+	}
+
+	hi, ok1 := unhex(s[i+1])
+	lo, ok2 := unhex(s[i+2])
+	if !ok1 || !ok2 {
+		return
+	}
+
+	c = hi<<4 | lo
+	ok = c == '%' || isControl(c)
+	return
+}
+
+// Does s end in the "%2F" that marks an object whose name ends in a slash, at
+// index i?
+func isTrailingSlashAt(s string, i int) bool {
+	return i == len(s)-3 && s[i:] == "%2F"
+}
+
+// Escape a single segment of an object name. A segment is the last of a file
+// if it ends a name that doesn't end in a slash; trailingSlash is set for the
+// last segment of a file exposed for an object whose name does.
+func encodeSegment(seg string, lastOfFile bool, trailingSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(seg); i++ {
+		c := seg[i]
+		switch {
+		case isControl(c):
+			sb.WriteByte('%')
+			sb.WriteByte(upperHex[c>>4])
+			sb.WriteByte(upperHex[c&0xf])
+		case c == '%':
+			if _, ok := escapeAt(seg, i); ok || (lastOfFile && isTrailingSlashAt(seg, i)) {
+				sb.WriteString("%25")
+			} else {
+				sb.WriteByte(c)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	s := sb.String()
+	if trailingSlash {
+		return s + "%2F"
+	}
+
+	switch s {
+	case "":
+		return "%"
+	case ".":
+		return "%2E"
+	case "..":
+		return "%2E%2E"
+	case "%", "%2E", "%2E%2E":
+		// Literal segments that would read as the escapes above.
+		return "%25" + s[1:]
+	}
+
+	return s
+}
+
+// Reverse encodeSegment, reporting whether the segment is the last of a file
+// exposed for an object whose name ends in a slash.
+func decodeSegment(s string, lastOfFile bool) (seg string, trailingSlash bool) {
+	switch s {
+	case "%":
+		return "", false
+	case "%2E":
+		return ".", false
+	case "%2E%2E":
+		return "..", false
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c, ok := escapeAt(s, i); ok {
+			sb.WriteByte(c)
+			i += 2
+			continue
+		}
+
+		if lastOfFile && isTrailingSlashAt(s, i) {
+			trailingSlash = true
+			break
+		}
+
+		sb.WriteByte(s[i])
+	}
+
+	seg = sb.String()
+	return
+}
+
+// Escape an object name, exposing an object whose name ends in a slash as a
+// file if asFile is set. Report whether the name changed.
+func encodeName(name string, asFile bool) (encoded string, changed bool) {
+	if name == "" {
+		return name, false
+	}
+
+	body, isDir := strings.CutSuffix(name, "/")
+	trailingSlash := isDir && asFile
+	if trailingSlash {
+		isDir = false
+	}
+
+	segs := strings.Split(body, "/")
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		segs[i] = encodeSegment(seg, last && !isDir, last && trailingSlash)
+	}
+
+	encoded = strings.Join(segs, "/")
+	if isDir {
+		encoded += "/"
+	}
+
+	changed = encoded != name
+	return
+}
+
+// Reverse encodeName.
+func decodeName(name string) string {
+	if name == "" {
+		return name
+	}
+
+	body, isDir := strings.CutSuffix(name, "/")
+	segs := strings.Split(body, "/")
+	for i, s := range segs {
+		last := i == len(segs)-1
+		var trailingSlash bool
+		segs[i], trailingSlash = decodeSegment(s, last && !isDir)
+		if trailingSlash {
+			isDir = true
+		}
+	}
+
+	decoded := strings.Join(segs, "/")
+	if isDir {
+		decoded += "/"
+	}
+
+	return decoded
+}
+
+// Escape the name of an object returned for a request for the given name,
+// counting names that had to change.
+func (b *nameEncodingBucket) localName(ctx context.Context, n string, reqName string) string {
+	encoded, changed := encodeName(n, !strings.HasSuffix(reqName, "/"))
+	if changed {
+		b.metricHandle.EncodedNameCount(ctx, 1, nil)
+	}
+	return encoded
+}
+
+func (b *nameEncodingBucket) Name() string {
+	return b.wrapped.Name()
+}
+
+func (b *nameEncodingBucket) BucketType() gcs.BucketType {
+	return b.wrapped.BucketType()
+}
+
+func (b *nameEncodingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	// Modify the request and call through.
+	mReq := new(gcs.ReadObjectRequest)
+	*mReq = *req
+	mReq.Name = decodeName(req.Name)
+
+	rc, err = b.wrapped.NewReader(ctx, mReq)
+	return
+}
+
+func (b *nameEncodingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
+	// Modify the request and call through.
+	mReq := new(gcs.CreateObjectRequest)
+	*mReq = *req
+	mReq.Name = decodeName(req.Name)
+
+	o, err = b.wrapped.CreateObject(ctx, mReq)
+
+	// Modify the returned object.
+	if o != nil {
+		o.Name = b.localName(ctx, o.Name, req.Name)
+	}
+
+	return
+}
+
+func (b *nameEncodingBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	// Modify the request and call through.
+	mReq := new(gcs.CreateObjectRequest)
+	*mReq = *req
+	mReq.Name = decodeName(req.Name)
+
+	wc, err := b.wrapped.CreateObjectChunkWriter(ctx, mReq, chunkSize, callBack)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nameEncodingWriter{Writer: wc, name: req.Name}, nil
+}
+
+func (b *nameEncodingBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (o *gcs.MinObject, err error) {
+	reqName := w.ObjectName()
+	if ew, ok := w.(*nameEncodingWriter); ok {
+		w = ew.Writer
+	}
+
+	o, err = b.wrapped.FinalizeUpload(ctx, w)
+
+	// Modify the returned object.
+	if o != nil {
+		o.Name = b.localName(ctx, o.Name, reqName)
+	}
+
+	return
+}
+
+func (b *nameEncodingBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (o *gcs.Object, err error) {
+	// Modify the request and call through.
+	mReq := new(gcs.CopyObjectRequest)
+	*mReq = *req
+	mReq.SrcName = decodeName(req.SrcName)
+	mReq.DstName = decodeName(req.DstName)
+
+	o, err = b.wrapped.CopyObject(ctx, mReq)
+
+	// Modify the returned object.
+	if o != nil {
+		o.Name = b.localName(ctx, o.Name, req.DstName)
+	}
+
+	return
+}
+
+func (b *nameEncodingBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
+	// Modify the request and call through.
+	mReq := new(gcs.ComposeObjectsRequest)
+	*mReq = *req
+	mReq.DstName = decodeName(req.DstName)
+
+	mReq.Sources = nil
+	for _, s := range req.Sources {
+		s.Name = decodeName(s.Name)
+		mReq.Sources = append(mReq.Sources, s)
+	}
+
+	o, err = b.wrapped.ComposeObjects(ctx, mReq)
+
+	// Modify the returned object.
+	if o != nil {
+		o.Name = b.localName(ctx, o.Name, req.DstName)
+	}
+
+	return
+}
+
+func (b *nameEncodingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	// Modify the request and call through.
+	mReq := new(gcs.StatObjectRequest)
+	*mReq = *req
+	mReq.Name = decodeName(req.Name)
+
+	m, e, err = b.wrapped.StatObject(ctx, mReq)
+
+	// Modify the returned object.
+	if m != nil {
+		m.Name = b.localName(ctx, m.Name, req.Name)
+	}
+
+	return
+}
+
+func (b *nameEncodingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (l *gcs.Listing, err error) {
+	// Modify the request and call through.
+	mReq := new(gcs.ListObjectsRequest)
+	*mReq = *req
+	mReq.Prefix = decodeName(req.Prefix)
+
+	l, err = b.wrapped.ListObjects(ctx, mReq)
+
+	// Modify the returned listing.
+	if l != nil {
+		var files []*gcs.MinObject
+		for _, o := range l.MinObjects {
+			// Expose the content of an object whose name ends in a slash as a
+			// file next to the directory. Listings of every object under a
+			// prefix, as for renames, must not see it twice.
+			if req.Delimiter != "" && strings.HasSuffix(o.Name, "/") && o.Size > 0 {
+				f := *o
+				f.Name = b.localName(ctx, o.Name, "")
+				files = append(files, &f)
+			}
+
+			o.Name = b.localName(ctx, o.Name, "/")
+		}
+		l.MinObjects = append(l.MinObjects, files...)
+
+		for i, n := range l.CollapsedRuns {
+			l.CollapsedRuns[i] = b.localName(ctx, n, "/")
+		}
+	}
+
+	return
+}
+
+func (b *nameEncodingBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (o *gcs.Object, err error) {
+	// Modify the request and call through.
+	mReq := new(gcs.UpdateObjectRequest)
+	*mReq = *req
+	mReq.Name = decodeName(req.Name)
+
+	o, err = b.wrapped.UpdateObject(ctx, mReq)
+
+	// Modify the returned object.
+	if o != nil {
+		o.Name = b.localName(ctx, o.Name, req.Name)
+	}
+
+	return
+}
+
+func (b *nameEncodingBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) (err error) {
+	// Modify the request and call through.
+	mReq := new(gcs.DeleteObjectRequest)
+	*mReq = *req
+	mReq.Name = decodeName(req.Name)
+
+	err = b.wrapped.DeleteObject(ctx, mReq)
+	return
+}
+
+func (b *nameEncodingBucket) DeleteFolder(ctx context.Context, folderName string) (err error) {
+	return b.wrapped.DeleteFolder(ctx, decodeName(folderName))
+}
+
+func (b *nameEncodingBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	f, err := b.wrapped.GetFolder(ctx, decodeName(folderName))
+
+	// Modify the returned folder.
+	if f != nil {
+		f.Name = b.localName(ctx, f.Name, "/")
+	}
+
+	return f, err
+}
+
+func (b *nameEncodingBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	f, err := b.wrapped.CreateFolder(ctx, decodeName(folderName))
+
+	// Modify the returned folder.
+	if f != nil {
+		f.Name = b.localName(ctx, f.Name, "/")
+	}
+
+	return f, err
+}
+
+func (b *nameEncodingBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	f, err := b.wrapped.RenameFolder(ctx, decodeName(folderName), decodeName(destinationFolderId))
+
+	// Modify the returned folder.
+	if f != nil {
+		f.Name = b.localName(ctx, f.Name, "/")
+	}
+
+	return f, err
+}
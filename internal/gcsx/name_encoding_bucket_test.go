@@ -0,0 +1,197 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+func TestEncodeName(t *testing.T) {
+	testCases := []struct {
+		name    string
+		asFile  bool
+		encoded string
+	}{
+		{name: "", encoded: ""},
+		{name: "foo", encoded: "foo"},
+		{name: "dir/foo", encoded: "dir/foo"},
+		{name: "dir/", encoded: "dir/"},
+		{name: "100%.txt", encoded: "100%.txt"},
+		{name: "a//b", encoded: "a/%/b"},
+		{name: "/a", encoded: "%/a"},
+		{name: "a//", encoded: "a/%/"},
+		{name: "/", encoded: "%/"},
+		{name: "dir/./x", encoded: "dir/%2E/x"},
+		{name: "dir/../x", encoded: "dir/%2E%2E/x"},
+		{name: "tab\there", encoded: "tab%09here"},
+		{name: "del\x7f", encoded: "del%7F"},
+		{name: "dir/foo/", asFile: true, encoded: "dir/foo%2F"},
+		{name: "dir/./", asFile: true, encoded: "dir/.%2F"},
+		{name: "a//", asFile: true, encoded: "a/%2F"},
+		{name: "50%25", encoded: "50%2525"},
+		{name: "%", encoded: "%25"},
+		{name: "%2E/x", encoded: "%252E/x"},
+		{name: "%2E%2E", encoded: "%252E%2E"},
+		{name: "x%2F", encoded: "x%252F"},
+		{name: "x%2F/", encoded: "x%2F/"},
+		{name: "x%2F/", asFile: true, encoded: "x%252F%2F"},
+		{name: "%0A", encoded: "%250A"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded, changed := encodeName(tc.name, tc.asFile)
+
+			assert.Equal(t, tc.encoded, encoded)
+			assert.Equal(t, tc.encoded != tc.name, changed)
+			assert.Equal(t, tc.name, decodeName(encoded))
+		})
+	}
+}
+
+// A metric handle that counts encoded names.
+type encodedNameCounter struct {
+	common.MetricHandle
+	count int64
+}
+
+func (c *encodedNameCounter) EncodedNameCount(_ context.Context, inc int64, _ []common.MetricAttr) {
+	c.count += inc
+}
+
+type NameEncodingBucketTest struct {
+	suite.Suite
+	ctx     context.Context
+	metrics *encodedNameCounter
+	wrapped gcs.Bucket
+	bucket  gcs.Bucket
+}
+
+func TestNameEncodingBucketSuite(t *testing.T) {
+	suite.Run(t, new(NameEncodingBucketTest))
+}
+
+func (t *NameEncodingBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.metrics = &encodedNameCounter{MetricHandle: common.NewNoopMetrics()}
+	t.wrapped = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	t.bucket = NewNameEncodingBucket(t.metrics, t.wrapped)
+
+	err := storageutil.CreateObjects(t.ctx, t.wrapped, map[string][]byte{
+		"a//b":     []byte("taco"),
+		"dir/./x":  []byte("burrito"),
+		"dir/foo/": []byte("enchilada"),
+		"plain":    []byte("queso"),
+	})
+	require.NoError(t.T(), err)
+}
+
+func (t *NameEncodingBucketTest) list(prefix string) (names []string) {
+	l, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{
+		Prefix:                   prefix,
+		Delimiter:                "/",
+		IncludeTrailingDelimiter: true,
+	})
+	require.NoError(t.T(), err)
+
+	for _, o := range l.MinObjects {
+		names = append(names, o.Name)
+	}
+	names = append(names, l.CollapsedRuns...)
+	return
+}
+
+func (t *NameEncodingBucketTest) TestListsEscapedNames() {
+	assert.ElementsMatch(t.T(), []string{"a/", "dir/", "plain"}, t.list(""))
+	assert.ElementsMatch(t.T(), []string{"a/%/"}, t.list("a/"))
+	assert.ElementsMatch(t.T(), []string{"a/%/b"}, t.list("a/%/"))
+	assert.ElementsMatch(t.T(), []string{"dir/%2E/", "dir/foo/", "dir/foo/", "dir/foo%2F"}, t.list("dir/"))
+	assert.ElementsMatch(t.T(), []string{"dir/%2E/x"}, t.list("dir/%2E/"))
+	assert.Positive(t.T(), t.metrics.count)
+}
+
+func (t *NameEncodingBucketTest) TestUndelimitedListingHasNoExtraFiles() {
+	l, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: "dir/"})
+	require.NoError(t.T(), err)
+
+	var names []string
+	for _, o := range l.MinObjects {
+		names = append(names, o.Name)
+	}
+	assert.ElementsMatch(t.T(), []string{"dir/%2E/x", "dir/foo/"}, names)
+}
+
+func (t *NameEncodingBucketTest) TestReadsAndStatsEscapedNames() {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "a/%/b")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+
+	contents, err = storageutil.ReadObject(t.ctx, t.bucket, "dir/foo%2F")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "enchilada", string(contents))
+
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/foo%2F"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "dir/foo%2F", m.Name)
+
+	m, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/foo/"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "dir/foo/", m.Name)
+
+	m, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "plain"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "plain", m.Name)
+}
+
+func (t *NameEncodingBucketTest) TestWritesUnderEscapedNames() {
+	o, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     "a/%/c",
+		Contents: strings.NewReader("salsa"),
+	})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "a/%/c", o.Name)
+
+	contents, err := storageutil.ReadObject(t.ctx, t.wrapped, "a//c")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "salsa", string(contents))
+}
+
+func (t *NameEncodingBucketTest) TestRenamesEscapedNames() {
+	_, err := t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{
+		SrcName: "dir/%2E/x",
+		DstName: "x",
+	})
+	require.NoError(t.T(), err)
+	err = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "dir/%2E/x"})
+	require.NoError(t.T(), err)
+
+	contents, err := storageutil.ReadObject(t.ctx, t.wrapped, "x")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "burrito", string(contents))
+	_, _, err = t.wrapped.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/./x"})
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
@@ -29,6 +29,7 @@ import (
 	cacheutil "github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/ratelimit"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 	"github.com/jacobsa/fuse/fuseops"
@@ -134,6 +135,10 @@ type randomReader struct {
 	// using fileCacheHandler for the given object and bucket.
 	fileCacheHandle *file.CacheHandle
 	metricHandle    common.MetricHandle
+
+	// The caller of the ReadAt in progress, which the bytes streamed by reader
+	// are accounted to.
+	caller ratelimit.CallerSlot
 }
 
 func (rr *randomReader) CheckInvariants() {
@@ -272,6 +277,8 @@ func (rr *randomReader) ReadAt(
 		return
 	}
 
+	rr.caller.SetFrom(ctx)
+
 	// Note: If we are reading the file for the first time and read type is sequential
 	// then the file cache behavior is write-through i.e. data is first read from
 	// GCS, cached in file and then served from that file. But the cacheHit is
@@ -495,8 +502,10 @@ func (rr *randomReader) startRead(
 		end = start + maxSizeToReadFromGCS
 	}
 
-	// Begin the read.
-	ctx, cancel := context.WithCancel(context.Background())
+	// Begin the read. The reader outlives this op, so it can't use its
+	// context. Later ops may read from it for other callers, so its bytes are
+	// accounted to the caller of each ReadAt as they are read.
+	ctx, cancel := context.WithCancel(ratelimit.WithCallerSlot(context.Background(), &rr.caller))
 	rc, err := rr.bucket.NewReader(
 		ctx,
 		&gcs.ReadObjectRequest{
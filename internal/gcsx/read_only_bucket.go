@@ -0,0 +1,121 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"fmt"
+	"io"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// NewReadOnlyBucket creates a view on the wrapped bucket that passes reads
+// through and fails every method that would modify the bucket with an error
+// wrapping syscall.EROFS.
+func NewReadOnlyBucket(wrapped gcs.Bucket) gcs.Bucket {
+	return &readOnlyBucket{
+		wrapped: wrapped,
+	}
+}
+
+type readOnlyBucket struct {
+	wrapped gcs.Bucket
+}
+
+func (b *readOnlyBucket) errReadOnly() error {
+	return fmt.Errorf("bucket %q is read-only: %w", b.wrapped.Name(), syscall.EROFS)
+}
+
+func (b *readOnlyBucket) Name() string {
+	return b.wrapped.Name()
+}
+
+func (b *readOnlyBucket) BucketType() gcs.BucketType {
+	return b.wrapped.BucketType()
+}
+
+func (b *readOnlyBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	return b.wrapped.NewReader(ctx, req)
+}
+
+func (b *readOnlyBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	return nil, b.errReadOnly()
+}
+
+func (b *readOnlyBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	return nil, b.errReadOnly()
+}
+
+func (b *readOnlyBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (*gcs.MinObject, error) {
+	return nil, b.errReadOnly()
+}
+
+func (b *readOnlyBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	return nil, b.errReadOnly()
+}
+
+func (b *readOnlyBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	return nil, b.errReadOnly()
+}
+
+func (b *readOnlyBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	return b.wrapped.StatObject(ctx, req)
+}
+
+func (b *readOnlyBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	return b.wrapped.ListObjects(ctx, req)
+}
+
+func (b *readOnlyBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	return nil, b.errReadOnly()
+}
+
+func (b *readOnlyBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) error {
+	return b.errReadOnly()
+}
+
+func (b *readOnlyBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	return b.errReadOnly()
+}
+
+func (b *readOnlyBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return b.wrapped.GetFolder(ctx, folderName)
+}
+
+func (b *readOnlyBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return nil, b.errReadOnly()
+}
+
+func (b *readOnlyBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	return nil, b.errReadOnly()
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type ReadOnlyBucketTest struct {
+	suite.Suite
+	ctx     context.Context
+	wrapped gcs.Bucket
+	bucket  gcs.Bucket
+}
+
+func TestReadOnlyBucketSuite(t *testing.T) {
+	suite.Run(t, new(ReadOnlyBucketTest))
+}
+
+func (t *ReadOnlyBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.wrapped = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	t.bucket = gcsx.NewReadOnlyBucket(t.wrapped)
+
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, "foo", []byte("taco"))
+	require.NoError(t.T(), err)
+}
+
+func (t *ReadOnlyBucketTest) TestName() {
+	assert.Equal(t.T(), "some_bucket", t.bucket.Name())
+}
+
+func (t *ReadOnlyBucketTest) TestReadsPassThrough() {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "foo")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(len("taco")), m.Size)
+
+	l, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{})
+	require.NoError(t.T(), err)
+	require.Len(t.T(), l.MinObjects, 1)
+	assert.Equal(t.T(), "foo", l.MinObjects[0].Name)
+}
+
+func (t *ReadOnlyBucketTest) TestCreateObjectFails() {
+	_, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     "bar",
+		Contents: strings.NewReader("burrito"),
+	})
+
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+	_, _, err = t.wrapped.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "bar"})
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *ReadOnlyBucketTest) TestMutationsFail() {
+	_, err := t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: "foo", DstName: "bar"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	_, err = t.bucket.ComposeObjects(t.ctx, &gcs.ComposeObjectsRequest{
+		DstName: "bar",
+		Sources: []gcs.ComposeSource{{Name: "foo"}},
+	})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	_, err = t.bucket.UpdateObject(t.ctx, &gcs.UpdateObjectRequest{Name: "foo"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	err = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "foo"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	_, err = t.bucket.CreateFolder(t.ctx, "dir")
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	// The object is untouched.
+	contents, err := storageutil.ReadObject(t.ctx, t.wrapped, "foo")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+}
@@ -0,0 +1,315 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// errSnapshotReadOnly is returned by every method of a snapshot bucket that
+// would modify the bucket.
+var errSnapshotReadOnly = fmt.Errorf("snapshot bucket is read-only: %w", syscall.EROFS)
+
+// NewSnapshotBucket creates a read-only view on the wrapped bucket as it was at
+// the supplied time. Every listing and stat resolves to the generation of each
+// object that was live at that time, found through versioned listings of the
+// wrapped bucket, so the view doesn't change while writers keep updating the
+// bucket.
+//
+// The wrapped bucket must have object versioning enabled, and must have had it
+// enabled since before asOf; otherwise generations that were overwritten or
+// deleted since then are gone and silently missing from the view. Managed
+// folders are not versioned, so GetFolder reflects the current state.
+func NewSnapshotBucket(asOf time.Time, wrapped gcs.Bucket) gcs.Bucket {
+	return &snapshotBucket{
+		asOf:    asOf,
+		wrapped: wrapped,
+	}
+}
+
+type snapshotBucket struct {
+	asOf    time.Time
+	wrapped gcs.Bucket
+}
+
+// Was the given generation live at the snapshot time?
+func (b *snapshotBucket) liveAt(o *gcs.MinObject) bool {
+	return !o.Created.After(b.asOf) && (o.Deleted.IsZero() || o.Deleted.After(b.asOf))
+}
+
+// List every generation matching the request, following continuation tokens
+// until the wrapped bucket is exhausted.
+func (b *snapshotBucket) listVersions(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (l *gcs.Listing, err error) {
+	mReq := new(gcs.ListObjectsRequest)
+	*mReq = *req
+	mReq.Versions = true
+	mReq.ContinuationToken = ""
+
+	l = new(gcs.Listing)
+	for {
+		var page *gcs.Listing
+		page, err = b.wrapped.ListObjects(ctx, mReq)
+		if err != nil {
+			return
+		}
+
+		l.MinObjects = append(l.MinObjects, page.MinObjects...)
+		l.CollapsedRuns = append(l.CollapsedRuns, page.CollapsedRuns...)
+
+		if page.ContinuationToken == "" {
+			return
+		}
+		mReq.ContinuationToken = page.ContinuationToken
+	}
+}
+
+// Does any object under the given prefix have a generation that was live at
+// the snapshot time? Each level is listed with a delimiter, and deeper levels
+// are only looked at while nothing live has been found, so a directory with a
+// file of its own costs a single listing.
+func (b *snapshotBucket) prefixLiveAt(ctx context.Context, prefix string) (live bool, err error) {
+	req := &gcs.ListObjectsRequest{
+		Prefix:    prefix,
+		Delimiter: "/",
+		Versions:  true,
+	}
+
+	var runs []string
+	for {
+		var page *gcs.Listing
+		page, err = b.wrapped.ListObjects(ctx, req)
+		if err != nil {
+			return
+		}
+
+		for _, o := range page.MinObjects {
+			if b.liveAt(o) {
+				live = true
+				return
+			}
+		}
+		runs = append(runs, page.CollapsedRuns...)
+
+		if page.ContinuationToken == "" {
+			break
+		}
+		req.ContinuationToken = page.ContinuationToken
+	}
+
+	for _, r := range runs {
+		live, err = b.prefixLiveAt(ctx, r)
+		if err != nil || live {
+			return
+		}
+	}
+
+	return
+}
+
+// Find the generation of the named object that was live at the snapshot time,
+// returning a *gcs.NotFoundError if there was none.
+func (b *snapshotBucket) resolve(ctx context.Context, name string) (o *gcs.MinObject, err error) {
+	// A live generation created before the snapshot was live at the time too,
+	// which saves listing the versions of an object that hasn't changed since.
+	o, _, err = b.wrapped.StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+	var notFoundErr *gcs.NotFoundError
+	switch {
+	case errors.As(err, &notFoundErr):
+		err = nil
+	case err != nil:
+		return
+	case !o.Created.IsZero() && !o.Created.After(b.asOf):
+		return
+	}
+
+	// Otherwise list the generations of exactly this name; the end offset is
+	// the first name past it.
+	l, err := b.listVersions(ctx, &gcs.ListObjectsRequest{
+		Prefix:      name,
+		StartOffset: name,
+		EndOffset:   name + "\x00",
+	})
+	if err != nil {
+		return
+	}
+
+	for _, m := range l.MinObjects {
+		if m.Name == name && b.liveAt(m) {
+			o = m
+			return
+		}
+	}
+
+	o = nil
+	err = &gcs.NotFoundError{
+		Err: fmt.Errorf("object %q did not exist at %v", name, b.asOf.Format(time.RFC3339)),
+	}
+	return
+}
+
+func (b *snapshotBucket) Name() string {
+	return b.wrapped.Name()
+}
+
+func (b *snapshotBucket) BucketType() gcs.BucketType {
+	return b.wrapped.BucketType()
+}
+
+func (b *snapshotBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	mReq := new(gcs.ReadObjectRequest)
+	*mReq = *req
+
+	// Without an explicit generation the wrapped bucket would serve the live
+	// one.
+	if mReq.Generation == 0 {
+		var o *gcs.MinObject
+		o, err = b.resolve(ctx, req.Name)
+		if err != nil {
+			return
+		}
+		mReq.Generation = o.Generation
+	}
+
+	rc, err = b.wrapped.NewReader(ctx, mReq)
+	return
+}
+
+func (b *snapshotBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	return nil, errSnapshotReadOnly
+}
+
+func (b *snapshotBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	return nil, errSnapshotReadOnly
+}
+
+func (b *snapshotBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (*gcs.MinObject, error) {
+	return nil, errSnapshotReadOnly
+}
+
+func (b *snapshotBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	return nil, errSnapshotReadOnly
+}
+
+func (b *snapshotBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	return nil, errSnapshotReadOnly
+}
+
+func (b *snapshotBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	m, err = b.resolve(ctx, req.Name)
+	if err != nil {
+		return
+	}
+
+	// Versioned listings carry no extended attributes, so only the deletion
+	// time is known.
+	if req.ReturnExtendedObjectAttributes {
+		e = &gcs.ExtendedObjectAttributes{Deleted: m.Deleted}
+	}
+
+	return
+}
+
+// ListObjects serves a page of the versioned listing of the wrapped bucket,
+// keeping the generations that were live at the snapshot time. Continuation
+// tokens are those of the wrapped bucket. Pages left empty by the filtering
+// are skipped, so that an empty page is only ever the last.
+func (b *snapshotBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (l *gcs.Listing, err error) {
+	mReq := new(gcs.ListObjectsRequest)
+	*mReq = *req
+	mReq.Versions = true
+
+	l = new(gcs.Listing)
+	for {
+		var page *gcs.Listing
+		page, err = b.wrapped.ListObjects(ctx, mReq)
+		if err != nil {
+			return
+		}
+
+		for _, o := range page.MinObjects {
+			if b.liveAt(o) {
+				l.MinObjects = append(l.MinObjects, o)
+			}
+		}
+
+		// A collapsed run only existed if some object under it did.
+		for _, p := range page.CollapsedRuns {
+			var live bool
+			live, err = b.prefixLiveAt(ctx, p)
+			if err != nil {
+				return
+			}
+
+			if live {
+				l.CollapsedRuns = append(l.CollapsedRuns, p)
+			}
+		}
+
+		l.ContinuationToken = page.ContinuationToken
+		if len(l.MinObjects) > 0 || len(l.CollapsedRuns) > 0 || l.ContinuationToken == "" {
+			return
+		}
+		mReq.ContinuationToken = l.ContinuationToken
+	}
+}
+
+func (b *snapshotBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	return nil, errSnapshotReadOnly
+}
+
+func (b *snapshotBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) error {
+	return errSnapshotReadOnly
+}
+
+func (b *snapshotBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	return errSnapshotReadOnly
+}
+
+func (b *snapshotBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return b.wrapped.GetFolder(ctx, folderName)
+}
+
+func (b *snapshotBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return nil, errSnapshotReadOnly
+}
+
+func (b *snapshotBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	return nil, errSnapshotReadOnly
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// listRecorder records the listings made through it.
+type listRecorder struct {
+	gcs.Bucket
+	reqs []gcs.ListObjectsRequest
+}
+
+func (r *listRecorder) ListObjects(ctx context.Context, req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	r.reqs = append(r.reqs, *req)
+	return r.Bucket.ListObjects(ctx, req)
+}
+
+type SnapshotBucketTest struct {
+	suite.Suite
+	ctx     context.Context
+	clock   *timeutil.SimulatedClock
+	wrapped gcs.Bucket
+}
+
+func TestSnapshotBucketSuite(t *testing.T) {
+	suite.Run(t, new(SnapshotBucketTest))
+}
+
+func (t *SnapshotBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.clock = &timeutil.SimulatedClock{}
+	t.clock.SetTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	t.wrapped = fake.NewFakeVersionedBucket(t.clock, "some_bucket", gcs.NonHierarchical)
+}
+
+// Take a snapshot of the wrapped bucket as of now, then move the clock on so
+// that later changes fall after it.
+func (t *SnapshotBucketTest) snapshot() gcs.Bucket {
+	b := gcsx.NewSnapshotBucket(t.clock.Now(), t.wrapped)
+	t.clock.AdvanceTime(time.Minute)
+	return b
+}
+
+func (t *SnapshotBucketTest) create(name, contents string) {
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, name, []byte(contents))
+	require.NoError(t.T(), err)
+	t.clock.AdvanceTime(time.Second)
+}
+
+func (t *SnapshotBucketTest) delete(name string) {
+	err := t.wrapped.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: name})
+	require.NoError(t.T(), err)
+	t.clock.AdvanceTime(time.Second)
+}
+
+func (t *SnapshotBucketTest) TestReadsGenerationLiveAtSnapshot() {
+	t.create("foo", "taco")
+	b := t.snapshot()
+	t.create("foo", "burrito")
+
+	contents, err := storageutil.ReadObject(t.ctx, b, "foo")
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+}
+
+func (t *SnapshotBucketTest) TestStatObject() {
+	t.create("foo", "taco")
+	t.create("deleted_before", "queso")
+	t.delete("deleted_before")
+	t.create("deleted_after", "salsa")
+	b := t.snapshot()
+	t.create("foo", "burrito")
+	t.delete("deleted_after")
+	t.create("created_after", "enchilada")
+
+	m, _, err := b.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(len("taco")), m.Size)
+
+	_, _, err = b.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "deleted_after"})
+	assert.NoError(t.T(), err)
+
+	for _, name := range []string{"deleted_before", "created_after", "fo"} {
+		_, _, err = b.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+		var notFoundErr *gcs.NotFoundError
+		assert.ErrorAs(t.T(), err, &notFoundErr, name)
+	}
+}
+
+func (t *SnapshotBucketTest) TestListObjects() {
+	t.create("a", "")
+	t.create("b", "")
+	t.create("dir/c", "")
+	t.create("gone/d", "")
+	t.delete("gone/d")
+	t.create("kept/e", "")
+	b := t.snapshot()
+	t.create("a", "overwritten")
+	t.delete("b")
+	t.delete("kept/e")
+	t.create("new", "")
+	t.create("newdir/f", "")
+
+	l, err := b.ListObjects(t.ctx, &gcs.ListObjectsRequest{Delimiter: "/"})
+
+	require.NoError(t.T(), err)
+	var names []string
+	for _, o := range l.MinObjects {
+		names = append(names, o.Name)
+	}
+	assert.Equal(t.T(), []string{"a", "b"}, names)
+	assert.Equal(t.T(), uint64(0), l.MinObjects[0].Size)
+	assert.Equal(t.T(), []string{"dir/", "kept/"}, l.CollapsedRuns)
+	assert.Equal(t.T(), "", l.ContinuationToken)
+}
+
+func (t *SnapshotBucketTest) TestStatObjectListsOnlyTheName() {
+	t.create("foo", "taco")
+	t.create("foo_sibling", "")
+	t.create("bar", "queso")
+	recorder := &listRecorder{Bucket: t.wrapped}
+	b := gcsx.NewSnapshotBucket(t.clock.Now(), recorder)
+	t.clock.AdvanceTime(time.Minute)
+	t.create("foo", "burrito")
+
+	// Unchanged since the snapshot: no listing at all.
+	_, _, err := b.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "bar"})
+	require.NoError(t.T(), err)
+	assert.Empty(t.T(), recorder.reqs)
+
+	// Overwritten since: a listing of exactly the name.
+	m, _, err := b.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(len("taco")), m.Size)
+	require.Len(t.T(), recorder.reqs, 1)
+	assert.Equal(t.T(), "foo", recorder.reqs[0].StartOffset)
+	assert.Equal(t.T(), "foo\x00", recorder.reqs[0].EndOffset)
+}
+
+func (t *SnapshotBucketTest) TestListObjectsPaginates() {
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		t.create(name, "")
+	}
+	b := t.snapshot()
+	t.create("a", "overwritten")
+	t.create("b", "overwritten")
+	t.create("c", "overwritten")
+
+	var names []string
+	req := &gcs.ListObjectsRequest{MaxResults: 2}
+	for {
+		l, err := b.ListObjects(t.ctx, req)
+		require.NoError(t.T(), err)
+		assert.LessOrEqual(t.T(), len(l.MinObjects), 2)
+		for _, o := range l.MinObjects {
+			names = append(names, o.Name)
+		}
+
+		if l.ContinuationToken == "" {
+			break
+		}
+		req.ContinuationToken = l.ContinuationToken
+	}
+
+	assert.Equal(t.T(), []string{"a", "b", "c", "d", "e"}, names)
+}
+
+func (t *SnapshotBucketTest) TestMutationsAreRejected() {
+	t.create("foo", "taco")
+	b := t.snapshot()
+
+	_, err := storageutil.CreateObject(t.ctx, b, "bar", []byte("burrito"))
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	err = b.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "foo"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	_, err = b.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: "foo", DstName: "bar"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	// Nothing reached the wrapped bucket.
+	_, _, err = t.wrapped.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "bar"})
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
@@ -21,6 +21,13 @@ import (
 type SyncerBucket struct {
 	gcs.Bucket
 	Syncer
+
+	// Whether the bucket was set up read-only, letting the file system refuse
+	// writes up front. See BucketConfig.ReadOnly.
+	ReadOnly bool
+
+	// Whether reads of the bucket bypass the file cache.
+	DisableFileCache bool
 }
 
 // NewSyncerBucket creates a SyncerBucket, which can be used either as
@@ -32,5 +39,5 @@ func NewSyncerBucket(
 	bucket gcs.Bucket,
 ) SyncerBucket {
 	syncer := NewSyncer(appendThreshold, chunkTransferTimeoutSecs, tmpObjectPrefix, bucket)
-	return SyncerBucket{bucket, syncer}
+	return SyncerBucket{Bucket: bucket, Syncer: syncer}
 }
@@ -15,14 +15,17 @@
 package gcsx
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
+	"syscall"
 	"time"
 
 	"github.com/jacobsa/fuse/fsutil"
 	"github.com/jacobsa/timeutil"
+	"golang.org/x/sys/unix"
 )
 
 // TempFile is a temporary file that keeps track of the lowest offset at which
@@ -39,6 +42,11 @@ type TempFile interface {
 	io.WriterAt
 	Truncate(n int64) (err error)
 
+	// Semantics matching fallocate(2). Preallocated space past the end of the
+	// file and punched or zeroed ranges are tracked as holes, which read as
+	// zeros without touching the backing file.
+	Fallocate(mode uint32, offset int64, length int64) (err error)
+
 	// Retrieve the file name
 	Name() string
 
@@ -137,6 +145,7 @@ func RecoverCacheFile(
 		clock:          clock,
 		f:              source,
 		dirtyThreshold: stat.Size(),
+		size:           stat.Size(),
 	}
 
 	return
@@ -173,11 +182,23 @@ type tempFile struct {
 	// INVARIANT: Stat().DirtyThreshold <= Stat().Size
 	dirtyThreshold int64
 
+	// The size of the file, kept here so that writes needn't stat it. Valid
+	// once the initial contents have been read in.
+	//
+	// INVARIANT: state != fileIncomplete => size == Stat().Size
+	size int64
+
 	// The time at which a method that modifies our contents was last called, or
 	// nil if never.
 	//
 	// INVARIANT: mtime == nil => Stat().DirtyThreshold == Stat().Size
 	mtime *time.Time
+
+	// The ranges of the file known to be zero-filled without having been
+	// written. Reads are served from here rather than from the file.
+	//
+	// INVARIANT: holes.checkInvariants(Stat().Size) does not panic
+	holes holeSet
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -208,6 +229,11 @@ func (tf *tempFile) CheckInvariants() {
 		panic(fmt.Errorf("stat: %w", err))
 	}
 
+	// INVARIANT: state != fileIncomplete => size == Stat().Size
+	if tf.state != fileIncomplete && tf.size != sr.Size {
+		panic(fmt.Errorf("size mismatch: %d vs. %d", tf.size, sr.Size))
+	}
+
 	if !(sr.DirtyThreshold <= sr.Size) {
 		panic(fmt.Errorf("mismatch: %d vs. %d", sr.DirtyThreshold, sr.Size))
 	}
@@ -216,6 +242,9 @@ func (tf *tempFile) CheckInvariants() {
 	if tf.mtime == nil && sr.DirtyThreshold != sr.Size {
 		panic(fmt.Errorf("mismatch: %d vs. %d", sr.DirtyThreshold, sr.Size))
 	}
+
+	// INVARIANT: holes.checkInvariants(Stat().Size) does not panic
+	tf.holes.checkInvariants(sr.Size)
 }
 
 func (tf *tempFile) Destroy() {
@@ -231,7 +260,27 @@ func (tf *tempFile) Read(p []byte) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("cannot Read incomplete file: %w", err)
 	}
-	return tf.f.Read(p)
+
+	if len(tf.holes) == 0 {
+		return tf.f.Read(p)
+	}
+
+	pos, err := tf.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("seek: %w", err)
+	}
+
+	n, err := tf.readAt(p, pos)
+	if _, seekErr := tf.f.Seek(pos+int64(n), io.SeekStart); seekErr != nil {
+		return n, fmt.Errorf("seek: %w", seekErr)
+	}
+
+	// Like os.File, report EOF only when no bytes were read.
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+
+	return n, err
 }
 
 func (tf *tempFile) Seek(offset int64, whence int) (int64, error) {
@@ -247,7 +296,7 @@ func (tf *tempFile) ReadAt(p []byte, offset int64) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("cannot ReadAt incomplete file: %w", err)
 	}
-	return tf.f.ReadAt(p, offset)
+	return tf.readAt(p, offset)
 }
 
 func (tf *tempFile) Stat() (sr StatResult, err error) {
@@ -275,16 +324,20 @@ func (tf *tempFile) WriteAt(p []byte, offset int64) (int, error) {
 		return 0, fmt.Errorf("cannot WriteAt incomplete file: %w", err)
 	}
 
-	// Update our state regarding being dirty.
-	tf.dirtyThreshold = minInt64(tf.dirtyThreshold, offset)
+	// Writing past the end of the file leaves a hole behind.
+	tf.holes.add(tf.size, offset)
+	tf.holes.remove(offset, offset+int64(len(p)))
 
-	tf.state = fileDirty
-
-	newMtime := tf.clock.Now()
-	tf.mtime = &newMtime
+	// Update our state regarding being dirty.
+	tf.markDirty(offset)
 
 	// Call through.
-	return tf.f.WriteAt(p, offset)
+	n, err := tf.f.WriteAt(p, offset)
+	if n > 0 {
+		tf.size = max(tf.size, offset+int64(n))
+	}
+
+	return n, err
 }
 
 func (tf *tempFile) Truncate(n int64) error {
@@ -293,16 +346,91 @@ func (tf *tempFile) Truncate(n int64) error {
 		return fmt.Errorf("cannot Truncate incomplete file: %w", err)
 	}
 
+	// Growing the file extends it with a hole; shrinking it drops the holes
+	// past the new end.
+	tf.holes.remove(n, math.MaxInt64)
+	tf.holes.add(tf.size, n)
+
 	// Update our state regarding being dirty.
-	tf.dirtyThreshold = minInt64(tf.dirtyThreshold, n)
+	tf.markDirty(n)
 
-	tf.state = fileDirty
+	// Call through.
+	if err = tf.f.Truncate(n); err != nil {
+		return err
+	}
 
-	newMtime := tf.clock.Now()
-	tf.mtime = &newMtime
+	tf.size = n
+	return nil
+}
 
-	// Call through.
-	return tf.f.Truncate(n)
+func (tf *tempFile) Fallocate(mode uint32, offset int64, length int64) error {
+	err := tf.ensureComplete()
+	if err != nil {
+		return fmt.Errorf("cannot Fallocate incomplete file: %w", err)
+	}
+
+	if offset < 0 || length <= 0 {
+		return syscall.EINVAL
+	}
+
+	size := tf.size
+	limit := offset + length
+	switch mode {
+	case 0, unix.FALLOC_FL_KEEP_SIZE:
+		// Reserve the space so that running out of it is reported now rather
+		// than at write time. Not all file systems can do so; in that case the
+		// space is reserved lazily as usual.
+		err = unix.Fallocate(int(tf.f.Fd()), mode, offset, length)
+		if err != nil && !errors.Is(err, unix.EOPNOTSUPP) {
+			return fmt.Errorf("fallocate: %w", err)
+		}
+
+		if mode&unix.FALLOC_FL_KEEP_SIZE != 0 || limit <= size {
+			return nil
+		}
+
+		if err != nil {
+			if err = tf.f.Truncate(limit); err != nil {
+				return fmt.Errorf("truncate: %w", err)
+			}
+		}
+
+		tf.size = limit
+		tf.holes.add(size, limit)
+		tf.markDirty(size)
+		return nil
+
+	case unix.FALLOC_FL_PUNCH_HOLE | unix.FALLOC_FL_KEEP_SIZE,
+		unix.FALLOC_FL_ZERO_RANGE | unix.FALLOC_FL_KEEP_SIZE,
+		unix.FALLOC_FL_ZERO_RANGE:
+		// Bytes past the end of the file are only affected if the file grows.
+		end := limit
+		if mode&unix.FALLOC_FL_KEEP_SIZE != 0 {
+			end = min(limit, size)
+		}
+
+		if offset >= end {
+			return nil
+		}
+
+		if err = tf.zero(offset, min(end, size)); err != nil {
+			return err
+		}
+
+		if end > size {
+			if err = tf.f.Truncate(end); err != nil {
+				return fmt.Errorf("truncate: %w", err)
+			}
+			tf.size = end
+		}
+
+		tf.holes.add(offset, end)
+		tf.markDirty(offset)
+		return nil
+
+	default:
+		return syscall.ENOTSUP
+	}
 }
 
 func (tf *tempFile) SetMtime(mtime time.Time) {
@@ -317,6 +445,84 @@ func (tf *tempFile) Name() string {
 // Helpers
 ////////////////////////////////////////////////////////////////////////
 
+// Record a modification of the contents at or after offset.
+func (tf *tempFile) markDirty(offset int64) {
+	tf.dirtyThreshold = minInt64(tf.dirtyThreshold, offset)
+
+	tf.state = fileDirty
+
+	newMtime := tf.clock.Now()
+	tf.mtime = &newMtime
+}
+
+// Serve a read with the semantics of io.ReaderAt, filling holes with zeros
+// rather than reading them from the file.
+func (tf *tempFile) readAt(p []byte, offset int64) (n int, err error) {
+	if len(tf.holes) == 0 {
+		return tf.f.ReadAt(p, offset)
+	}
+
+	for n < len(p) {
+		pos := offset + int64(n)
+		chunk := p[n:]
+
+		// Within a hole, the bytes are zeros.
+		if h, ok := tf.holes.find(pos); ok {
+			chunk = chunk[:min(int64(len(chunk)), h.limit-pos)]
+			clear(chunk)
+			n += len(chunk)
+			continue
+		}
+
+		// Otherwise read from the file, up to the start of the next hole.
+		if h, ok := tf.holes.next(pos); ok {
+			chunk = chunk[:min(int64(len(chunk)), h.start-pos)]
+		}
+
+		var m int
+		m, err = tf.f.ReadAt(chunk, pos)
+		n += m
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Zero the range [start, limit) of the file, which must lie within it, freeing
+// the backing space where the file system allows it.
+func (tf *tempFile) zero(start, limit int64) error {
+	if start >= limit {
+		return nil
+	}
+
+	err := unix.Fallocate(
+		int(tf.f.Fd()),
+		unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE,
+		start,
+		limit-start)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, unix.EOPNOTSUPP) {
+		return fmt.Errorf("fallocate: %w", err)
+	}
+
+	// Fall back to writing the zeros out.
+	buf := make([]byte, min(limit-start, 1<<20))
+	for start < limit {
+		chunk := buf[:min(int64(len(buf)), limit-start)]
+		if _, err = tf.f.WriteAt(chunk, start); err != nil {
+			return fmt.Errorf("WriteAt: %w", err)
+		}
+		start += int64(len(chunk))
+	}
+
+	return nil
+}
+
 func minInt64(a int64, b int64) int64 {
 	if a < b {
 		return a
@@ -344,6 +550,7 @@ func (tf *tempFile) ensure(limit int64) error {
 		if err == io.EOF {
 			tf.source.Close()
 			tf.dirtyThreshold = size + n
+			tf.size = size + n
 			tf.state = fileComplete
 			err = nil
 		}
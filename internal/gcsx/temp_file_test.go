@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -26,6 +27,7 @@ import (
 	. "github.com/jacobsa/ogletest"
 	"github.com/jacobsa/timeutil"
 	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
 )
 
 func TestTempFile(t *testing.T) { RunTests(t) }
@@ -104,6 +106,12 @@ func (tf *checkingTempFile) Truncate(n int64) error {
 	return tf.wrapped.Truncate(n)
 }
 
+func (tf *checkingTempFile) Fallocate(mode uint32, o int64, l int64) error {
+	tf.wrapped.CheckInvariants()
+	defer tf.wrapped.CheckInvariants()
+	return tf.wrapped.Fallocate(mode, o, l)
+}
+
 func (tf *checkingTempFile) SetMtime(mtime time.Time) {
 	tf.wrapped.CheckInvariants()
 	defer tf.wrapped.CheckInvariants()
@@ -249,3 +257,102 @@ func (t *TempFileTest) SetMtime() {
 	AssertEq(nil, err)
 	ExpectThat(sr.Mtime, Pointee(timeutil.TimeEq(mtime)))
 }
+
+func (t *TempFileTest) Fallocate_Extend() {
+	// Call
+	err := t.tf.Fallocate(0, int64(initialContentSize)+2, 3)
+	AssertEq(nil, err)
+
+	// Check Stat.
+	sr, err := t.tf.Stat()
+
+	AssertEq(nil, err)
+	ExpectEq(initialContentSize+5, sr.Size)
+	ExpectEq(initialContentSize, sr.DirtyThreshold)
+	ExpectThat(sr.Mtime, Pointee(timeutil.TimeEq(t.clock.Now())))
+
+	// Read back.
+	actual, err := readAll(&t.tf)
+	AssertEq(nil, err)
+	ExpectEq(initialContent+"\x00\x00\x00\x00\x00", string(actual))
+}
+
+func (t *TempFileTest) Fallocate_KeepSize() {
+	// Call
+	err := t.tf.Fallocate(unix.FALLOC_FL_KEEP_SIZE, 0, 100)
+	AssertEq(nil, err)
+
+	// Nothing should have changed.
+	sr, err := t.tf.Stat()
+
+	AssertEq(nil, err)
+	ExpectEq(initialContentSize, sr.Size)
+	ExpectEq(initialContentSize, sr.DirtyThreshold)
+	ExpectEq(nil, sr.Mtime)
+}
+
+func (t *TempFileTest) Fallocate_PunchHole() {
+	// Call
+	err := t.tf.Fallocate(unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, 2, 3)
+	AssertEq(nil, err)
+
+	// Check Stat.
+	sr, err := t.tf.Stat()
+
+	AssertEq(nil, err)
+	ExpectEq(initialContentSize, sr.Size)
+	ExpectEq(2, sr.DirtyThreshold)
+
+	// Read back.
+	expected := []byte(initialContent)
+	copy(expected[2:5], "\x00\x00\x00")
+
+	actual, err := readAll(&t.tf)
+	AssertEq(nil, err)
+	ExpectEq(string(expected), string(actual))
+}
+
+func (t *TempFileTest) Fallocate_PunchHoleThenWrite() {
+	err := t.tf.Fallocate(unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, 1, 6)
+	AssertEq(nil, err)
+
+	// Write into the middle of the hole, splitting it.
+	_, err = t.tf.WriteAt([]byte("xy"), 3)
+	AssertEq(nil, err)
+
+	// Read back.
+	expected := []byte(initialContent)
+	copy(expected[1:7], "\x00\x00xy\x00\x00")
+
+	actual, err := readAll(&t.tf)
+	AssertEq(nil, err)
+	ExpectEq(string(expected), string(actual))
+
+	var buf [4]byte
+	n, err := t.tf.ReadAt(buf[:], 2)
+	AssertEq(nil, err)
+	ExpectEq(4, n)
+	ExpectEq("\x00xy\x00", string(buf[:]))
+}
+
+func (t *TempFileTest) Fallocate_UnsupportedMode() {
+	err := t.tf.Fallocate(unix.FALLOC_FL_COLLAPSE_RANGE, 0, 1)
+	ExpectEq(syscall.ENOTSUP, err)
+}
+
+func (t *TempFileTest) Truncate_UpwardLeavesHole() {
+	err := t.tf.Truncate(int64(initialContentSize) + 4)
+	AssertEq(nil, err)
+
+	actual, err := readAll(&t.tf)
+	AssertEq(nil, err)
+	ExpectEq(initialContent+"\x00\x00\x00\x00", string(actual))
+
+	// Shrinking again drops the hole.
+	err = t.tf.Truncate(int64(initialContentSize))
+	AssertEq(nil, err)
+
+	actual, err = readAll(&t.tf)
+	AssertEq(nil, err)
+	ExpectEq(initialContent, string(actual))
+}
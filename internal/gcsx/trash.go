@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"golang.org/x/net/context"
+)
+
+const (
+	// The name an object had before it was moved to the trash.
+	TrashOriginalNameMetadataKey = "gcsfuse_trash_original_name"
+
+	// When an object was moved to the trash, in RFC 3339 format.
+	TrashDeletedAtMetadataKey = "gcsfuse_trash_deleted_at"
+)
+
+// MoveToTrash copies the latest generation of the named object to the same
+// name under trashPrefix, recording the original name and the deletion time in
+// its metadata. It returns the generation copied, which the caller should then
+// delete; an existing trashed object of the same name is replaced.
+func MoveToTrash(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	trashPrefix string,
+	name string,
+	now time.Time) (generation int64, err error) {
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{
+		Name:              name,
+		ForceFetchFromGcs: true,
+	})
+	if err != nil {
+		err = fmt.Errorf("StatObject: %w", err)
+		return
+	}
+
+	o, err := bucket.CopyObject(ctx, &gcs.CopyObjectRequest{
+		SrcName:       name,
+		DstName:       trashPrefix + name,
+		SrcGeneration: m.Generation,
+	})
+	if err != nil {
+		err = fmt.Errorf("CopyObject: %w", err)
+		return
+	}
+
+	deletedAt := now.UTC().Format(time.RFC3339)
+	_, err = bucket.UpdateObject(ctx, &gcs.UpdateObjectRequest{
+		Name:       o.Name,
+		Generation: o.Generation,
+		Metadata: map[string]*string{
+			TrashOriginalNameMetadataKey: &name,
+			TrashDeletedAtMetadataKey:    &deletedAt,
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf("UpdateObject: %w", err)
+		return
+	}
+
+	generation = m.Generation
+	return
+}
+
+// When the supplied trashed object was deleted. Objects that were put in the
+// trash by other means count as deleted when last updated.
+func trashedAt(o *gcs.MinObject) time.Time {
+	if t, err := time.Parse(time.RFC3339, o.Metadata[TrashDeletedAtMetadataKey]); err == nil {
+		return t
+	}
+
+	return o.Updated
+}
+
+func purgeTrashOnce(
+	ctx context.Context,
+	trashPrefix string,
+	retention time.Duration,
+	bucket gcs.Bucket,
+	now time.Time) (objectsDeleted uint64, err error) {
+	minObjects := make(chan *gcs.MinObject, 100)
+	listErr := make(chan error, 1)
+	go func() {
+		defer close(minObjects)
+		listErr <- storageutil.ListPrefix(ctx, bucket, trashPrefix, minObjects)
+	}()
+
+	for o := range minObjects {
+		if err != nil || now.Sub(trashedAt(o)) < retention {
+			continue
+		}
+
+		// Leave the object alone if it has been trashed again since listing.
+		err = bucket.DeleteObject(
+			ctx,
+			&gcs.DeleteObjectRequest{
+				Name:       o.Name,
+				Generation: o.Generation,
+			})
+		if err != nil {
+			err = fmt.Errorf("DeleteObject(%q): %w", o.Name, err)
+			continue
+		}
+
+		objectsDeleted++
+	}
+
+	if lErr := <-listErr; err == nil && lErr != nil {
+		err = fmt.Errorf("ListPrefix: %w", lErr)
+	}
+
+	return
+}
+
+// Periodically delete objects that have been in the trash for longer than the
+// retention period, until the context is cancelled.
+func purgeTrash(
+	ctx context.Context,
+	trashPrefix string,
+	retention time.Duration,
+	bucket gcs.Bucket) {
+	const period = 10 * time.Minute
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+
+		startTime := time.Now()
+		objectsDeleted, err := purgeTrashOnce(ctx, trashPrefix, retention, bucket, startTime)
+
+		if err != nil {
+			logger.Infof(
+				"Trash purge failed after deleting %d objects in %v, with error: %v",
+				objectsDeleted,
+				time.Since(startTime),
+				err)
+		} else {
+			logger.Infof(
+				"Trash purge deleted %d objects in %v.",
+				objectsDeleted,
+				time.Since(startTime))
+		}
+	}
+}
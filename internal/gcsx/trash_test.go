@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+const testTrashPrefix = ".trash/"
+
+type TrashTest struct {
+	suite.Suite
+	ctx    context.Context
+	clock  *timeutil.SimulatedClock
+	bucket gcs.Bucket
+}
+
+func TestTrashSuite(t *testing.T) {
+	suite.Run(t, new(TrashTest))
+}
+
+func (t *TrashTest) SetupTest() {
+	t.ctx = context.Background()
+	t.clock = &timeutil.SimulatedClock{}
+	t.clock.SetTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	t.bucket = fake.NewFakeBucket(t.clock, "some_bucket", gcs.NonHierarchical)
+}
+
+func (t *TrashTest) create(name, contents string) *gcs.Object {
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, name, []byte(contents))
+	require.NoError(t.T(), err)
+	return o
+}
+
+func (t *TrashTest) stat(name string) (*gcs.MinObject, error) {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	return m, err
+}
+
+func (t *TrashTest) TestMoveToTrash() {
+	o := t.create("dir/foo", "taco")
+
+	gen, err := MoveToTrash(t.ctx, t.bucket, testTrashPrefix, "dir/foo", t.clock.Now())
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), o.Generation, gen)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, ".trash/dir/foo")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+	m, err := t.stat(".trash/dir/foo")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "dir/foo", m.Metadata[TrashOriginalNameMetadataKey])
+	assert.Equal(t.T(), "2024-05-01T10:00:00Z", m.Metadata[TrashDeletedAtMetadataKey])
+	// Deleting the original is left to the caller.
+	_, err = t.stat("dir/foo")
+	assert.NoError(t.T(), err)
+}
+
+func (t *TrashTest) TestMoveToTrashMissingObject() {
+	_, err := MoveToTrash(t.ctx, t.bucket, testTrashPrefix, "foo", t.clock.Now())
+
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *TrashTest) TestPurgeTrashOnce() {
+	t.create("foo", "taco")
+	t.create("bar", "burrito")
+	_, err := MoveToTrash(t.ctx, t.bucket, testTrashPrefix, "foo", t.clock.Now())
+	require.NoError(t.T(), err)
+	t.clock.AdvanceTime(time.Hour)
+	_, err = MoveToTrash(t.ctx, t.bucket, testTrashPrefix, "bar", t.clock.Now())
+	require.NoError(t.T(), err)
+	t.clock.AdvanceTime(30 * time.Minute)
+
+	deleted, err := purgeTrashOnce(t.ctx, testTrashPrefix, time.Hour, t.bucket, t.clock.Now())
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(1), deleted)
+	var notFoundErr *gcs.NotFoundError
+	_, err = t.stat(".trash/foo")
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+	_, err = t.stat(".trash/bar")
+	assert.NoError(t.T(), err)
+	_, err = t.stat("foo")
+	assert.NoError(t.T(), err)
+}
+
+func (t *TrashTest) TestHidingBucketHidesPrefixFromRoot() {
+	t.create("foo", "")
+	t.create(".trash/baz", "")
+	b := NewHidingBucket(testTrashPrefix, t.bucket)
+
+	l, err := b.ListObjects(t.ctx, &gcs.ListObjectsRequest{})
+	require.NoError(t.T(), err)
+	require.Len(t.T(), l.MinObjects, 1)
+	assert.Equal(t.T(), "foo", l.MinObjects[0].Name)
+
+	l, err = b.ListObjects(t.ctx, &gcs.ListObjectsRequest{Delimiter: "/"})
+	require.NoError(t.T(), err)
+	require.Len(t.T(), l.MinObjects, 1)
+	assert.Empty(t.T(), l.CollapsedRuns)
+}
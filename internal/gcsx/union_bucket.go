@@ -0,0 +1,910 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// WhiteoutPrefix starts the base name of the objects that a union bucket
+// creates in its top layer to record that an entry of a lower layer was
+// deleted. The whiteout for "dir/name" is "dir/.wh.name", and hides both a
+// lower object of that name and everything under "dir/name/".
+const WhiteoutPrefix = ".wh."
+
+// NewUnionBucket creates a view that layers the supplied buckets, the first
+// being the top layer, into a single bucket. Reads resolve each name to the
+// topmost layer that has it, while writes always go to the top layer; writing
+// to an object of a lower layer first copies it up. Deleting an entry of a
+// lower layer leaves a whiteout object in the top layer, which is never listed.
+// Whiting out a directory removes the whiteouts within it, which it makes
+// redundant.
+//
+// A read of a generation the bucket has already resolved goes straight to the
+// layer that had it. Listings merge a page of each layer at a time, and must
+// check each directory for entries that weren't whited out, so they cost more
+// than a plain listing.
+func NewUnionBucket(layers []gcs.Bucket) (b gcs.Bucket, err error) {
+	if len(layers) == 0 {
+		err = errors.New("a union bucket needs at least one layer")
+		return
+	}
+
+	b = &unionBucket{
+		layers: layers,
+		served: lru.NewCache(servedFromCacheEntries),
+	}
+
+	return
+}
+
+// The number of names whose layer a union bucket remembers.
+const servedFromCacheEntries = 1 << 16
+
+// servedFrom records the layer in which a generation of a name was found.
+type servedFrom struct {
+	generation int64
+	layer      int
+}
+
+// Size counts entries rather than bytes; see servedFromCacheEntries.
+func (s servedFrom) Size() uint64 {
+	return 1
+}
+
+type unionBucket struct {
+	// The layers, top first.
+	layers []gcs.Bucket
+
+	// The last layer and generation each name was found in, keyed by name.
+	served *lru.Cache
+}
+
+// Remember the layer that served the supplied object.
+func (b *unionBucket) remember(layer int, m *gcs.MinObject) {
+	// Insert only fails for entries larger than the cache, which these never
+	// are.
+	_, _ = b.served.Insert(m.Name, servedFrom{generation: m.Generation, layer: layer})
+}
+
+func (b *unionBucket) top() gcs.Bucket {
+	return b.layers[0]
+}
+
+// Return the name of the whiteout for the supplied object or directory name.
+func whiteoutName(name string) string {
+	dir, base := path.Split(strings.TrimSuffix(name, "/"))
+	return dir + WhiteoutPrefix + base
+}
+
+func isWhiteout(name string) bool {
+	_, base := path.Split(name)
+	return strings.HasPrefix(base, WhiteoutPrefix)
+}
+
+// Return the names of the directories containing name, followed by name
+// itself, without trailing slashes. For example "a", "a/b" and "a/b/c" for
+// "a/b/c/".
+func ancestorsAndSelf(name string) (names []string) {
+	name = strings.TrimSuffix(name, "/")
+	for i, c := range name {
+		if c == '/' {
+			names = append(names, name[:i])
+		}
+	}
+
+	if name != "" {
+		names = append(names, name)
+	}
+
+	return
+}
+
+func isNotFound(err error) bool {
+	var notFoundErr *gcs.NotFoundError
+	return errors.As(err, &notFoundErr)
+}
+
+func notFound(name string) error {
+	return &gcs.NotFoundError{Err: fmt.Errorf("object %q not found in any layer", name)}
+}
+
+// Is the supplied name, or any directory containing it, whited out in the top
+// layer?
+func (b *unionBucket) whitedOut(ctx context.Context, name string) (bool, error) {
+	for _, n := range ancestorsAndSelf(name) {
+		_, _, err := b.top().StatObject(ctx, &gcs.StatObjectRequest{Name: whiteoutName(n)})
+		if err == nil {
+			return true, nil
+		}
+
+		if !isNotFound(err) {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// Is the supplied name hidden by one of the given whiteouts?
+func hiddenBy(whiteouts map[string]bool, name string) bool {
+	for _, n := range ancestorsAndSelf(name) {
+		if whiteouts[whiteoutName(n)] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find the topmost layer that serves the named object, returning a
+// *gcs.NotFoundError if there is none.
+func (b *unionBucket) find(ctx context.Context, name string) (layer int, m *gcs.MinObject, err error) {
+	if isWhiteout(name) {
+		err = notFound(name)
+		return
+	}
+
+	defer func() {
+		if err == nil {
+			b.remember(layer, m)
+		}
+	}()
+
+	m, _, err = b.top().StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+	if err == nil || !isNotFound(err) {
+		return
+	}
+
+	hidden, err := b.whitedOut(ctx, name)
+	if err != nil {
+		return
+	}
+
+	if !hidden {
+		for layer = 1; layer < len(b.layers); layer++ {
+			m, _, err = b.layers[layer].StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+			if err == nil || !isNotFound(err) {
+				return
+			}
+		}
+	}
+
+	err = notFound(name)
+	return
+}
+
+// Translate a generation precondition on the named object, which may refer to
+// a generation of a lower layer, to one for the top layer.
+func (b *unionBucket) topPrecondition(ctx context.Context, name string, p *int64) (*int64, error) {
+	if p == nil || *p == 0 {
+		return p, nil
+	}
+
+	layer, m, err := b.find(ctx, name)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	// The top layer has nothing by that name yet, which is what the caller
+	// expects if it saw the lower one.
+	if err == nil && layer > 0 && m.Generation == *p {
+		var zero int64
+		return &zero, nil
+	}
+
+	return p, nil
+}
+
+// Copy the given generation of the named object from a lower layer to dstName
+// in the top layer.
+func (b *unionBucket) copyUp(
+	ctx context.Context,
+	layer int,
+	name string,
+	generation int64,
+	dstName string,
+	dstGenerationPrecondition *int64) (o *gcs.Object, err error) {
+	lower := b.layers[layer]
+	m, e, err := lower.StatObject(ctx, &gcs.StatObjectRequest{
+		Name:                           name,
+		ForceFetchFromGcs:              true,
+		ReturnExtendedObjectAttributes: true,
+	})
+	if err != nil {
+		err = fmt.Errorf("StatObject: %w", err)
+		return
+	}
+
+	rc, err := lower.NewReader(ctx, &gcs.ReadObjectRequest{
+		Name:           name,
+		Generation:     generation,
+		ReadCompressed: true,
+	})
+	if err != nil {
+		err = fmt.Errorf("NewReader: %w", err)
+		return
+	}
+	defer rc.Close()
+
+	o, err = b.top().CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:                   dstName,
+		ContentType:            e.ContentType,
+		ContentLanguage:        e.ContentLanguage,
+		ContentEncoding:        m.ContentEncoding,
+		CacheControl:           e.CacheControl,
+		Metadata:               m.Metadata,
+		Contents:               rc,
+		GenerationPrecondition: dstGenerationPrecondition,
+	})
+	if err != nil {
+		err = fmt.Errorf("CreateObject: %w", err)
+	}
+
+	return
+}
+
+// Make sure the top layer has the named object, copying it up if it comes
+// from a lower layer. Return the top layer's generation and meta-generation.
+func (b *unionBucket) ensureInTop(ctx context.Context, name string, generation int64) (gen int64, metaGen int64, err error) {
+	layer, m, err := b.find(ctx, name)
+	if err != nil {
+		return
+	}
+
+	if layer == 0 {
+		gen, metaGen = generation, m.MetaGeneration
+		if gen == 0 {
+			gen = m.Generation
+		}
+		return
+	}
+
+	if generation == 0 {
+		generation = m.Generation
+	}
+
+	var zero int64
+	o, err := b.copyUp(ctx, layer, name, generation, name, &zero)
+	if err != nil {
+		return
+	}
+
+	gen, metaGen = o.Generation, o.MetaGeneration
+	return
+}
+
+// List every page matching the request in the given layer.
+func listAll(ctx context.Context, layer gcs.Bucket, req *gcs.ListObjectsRequest) (l *gcs.Listing, err error) {
+	mReq := new(gcs.ListObjectsRequest)
+	*mReq = *req
+
+	l = new(gcs.Listing)
+	for {
+		var page *gcs.Listing
+		page, err = layer.ListObjects(ctx, mReq)
+		if err != nil {
+			return
+		}
+
+		l.MinObjects = append(l.MinObjects, page.MinObjects...)
+		l.CollapsedRuns = append(l.CollapsedRuns, page.CollapsedRuns...)
+
+		if page.ContinuationToken == "" {
+			return
+		}
+		mReq.ContinuationToken = page.ContinuationToken
+	}
+}
+
+// Return the first name after every name that starts with the supplied run.
+func afterRun(run string) string {
+	return run[:len(run)-1] + string([]byte{run[len(run)-1] + 1})
+}
+
+// Return the last entry of a page of a listing, and whether it is a run.
+func lastEntry(l *gcs.Listing) (name string, isRun bool) {
+	if n := len(l.MinObjects); n > 0 {
+		name = l.MinObjects[n-1].Name
+	}
+
+	if n := len(l.CollapsedRuns); n > 0 && l.CollapsedRuns[n-1] >= name {
+		name, isRun = l.CollapsedRuns[n-1], true
+	}
+
+	return
+}
+
+// Find which of the whiteouts that could hide the supplied names, below the
+// directory dir, exist in the top layer. Whiteouts of the same directory are
+// found with a single listing bounded by the names.
+func (b *unionBucket) whiteoutsFor(ctx context.Context, dir string, names []string) (whiteouts map[string]bool, err error) {
+	whiteouts = make(map[string]bool)
+
+	byDir := make(map[string][]string)
+	for _, name := range names {
+		for _, n := range ancestorsAndSelf(name) {
+			if len(n) <= len(strings.TrimSuffix(dir, "/")) {
+				continue
+			}
+
+			w := whiteoutName(n)
+			d, _ := path.Split(w)
+			byDir[d] = append(byDir[d], w)
+		}
+	}
+
+	for d, ws := range byDir {
+		var l *gcs.Listing
+		l, err = listAll(ctx, b.top(), &gcs.ListObjectsRequest{
+			Prefix:      d + WhiteoutPrefix,
+			Delimiter:   "/",
+			StartOffset: slices.Min(ws),
+			EndOffset:   slices.Max(ws) + "\x00",
+		})
+		if err != nil {
+			return
+		}
+
+		for _, o := range l.MinObjects {
+			whiteouts[o.Name] = true
+		}
+	}
+
+	return
+}
+
+// unionRun is a collapsed run of a page of a union listing.
+type unionRun struct {
+	prefix string
+
+	// Whether the lower layers' entries under the run are whited out.
+	lowerHidden bool
+}
+
+// An entry of a page of a union listing.
+type unionEntry struct {
+	name string
+	o    *gcs.MinObject
+	run  *unionRun
+}
+
+// List a page of the union, merging a page of each layer. The continuation
+// token is the name at which the next page starts; entries are only returned
+// up to the point every layer's page has reached. The returned runs aren't yet
+// checked for holding anything visible.
+func (b *unionBucket) listPage(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest,
+	lowerHidden bool) (l *gcs.Listing, runs []unionRun, err error) {
+	layers := b.layers
+	if lowerHidden {
+		layers = layers[:1]
+	}
+
+	mReq := new(gcs.ListObjectsRequest)
+	*mReq = *req
+	mReq.ContinuationToken = ""
+	if req.ContinuationToken != "" {
+		mReq.StartOffset = max(req.StartOffset, req.ContinuationToken)
+	}
+
+	// Everything up to and including limit has been listed by every layer,
+	// unless complete, in which case everything has.
+	pages := make([]*gcs.Listing, len(layers))
+	complete := true
+	var limit string
+	var limitIsRun bool
+	for i, layer := range layers {
+		pages[i], err = layer.ListObjects(ctx, mReq)
+		if err != nil {
+			return
+		}
+
+		if pages[i].ContinuationToken != "" {
+			name, isRun := lastEntry(pages[i])
+			if complete || name < limit {
+				limit, limitIsRun = name, isRun
+			}
+			complete = false
+		}
+	}
+
+	within := func(name string) bool {
+		return complete || name <= limit
+	}
+
+	// Find the whiteouts that could hide what the page holds. Top layer runs
+	// are looked up too, since a whiteout hides the lower layers beneath them.
+	whiteouts := make(map[string]bool)
+	if len(layers) > 1 {
+		var names []string
+		for i, p := range pages {
+			for _, o := range p.MinObjects {
+				if i > 0 && within(o.Name) {
+					names = append(names, o.Name)
+				}
+			}
+
+			for _, r := range p.CollapsedRuns {
+				if within(r) {
+					names = append(names, r)
+				}
+			}
+		}
+
+		dir, _ := path.Split(req.Prefix)
+		whiteouts, err = b.whiteoutsFor(ctx, dir, names)
+		if err != nil {
+			return
+		}
+	}
+
+	var entries []unionEntry
+	seen := make(map[string]bool)
+	seenRuns := make(map[string]bool)
+	for i, p := range pages {
+		for _, o := range p.MinObjects {
+			if !within(o.Name) || seen[o.Name] || isWhiteout(o.Name) ||
+				(i > 0 && hiddenBy(whiteouts, o.Name)) {
+				continue
+			}
+
+			seen[o.Name] = true
+			b.remember(i, o)
+			entries = append(entries, unionEntry{name: o.Name, o: o})
+		}
+
+		for _, r := range p.CollapsedRuns {
+			if !within(r) || seenRuns[r] || (i > 0 && hiddenBy(whiteouts, r)) {
+				continue
+			}
+
+			seenRuns[r] = true
+			entries = append(entries, unionEntry{name: r, run: &unionRun{
+				prefix:      r,
+				lowerHidden: lowerHidden || whiteouts[whiteoutName(r)],
+			}})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	// Several layers may have filled their pages.
+	if req.MaxResults > 0 && len(entries) > req.MaxResults {
+		entries = entries[:req.MaxResults]
+		last := entries[len(entries)-1]
+		complete, limit, limitIsRun = false, last.name, last.run != nil
+	}
+
+	l = new(gcs.Listing)
+	for _, e := range entries {
+		if e.run != nil {
+			runs = append(runs, *e.run)
+		} else {
+			l.MinObjects = append(l.MinObjects, e.o)
+		}
+	}
+
+	if !complete {
+		l.ContinuationToken = limit + "\x00"
+		if limitIsRun {
+			l.ContinuationToken = afterRun(limit)
+		}
+	}
+
+	return
+}
+
+// Is there anything visible under the supplied directory prefix? Each level is
+// listed in turn, and deeper levels only while nothing visible has been found.
+func (b *unionBucket) anyVisible(ctx context.Context, run unionRun) (bool, error) {
+	req := &gcs.ListObjectsRequest{
+		Prefix:    run.prefix,
+		Delimiter: "/",
+	}
+
+	for {
+		l, runs, err := b.listPage(ctx, req, run.lowerHidden)
+		if err != nil {
+			return false, err
+		}
+
+		if len(l.MinObjects) > 0 {
+			return true, nil
+		}
+
+		for _, r := range runs {
+			visible, err := b.anyVisible(ctx, r)
+			if err != nil || visible {
+				return visible, err
+			}
+		}
+
+		if l.ContinuationToken == "" {
+			return false, nil
+		}
+		req.ContinuationToken = l.ContinuationToken
+	}
+}
+
+// Delete the whiteouts in the top layer under the supplied directory, once a
+// whiteout of the directory itself hides everything beneath it.
+func (b *unionBucket) dropWhiteoutsUnder(ctx context.Context, dir string) error {
+	l, err := listAll(ctx, b.top(), &gcs.ListObjectsRequest{Prefix: dir})
+	if err != nil {
+		return err
+	}
+
+	for _, o := range l.MinObjects {
+		if !isWhiteout(o.Name) {
+			continue
+		}
+
+		err = b.top().DeleteObject(ctx, &gcs.DeleteObjectRequest{
+			Name:       o.Name,
+			Generation: o.Generation,
+		})
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *unionBucket) Name() string {
+	return b.top().Name()
+}
+
+func (b *unionBucket) BucketType() gcs.BucketType {
+	return b.top().BucketType()
+}
+
+func (b *unionBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	// A generation that was stat'ed or listed is read from the layer that had
+	// it, without looking the name up again.
+	if req.Generation != 0 {
+		if s, ok := b.served.LookUp(req.Name).(servedFrom); ok && s.generation == req.Generation {
+			rc, err = b.layers[s.layer].NewReader(ctx, req)
+			return
+		}
+	}
+
+	layer, _, err := b.find(ctx, req.Name)
+	if err != nil {
+		return
+	}
+
+	rc, err = b.layers[layer].NewReader(ctx, req)
+	return
+}
+
+func (b *unionBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
+	if isWhiteout(req.Name) {
+		err = fmt.Errorf("%q is reserved for whiteouts: %w", req.Name, syscall.EINVAL)
+		return
+	}
+
+	mReq := new(gcs.CreateObjectRequest)
+	*mReq = *req
+	mReq.GenerationPrecondition, err = b.topPrecondition(ctx, req.Name, req.GenerationPrecondition)
+	if err != nil {
+		return
+	}
+
+	o, err = b.top().CreateObject(ctx, mReq)
+	return
+}
+
+func (b *unionBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	if isWhiteout(req.Name) {
+		return nil, fmt.Errorf("%q is reserved for whiteouts: %w", req.Name, syscall.EINVAL)
+	}
+
+	mReq := new(gcs.CreateObjectRequest)
+	*mReq = *req
+
+	var err error
+	mReq.GenerationPrecondition, err = b.topPrecondition(ctx, req.Name, req.GenerationPrecondition)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.top().CreateObjectChunkWriter(ctx, mReq, chunkSize, callBack)
+}
+
+func (b *unionBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (*gcs.MinObject, error) {
+	return b.top().FinalizeUpload(ctx, w)
+}
+
+func (b *unionBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (o *gcs.Object, err error) {
+	layer, m, err := b.find(ctx, req.SrcName)
+	if err != nil {
+		return
+	}
+
+	dstPrecondition, err := b.topPrecondition(ctx, req.DstName, req.DstGenerationPrecondition)
+	if err != nil {
+		return
+	}
+
+	if layer == 0 {
+		mReq := new(gcs.CopyObjectRequest)
+		*mReq = *req
+		mReq.DstGenerationPrecondition = dstPrecondition
+		o, err = b.top().CopyObject(ctx, mReq)
+		return
+	}
+
+	if req.SrcMetaGenerationPrecondition != nil && *req.SrcMetaGenerationPrecondition != m.MetaGeneration {
+		err = &gcs.PreconditionError{
+			Err: fmt.Errorf("object %q has meta-generation %d", req.SrcName, m.MetaGeneration),
+		}
+		return
+	}
+
+	generation := req.SrcGeneration
+	if generation == 0 {
+		generation = m.Generation
+	}
+
+	o, err = b.copyUp(ctx, layer, req.SrcName, generation, req.DstName, dstPrecondition)
+	return
+}
+
+func (b *unionBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
+	mReq := new(gcs.ComposeObjectsRequest)
+	*mReq = *req
+
+	// The destination may be a lower layer's object that is about to be copied
+	// up as a source.
+	dstLayer, dst, err := b.find(ctx, req.DstName)
+	if err != nil && !isNotFound(err) {
+		return
+	}
+	dstIsLower := err == nil && dstLayer > 0
+	err = nil
+
+	// Sources must all be in the top layer.
+	mReq.Sources = nil
+	for _, s := range req.Sources {
+		var gen, metaGen int64
+		gen, metaGen, err = b.ensureInTop(ctx, s.Name, s.Generation)
+		if err != nil {
+			err = fmt.Errorf("copying up %q: %w", s.Name, err)
+			return
+		}
+
+		if dstIsLower && s.Name == req.DstName &&
+			req.DstGenerationPrecondition != nil && *req.DstGenerationPrecondition == dst.Generation {
+			mReq.DstGenerationPrecondition = &gen
+			mReq.DstMetaGenerationPrecondition = &metaGen
+			dstIsLower = false
+		}
+
+		s.Generation = gen
+		mReq.Sources = append(mReq.Sources, s)
+	}
+
+	if dstIsLower {
+		mReq.DstGenerationPrecondition, err = b.topPrecondition(ctx, req.DstName, req.DstGenerationPrecondition)
+		if err != nil {
+			return
+		}
+		mReq.DstMetaGenerationPrecondition = nil
+	}
+
+	o, err = b.top().ComposeObjects(ctx, mReq)
+	return
+}
+
+func (b *unionBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	layer, m, err := b.find(ctx, req.Name)
+	if err != nil || (!req.ReturnExtendedObjectAttributes && !req.ForceFetchFromGcs) {
+		return
+	}
+
+	m, e, err = b.layers[layer].StatObject(ctx, req)
+	return
+}
+
+// ListObjects merges a page of each layer's listing. Continuation tokens are
+// the name at which to resume. Pages left empty by whiteouts are skipped, so
+// that an empty page is only ever the last.
+func (b *unionBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (l *gcs.Listing, err error) {
+	// Lower layers contribute nothing if the directory being listed is whited
+	// out.
+	dir, _ := path.Split(req.Prefix)
+	lowerHidden, err := b.whitedOut(ctx, dir)
+	if err != nil {
+		return
+	}
+
+	mReq := new(gcs.ListObjectsRequest)
+	*mReq = *req
+	for {
+		var runs []unionRun
+		l, runs, err = b.listPage(ctx, mReq, lowerHidden)
+		if err != nil {
+			return
+		}
+
+		// A run may be left with nothing but whiteouts in it.
+		for _, r := range runs {
+			var visible bool
+			visible, err = b.anyVisible(ctx, r)
+			if err != nil {
+				return
+			}
+
+			if visible {
+				l.CollapsedRuns = append(l.CollapsedRuns, r.prefix)
+			}
+		}
+
+		if len(l.MinObjects) > 0 || len(l.CollapsedRuns) > 0 || l.ContinuationToken == "" {
+			return
+		}
+		mReq.ContinuationToken = l.ContinuationToken
+	}
+}
+
+func (b *unionBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (o *gcs.Object, err error) {
+	layer, m, err := b.find(ctx, req.Name)
+	if err != nil {
+		return
+	}
+
+	mReq := new(gcs.UpdateObjectRequest)
+	*mReq = *req
+
+	if layer > 0 {
+		if req.MetaGenerationPrecondition != nil && *req.MetaGenerationPrecondition != m.MetaGeneration {
+			err = &gcs.PreconditionError{
+				Err: fmt.Errorf("object %q has meta-generation %d", req.Name, m.MetaGeneration),
+			}
+			return
+		}
+
+		mReq.Generation, mReq.MetaGenerationPrecondition, err = b.copyUpForUpdate(ctx, req.Name, req.Generation)
+		if err != nil {
+			return
+		}
+	}
+
+	o, err = b.top().UpdateObject(ctx, mReq)
+	return
+}
+
+// Copy the named object up so that it can be updated, returning the
+// generation and meta-generation precondition to update it with.
+func (b *unionBucket) copyUpForUpdate(ctx context.Context, name string, generation int64) (int64, *int64, error) {
+	gen, metaGen, err := b.ensureInTop(ctx, name, generation)
+	if err != nil {
+		return 0, nil, fmt.Errorf("copying up %q: %w", name, err)
+	}
+
+	return gen, &metaGen, nil
+}
+
+func (b *unionBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) (err error) {
+	if isWhiteout(req.Name) {
+		return notFound(req.Name)
+	}
+
+	// Delete from the top layer whatever the request refers to there.
+	top, _, err := b.top().StatObject(ctx, &gcs.StatObjectRequest{Name: req.Name})
+	switch {
+	case err == nil && (req.Generation == 0 || req.Generation == top.Generation):
+		if err = b.top().DeleteObject(ctx, req); err != nil {
+			return
+		}
+
+	case err == nil:
+		// Some other generation of the top layer's object; let the top layer
+		// report the error.
+		return b.top().DeleteObject(ctx, req)
+
+	case !isNotFound(err):
+		return
+	}
+
+	deletedTop := err == nil
+	err = nil
+
+	// Then white out any lower layer's object of the same name.
+	hidden, err := b.whitedOut(ctx, req.Name)
+	if err != nil || hidden {
+		if err == nil && !deletedTop {
+			err = notFound(req.Name)
+		}
+		return
+	}
+
+	for _, layer := range b.layers[1:] {
+		var m *gcs.MinObject
+		m, _, err = layer.StatObject(ctx, &gcs.StatObjectRequest{Name: req.Name})
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		if !deletedTop && req.Generation != 0 && req.Generation != m.Generation {
+			return notFound(req.Name)
+		}
+
+		_, err = b.top().CreateObject(ctx, &gcs.CreateObjectRequest{
+			Name:     whiteoutName(req.Name),
+			Contents: strings.NewReader(""),
+		})
+		if err == nil && strings.HasSuffix(req.Name, "/") {
+			err = b.dropWhiteoutsUnder(ctx, req.Name)
+		}
+		return
+	}
+
+	err = nil
+	if !deletedTop {
+		err = notFound(req.Name)
+	}
+
+	return
+}
+
+func (b *unionBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	return b.top().DeleteFolder(ctx, folderName)
+}
+
+func (b *unionBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return b.top().GetFolder(ctx, folderName)
+}
+
+func (b *unionBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return b.top().CreateFolder(ctx, folderName)
+}
+
+func (b *unionBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	return b.top().RenameFolder(ctx, folderName, destinationFolderId)
+}
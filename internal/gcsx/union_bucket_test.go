@@ -0,0 +1,343 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type UnionBucketTest struct {
+	suite.Suite
+	ctx    context.Context
+	top    gcs.Bucket
+	lower  gcs.Bucket
+	bucket gcs.Bucket
+}
+
+func TestUnionBucketSuite(t *testing.T) {
+	suite.Run(t, new(UnionBucketTest))
+}
+
+func (t *UnionBucketTest) SetupTest() {
+	var err error
+	t.ctx = context.Background()
+	t.top = fake.NewFakeBucket(timeutil.RealClock(), "top", gcs.NonHierarchical)
+	t.lower = fake.NewFakeBucket(timeutil.RealClock(), "lower", gcs.NonHierarchical)
+	t.bucket, err = gcsx.NewUnionBucket([]gcs.Bucket{t.top, t.lower})
+	require.NoError(t.T(), err)
+}
+
+func (t *UnionBucketTest) create(b gcs.Bucket, name, contents string) *gcs.Object {
+	o, err := storageutil.CreateObject(t.ctx, b, name, []byte(contents))
+	require.NoError(t.T(), err)
+	return o
+}
+
+func (t *UnionBucketTest) read(name string) string {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, name)
+	require.NoError(t.T(), err)
+	return string(contents)
+}
+
+func (t *UnionBucketTest) list(prefix string) (names []string, runs []string) {
+	l, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: prefix, Delimiter: "/"})
+	require.NoError(t.T(), err)
+	for _, o := range l.MinObjects {
+		names = append(names, o.Name)
+	}
+	return names, l.CollapsedRuns
+}
+
+func (t *UnionBucketTest) assertNotFound(name string) {
+	_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr, name)
+}
+
+func (t *UnionBucketTest) TestNoLayers() {
+	_, err := gcsx.NewUnionBucket(nil)
+
+	assert.Error(t.T(), err)
+}
+
+func (t *UnionBucketTest) TestTopLayerWins() {
+	t.create(t.top, "foo", "taco")
+	t.create(t.lower, "foo", "burrito")
+	t.create(t.lower, "bar", "enchilada")
+
+	assert.Equal(t.T(), "taco", t.read("foo"))
+	assert.Equal(t.T(), "enchilada", t.read("bar"))
+	assert.Equal(t.T(), "top", t.bucket.Name())
+}
+
+func (t *UnionBucketTest) TestListObjectsMergesLayers() {
+	t.create(t.top, "a", "")
+	t.create(t.top, "dir/b", "")
+	t.create(t.lower, "a", "lower")
+	t.create(t.lower, "c", "")
+	t.create(t.lower, "other/d", "")
+
+	names, runs := t.list("")
+
+	assert.Equal(t.T(), []string{"a", "c"}, names)
+	assert.Equal(t.T(), []string{"dir/", "other/"}, runs)
+}
+
+func (t *UnionBucketTest) TestWritesGoToTopLayer() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("taco"))
+	require.NoError(t.T(), err)
+
+	_, _, err = t.top.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	assert.NoError(t.T(), err)
+	_, _, err = t.lower.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *UnionBucketTest) TestOverwritingLowerObjectWithItsGeneration() {
+	o := t.create(t.lower, "foo", "taco")
+
+	_, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:                   "foo",
+		Contents:               strings.NewReader("burrito"),
+		GenerationPrecondition: &o.Generation,
+	})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "burrito", t.read("foo"))
+	contents, err := storageutil.ReadObject(t.ctx, t.lower, "foo")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+}
+
+func (t *UnionBucketTest) TestDeleteLowerObjectLeavesWhiteout() {
+	t.create(t.lower, "dir/foo", "taco")
+	t.create(t.lower, "dir/bar", "burrito")
+
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "dir/foo"})
+
+	require.NoError(t.T(), err)
+	t.assertNotFound("dir/foo")
+	t.assertNotFound("dir/" + gcsx.WhiteoutPrefix + "foo")
+	names, _ := t.list("dir/")
+	assert.Equal(t.T(), []string{"dir/bar"}, names)
+	// The lower layer itself is untouched.
+	_, err = storageutil.ReadObject(t.ctx, t.lower, "dir/foo")
+	assert.NoError(t.T(), err)
+}
+
+func (t *UnionBucketTest) TestDeleteObjectInBothLayers() {
+	t.create(t.top, "foo", "taco")
+	t.create(t.lower, "foo", "burrito")
+
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "foo"})
+
+	require.NoError(t.T(), err)
+	t.assertNotFound("foo")
+}
+
+func (t *UnionBucketTest) TestDeleteMissingObject() {
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "foo"})
+
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *UnionBucketTest) TestRecreateAfterDelete() {
+	t.create(t.lower, "foo", "taco")
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+
+	t.create(t.bucket, "foo", "burrito")
+
+	assert.Equal(t.T(), "burrito", t.read("foo"))
+	names, _ := t.list("")
+	assert.Equal(t.T(), []string{"foo"}, names)
+}
+
+func (t *UnionBucketTest) TestWhitedOutDirectoryHidesContents() {
+	t.create(t.lower, "dir/", "")
+	t.create(t.lower, "dir/foo", "taco")
+
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "dir/"})
+
+	require.NoError(t.T(), err)
+	t.assertNotFound("dir/foo")
+	names, runs := t.list("")
+	assert.Empty(t.T(), names)
+	assert.Empty(t.T(), runs)
+	names, _ = t.list("dir/")
+	assert.Empty(t.T(), names)
+}
+
+func (t *UnionBucketTest) TestEmptiedDirectoryIsNotListed() {
+	t.create(t.lower, "dir/foo", "taco")
+
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "dir/foo"})
+
+	require.NoError(t.T(), err)
+	_, runs := t.list("")
+	assert.Empty(t.T(), runs)
+}
+
+func (t *UnionBucketTest) TestCopyObjectFromLowerLayer() {
+	t.create(t.lower, "foo", "taco")
+
+	_, err := t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: "foo", DstName: "bar"})
+
+	require.NoError(t.T(), err)
+	contents, err := storageutil.ReadObject(t.ctx, t.top, "bar")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+}
+
+func (t *UnionBucketTest) TestComposeCopiesUpLowerSources() {
+	o := t.create(t.lower, "foo", "taco")
+	t.create(t.top, "bar", "burrito")
+
+	_, err := t.bucket.ComposeObjects(t.ctx, &gcs.ComposeObjectsRequest{
+		DstName:                   "foo",
+		DstGenerationPrecondition: &o.Generation,
+		Sources: []gcs.ComposeSource{
+			{Name: "foo", Generation: o.Generation},
+			{Name: "bar"},
+		},
+	})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "tacoburrito", t.read("foo"))
+}
+
+func (t *UnionBucketTest) TestUpdateObjectCopiesUp() {
+	t.create(t.lower, "foo", "taco")
+	value := "bar"
+
+	_, err := t.bucket.UpdateObject(t.ctx, &gcs.UpdateObjectRequest{
+		Name:     "foo",
+		Metadata: map[string]*string{"key": &value},
+	})
+
+	require.NoError(t.T(), err)
+	m, _, err := t.top.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "bar", m.Metadata["key"])
+	assert.Equal(t.T(), "taco", t.read("foo"))
+}
+
+func (t *UnionBucketTest) TestWhiteoutNamesAreReserved() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, gcsx.WhiteoutPrefix+"foo", []byte(""))
+
+	assert.Error(t.T(), err)
+}
+
+func (t *UnionBucketTest) TestListObjectsPaginates() {
+	for _, name := range []string{"a", "c", "e", "dir/x"} {
+		t.create(t.top, name, "")
+	}
+	for _, name := range []string{"b", "c", "d", "f", "gone", "dir/y", "other/z"} {
+		t.create(t.lower, name, "")
+	}
+	require.NoError(t.T(), t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "gone"}))
+
+	var names, runs []string
+	req := &gcs.ListObjectsRequest{Delimiter: "/", MaxResults: 2}
+	for {
+		l, err := t.bucket.ListObjects(t.ctx, req)
+		require.NoError(t.T(), err)
+		assert.LessOrEqual(t.T(), len(l.MinObjects)+len(l.CollapsedRuns), 2)
+		for _, o := range l.MinObjects {
+			names = append(names, o.Name)
+		}
+		runs = append(runs, l.CollapsedRuns...)
+
+		if l.ContinuationToken == "" {
+			break
+		}
+		req.ContinuationToken = l.ContinuationToken
+	}
+
+	assert.Equal(t.T(), []string{"a", "b", "c", "d", "e", "f"}, names)
+	assert.Equal(t.T(), []string{"dir/", "other/"}, runs)
+}
+
+// statCounter counts the objects stat'ed through it.
+type statCounter struct {
+	gcs.Bucket
+	stats int
+}
+
+func (c *statCounter) StatObject(ctx context.Context, req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	c.stats++
+	return c.Bucket.StatObject(ctx, req)
+}
+
+func (t *UnionBucketTest) TestReadOfListedGenerationSkipsLookup() {
+	top := &statCounter{Bucket: t.top}
+	bucket, err := gcsx.NewUnionBucket([]gcs.Bucket{top, t.lower})
+	require.NoError(t.T(), err)
+	t.create(t.lower, "dir/foo", "taco")
+	l, err := bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: "dir/", Delimiter: "/"})
+	require.NoError(t.T(), err)
+	require.Len(t.T(), l.MinObjects, 1)
+	top.stats = 0
+
+	rc, err := bucket.NewReader(t.ctx, &gcs.ReadObjectRequest{
+		Name:       "dir/foo",
+		Generation: l.MinObjects[0].Generation,
+	})
+
+	require.NoError(t.T(), err)
+	require.NoError(t.T(), rc.Close())
+	assert.Zero(t.T(), top.stats)
+}
+
+func (t *UnionBucketTest) TestEmptiedNestedDirectoryIsNotListed() {
+	t.create(t.lower, "dir/sub/foo", "taco")
+	t.create(t.top, "other/sub/bar", "burrito")
+
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "dir/sub/foo"})
+
+	require.NoError(t.T(), err)
+	_, runs := t.list("")
+	assert.Equal(t.T(), []string{"other/"}, runs)
+}
+
+func (t *UnionBucketTest) TestWhitingOutDirectoryDropsWhiteoutsWithin() {
+	t.create(t.lower, "dir/", "")
+	t.create(t.lower, "dir/foo", "taco")
+	t.create(t.lower, "dir/sub/bar", "burrito")
+	for _, name := range []string{"dir/foo", "dir/sub/bar", "dir/"} {
+		require.NoError(t.T(), t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: name}))
+	}
+
+	l, err := t.top.ListObjects(t.ctx, &gcs.ListObjectsRequest{})
+
+	require.NoError(t.T(), err)
+	require.Len(t.T(), l.MinObjects, 1)
+	assert.Equal(t.T(), gcsx.WhiteoutPrefix+"dir", l.MinObjects[0].Name)
+	t.assertNotFound("dir/foo")
+	t.assertNotFound("dir/sub/bar")
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+// AdaptiveConfig controls the adaptive limits put on the calls to a bucket.
+type AdaptiveConfig struct {
+	// The most requests that may be in flight at once. The limit falls below
+	// this when the backend is overloaded. Zero disables the limit.
+	MaxInFlight int
+
+	// The number of requests in a row that must fail because the backend is
+	// unhealthy to open the circuit. Zero disables the circuit breaker.
+	BreakerThreshold int
+
+	// How long the circuit stays open before a request is let through to see
+	// whether the backend has recovered.
+	BreakerCooldown time.Duration
+}
+
+// NewAdaptiveBucket wraps the supplied bucket in a layer that adapts to the
+// health of the backend, according to the config: requests wait while the
+// adaptive limit on requests in flight is reached, and fail fast with
+// ErrCircuitOpen while the circuit is open. Readers hold their slot only
+// until NewReader returns. Limits and trips are reported to the metric
+// handle.
+func NewAdaptiveBucket(
+	wrapped gcs.Bucket,
+	cfg AdaptiveConfig,
+	clock timeutil.Clock,
+	metricHandle common.MetricHandle) (b gcs.Bucket) {
+	ab := &adaptiveBucket{
+		wrapped:      wrapped,
+		clock:        clock,
+		metricHandle: metricHandle,
+	}
+
+	if cfg.MaxInFlight > 0 {
+		ab.limiter = newAdaptiveLimiter(cfg.MaxInFlight)
+		metricHandle.GCSConcurrencyLimit(context.Background(), int64(cfg.MaxInFlight), nil)
+	}
+
+	if cfg.BreakerThreshold > 0 {
+		ab.breaker = newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, clock)
+	}
+
+	b = ab
+	return
+}
+
+type adaptiveBucket struct {
+	wrapped      gcs.Bucket
+	clock        timeutil.Clock
+	metricHandle common.MetricHandle
+
+	// Either may be nil, if disabled.
+	limiter *adaptiveLimiter
+	breaker *circuitBreaker
+}
+
+// Make the call once the breaker and limiter allow, and feed its outcome back
+// to them.
+func limited[T any](
+	ctx context.Context,
+	b *adaptiveBucket,
+	method string,
+	call func() (T, error)) (v T, err error) {
+	var probe bool
+	if b.breaker != nil {
+		if probe, err = b.breaker.allow(); err != nil {
+			b.metricHandle.GCSCircuitBreakerRejectCount(ctx, 1, []common.MetricAttr{{Key: common.GCSMethod, Value: method}})
+			err = fmt.Errorf("%s: %w", method, err)
+			return
+		}
+	}
+
+	var s slot
+	if b.limiter != nil {
+		if s, err = b.limiter.acquire(ctx); err != nil {
+			if b.breaker != nil {
+				b.breaker.record(probe, err)
+			}
+			return
+		}
+	}
+
+	start := b.clock.Now()
+	v, err = call()
+
+	if b.limiter != nil {
+		if limit, changed := b.limiter.release(s, method, b.clock.Now().Sub(start), err); changed {
+			b.metricHandle.GCSConcurrencyLimit(ctx, int64(limit), nil)
+		}
+	}
+
+	if b.breaker != nil && b.breaker.record(probe, err) {
+		logger.Warnf("Opening the circuit for bucket %q after %s failed: %v", b.wrapped.Name(), method, err)
+		b.metricHandle.GCSCircuitBreakerTripCount(ctx, 1, nil)
+	}
+
+	return
+}
+
+func (b *adaptiveBucket) Name() string {
+	return b.wrapped.Name()
+}
+
+func (b *adaptiveBucket) BucketType() gcs.BucketType {
+	return b.wrapped.BucketType()
+}
+
+func (b *adaptiveBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	return limited(ctx, b, "NewReader", func() (io.ReadCloser, error) {
+		return b.wrapped.NewReader(ctx, req)
+	})
+}
+
+func (b *adaptiveBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	return limited(ctx, b, "CreateObject", func() (*gcs.Object, error) {
+		return b.wrapped.CreateObject(ctx, req)
+	})
+}
+
+func (b *adaptiveBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	return limited(ctx, b, "CreateObjectChunkWriter", func() (gcs.Writer, error) {
+		return b.wrapped.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+	})
+}
+
+func (b *adaptiveBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (*gcs.MinObject, error) {
+	// Like throttledBucket, don't fail the upload of data already written.
+	return b.wrapped.FinalizeUpload(ctx, w)
+}
+
+func (b *adaptiveBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	return limited(ctx, b, "CopyObject", func() (*gcs.Object, error) {
+		return b.wrapped.CopyObject(ctx, req)
+	})
+}
+
+func (b *adaptiveBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	return limited(ctx, b, "ComposeObjects", func() (*gcs.Object, error) {
+		return b.wrapped.ComposeObjects(ctx, req)
+	})
+}
+
+type statResult struct {
+	m *gcs.MinObject
+	e *gcs.ExtendedObjectAttributes
+}
+
+func (b *adaptiveBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	res, err := limited(ctx, b, "StatObject", func() (res statResult, err error) {
+		res.m, res.e, err = b.wrapped.StatObject(ctx, req)
+		return
+	})
+
+	m, e = res.m, res.e
+	return
+}
+
+func (b *adaptiveBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	return limited(ctx, b, "ListObjects", func() (*gcs.Listing, error) {
+		return b.wrapped.ListObjects(ctx, req)
+	})
+}
+
+func (b *adaptiveBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	return limited(ctx, b, "UpdateObject", func() (*gcs.Object, error) {
+		return b.wrapped.UpdateObject(ctx, req)
+	})
+}
+
+func (b *adaptiveBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) error {
+	_, err := limited(ctx, b, "DeleteObject", func() (struct{}, error) {
+		return struct{}{}, b.wrapped.DeleteObject(ctx, req)
+	})
+	return err
+}
+
+func (b *adaptiveBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	_, err := limited(ctx, b, "DeleteFolder", func() (struct{}, error) {
+		return struct{}{}, b.wrapped.DeleteFolder(ctx, folderName)
+	})
+	return err
+}
+
+func (b *adaptiveBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return limited(ctx, b, "GetFolder", func() (*gcs.Folder, error) {
+		return b.wrapped.GetFolder(ctx, folderName)
+	})
+}
+
+func (b *adaptiveBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return limited(ctx, b, "CreateFolder", func() (*gcs.Folder, error) {
+		return b.wrapped.CreateFolder(ctx, folderName)
+	})
+}
+
+func (b *adaptiveBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	return limited(ctx, b, "RenameFolder", func() (*gcs.Folder, error) {
+		return b.wrapped.RenameFolder(ctx, folderName, destinationFolderId)
+	})
+}
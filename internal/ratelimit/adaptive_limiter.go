@@ -0,0 +1,225 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// The factor the limit is cut by when the backend is overloaded.
+	backoffRatio = 0.7
+
+	// How many times slower than usual a request must be to count as a sign
+	// of overload.
+	latencyTolerance = 2.0
+
+	// The weight of each latency in the usual latency of its method, and how
+	// many latencies must be known before it is trusted.
+	latencyWeight     = 0.05
+	minLatencySamples = 20
+)
+
+// The methods whose latency says how loaded the backend is. The others take
+// longer the more data they move or return, so only their errors count.
+var latencySensitive = map[string]bool{
+	"StatObject":   true,
+	"DeleteObject": true,
+	"UpdateObject": true,
+}
+
+// Report whether the error is one GCS returns when it is overloaded or
+// otherwise unhealthy, rather than one about the request.
+func overloaded(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.ResourceExhausted, codes.Unavailable, codes.Internal:
+			return true
+		}
+	}
+
+	return false
+}
+
+// A limit on the number of requests in flight, adjusted by additive increase
+// and multiplicative decrease: the limit grows by one for each limit's worth
+// of requests that succeed while it is nearly in use, and is cut by
+// backoffRatio when a request fails because the backend is overloaded or, for
+// the latency-sensitive methods, takes much longer than usual for its method.
+// Requests that are cancelled or time out leave the limit alone.
+//
+// The limit starts at its maximum, so a healthy backend is never throttled.
+//
+// Safe for concurrent access.
+type adaptiveLimiter struct {
+	max float64
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	limit    float64
+	inFlight int
+
+	// Closed and replaced whenever a slot may have become free.
+	//
+	// GUARDED_BY(mu)
+	freed chan struct{}
+
+	// The number of times the limit has been cut. Requests admitted before the
+	// latest cut can't cut it again, so that a burst of failures in flight
+	// together counts once.
+	//
+	// GUARDED_BY(mu)
+	epoch uint64
+
+	// The usual latency of each latency-sensitive method.
+	//
+	// GUARDED_BY(mu)
+	usual map[string]*usualLatency
+}
+
+type usualLatency struct {
+	mean    float64
+	samples int
+}
+
+// A slot held by a request admitted by the limiter.
+type slot struct {
+	epoch uint64
+}
+
+func newAdaptiveLimiter(max int) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		max:   float64(max),
+		limit: float64(max),
+		freed: make(chan struct{}),
+		usual: make(map[string]*usualLatency),
+	}
+}
+
+// Wait until a request may be sent, or the context is cancelled.
+//
+// LOCKS_EXCLUDED(l.mu)
+func (l *adaptiveLimiter) acquire(ctx context.Context) (s slot, err error) {
+	for {
+		l.mu.Lock()
+		if float64(l.inFlight) < l.limit {
+			l.inFlight++
+			s = slot{epoch: l.epoch}
+			l.mu.Unlock()
+			return
+		}
+
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+}
+
+// Give back the slot of a request that took the given time to return the
+// given error, adjusting the limit accordingly. Return the limit, and whether
+// it changed.
+//
+// LOCKS_EXCLUDED(l.mu)
+func (l *adaptiveLimiter) release(
+	s slot,
+	method string,
+	latency time.Duration,
+	err error) (limit int, changed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	busy := float64(l.inFlight) >= l.limit/2
+	l.inFlight--
+	before := int(l.limit)
+
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// The caller gave up, which says nothing about the backend.
+
+	case overloaded(err):
+		l.backOff(s)
+
+	case err == nil:
+		// Learn from slow requests too, so that the usual latency follows a
+		// lasting shift rather than every later request counting as slow.
+		slow := latencySensitive[method] && l.slow(method, latency)
+		if latencySensitive[method] {
+			l.learn(method, latency)
+		}
+
+		if slow {
+			l.backOff(s)
+		} else if busy {
+			l.limit = min(l.limit+1/l.limit, l.max)
+		}
+	}
+
+	close(l.freed)
+	l.freed = make(chan struct{})
+
+	limit = int(l.limit)
+	changed = limit != before
+	return
+}
+
+// Cut the limit, unless it has been cut since the request was admitted.
+//
+// LOCKS_REQUIRED(l.mu)
+func (l *adaptiveLimiter) backOff(s slot) {
+	if s.epoch == l.epoch {
+		l.limit = max(l.limit*backoffRatio, 1)
+		l.epoch++
+	}
+}
+
+// Report whether the latency is much more than usual for the method.
+//
+// LOCKS_REQUIRED(l.mu)
+func (l *adaptiveLimiter) slow(method string, latency time.Duration) bool {
+	u, ok := l.usual[method]
+	return ok && u.samples >= minLatencySamples && float64(latency) > latencyTolerance*u.mean
+}
+
+// LOCKS_REQUIRED(l.mu)
+func (l *adaptiveLimiter) learn(method string, latency time.Duration) {
+	u, ok := l.usual[method]
+	if !ok {
+		u = &usualLatency{mean: float64(latency)}
+		l.usual[method] = u
+	}
+
+	u.mean += latencyWeight * (float64(latency) - u.mean)
+	u.samples++
+}
@@ -0,0 +1,362 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errTooManyRequests = &googleapi.Error{Code: http.StatusTooManyRequests}
+	errUnavailable     = &googleapi.Error{Code: http.StatusServiceUnavailable}
+)
+
+func TestOverloaded(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"429", errTooManyRequests, true},
+		{"503", errUnavailable, true},
+		{"500", &googleapi.Error{Code: http.StatusInternalServerError}, true},
+		{"wrapped 429", fmt.Errorf("StatObject: %w", errTooManyRequests), true},
+		{"404", &googleapi.Error{Code: http.StatusNotFound}, false},
+		{"grpc unavailable", status.Error(codes.Unavailable, "unavailable"), true},
+		{"grpc not found", status.Error(codes.NotFound, "not found"), false},
+		{"not found", &gcs.NotFoundError{Err: errors.New("not found")}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, overloaded(tc.err))
+		})
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// adaptiveLimiter
+////////////////////////////////////////////////////////////////////////
+
+func TestLimiterWaitsForFreeSlot(t *testing.T) {
+	l := newAdaptiveLimiter(1)
+	s, err := l.acquire(context.Background())
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = l.acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan error)
+	go func() {
+		_, err := l.acquire(context.Background())
+		acquired <- err
+	}()
+	l.release(s, "StatObject", 0, nil)
+	assert.NoError(t, <-acquired)
+}
+
+func TestLimiterBacksOffOnceForOverloadedRequestsInFlightTogether(t *testing.T) {
+	l := newAdaptiveLimiter(10)
+	var slots []slot
+	for range 3 {
+		s, err := l.acquire(context.Background())
+		require.NoError(t, err)
+		slots = append(slots, s)
+	}
+
+	limit, changed := l.release(slots[0], "StatObject", 0, errTooManyRequests)
+	assert.True(t, changed)
+	assert.Equal(t, 7, limit)
+	for _, s := range slots[1:] {
+		limit, changed = l.release(s, "StatObject", 0, errUnavailable)
+		assert.False(t, changed)
+		assert.Equal(t, 7, limit)
+	}
+
+	// A request admitted since backs off again.
+	s, err := l.acquire(context.Background())
+	require.NoError(t, err)
+	limit, _ = l.release(s, "StatObject", 0, errUnavailable)
+	assert.Equal(t, 4, limit)
+}
+
+func TestLimiterBacksOffOnSlowRequests(t *testing.T) {
+	l := newAdaptiveLimiter(10)
+	for range minLatencySamples {
+		s, err := l.acquire(context.Background())
+		require.NoError(t, err)
+		l.release(s, "StatObject", 10*time.Millisecond, nil)
+	}
+
+	// A slow request of another method says nothing about stats.
+	s, err := l.acquire(context.Background())
+	require.NoError(t, err)
+	_, changed := l.release(s, "DeleteObject", 100*time.Millisecond, nil)
+	assert.False(t, changed)
+
+	s, err = l.acquire(context.Background())
+	require.NoError(t, err)
+	limit, changed := l.release(s, "StatObject", 100*time.Millisecond, nil)
+	assert.True(t, changed)
+	assert.Equal(t, 7, limit)
+}
+
+func TestLimiterIgnoresLatencyOfCallsThatMoveData(t *testing.T) {
+	l := newAdaptiveLimiter(10)
+	for range minLatencySamples {
+		s, err := l.acquire(context.Background())
+		require.NoError(t, err)
+		l.release(s, "CreateObject", 10*time.Millisecond, nil)
+	}
+
+	s, err := l.acquire(context.Background())
+	require.NoError(t, err)
+	_, changed := l.release(s, "CreateObject", time.Second, nil)
+	assert.False(t, changed)
+
+	s, err = l.acquire(context.Background())
+	require.NoError(t, err)
+	limit, changed := l.release(s, "CreateObject", 0, errTooManyRequests)
+	assert.True(t, changed)
+	assert.Equal(t, 7, limit)
+}
+
+func TestLimiterAdaptsToLastingLatencyShift(t *testing.T) {
+	l := newAdaptiveLimiter(10)
+	for range minLatencySamples {
+		s, err := l.acquire(context.Background())
+		require.NoError(t, err)
+		l.release(s, "StatObject", 10*time.Millisecond, nil)
+	}
+
+	var limit int
+	for range 100 {
+		s, err := l.acquire(context.Background())
+		require.NoError(t, err)
+		limit, _ = l.release(s, "StatObject", 100*time.Millisecond, nil)
+	}
+
+	// The new latency has become the usual one, so requests no longer count
+	// as slow and the limit isn't cut for good.
+	assert.Greater(t, limit, 1)
+	s, err := l.acquire(context.Background())
+	require.NoError(t, err)
+	_, changed := l.release(s, "StatObject", 100*time.Millisecond, nil)
+	assert.False(t, changed)
+}
+
+func TestLimiterIgnoresAbandonedRequests(t *testing.T) {
+	l := newAdaptiveLimiter(10)
+	for range minLatencySamples {
+		s, err := l.acquire(context.Background())
+		require.NoError(t, err)
+		l.release(s, "StatObject", 10*time.Millisecond, nil)
+	}
+
+	for _, err := range []error{
+		context.Canceled,
+		fmt.Errorf("StatObject: %w", context.DeadlineExceeded),
+	} {
+		s, acquireErr := l.acquire(context.Background())
+		require.NoError(t, acquireErr)
+		_, changed := l.release(s, "StatObject", time.Second, err)
+		assert.False(t, changed)
+	}
+}
+
+func TestLimiterGrowsBackToMaxWhileBusy(t *testing.T) {
+	l := newAdaptiveLimiter(10)
+	s, err := l.acquire(context.Background())
+	require.NoError(t, err)
+	l.release(s, "StatObject", 0, errTooManyRequests)
+
+	var limit int
+	for range 100 {
+		var slots []slot
+		for range 5 {
+			s, err := l.acquire(context.Background())
+			require.NoError(t, err)
+			slots = append(slots, s)
+		}
+		for _, s := range slots {
+			limit, _ = l.release(s, "StatObject", 0, nil)
+		}
+	}
+
+	assert.Equal(t, 10, limit)
+}
+
+////////////////////////////////////////////////////////////////////////
+// circuitBreaker
+////////////////////////////////////////////////////////////////////////
+
+func newTestBreaker() (*circuitBreaker, *timeutil.SimulatedClock) {
+	clock := &timeutil.SimulatedClock{}
+	clock.SetTime(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	return newCircuitBreaker(2, time.Minute, clock), clock
+}
+
+func TestBreakerOpensAfterThresholdFailures(t *testing.T) {
+	cb, _ := newTestBreaker()
+
+	assert.False(t, cb.record(false, errUnavailable))
+	assert.True(t, cb.record(false, errUnavailable))
+
+	_, err := cb.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorIs(t, err, syscall.EHOSTDOWN)
+}
+
+func TestBreakerIgnoresErrorsAboutTheRequest(t *testing.T) {
+	cb, _ := newTestBreaker()
+
+	cb.record(false, errUnavailable)
+	cb.record(false, &gcs.NotFoundError{Err: errors.New("not found")})
+	cb.record(false, context.Canceled)
+
+	assert.False(t, cb.record(false, errUnavailable))
+	_, err := cb.allow()
+	assert.NoError(t, err)
+}
+
+func TestBreakerClosesAfterSuccessfulProbe(t *testing.T) {
+	cb, clock := newTestBreaker()
+	cb.record(false, errUnavailable)
+	cb.record(false, errUnavailable)
+	clock.AdvanceTime(time.Minute)
+
+	probe, err := cb.allow()
+	require.NoError(t, err)
+	assert.True(t, probe)
+	// Only one probe at a time.
+	_, err = cb.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	cb.record(probe, nil)
+
+	probe, err = cb.allow()
+	assert.NoError(t, err)
+	assert.False(t, probe)
+}
+
+func TestBreakerReopensAfterFailedProbe(t *testing.T) {
+	cb, clock := newTestBreaker()
+	cb.record(false, errUnavailable)
+	cb.record(false, errUnavailable)
+	clock.AdvanceTime(time.Minute)
+	probe, err := cb.allow()
+	require.NoError(t, err)
+
+	assert.True(t, cb.record(probe, errTooManyRequests))
+
+	_, err = cb.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	clock.AdvanceTime(time.Minute)
+	_, err = cb.allow()
+	assert.NoError(t, err)
+}
+
+////////////////////////////////////////////////////////////////////////
+// adaptiveBucket
+////////////////////////////////////////////////////////////////////////
+
+// A bucket whose stats fail with err.
+type failingBucket struct {
+	gcs.Bucket
+	err   error
+	calls atomic.Int64
+}
+
+func (b *failingBucket) Name() string {
+	return "some_bucket"
+}
+
+func (b *failingBucket) StatObject(_ context.Context, req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	b.calls.Add(1)
+	if b.err != nil {
+		return nil, nil, b.err
+	}
+
+	return &gcs.MinObject{Name: req.Name}, nil, nil
+}
+
+type adaptiveCounter struct {
+	common.MetricHandle
+	limit   atomic.Int64
+	trips   atomic.Int64
+	rejects atomic.Int64
+}
+
+func (c *adaptiveCounter) GCSConcurrencyLimit(_ context.Context, value int64, _ []common.MetricAttr) {
+	c.limit.Store(value)
+}
+
+func (c *adaptiveCounter) GCSCircuitBreakerTripCount(_ context.Context, inc int64, _ []common.MetricAttr) {
+	c.trips.Add(inc)
+}
+
+func (c *adaptiveCounter) GCSCircuitBreakerRejectCount(_ context.Context, inc int64, _ []common.MetricAttr) {
+	c.rejects.Add(inc)
+}
+
+func TestAdaptiveBucketFailsFastWhileCircuitOpen(t *testing.T) {
+	wrapped := &failingBucket{err: errUnavailable}
+	metrics := &adaptiveCounter{MetricHandle: common.NewNoopMetrics()}
+	b := NewAdaptiveBucket(wrapped, AdaptiveConfig{MaxInFlight: 10, BreakerThreshold: 1, BreakerCooldown: time.Hour}, timeutil.RealClock(), metrics)
+	assert.EqualValues(t, 10, metrics.limit.Load())
+
+	_, _, err := b.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+	assert.ErrorIs(t, err, errUnavailable)
+	_, _, err = b.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+
+	assert.ErrorIs(t, err, syscall.EHOSTDOWN)
+	assert.EqualValues(t, 1, wrapped.calls.Load())
+	assert.EqualValues(t, 7, metrics.limit.Load())
+	assert.EqualValues(t, 1, metrics.trips.Load())
+	assert.EqualValues(t, 1, metrics.rejects.Load())
+}
+
+func TestAdaptiveBucketPassesThroughWhenHealthy(t *testing.T) {
+	wrapped := &failingBucket{}
+	metrics := &adaptiveCounter{MetricHandle: common.NewNoopMetrics()}
+	b := NewAdaptiveBucket(wrapped, AdaptiveConfig{MaxInFlight: 1, BreakerThreshold: 1, BreakerCooldown: time.Hour}, timeutil.RealClock(), metrics)
+
+	for range 3 {
+		m, _, err := b.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+		require.NoError(t, err)
+		assert.Equal(t, "foo", m.Name)
+	}
+
+	assert.EqualValues(t, 3, wrapped.calls.Load())
+	assert.EqualValues(t, 0, metrics.trips.Load())
+}
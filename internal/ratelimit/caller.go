@@ -0,0 +1,99 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+)
+
+// Caller identifies the process a request is made for, as told by the kernel
+// in the file system op that led to it.
+type Caller struct {
+	Uid uint32
+	Pid uint32
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context whose requests are accounted to the caller.
+func WithCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+// CallerFrom returns the caller requests made with the context are accounted
+// to, if any.
+func CallerFrom(ctx context.Context) (c Caller, ok bool) {
+	switch v := ctx.Value(callerKey{}).(type) {
+	case Caller:
+		return v, true
+	case *CallerSlot:
+		if p := v.current.Load(); p != nil {
+			return *p, true
+		}
+	}
+
+	return
+}
+
+// A CallerSlot holds the caller of the latest op using something that outlives
+// it, such as a stream shared by the reads on a file handle. Requests made
+// with a context from WithCallerSlot are accounted to whoever is in the slot
+// at the time, not to the op that started them.
+type CallerSlot struct {
+	current atomic.Pointer[Caller]
+}
+
+// SetFrom puts the caller of the context in the slot, emptying it if the
+// context has none.
+func (s *CallerSlot) SetFrom(ctx context.Context) {
+	if c, ok := CallerFrom(ctx); ok {
+		s.current.Store(&c)
+		return
+	}
+
+	s.current.Store(nil)
+}
+
+// WithCallerSlot returns a context whose requests are accounted to the caller
+// in the slot when they are made.
+func WithCallerSlot(ctx context.Context, s *CallerSlot) context.Context {
+	return context.WithValue(ctx, callerKey{}, s)
+}
+
+// A function telling apart the callers that share a fair throttle, returning
+// false for requests made for no caller.
+type CallerKey func(ctx context.Context) (key uint32, ok bool)
+
+// NewCallerKey returns the key telling callers apart by "uid" or "pid".
+func NewCallerKey(by string) (CallerKey, error) {
+	switch by {
+	case "uid":
+		return func(ctx context.Context) (uint32, bool) {
+			c, ok := CallerFrom(ctx)
+			return c.Uid, ok
+		}, nil
+
+	case "pid":
+		return func(ctx context.Context) (uint32, bool) {
+			c, ok := CallerFrom(ctx)
+			return c.Pid, ok
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown caller key %q", by)
+}
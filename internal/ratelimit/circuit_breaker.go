@@ -0,0 +1,128 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+// ErrCircuitOpen is returned for requests failed fast because the backend is
+// unhealthy. It wraps EHOSTDOWN, so that is what file system ops see.
+var ErrCircuitOpen = fmt.Errorf("circuit breaker open, GCS is unhealthy: %w", syscall.EHOSTDOWN)
+
+type breakerState int
+
+const (
+	// Requests are let through.
+	closed breakerState = iota
+
+	// Requests fail fast until the cooldown has passed.
+	open
+
+	// A single probe is let through, to see whether the backend has recovered.
+	halfOpen
+)
+
+// A circuit breaker that opens after a run of requests fail because the
+// backend is overloaded or unhealthy, fails requests fast while open, and
+// lets a probe through once the cooldown has passed, closing again if it
+// succeeds.
+//
+// Safe for concurrent access.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	clock     timeutil.Clock
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, clock timeutil.Clock) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, clock: clock}
+}
+
+// Return ErrCircuitOpen if the request must fail fast. Otherwise the outcome
+// of the request must be passed to record, along with whether it is the probe
+// of a half-open circuit.
+//
+// LOCKS_EXCLUDED(cb.mu)
+func (cb *circuitBreaker) allow() (probe bool, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == open && cb.clock.Now().Sub(cb.openedAt) >= cb.cooldown {
+		cb.state = halfOpen
+	}
+
+	switch {
+	case cb.state == closed:
+
+	case cb.state == halfOpen && !cb.probing:
+		cb.probing = true
+		probe = true
+
+	default:
+		err = ErrCircuitOpen
+	}
+
+	return
+}
+
+// Record the outcome of a request that was allowed, returning whether it
+// opened the circuit.
+//
+// LOCKS_EXCLUDED(cb.mu)
+func (cb *circuitBreaker) record(probe bool, err error) (tripped bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if probe {
+		cb.probing = false
+	}
+
+	switch {
+	// A cancelled request says nothing about the backend.
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+
+	case overloaded(err):
+		cb.failures++
+		if (probe && cb.state == halfOpen) || (cb.state == closed && cb.failures >= cb.threshold) {
+			cb.state = open
+			cb.openedAt = cb.clock.Now()
+			tripped = true
+		}
+
+	// Any other reply, even an error about the request, shows the backend is
+	// healthy.
+	default:
+		cb.failures = 0
+		cb.state = closed
+	}
+
+	return
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// How recently a caller must have waited on a fair throttle to count
+	// towards sharing it.
+	activeWindow = time.Second
+
+	// How far ahead of its share a caller may get, so that short bursts
+	// aren't held up.
+	fairBurst = 100 * time.Millisecond
+)
+
+// NewFairThrottle returns a throttle that lets through rateHz tokens a second
+// in all, like NewThrottle, and shares them equally among the callers that
+// have waited on it recently, as told apart by key. Each caller's share is
+// also capped at perCallerHz, unless that isn't positive. Tokens waited for
+// by no caller are only subject to the overall limit.
+func NewFairThrottle(
+	rateHz float64,
+	capacity uint64,
+	perCallerHz float64,
+	key CallerKey) (t Throttle) {
+	if !(perCallerHz > 0) {
+		perCallerHz = math.Inf(1)
+	}
+
+	t = &fairThrottle{
+		total:       NewThrottle(rateHz, capacity),
+		rateHz:      rateHz,
+		perCallerHz: perCallerHz,
+		key:         key,
+		callers:     make(map[uint32]*fairShare),
+	}
+
+	return
+}
+
+type fairThrottle struct {
+	total       Throttle
+	rateHz      float64
+	perCallerHz float64
+	key         CallerKey
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	callers map[uint32]*fairShare
+}
+
+// The account of one caller: the time by which it will have been let
+// through all it has waited for at its share, and when it last waited.
+type fairShare struct {
+	caughtUp   time.Time
+	lastActive time.Time
+}
+
+func (t *fairThrottle) Capacity() uint64 {
+	return t.total.Capacity()
+}
+
+func (t *fairThrottle) Wait(ctx context.Context, tokens uint64) (err error) {
+	if k, ok := t.key(ctx); ok {
+		if err = t.waitForShare(ctx, k, tokens); err != nil {
+			return
+		}
+	}
+
+	err = t.total.Wait(ctx, tokens)
+	return
+}
+
+// Wait until the caller's share has caught up with the tokens it has asked
+// for, allowing for a short burst.
+//
+// LOCKS_EXCLUDED(t.mu)
+func (t *fairThrottle) waitForShare(ctx context.Context, k uint32, tokens uint64) error {
+	now := time.Now()
+	t.mu.Lock()
+	share := t.share(k, now)
+	c := t.callers[k]
+	cost := time.Duration(float64(tokens) / share * float64(time.Second))
+	start := c.caughtUp
+	if start.Before(now) {
+		start = now
+	}
+	c.caughtUp = start.Add(cost)
+	t.mu.Unlock()
+
+	d := c.caughtUp.Sub(now) - fairBurst - cost
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+
+	case <-ctx.Done():
+		// Give back what wasn't let through.
+		t.mu.Lock()
+		c.caughtUp = c.caughtUp.Add(-cost)
+		t.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Mark the caller active, forget callers that no longer are, and return the
+// tokens a second each active caller gets.
+//
+// LOCKS_REQUIRED(t.mu)
+func (t *fairThrottle) share(k uint32, now time.Time) float64 {
+	c, ok := t.callers[k]
+	if !ok {
+		c = &fairShare{}
+		t.callers[k] = c
+	}
+	c.lastActive = now
+
+	for other, oc := range t.callers {
+		if now.Sub(oc.lastActive) > activeWindow && now.After(oc.caughtUp) {
+			delete(t.callers, other)
+		}
+	}
+
+	return min(t.rateHz/float64(len(t.callers)), t.perCallerHz)
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func newTestFairThrottle(t *testing.T, perCallerHz float64) *fairThrottle {
+	t.Helper()
+	key, err := NewCallerKey("uid")
+	require.NoError(t, err)
+
+	return NewFairThrottle(1000, 1000, perCallerHz, key).(*fairThrottle)
+}
+
+func uid(u uint32) context.Context {
+	return WithCaller(context.Background(), Caller{Uid: u, Pid: 1})
+}
+
+func TestCallerKeys(t *testing.T) {
+	ctx := WithCaller(context.Background(), Caller{Uid: 1000, Pid: 42})
+
+	byUid, err := NewCallerKey("uid")
+	require.NoError(t, err)
+	k, ok := byUid(ctx)
+	assert.True(t, ok)
+	assert.EqualValues(t, 1000, k)
+	byPid, err := NewCallerKey("pid")
+	require.NoError(t, err)
+	k, ok = byPid(ctx)
+	assert.True(t, ok)
+	assert.EqualValues(t, 42, k)
+	_, ok = byPid(context.Background())
+	assert.False(t, ok)
+	_, err = NewCallerKey("gid")
+	assert.Error(t, err)
+}
+
+func TestSharesRateAmongActiveCallers(t *testing.T) {
+	ft := newTestFairThrottle(t, 0)
+	now := time.Now()
+
+	assert.Equal(t, 1000.0, ft.share(1, now))
+	assert.Equal(t, 500.0, ft.share(2, now))
+	assert.Equal(t, 500.0, ft.share(1, now.Add(activeWindow)))
+	// Caller 2 has gone quiet.
+	assert.Equal(t, 1000.0, ft.share(1, now.Add(2*activeWindow)))
+}
+
+func TestCapsEachCallersShare(t *testing.T) {
+	ft := newTestFairThrottle(t, 100)
+
+	assert.Equal(t, 100.0, ft.share(1, time.Now()))
+}
+
+func TestCallerOverItsShareWaits(t *testing.T) {
+	ft := newTestFairThrottle(t, 0)
+
+	start := time.Now()
+	require.NoError(t, ft.Wait(uid(1), 300))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	require.NoError(t, ft.Wait(uid(1), 300))
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	// Another caller isn't held up by the first's backlog.
+	start = time.Now()
+	require.NoError(t, ft.Wait(uid(2), 100))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRequestsWithoutCallerAreOnlyLimitedOverall(t *testing.T) {
+	ft := newTestFairThrottle(t, 1)
+
+	start := time.Now()
+	require.NoError(t, ft.Wait(context.Background(), 500))
+
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Empty(t, ft.callers)
+}
+
+func TestCancelledWaitGivesBackShare(t *testing.T) {
+	ft := newTestFairThrottle(t, 0)
+	require.NoError(t, ft.Wait(uid(1), 300))
+	caughtUp := ft.callers[1].caughtUp
+	ctx, cancel := context.WithTimeout(uid(1), 10*time.Millisecond)
+	defer cancel()
+
+	err := ft.Wait(ctx, 300)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, caughtUp, ft.callers[1].caughtUp)
+}
+
+func TestCallerSlotAccountsToItsCurrentCaller(t *testing.T) {
+	var slot CallerSlot
+	ctx := WithCallerSlot(context.Background(), &slot)
+
+	_, ok := CallerFrom(ctx)
+	assert.False(t, ok)
+
+	slot.SetFrom(uid(1000))
+	c, ok := CallerFrom(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1000), c.Uid)
+
+	slot.SetFrom(uid(1001))
+	c, ok = CallerFrom(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1001), c.Uid)
+
+	slot.SetFrom(context.Background())
+	_, ok = CallerFrom(ctx)
+	assert.False(t, ok)
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caching
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// NewCoalescingBucket wraps the supplied bucket in a layer that lets
+// concurrent identical StatObject, GetFolder and ListObjects requests share a
+// single call to the wrapped bucket and its result. A request that arrives
+// while an identical one is in flight is counted by the metric handle as
+// coalesced, and gets the result of the request in flight rather than of one
+// issued after it arrived.
+//
+// The shared call is cancelled only once every request waiting on it has
+// been cancelled.
+func NewCoalescingBucket(wrapped gcs.Bucket, metricHandle common.MetricHandle) (b gcs.Bucket) {
+	b = &coalescingBucket{
+		wrapped:      wrapped,
+		metricHandle: metricHandle,
+		calls:        make(map[any]*call),
+	}
+
+	return
+}
+
+type coalescingBucket struct {
+	wrapped      gcs.Bucket
+	metricHandle common.MetricHandle
+
+	mu sync.Mutex
+
+	// The calls in flight, keyed by the request they are making.
+	//
+	// GUARDED_BY(mu)
+	calls map[any]*call
+}
+
+// A call to the wrapped bucket shared by identical requests.
+type call struct {
+	// Closed once v and err are set.
+	done chan struct{}
+	v    any
+	err  error
+
+	cancel context.CancelFunc
+
+	// The number of requests still waiting on the call.
+	//
+	// GUARDED_BY(coalescingBucket.mu)
+	waiters int
+}
+
+// Keys for requests whose arguments aren't a distinct type of their own.
+type getFolderKey string
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *coalescingBucket) do(
+	ctx context.Context,
+	method string,
+	key any,
+	f func(context.Context) (any, error)) (v any, err error) {
+	b.mu.Lock()
+	c, ok := b.calls[key]
+	if ok {
+		c.waiters++
+		b.mu.Unlock()
+		b.metricHandle.GCSCoalescedCount(ctx, 1, []common.MetricAttr{{Key: common.GCSMethod, Value: method}})
+	} else {
+		// Don't let the first request's cancellation fail the others.
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call{done: make(chan struct{}), cancel: cancel, waiters: 1}
+		b.calls[key] = c
+		b.mu.Unlock()
+
+		go func() {
+			c.v, c.err = f(callCtx)
+			b.forget(key, c)
+			cancel()
+			close(c.done)
+		}()
+	}
+
+	select {
+	case <-c.done:
+		v, err = c.v, c.err
+
+	case <-ctx.Done():
+		b.mu.Lock()
+		c.waiters--
+		abandoned := c.waiters == 0
+		b.mu.Unlock()
+
+		// Later requests mustn't join a call that's being cancelled.
+		if abandoned {
+			b.forget(key, c)
+			c.cancel()
+		}
+
+		err = ctx.Err()
+	}
+
+	return
+}
+
+// Remove the call from those in flight, unless it has been already.
+//
+// LOCKS_EXCLUDED(b.mu)
+func (b *coalescingBucket) forget(key any, c *call) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.calls[key] == c {
+		delete(b.calls, key)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Bucket interface
+////////////////////////////////////////////////////////////////////////
+
+func (b *coalescingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	v, err := b.do(ctx, "StatObject", *req, func(ctx context.Context) (any, error) {
+		m, e, err := b.wrapped.StatObject(ctx, req)
+		return statResult{m, e}, err
+	})
+	if err != nil {
+		return
+	}
+
+	res := v.(statResult)
+	m, e = res.m, res.e
+	return
+}
+
+type statResult struct {
+	m *gcs.MinObject
+	e *gcs.ExtendedObjectAttributes
+}
+
+func (b *coalescingBucket) GetFolder(ctx context.Context, folderName string) (f *gcs.Folder, err error) {
+	v, err := b.do(ctx, "GetFolder", getFolderKey(folderName), func(ctx context.Context) (any, error) {
+		return b.wrapped.GetFolder(ctx, folderName)
+	})
+	if err != nil {
+		return
+	}
+
+	f = v.(*gcs.Folder)
+	return
+}
+
+func (b *coalescingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	v, err := b.do(ctx, "ListObjects", *req, func(ctx context.Context) (any, error) {
+		return b.wrapped.ListObjects(ctx, req)
+	})
+	if err != nil {
+		return
+	}
+
+	// Give each caller its own slices, which they are free to modify.
+	shared := v.(*gcs.Listing)
+	listing = &gcs.Listing{
+		MinObjects:        slices.Clone(shared.MinObjects),
+		CollapsedRuns:     slices.Clone(shared.CollapsedRuns),
+		ContinuationToken: shared.ContinuationToken,
+	}
+
+	return
+}
+
+func (b *coalescingBucket) Name() string {
+	return b.wrapped.Name()
+}
+
+func (b *coalescingBucket) BucketType() gcs.BucketType {
+	return b.wrapped.BucketType()
+}
+
+func (b *coalescingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	return b.wrapped.NewReader(ctx, req)
+}
+
+func (b *coalescingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	return b.wrapped.CreateObject(ctx, req)
+}
+
+func (b *coalescingBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	return b.wrapped.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+}
+
+func (b *coalescingBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (*gcs.MinObject, error) {
+	return b.wrapped.FinalizeUpload(ctx, w)
+}
+
+func (b *coalescingBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	return b.wrapped.CopyObject(ctx, req)
+}
+
+func (b *coalescingBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	return b.wrapped.ComposeObjects(ctx, req)
+}
+
+func (b *coalescingBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	return b.wrapped.UpdateObject(ctx, req)
+}
+
+func (b *coalescingBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) error {
+	return b.wrapped.DeleteObject(ctx, req)
+}
+
+func (b *coalescingBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	return b.wrapped.DeleteFolder(ctx, folderName)
+}
+
+func (b *coalescingBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return b.wrapped.CreateFolder(ctx, folderName)
+}
+
+func (b *coalescingBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	return b.wrapped.RenameFolder(ctx, folderName, destinationFolderId)
+}
@@ -0,0 +1,262 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caching_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A bucket whose StatObject, GetFolder and ListObjects calls block until
+// released or cancelled.
+type gatedBucket struct {
+	gcs.Bucket
+	release chan struct{}
+
+	calls     atomic.Int64
+	cancelled atomic.Int64
+}
+
+func (b *gatedBucket) wait(ctx context.Context) error {
+	b.calls.Add(1)
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		b.cancelled.Add(1)
+		return ctx.Err()
+	}
+}
+
+func (b *gatedBucket) StatObject(ctx context.Context, req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	return b.Bucket.StatObject(ctx, req)
+}
+
+func (b *gatedBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return &gcs.Folder{Name: folderName}, nil
+}
+
+func (b *gatedBucket) ListObjects(ctx context.Context, req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return b.Bucket.ListObjects(ctx, req)
+}
+
+type coalescedCounter struct {
+	common.MetricHandle
+	coalesced atomic.Int64
+}
+
+func (c *coalescedCounter) GCSCoalescedCount(_ context.Context, inc int64, _ []common.MetricAttr) {
+	c.coalesced.Add(inc)
+}
+
+type coalescingTest struct {
+	wrapped *gatedBucket
+	metrics *coalescedCounter
+	bucket  gcs.Bucket
+}
+
+// Set up a coalescing bucket holding "foo" and "bar".
+func setUpCoalescing(t *testing.T) *coalescingTest {
+	t.Helper()
+	fakeBucket := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	for _, name := range []string{"foo", "bar"} {
+		_, err := fakeBucket.CreateObject(context.Background(), &gcs.CreateObjectRequest{Name: name, Contents: strings.NewReader(name)})
+		require.NoError(t, err)
+	}
+
+	ct := &coalescingTest{
+		wrapped: &gatedBucket{Bucket: fakeBucket, release: make(chan struct{})},
+		metrics: &coalescedCounter{MetricHandle: common.NewNoopMetrics()},
+	}
+	ct.bucket = caching.NewCoalescingBucket(ct.wrapped, ct.metrics)
+
+	return ct
+}
+
+// Wait until the wrapped bucket has been called calls times, and coalesced
+// requests number coalesced.
+func (ct *coalescingTest) waitFor(t *testing.T, calls int64, coalesced int64) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return ct.wrapped.calls.Load() == calls && ct.metrics.coalesced.Load() == coalesced
+	}, time.Second, time.Millisecond)
+}
+
+func TestCoalescesConcurrentStats(t *testing.T) {
+	ct := setUpCoalescing(t)
+	const n = 8
+	results := make([]*gcs.MinObject, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _, errs[i] = ct.bucket.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+		}()
+	}
+
+	ct.waitFor(t, 1, n-1)
+	close(ct.wrapped.release)
+	wg.Wait()
+
+	for i := range n {
+		require.NoError(t, errs[i])
+		assert.Equal(t, "foo", results[i].Name)
+	}
+	assert.EqualValues(t, 1, ct.wrapped.calls.Load())
+}
+
+func TestDoesntCoalesceDifferentRequests(t *testing.T) {
+	ct := setUpCoalescing(t)
+	var wg sync.WaitGroup
+	for _, req := range []*gcs.StatObjectRequest{
+		{Name: "foo"},
+		{Name: "bar"},
+		{Name: "foo", ForceFetchFromGcs: true},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := ct.bucket.StatObject(context.Background(), req)
+			assert.NoError(t, err)
+		}()
+	}
+
+	ct.waitFor(t, 3, 0)
+	close(ct.wrapped.release)
+	wg.Wait()
+}
+
+func TestDoesntCoalesceSequentialRequests(t *testing.T) {
+	ct := setUpCoalescing(t)
+	close(ct.wrapped.release)
+
+	for range 2 {
+		_, err := ct.bucket.GetFolder(context.Background(), "dir/")
+		require.NoError(t, err)
+	}
+
+	assert.EqualValues(t, 2, ct.wrapped.calls.Load())
+	assert.EqualValues(t, 0, ct.metrics.coalesced.Load())
+}
+
+func TestCoalescesConcurrentGetFolders(t *testing.T) {
+	ct := setUpCoalescing(t)
+	done := make(chan *gcs.Folder)
+	for range 2 {
+		go func() {
+			f, err := ct.bucket.GetFolder(context.Background(), "dir/")
+			assert.NoError(t, err)
+			done <- f
+		}()
+	}
+
+	ct.waitFor(t, 1, 1)
+	close(ct.wrapped.release)
+
+	assert.Equal(t, "dir/", (<-done).Name)
+	assert.Equal(t, "dir/", (<-done).Name)
+}
+
+func TestCoalescedListingsAreIndependent(t *testing.T) {
+	ct := setUpCoalescing(t)
+	done := make(chan *gcs.Listing)
+	for range 2 {
+		go func() {
+			listing, err := ct.bucket.ListObjects(context.Background(), &gcs.ListObjectsRequest{})
+			assert.NoError(t, err)
+			done <- listing
+		}()
+	}
+
+	ct.waitFor(t, 1, 1)
+	close(ct.wrapped.release)
+	l1, l2 := <-done, <-done
+	l1.MinObjects[0] = nil
+
+	require.Len(t, l2.MinObjects, 2)
+	assert.Equal(t, "bar", l2.MinObjects[0].Name)
+}
+
+func TestCancellingOneRequestLeavesOthersWaiting(t *testing.T) {
+	ct := setUpCoalescing(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		_, _, err := ct.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+		cancelled <- err
+	}()
+	ct.waitFor(t, 1, 0)
+	done := make(chan error)
+	go func() {
+		_, _, err := ct.bucket.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+		done <- err
+	}()
+	ct.waitFor(t, 1, 1)
+
+	cancel()
+	assert.ErrorIs(t, <-cancelled, context.Canceled)
+	close(ct.wrapped.release)
+
+	assert.NoError(t, <-done)
+	assert.EqualValues(t, 0, ct.wrapped.cancelled.Load())
+}
+
+func TestCancelsCallOnceAbandoned(t *testing.T) {
+	ct := setUpCoalescing(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		_, _, err := ct.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+		cancelled <- err
+	}()
+	ct.waitFor(t, 1, 0)
+
+	cancel()
+
+	assert.ErrorIs(t, <-cancelled, context.Canceled)
+	assert.Eventually(t, func() bool { return ct.wrapped.cancelled.Load() == 1 }, time.Second, time.Millisecond)
+	// A later request doesn't join the abandoned call.
+	close(ct.wrapped.release)
+	_, _, err := ct.bucket.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, ct.wrapped.calls.Load())
+	assert.EqualValues(t, 0, ct.metrics.coalesced.Load())
+}
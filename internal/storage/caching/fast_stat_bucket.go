@@ -334,6 +334,11 @@ func (b *fastStatBucket) ListObjects(
 		return
 	}
 
+	// Noncurrent generations must not be mistaken for the live objects.
+	if req.Versions {
+		return
+	}
+
 	if b.BucketType() == gcs.Hierarchical {
 		b.insertHierarchicalListing(listing)
 		return
@@ -778,6 +778,25 @@ func (t *ListObjectsTest) NonEmptyListingForHNS() {
 	ExpectEq(expected, listing)
 }
 
+func (t *ListObjectsTest) VersionsListingIsNotCached() {
+	// Wrapped
+	o0 := &gcs.MinObject{Name: "taco", Generation: 1}
+	o1 := &gcs.MinObject{Name: "taco", Generation: 2}
+
+	expected := &gcs.Listing{
+		MinObjects: []*gcs.MinObject{o0, o1},
+	}
+
+	ExpectCall(t.wrapped, "ListObjects")(Any(), Any()).
+		WillOnce(Return(expected, nil))
+
+	// Call
+	listing, err := t.bucket.ListObjects(context.TODO(), &gcs.ListObjectsRequest{Versions: true})
+
+	AssertEq(nil, err)
+	ExpectEq(expected, listing)
+}
+
 ////////////////////////////////////////////////////////////////////////
 // UpdateObject
 ////////////////////////////////////////////////////////////////////////
@@ -25,6 +25,7 @@ import (
 	"io"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -44,6 +45,22 @@ func NewFakeBucket(clock timeutil.Clock, name string, bucketType gcs.BucketType)
 	return b
 }
 
+// NewFakeVersionedBucket is like NewFakeBucket, but the bucket keeps the
+// generations of objects that are overwritten or deleted, as one with object
+// versioning enabled does. They can be listed with
+// ListObjectsRequest.Versions and read, copied or deleted by generation.
+func NewFakeVersionedBucket(clock timeutil.Clock, name string, bucketType gcs.BucketType) gcs.Bucket {
+	b := &bucket{
+		clock:      clock,
+		name:       name,
+		bucketType: bucketType,
+		versioned:  true,
+		noncurrent: make(map[string][]fakeObject),
+	}
+	b.mu = syncutil.NewInvariantMutex(b.checkInvariants)
+	return b
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Helper types
 ////////////////////////////////////////////////////////////////////////
@@ -178,6 +195,15 @@ type bucket struct {
 	//
 	// INVARIANT: This is an upper bound for generation numbers in objects.
 	prevGeneration int64 // GUARDED_BY(mu)
+
+	// Whether overwritten and deleted objects are kept as noncurrent
+	// generations.
+	versioned bool
+
+	// The noncurrent generations of each name. Empty unless versioned.
+	//
+	// INVARIANT: For each name, strictly increasing by generation.
+	noncurrent map[string][]fakeObject // GUARDED_BY(mu)
 }
 
 func checkName(name string) (err error) {
@@ -226,6 +252,59 @@ func (b *bucket) checkInvariants() {
 					b.prevGeneration))
 		}
 	}
+
+	// Make sure noncurrent generations are in order and were all minted.
+	for name, gens := range b.noncurrent {
+		for i, o := range gens {
+			if o.metadata.Name != name ||
+				o.metadata.Generation > b.prevGeneration ||
+				(i > 0 && gens[i-1].metadata.Generation >= o.metadata.Generation) {
+				panic(
+					fmt.Sprintf(
+						"Unexpected noncurrent generation %v of %q",
+						o.metadata.Generation,
+						name))
+			}
+		}
+	}
+}
+
+// Keep a live object that is being overwritten or deleted as a noncurrent
+// generation, if the bucket is versioned.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) retire(o fakeObject) {
+	if !b.versioned {
+		return
+	}
+
+	o.metadata.Deleted = b.clock.Now()
+	b.noncurrent[o.metadata.Name] = append(b.noncurrent[o.metadata.Name], o)
+}
+
+// Find the given generation of the named object, live or noncurrent. A zero
+// generation means the live one.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) findGeneration(name string, generation int64) (o *fakeObject, ok bool) {
+	index := b.objects.find(name)
+	if index < len(b.objects) &&
+		(generation == 0 || b.objects[index].metadata.Generation == generation) {
+		return &b.objects[index], true
+	}
+
+	if generation == 0 {
+		return
+	}
+
+	gens := b.noncurrent[name]
+	for i := range gens {
+		if gens[i].metadata.Generation == generation {
+			return &gens[i], true
+		}
+	}
+
+	return
 }
 
 // Create an object struct for the given attributes and contents.
@@ -255,6 +334,7 @@ func (b *bucket) mintObject(
 		Generation:      b.prevGeneration,
 		MetaGeneration:  1,
 		StorageClass:    "STANDARD",
+		Created:         b.clock.Now(),
 		Updated:         b.clock.Now(),
 	}
 
@@ -399,6 +479,7 @@ func createOrUpdateFakeObject(b *bucket, req *gcs.CreateObjectRequest, contents
 	// Replace an entry in or add an entry to our list of objects.
 	existingIndex := b.objects.find(req.Name)
 	if existingIndex < len(b.objects) {
+		b.retire(b.objects[existingIndex])
 		b.objects[existingIndex] = fo
 	} else {
 		b.objects = append(b.objects, fo)
@@ -432,15 +513,14 @@ func (b *bucket) createObjectLocked(
 	return createOrUpdateFakeObject(b, req, contents)
 }
 
-// Create a reader based on the supplied request, also returning the index
-// within b.objects of the entry for the requested generation.
+// Create a reader based on the supplied request, also returning the entry for
+// the requested generation.
 //
 // LOCKS_REQUIRED(b.mu)
 func (b *bucket) newReaderLocked(
-	req *gcs.ReadObjectRequest) (r io.Reader, index int, err error) {
+	req *gcs.ReadObjectRequest) (r io.Reader, o *fakeObject, err error) {
 	// Find the object with the requested name.
-	index = b.objects.find(req.Name)
-	if index == len(b.objects) {
+	if b.objects.find(req.Name) == len(b.objects) && len(b.noncurrent[req.Name]) == 0 {
 		err = &gcs.NotFoundError{
 			Err: fmt.Errorf("object %s not found", req.Name),
 		}
@@ -448,10 +528,9 @@ func (b *bucket) newReaderLocked(
 		return
 	}
 
-	o := b.objects[index]
-
-	// Does the generation match?
-	if req.Generation != 0 && req.Generation != o.metadata.Generation {
+	// Does the generation exist?
+	o, ok := b.findGeneration(req.Name, req.Generation)
+	if !ok {
 		err = &gcs.NotFoundError{
 			Err: fmt.Errorf(
 				"object %s generation %v not found", req.Name, req.Generation),
@@ -527,6 +606,8 @@ func copyMinObject(o *gcs.Object) *gcs.MinObject {
 	copy.Metadata = copyMetadata(o.Metadata)
 	copy.ContentEncoding = o.ContentEncoding
 	copy.CRC32C = o.CRC32C
+	copy.Created = o.Created
+	copy.Deleted = o.Deleted
 	return &copy
 }
 
@@ -549,6 +630,11 @@ func (b *bucket) ListObjects(
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	if req.Versions && b.versioned {
+		listing, err = b.listVersionsLocked(req)
+		return
+	}
+
 	// Set up the result object.
 	listing = new(gcs.Listing)
 
@@ -559,7 +645,7 @@ func (b *bucket) ListObjects(
 	}
 
 	// Find where in the space of object names to start.
-	nameStart := req.Prefix
+	nameStart := max(req.Prefix, req.StartOffset)
 	if req.ContinuationToken != "" && req.ContinuationToken > nameStart {
 		nameStart = req.ContinuationToken
 	}
@@ -567,6 +653,10 @@ func (b *bucket) ListObjects(
 	// Find the range of indexes within the array to scan.
 	indexStart := b.objects.lowerBound(nameStart)
 	prefixLimit := b.objects.prefixUpperBound(req.Prefix)
+	if req.EndOffset != "" {
+		prefixLimit = minInt(prefixLimit, b.objects.lowerBound(req.EndOffset))
+	}
+	indexStart = minInt(indexStart, prefixLimit)
 	indexLimit := minInt(indexStart+maxResults, prefixLimit)
 
 	// Scan the array.
@@ -658,6 +748,101 @@ func (b *bucket) ListObjects(
 	return
 }
 
+// Serve a listing that includes noncurrent generations. Continuation tokens
+// are the decimal index of the next result (object or collapsed run) in the
+// whole listing.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) listVersionsLocked(req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	listing = new(gcs.Listing)
+
+	maxResults := req.MaxResults
+	if maxResults == 0 {
+		maxResults = 1000
+	}
+
+	start := 0
+	if req.ContinuationToken != "" {
+		start, err = strconv.Atoi(req.ContinuationToken)
+		if err != nil || start < 0 {
+			err = fmt.Errorf("invalid continuation token %q", req.ContinuationToken)
+			return
+		}
+	}
+
+	// Gather every generation of every matching name.
+	inRange := func(name string) bool {
+		return name >= req.StartOffset && (req.EndOffset == "" || name < req.EndOffset)
+	}
+
+	var all []*gcs.Object
+	for i := b.objects.lowerBound(req.Prefix); i < b.objects.prefixUpperBound(req.Prefix); i++ {
+		if inRange(b.objects[i].metadata.Name) {
+			all = append(all, &b.objects[i].metadata)
+		}
+	}
+
+	for name, gens := range b.noncurrent {
+		if !strings.HasPrefix(name, req.Prefix) || !inRange(name) {
+			continue
+		}
+
+		for i := range gens {
+			all = append(all, &gens[i].metadata)
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Generation < all[j].Generation
+	})
+
+	// Number the results, a collapsed run counting once, and keep those that
+	// fall in the requested page.
+	index := -1
+	lastRun := ""
+	for _, o := range all {
+		// Collapse runs sharing a delimiter, as in an ordinary listing.
+		if req.Delimiter != "" {
+			rest := o.Name[len(req.Prefix):]
+			if delimiterIndex := strings.Index(rest, req.Delimiter); delimiterIndex >= 0 {
+				resultPrefix := o.Name[:len(req.Prefix)+delimiterIndex+len(req.Delimiter)]
+				if resultPrefix != lastRun {
+					lastRun = resultPrefix
+					index++
+					if index >= start+maxResults {
+						break
+					}
+					if index >= start {
+						listing.CollapsedRuns = append(listing.CollapsedRuns, resultPrefix)
+					}
+				}
+
+				isTrailingDelimiter := delimiterIndex == len(rest)-len(req.Delimiter)
+				if !isTrailingDelimiter || !req.IncludeTrailingDelimiter {
+					continue
+				}
+			}
+		}
+
+		index++
+		if index >= start+maxResults {
+			break
+		}
+		if index >= start {
+			listing.MinObjects = append(listing.MinObjects, copyMinObject(o))
+		}
+	}
+
+	if index >= start+maxResults {
+		listing.ContinuationToken = strconv.Itoa(start + maxResults)
+	}
+
+	return
+}
+
 // LOCKS_EXCLUDED(b.mu)
 func (b *bucket) NewReader(
 	ctx context.Context,
@@ -719,8 +904,7 @@ func (b *bucket) CopyObject(
 	}
 
 	// Does the object exist?
-	srcIndex := b.objects.find(req.SrcName)
-	if srcIndex == len(b.objects) {
+	if b.objects.find(req.SrcName) == len(b.objects) && len(b.noncurrent[req.SrcName]) == 0 {
 		err = &gcs.NotFoundError{
 			Err: fmt.Errorf("object %q not found", req.SrcName),
 		}
@@ -729,8 +913,8 @@ func (b *bucket) CopyObject(
 	}
 
 	// Does it have the correct generation?
-	if req.SrcGeneration != 0 &&
-		b.objects[srcIndex].metadata.Generation != req.SrcGeneration {
+	src, ok := b.findGeneration(req.SrcName, req.SrcGeneration)
+	if !ok {
 		err = &gcs.NotFoundError{
 			Err: fmt.Errorf(
 				"object %s generation %d not found", req.SrcName, req.SrcGeneration),
@@ -742,12 +926,32 @@ func (b *bucket) CopyObject(
 	// Does it have the correct meta-generation?
 	if req.SrcMetaGenerationPrecondition != nil {
 		p := *req.SrcMetaGenerationPrecondition
-		if b.objects[srcIndex].metadata.MetaGeneration != p {
+		if src.metadata.MetaGeneration != p {
 			err = &gcs.PreconditionError{
 				Err: fmt.Errorf(
 					"object %q has meta-generation %d",
 					req.SrcName,
-					b.objects[srcIndex].metadata.MetaGeneration),
+					src.metadata.MetaGeneration),
+			}
+
+			return
+		}
+	}
+
+	// Does the destination satisfy its generation precondition?
+	existingIndex := b.objects.find(req.DstName)
+	if req.DstGenerationPrecondition != nil {
+		var existingGen int64
+		if existingIndex < len(b.objects) {
+			existingGen = b.objects[existingIndex].metadata.Generation
+		}
+
+		if existingGen != *req.DstGenerationPrecondition {
+			err = &gcs.PreconditionError{
+				Err: fmt.Errorf(
+					"object %q has generation %d",
+					req.DstName,
+					existingGen),
 			}
 
 			return
@@ -756,16 +960,17 @@ func (b *bucket) CopyObject(
 
 	// Copy it and assign a new generation number, to ensure that the generation
 	// number for the destination name is strictly increasing.
-	dst := b.objects[srcIndex]
+	dst := *src
 	dst.metadata.Name = req.DstName
 	dst.metadata.MediaLink = "http://localhost/download/storage/fake/" + req.DstName
 
 	b.prevGeneration++
 	dst.metadata.Generation = b.prevGeneration
+	dst.metadata.Created = b.clock.Now()
 
 	// Insert into our array.
-	existingIndex := b.objects.find(req.DstName)
 	if existingIndex < len(b.objects) {
+		b.retire(b.objects[existingIndex])
 		b.objects[existingIndex] = dst
 	} else {
 		b.objects = append(b.objects, dst)
@@ -801,9 +1006,9 @@ func (b *bucket) ComposeObjects(
 
 	for _, src := range req.Sources {
 		var r io.Reader
-		var srcIndex int
+		var srcObject *fakeObject
 
-		r, srcIndex, err = b.newReaderLocked(&gcs.ReadObjectRequest{
+		r, srcObject, err = b.newReaderLocked(&gcs.ReadObjectRequest{
 			Name:       src.Name,
 			Generation: src.Generation,
 		})
@@ -813,7 +1018,7 @@ func (b *bucket) ComposeObjects(
 		}
 
 		srcReaders = append(srcReaders, r)
-		dstComponentCount += b.objects[srcIndex].metadata.ComponentCount
+		dstComponentCount += srcObject.metadata.ComponentCount
 	}
 
 	// GCS doesn't like the component count to go too high.
@@ -974,15 +1179,18 @@ func (b *bucket) DeleteObject(
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// Do we possess the object with the given name?
+	// Do we possess the object with the given name? If not, the request may
+	// be for a noncurrent generation, which is deleted permanently.
 	index := b.objects.find(req.Name)
 	if index == len(b.objects) {
+		b.deleteNoncurrent(req.Name, req.Generation)
 		return
 	}
 
 	// Don't do anything if the generation is wrong.
 	if req.Generation != 0 &&
 		b.objects[index].metadata.Generation != req.Generation {
+		b.deleteNoncurrent(req.Name, req.Generation)
 		return
 	}
 
@@ -1002,11 +1210,29 @@ func (b *bucket) DeleteObject(
 	}
 
 	// Remove the object.
+	b.retire(b.objects[index])
 	b.objects = append(b.objects[:index], b.objects[index+1:]...)
 
 	return
 }
 
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) deleteNoncurrent(name string, generation int64) {
+	gens := b.noncurrent[name]
+	for i := range gens {
+		if gens[i].metadata.Generation == generation {
+			gens = append(gens[:i], gens[i+1:]...)
+			break
+		}
+	}
+
+	if len(gens) == 0 {
+		delete(b.noncurrent, name)
+	} else {
+		b.noncurrent[name] = gens
+	}
+}
+
 func (b *bucket) DeleteFolder(ctx context.Context, folderName string) (err error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -0,0 +1,61 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	storagev1 "google.golang.org/api/storage/v1"
+)
+
+func toBucket(b gcs.Bucket) *storagev1.Bucket {
+	out := &storagev1.Bucket{
+		Kind:         "storage#bucket",
+		Id:           b.Name(),
+		Name:         b.Name(),
+		StorageClass: "STANDARD",
+	}
+
+	if b.BucketType() == gcs.Hierarchical {
+		out.HierarchicalNamespace = &storagev1.BucketHierarchicalNamespace{Enabled: true}
+	}
+
+	return out
+}
+
+// The project is ignored; all buckets are listed, in a single page.
+func (s *Server) listBuckets(w http.ResponseWriter, r *http.Request) (err error) {
+	out := &storagev1.Buckets{Kind: "storage#buckets"}
+	for _, b := range s.buckets {
+		out.Items = append(out.Items, toBucket(b))
+	}
+
+	sort.Slice(out.Items, func(i, j int) bool { return out.Items[i].Name < out.Items[j].Name })
+
+	writeJSON(w, out)
+	return
+}
+
+func (s *Server) getBucket(w http.ResponseWriter, r *http.Request, bucketName string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, toBucket(b))
+	return
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	storagev1 "google.golang.org/api/storage/v1"
+)
+
+func toFolder(bucketName string, f *gcs.Folder) *storagev1.Folder {
+	return &storagev1.Folder{
+		Kind:       "storage#folder",
+		Id:         bucketName + "/" + f.Name,
+		Bucket:     bucketName,
+		Name:       f.Name,
+		UpdateTime: formatTime(f.UpdateTime),
+	}
+}
+
+func (s *Server) insertFolder(w http.ResponseWriter, r *http.Request, bucketName string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	var body storagev1.Folder
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return badRequest("decoding folder: %v", err)
+	}
+
+	f, err := b.CreateFolder(r.Context(), body.Name)
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, toFolder(bucketName, f))
+	return
+}
+
+func (s *Server) getFolder(w http.ResponseWriter, r *http.Request, bucketName, name string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	f, err := b.GetFolder(r.Context(), name)
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, toFolder(bucketName, f))
+	return
+}
+
+func (s *Server) deleteFolder(w http.ResponseWriter, r *http.Request, bucketName, name string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	if err = b.DeleteFolder(r.Context(), name); err != nil {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return
+}
+
+// Renames finish before the operation describing them is returned.
+func (s *Server) renameFolder(w http.ResponseWriter, r *http.Request, bucketName, src, dst string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	f, err := b.RenameFolder(r.Context(), src, dst)
+	if err != nil {
+		return
+	}
+
+	response, err := json.Marshal(toFolder(bucketName, f))
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, &storagev1.GoogleLongrunningOperation{
+		Kind:     "storage#operation",
+		Name:     fmt.Sprintf("projects/_/buckets/%s/operations/rename-%s", bucketName, src),
+		Done:     true,
+		Response: response,
+	})
+
+	return
+}
@@ -0,0 +1,562 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	storagev1 "google.golang.org/api/storage/v1"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Conversions
+////////////////////////////////////////////////////////////////////////
+
+// Return the scheme and host under which the request reached the server.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func encodeCRC32C(crc uint32) string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], crc)
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+func toObject(r *http.Request, bucketName string, o *gcs.Object) *storagev1.Object {
+	out := &storagev1.Object{
+		Kind:               "storage#object",
+		Id:                 fmt.Sprintf("%s/%s/%d", bucketName, o.Name, o.Generation),
+		Bucket:             bucketName,
+		Name:               o.Name,
+		ContentType:        o.ContentType,
+		ContentLanguage:    o.ContentLanguage,
+		ContentEncoding:    o.ContentEncoding,
+		ContentDisposition: o.ContentDisposition,
+		CacheControl:       o.CacheControl,
+		CustomTime:         o.CustomTime,
+		EventBasedHold:     o.EventBasedHold,
+		Size:               o.Size,
+		Metadata:           o.Metadata,
+		Generation:         o.Generation,
+		Metageneration:     o.MetaGeneration,
+		StorageClass:       o.StorageClass,
+		ComponentCount:     o.ComponentCount,
+		TimeCreated:        formatTime(o.Created),
+		TimeDeleted:        formatTime(o.Deleted),
+		Updated:            formatTime(o.Updated),
+		Acl:                o.Acl,
+		MediaLink: fmt.Sprintf(
+			"%s/download/storage/v1/b/%s/o/%s?generation=%d&alt=media",
+			baseURL(r),
+			url.PathEscape(bucketName),
+			url.PathEscape(o.Name),
+			o.Generation),
+	}
+
+	if o.Owner != "" {
+		out.Owner = &storagev1.ObjectOwner{Entity: o.Owner}
+	}
+
+	if o.MD5 != nil {
+		out.Md5Hash = base64.StdEncoding.EncodeToString(o.MD5[:])
+	}
+
+	if o.CRC32C != nil {
+		out.Crc32c = encodeCRC32C(*o.CRC32C)
+	}
+
+	return out
+}
+
+////////////////////////////////////////////////////////////////////////
+// Preconditions
+////////////////////////////////////////////////////////////////////////
+
+// Preconditions on the live generation of an object being read.
+type conditions struct {
+	genMatch     *int64
+	metaGenMatch *int64
+}
+
+func queryConditions(q url.Values) (c conditions, err error) {
+	if c.genMatch, err = int64Param(q, "ifGenerationMatch"); err != nil {
+		return
+	}
+
+	c.metaGenMatch, err = int64Param(q, "ifMetagenerationMatch")
+	return
+}
+
+func (c conditions) check(m *gcs.MinObject) error {
+	if c.genMatch != nil && *c.genMatch != m.Generation {
+		return &gcs.PreconditionError{
+			Err: fmt.Errorf("object %q has generation %d, not %d", m.Name, m.Generation, *c.genMatch),
+		}
+	}
+
+	if c.metaGenMatch != nil && *c.metaGenMatch != m.MetaGeneration {
+		return &gcs.PreconditionError{
+			Err: fmt.Errorf("object %q has meta-generation %d, not %d", m.Name, m.MetaGeneration, *c.metaGenMatch),
+		}
+	}
+
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////
+// Reads
+////////////////////////////////////////////////////////////////////////
+
+// Return the object with the given name, failing unless its live generation
+// is the given one (if non-zero) and satisfies the conditions.
+func stat(
+	r *http.Request,
+	b gcs.Bucket,
+	name string,
+	gen int64,
+	conds conditions) (o *gcs.Object, err error) {
+	m, e, err := b.StatObject(r.Context(), &gcs.StatObjectRequest{
+		Name:                           name,
+		ForceFetchFromGcs:              true,
+		ReturnExtendedObjectAttributes: true,
+	})
+
+	if err != nil {
+		return
+	}
+
+	if gen != 0 && gen != m.Generation {
+		err = notFound("object %q has no generation %d", name, gen)
+		return
+	}
+
+	if err = conds.check(m); err != nil {
+		return
+	}
+
+	o = storageutil.ConvertMinObjectAndExtendedObjectAttributesToObject(m, e)
+	return
+}
+
+// Parse the Range header of a read of an object with the given size into the
+// range [start, limit). Partial is false for reads of the whole object.
+func parseRange(header string, size int64) (start, limit int64, partial bool, err error) {
+	limit = size
+	if header == "" || size == 0 {
+		return
+	}
+
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	first, last, hasDash := strings.Cut(spec, "-")
+	if !ok || !hasDash || strings.Contains(spec, ",") {
+		err = badRequest("unsupported range %q", header)
+		return
+	}
+
+	var n int64
+	switch {
+	case first == "":
+		if n, err = strconv.ParseInt(last, 10, 64); err != nil {
+			err = badRequest("invalid range %q", header)
+			return
+		}
+
+		start = max(size-n, 0)
+
+	default:
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+			err = badRequest("invalid range %q", header)
+			return
+		}
+
+		if last != "" {
+			if n, err = strconv.ParseInt(last, 10, 64); err != nil {
+				err = badRequest("invalid range %q", header)
+				return
+			}
+
+			limit = min(n+1, size)
+		}
+	}
+
+	if start >= size || limit <= start {
+		err = &statusError{
+			status: http.StatusRequestedRangeNotSatisfiable,
+			err:    fmt.Errorf("range %q not satisfiable for size %d", header, size),
+		}
+
+		return
+	}
+
+	partial = true
+	return
+}
+
+// Serve the contents of an object with the headers of the XML API, which the
+// JSON API's media downloads carry too. Objects are served as stored, without
+// decompressive transcoding.
+func (s *Server) serveMedia(
+	w http.ResponseWriter,
+	r *http.Request,
+	b gcs.Bucket,
+	name string,
+	gen int64,
+	conds conditions) (err error) {
+	o, err := stat(r, b, name, gen, conds)
+	if err != nil {
+		return
+	}
+
+	size := int64(o.Size)
+	start, limit, partial, err := parseRange(r.Header.Get("Range"), size)
+	if err != nil {
+		return
+	}
+
+	h := w.Header()
+	for header, v := range map[string]string{
+		"Content-Type":                   o.ContentType,
+		"Content-Encoding":               o.ContentEncoding,
+		"Cache-Control":                  o.CacheControl,
+		"X-Goog-Stored-Content-Encoding": o.ContentEncoding,
+	} {
+		if v != "" {
+			h.Set(header, v)
+		}
+	}
+
+	h.Set("Last-Modified", o.Updated.UTC().Format(http.TimeFormat))
+	h.Set("X-Goog-Generation", strconv.FormatInt(o.Generation, 10))
+	h.Set("X-Goog-Metageneration", strconv.FormatInt(o.MetaGeneration, 10))
+	h.Set("X-Goog-Stored-Content-Length", strconv.FormatInt(size, 10))
+
+	var hashes []string
+	if o.CRC32C != nil {
+		hashes = append(hashes, "crc32c="+encodeCRC32C(*o.CRC32C))
+	}
+
+	if o.MD5 != nil {
+		hashes = append(hashes, "md5="+base64.StdEncoding.EncodeToString(o.MD5[:]))
+	}
+
+	if len(hashes) > 0 {
+		h.Set("X-Goog-Hash", strings.Join(hashes, ","))
+	}
+
+	rc, err := b.NewReader(r.Context(), &gcs.ReadObjectRequest{
+		Name:       name,
+		Generation: o.Generation,
+		Range:      &gcs.ByteRange{Start: uint64(start), Limit: uint64(limit)},
+	})
+
+	if err != nil {
+		return
+	}
+
+	defer rc.Close()
+
+	h.Set("Content-Length", strconv.FormatInt(limit-start, 10))
+	if partial {
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, limit-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// The status is out; a failure now can only cut the body short.
+	io.Copy(w, rc)
+	return
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucketName, name string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	q := r.URL.Query()
+	gen, err := generationParam(q, "generation")
+	if err != nil {
+		return
+	}
+
+	conds, err := queryConditions(q)
+	if err != nil {
+		return
+	}
+
+	if q.Get("alt") == "media" {
+		return s.serveMedia(w, r, b, name, gen, conds)
+	}
+
+	o, err := stat(r, b, name, gen, conds)
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, toObject(r, bucketName, o))
+	return
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucketName string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	q := r.URL.Query()
+	maxResults, err := int64Param(q, "maxResults")
+	if err != nil {
+		return
+	}
+
+	req := &gcs.ListObjectsRequest{
+		Prefix:                   q.Get("prefix"),
+		Delimiter:                q.Get("delimiter"),
+		IncludeTrailingDelimiter: q.Get("includeTrailingDelimiter") == "true",
+		IncludeFoldersAsPrefixes: q.Get("includeFoldersAsPrefixes") == "true",
+		ContinuationToken:        q.Get("pageToken"),
+		Versions:                 q.Get("versions") == "true",
+		StartOffset:              q.Get("startOffset"),
+		EndOffset:                q.Get("endOffset"),
+	}
+
+	if maxResults != nil {
+		req.MaxResults = int(*maxResults)
+	}
+
+	listing, err := b.ListObjects(r.Context(), req)
+	if err != nil {
+		return
+	}
+
+	out := &storagev1.Objects{
+		Kind:          "storage#objects",
+		Prefixes:      listing.CollapsedRuns,
+		NextPageToken: listing.ContinuationToken,
+	}
+
+	for _, m := range listing.MinObjects {
+		o := storageutil.ConvertMinObjectToObject(m)
+		o.Created = m.Created
+		o.Deleted = m.Deleted
+		out.Items = append(out.Items, toObject(r, bucketName, o))
+	}
+
+	writeJSON(w, out)
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Modifications
+////////////////////////////////////////////////////////////////////////
+
+// The fields of an object that a patch can change. Null metadata values
+// delete the keys.
+type objectPatch struct {
+	ContentType     *string            `json:"contentType"`
+	ContentEncoding *string            `json:"contentEncoding"`
+	ContentLanguage *string            `json:"contentLanguage"`
+	CacheControl    *string            `json:"cacheControl"`
+	Metadata        map[string]*string `json:"metadata"`
+}
+
+func (s *Server) patchObject(w http.ResponseWriter, r *http.Request, bucketName, name string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	q := r.URL.Query()
+	req := &gcs.UpdateObjectRequest{Name: name}
+	if req.Generation, err = generationParam(q, "generation"); err != nil {
+		return
+	}
+
+	if req.MetaGenerationPrecondition, err = int64Param(q, "ifMetagenerationMatch"); err != nil {
+		return
+	}
+
+	var patch objectPatch
+	if err = json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		return badRequest("decoding patch: %v", err)
+	}
+
+	req.ContentType = patch.ContentType
+	req.ContentEncoding = patch.ContentEncoding
+	req.ContentLanguage = patch.ContentLanguage
+	req.CacheControl = patch.CacheControl
+	req.Metadata = patch.Metadata
+
+	o, err := b.UpdateObject(r.Context(), req)
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, toObject(r, bucketName, o))
+	return
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, bucketName, name string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	q := r.URL.Query()
+	req := &gcs.DeleteObjectRequest{Name: name}
+	if req.Generation, err = generationParam(q, "generation"); err != nil {
+		return
+	}
+
+	if req.MetaGenerationPrecondition, err = int64Param(q, "ifMetagenerationMatch"); err != nil {
+		return
+	}
+
+	if err = b.DeleteObject(r.Context(), req); err != nil {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return
+}
+
+func (s *Server) composeObject(w http.ResponseWriter, r *http.Request, bucketName, name string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	var body storagev1.ComposeRequest
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return badRequest("decoding compose request: %v", err)
+	}
+
+	q := r.URL.Query()
+	req := &gcs.ComposeObjectsRequest{DstName: name}
+	if req.DstGenerationPrecondition, err = int64Param(q, "ifGenerationMatch"); err != nil {
+		return
+	}
+
+	if req.DstMetaGenerationPrecondition, err = int64Param(q, "ifMetagenerationMatch"); err != nil {
+		return
+	}
+
+	for _, src := range body.SourceObjects {
+		req.Sources = append(req.Sources, gcs.ComposeSource{Name: src.Name, Generation: src.Generation})
+	}
+
+	if dst := body.Destination; dst != nil {
+		req.ContentType = dst.ContentType
+		req.Metadata = dst.Metadata
+		req.ContentLanguage = dst.ContentLanguage
+		req.ContentEncoding = dst.ContentEncoding
+		req.CacheControl = dst.CacheControl
+		req.ContentDisposition = dst.ContentDisposition
+		req.CustomTime = dst.CustomTime
+		req.EventBasedHold = dst.EventBasedHold
+		req.StorageClass = dst.StorageClass
+		req.Acl = dst.Acl
+	}
+
+	o, err := b.ComposeObjects(r.Context(), req)
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, toObject(r, bucketName, o))
+	return
+}
+
+// Serve both copyTo and rewriteTo, the latter always finishing in a single
+// call. Only copies within a bucket are supported.
+func (s *Server) copyObject(
+	w http.ResponseWriter,
+	r *http.Request,
+	srcBucketName, srcName, dstBucketName, dstName string,
+	rewrite bool) (err error) {
+	b, err := s.bucket(srcBucketName)
+	if err != nil {
+		return
+	}
+
+	if dstBucketName != srcBucketName {
+		return &statusError{
+			status: http.StatusNotImplemented,
+			err:    fmt.Errorf("copying from %q to %q: copies between buckets are not supported", srcBucketName, dstBucketName),
+		}
+	}
+
+	q := r.URL.Query()
+	req := &gcs.CopyObjectRequest{SrcName: srcName, DstName: dstName}
+	if req.SrcGeneration, err = generationParam(q, "sourceGeneration"); err != nil {
+		return
+	}
+
+	if req.SrcMetaGenerationPrecondition, err = int64Param(q, "ifSourceMetagenerationMatch"); err != nil {
+		return
+	}
+
+	if req.DstGenerationPrecondition, err = int64Param(q, "ifGenerationMatch"); err != nil {
+		return
+	}
+
+	o, err := b.CopyObject(r.Context(), req)
+	if err != nil {
+		return
+	}
+
+	if !rewrite {
+		writeJSON(w, toObject(r, dstBucketName, o))
+		return
+	}
+
+	writeJSON(w, &storagev1.RewriteResponse{
+		Kind:                "storage#rewriteResponse",
+		Done:                true,
+		ObjectSize:          int64(o.Size),
+		TotalBytesRewritten: int64(o.Size),
+		Resource:            toObject(r, dstBucketName, o),
+	})
+
+	return
+}
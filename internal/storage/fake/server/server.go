@@ -0,0 +1,313 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server serves the GCS JSON API on top of gcs.Bucket
+// implementations, typically fake buckets, so that the real storage client
+// can be pointed at them through a custom endpoint.
+//
+// Object metadata, listings, uploads (simple, multipart and resumable),
+// compose, copy and rewrite, patch and delete are served under /storage/v1
+// and /upload/storage/v1, as are HNS folders. Media is served both through
+// the JSON API and through the XML API path /<bucket>/<object>, which the
+// client uses for reads by default. Authentication is not checked.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// Server is an http.Handler serving the GCS API for a fixed set of buckets.
+type Server struct {
+	buckets map[string]gcs.Bucket
+
+	mu sync.Mutex
+
+	// Resumable uploads in progress, by upload ID.
+	//
+	// GUARDED_BY(mu)
+	uploads map[string]*resumableUpload
+
+	// GUARDED_BY(mu)
+	nextUploadID int
+}
+
+// NewServer returns a server for the given buckets, addressed by their names.
+func NewServer(buckets ...gcs.Bucket) *Server {
+	s := &Server{
+		buckets: make(map[string]gcs.Bucket),
+		uploads: make(map[string]*resumableUpload),
+	}
+
+	for _, b := range buckets {
+		s.buckets[b.Name()] = b
+	}
+
+	return s
+}
+
+////////////////////////////////////////////////////////////////////////
+// Errors
+////////////////////////////////////////////////////////////////////////
+
+// An error to be reported with the given HTTP status.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, v ...any) error {
+	return &statusError{status: http.StatusBadRequest, err: fmt.Errorf(format, v...)}
+}
+
+func notFound(format string, v ...any) error {
+	return &gcs.NotFoundError{Err: fmt.Errorf(format, v...)}
+}
+
+// Write the error in the format of the JSON API, which the XML API clients
+// only look at the status of.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	reason := "backendError"
+
+	var statusErr *statusError
+	var notFoundErr *gcs.NotFoundError
+	var preconditionErr *gcs.PreconditionError
+	switch {
+	case errors.As(err, &statusErr):
+		status = statusErr.status
+		reason = "invalid"
+	case errors.As(err, &notFoundErr):
+		status = http.StatusNotFound
+		reason = "notFound"
+	case errors.As(err, &preconditionErr):
+		status = http.StatusPreconditionFailed
+		reason = "conditionNotMet"
+	}
+
+	type errorItem struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	}
+
+	var body struct {
+		Error struct {
+			Code    int         `json:"code"`
+			Message string      `json:"message"`
+			Errors  []errorItem `json:"errors"`
+		} `json:"error"`
+	}
+
+	body.Error.Code = status
+	body.Error.Message = err.Error()
+	body.Error.Errors = []errorItem{{Reason: reason, Message: err.Error()}}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Requests
+////////////////////////////////////////////////////////////////////////
+
+// Return the int64 query parameter with the given name, or nil if absent.
+func int64Param(q url.Values, name string) (v *int64, err error) {
+	s := q.Get(name)
+	if s == "" {
+		return
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		err = badRequest("invalid %s %q", name, s)
+		return
+	}
+
+	v = &n
+	return
+}
+
+// Return the generation named by the query parameter, zero meaning the live
+// one.
+func generationParam(q url.Values, name string) (gen int64, err error) {
+	v, err := int64Param(q, name)
+	if v != nil {
+		gen = *v
+	}
+
+	return
+}
+
+func (s *Server) bucket(name string) (b gcs.Bucket, err error) {
+	b, ok := s.buckets[name]
+	if !ok {
+		err = notFound("bucket %q not found", name)
+	}
+
+	return
+}
+
+// Split the escaped path into its unescaped segments, so that object names
+// holding escaped slashes stay whole.
+func pathSegments(r *http.Request) (segs []string, err error) {
+	for _, seg := range strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/") {
+		var unescaped string
+		if unescaped, err = url.PathUnescape(seg); err != nil {
+			err = badRequest("invalid path %q", r.URL.EscapedPath())
+			return
+		}
+
+		segs = append(segs, unescaped)
+	}
+
+	return
+}
+
+// Do the segments match the pattern, in which "*" matches any segment?
+func match(segs []string, pattern ...string) bool {
+	if len(segs) != len(pattern) {
+		return false
+	}
+
+	for i, p := range pattern {
+		if p != "*" && p != segs[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.serve(w, r); err != nil {
+		writeError(w, err)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) (err error) {
+	segs, err := pathSegments(r)
+	if err != nil {
+		return
+	}
+
+	// Strip the prefixes of the JSON API.
+	upload := false
+	switch {
+	case len(segs) >= 3 && segs[0] == "upload" && segs[1] == "storage" && segs[2] == "v1":
+		upload = true
+		segs = segs[3:]
+	case len(segs) >= 3 && segs[0] == "download" && segs[1] == "storage" && segs[2] == "v1":
+		segs = segs[3:]
+	case len(segs) >= 2 && segs[0] == "storage" && segs[1] == "v1":
+		segs = segs[2:]
+	default:
+		return s.serveXML(w, r, segs)
+	}
+
+	m := r.Method
+	switch {
+	case match(segs, "b") && m == http.MethodGet:
+		return s.listBuckets(w, r)
+	case match(segs, "b", "*") && m == http.MethodGet:
+		return s.getBucket(w, r, segs[1])
+
+	case match(segs, "b", "*", "o") && upload && r.URL.Query().Has("upload_id"):
+		return s.continueUpload(w, r, segs[1])
+	case match(segs, "b", "*", "o") && upload && m == http.MethodPost:
+		return s.insertObject(w, r, segs[1])
+	case match(segs, "b", "*", "o") && m == http.MethodGet:
+		return s.listObjects(w, r, segs[1])
+	case match(segs, "b", "*", "o", "*") && m == http.MethodGet:
+		return s.getObject(w, r, segs[1], segs[3])
+	case match(segs, "b", "*", "o", "*") && m == http.MethodPatch:
+		return s.patchObject(w, r, segs[1], segs[3])
+	case match(segs, "b", "*", "o", "*") && m == http.MethodDelete:
+		return s.deleteObject(w, r, segs[1], segs[3])
+	case match(segs, "b", "*", "o", "*", "compose") && m == http.MethodPost:
+		return s.composeObject(w, r, segs[1], segs[3])
+	case match(segs, "b", "*", "o", "*", "copyTo", "b", "*", "o", "*") && m == http.MethodPost:
+		return s.copyObject(w, r, segs[1], segs[3], segs[6], segs[8], false)
+	case match(segs, "b", "*", "o", "*", "rewriteTo", "b", "*", "o", "*") && m == http.MethodPost:
+		return s.copyObject(w, r, segs[1], segs[3], segs[6], segs[8], true)
+
+	case match(segs, "b", "*", "folders") && m == http.MethodPost:
+		return s.insertFolder(w, r, segs[1])
+	case match(segs, "b", "*", "folders", "*") && m == http.MethodGet:
+		return s.getFolder(w, r, segs[1], segs[3])
+	case match(segs, "b", "*", "folders", "*") && m == http.MethodDelete:
+		return s.deleteFolder(w, r, segs[1], segs[3])
+	case match(segs, "b", "*", "folders", "*", "renameTo", "folders", "*") && m == http.MethodPost:
+		return s.renameFolder(w, r, segs[1], segs[3], segs[6])
+	}
+
+	return &statusError{
+		status: http.StatusNotImplemented,
+		err:    fmt.Errorf("%s %s is not supported", r.Method, r.URL.Path),
+	}
+}
+
+// Serve reads through the XML API, at /<bucket>/<object>.
+func (s *Server) serveXML(w http.ResponseWriter, r *http.Request, segs []string) (err error) {
+	if len(segs) < 2 || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return &statusError{
+			status: http.StatusNotImplemented,
+			err:    fmt.Errorf("%s %s is not supported", r.Method, r.URL.Path),
+		}
+	}
+
+	b, err := s.bucket(segs[0])
+	if err != nil {
+		return
+	}
+
+	gen, err := generationParam(r.URL.Query(), "generation")
+	if err != nil {
+		return
+	}
+
+	conds := conditions{}
+	for header, v := range map[string]**int64{
+		"X-Goog-If-Generation-Match":     &conds.genMatch,
+		"X-Goog-If-Metageneration-Match": &conds.metaGenMatch,
+	} {
+		if h := r.Header.Get(header); h != "" {
+			n, parseErr := strconv.ParseInt(h, 10, 64)
+			if parseErr != nil {
+				return badRequest("invalid %s %q", header, h)
+			}
+
+			*v = &n
+		}
+	}
+
+	return s.serveMedia(w, r, b, strings.Join(segs[1:], "/"), gen, conds)
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake/server"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	storagev1 "google.golang.org/api/storage/v1"
+)
+
+const bucketName = "some_bucket"
+
+func newServerForTest(t *testing.T, bucketType gcs.BucketType) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(server.NewServer(fake.NewFakeBucket(timeutil.RealClock(), bucketName, bucketType)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// Return a bucket going through the real storage client to a fresh server.
+func newBucketForTest(t *testing.T, jsonReads bool) gcs.Bucket {
+	t.Helper()
+	srv := newServerForTest(t, gcs.NonHierarchical)
+	config := storageutil.GetDefaultStorageClientConfig()
+	config.CustomEndpoint = srv.URL + "/storage/v1/"
+	config.ExperimentalEnableJsonRead = jsonReads
+	sh, err := storage.NewStorageHandle(context.Background(), config)
+	require.NoError(t, err)
+	return sh.BucketHandle(context.Background(), bucketName, "")
+}
+
+func TestCreateStatAndRead(t *testing.T) {
+	for _, jsonReads := range []bool{false, true} {
+		ctx := context.Background()
+		b := newBucketForTest(t, jsonReads)
+
+		o, err := b.CreateObject(ctx, &gcs.CreateObjectRequest{
+			Name:        "dir/foo",
+			ContentType: "text/plain",
+			Metadata:    map[string]string{"gcsfuse_mtime": "now"},
+			Contents:    strings.NewReader("taco"),
+		})
+
+		require.NoError(t, err)
+		m, e, err := b.StatObject(ctx, &gcs.StatObjectRequest{Name: "dir/foo", ReturnExtendedObjectAttributes: true})
+		require.NoError(t, err)
+		assert.Equal(t, o.Generation, m.Generation)
+		assert.EqualValues(t, len("taco"), m.Size)
+		assert.Equal(t, map[string]string{"gcsfuse_mtime": "now"}, m.Metadata)
+		assert.Equal(t, "text/plain", e.ContentType)
+		assert.NotNil(t, e.MD5)
+		require.NotNil(t, m.CRC32C)
+		assert.Equal(t, *o.CRC32C, *m.CRC32C)
+		rc, err := b.NewReader(ctx, &gcs.ReadObjectRequest{Name: "dir/foo", Generation: o.Generation, Range: &gcs.ByteRange{Start: 1, Limit: 3}})
+		require.NoError(t, err)
+		contents, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, "ac", string(contents), "jsonReads: %v", jsonReads)
+		contents, err = storageutil.ReadObject(ctx, b, "dir/foo")
+		require.NoError(t, err)
+		assert.Equal(t, "taco", string(contents), "jsonReads: %v", jsonReads)
+		_, err = b.NewReader(ctx, &gcs.ReadObjectRequest{Name: "dir/bar"})
+		assert.IsType(t, &gcs.NotFoundError{}, err)
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t, false)
+	for _, name := range []string{"a", "b/", "b/c", "d/e"} {
+		_, err := storageutil.CreateObject(ctx, b, name, []byte(name))
+		require.NoError(t, err)
+	}
+
+	listing, err := b.ListObjects(ctx, &gcs.ListObjectsRequest{Delimiter: "/", IncludeTrailingDelimiter: true})
+
+	require.NoError(t, err)
+	var names []string
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+	}
+	assert.Equal(t, []string{"a", "b/"}, names)
+	assert.Equal(t, []string{"b/", "d/"}, listing.CollapsedRuns)
+	first, err := b.ListObjects(ctx, &gcs.ListObjectsRequest{MaxResults: 3})
+	require.NoError(t, err)
+	assert.Len(t, first.MinObjects, 3)
+	require.NotEmpty(t, first.ContinuationToken)
+	second, err := b.ListObjects(ctx, &gcs.ListObjectsRequest{MaxResults: 3, ContinuationToken: first.ContinuationToken})
+	require.NoError(t, err)
+	require.Len(t, second.MinObjects, 1)
+	assert.Equal(t, "d/e", second.MinObjects[0].Name)
+}
+
+func TestPreconditions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t, false)
+	o, err := storageutil.CreateObject(ctx, b, "foo", []byte("taco"))
+	require.NoError(t, err)
+	var zero int64
+	wrong := o.MetaGeneration + 1
+
+	_, err = b.CreateObject(ctx, &gcs.CreateObjectRequest{Name: "foo", Contents: strings.NewReader("x"), GenerationPrecondition: &zero})
+	assert.IsType(t, &gcs.PreconditionError{}, err)
+	_, err = b.UpdateObject(ctx, &gcs.UpdateObjectRequest{Name: "foo", MetaGenerationPrecondition: &wrong})
+	assert.IsType(t, &gcs.PreconditionError{}, err)
+	err = b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: "foo", MetaGenerationPrecondition: &wrong})
+	assert.IsType(t, &gcs.PreconditionError{}, err)
+	_, err = b.CreateObject(ctx, &gcs.CreateObjectRequest{Name: "foo", Contents: strings.NewReader("burrito"), GenerationPrecondition: &o.Generation})
+	assert.NoError(t, err)
+}
+
+func TestCopyComposeUpdateAndDelete(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t, false)
+	_, err := b.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:        "foo",
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"a": "1", "b": "2"},
+		Contents:    strings.NewReader("taco"),
+	})
+	require.NoError(t, err)
+
+	c, err := b.CopyObject(ctx, &gcs.CopyObjectRequest{SrcName: "foo", DstName: "bar"})
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", c.ContentType)
+	composed, err := b.ComposeObjects(ctx, &gcs.ComposeObjectsRequest{
+		DstName: "baz",
+		Sources: []gcs.ComposeSource{{Name: "foo"}, {Name: "bar", Generation: c.Generation}},
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, composed.ComponentCount)
+	contents, err := storageutil.ReadObject(ctx, b, "baz")
+	require.NoError(t, err)
+	assert.Equal(t, "tacotaco", string(contents))
+	newType := "text/csv"
+	newValue := "3"
+	u, err := b.UpdateObject(ctx, &gcs.UpdateObjectRequest{
+		Name:        "bar",
+		ContentType: &newType,
+		Metadata:    map[string]*string{"a": &newValue},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv", u.ContentType)
+	assert.Equal(t, map[string]string{"a": "3", "b": "2"}, u.Metadata)
+	require.NoError(t, b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: "bar", Generation: u.Generation}))
+	_, _, err = b.StatObject(ctx, &gcs.StatObjectRequest{Name: "bar"})
+	assert.IsType(t, &gcs.NotFoundError{}, err)
+}
+
+func TestChunkWriterUsesResumableUpload(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t, false)
+	contents := bytes.Repeat([]byte("taco"), 150*1024)
+	var reported int64
+	w, err := b.CreateObjectChunkWriter(ctx, &gcs.CreateObjectRequest{Name: "foo"}, 256*1024, func(n int64) { reported = n })
+	require.NoError(t, err)
+	_, err = w.Write(contents)
+	require.NoError(t, err)
+
+	o, err := b.FinalizeUpload(ctx, w)
+
+	require.NoError(t, err)
+	assert.EqualValues(t, len(contents), o.Size)
+	assert.EqualValues(t, len(contents), reported)
+	read, err := storageutil.ReadObject(ctx, b, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, contents, read)
+}
+
+func TestFolders(t *testing.T) {
+	t.Parallel()
+	srv := newServerForTest(t, gcs.Hierarchical)
+	base := srv.URL + "/storage/v1/b/" + bucketName + "/folders"
+	do := func(method, url, body string, out any) int {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if out != nil && resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+		}
+		return resp.StatusCode
+	}
+
+	var created storagev1.Folder
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, base, `{"name":"a/"}`, &created))
+	assert.Equal(t, "a/", created.Name)
+	var op storagev1.GoogleLongrunningOperation
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, base+"/a%2F/renameTo/folders/b%2F", "", &op))
+	assert.True(t, op.Done)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, base+"/a%2F", "", nil))
+	var got storagev1.Folder
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, base+"/b%2F", "", &got))
+	assert.Equal(t, "b/", got.Name)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, base+"/b%2F", "", nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, base+"/b%2F", "", nil))
+}
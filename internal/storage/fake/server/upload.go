@@ -0,0 +1,318 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	storagev1 "google.golang.org/api/storage/v1"
+)
+
+// A resumable upload in progress. Chunks are buffered until the final one
+// arrives, and only then is the object created.
+type resumableUpload struct {
+	bucketName string
+	req        *gcs.CreateObjectRequest
+	contents   bytes.Buffer
+}
+
+// Build the request creating the object described by the metadata of an
+// upload, with the preconditions in the query.
+func createRequest(q url.Values, attrs *storagev1.Object) (req *gcs.CreateObjectRequest, err error) {
+	req = &gcs.CreateObjectRequest{
+		Name:               attrs.Name,
+		ContentType:        attrs.ContentType,
+		ContentLanguage:    attrs.ContentLanguage,
+		ContentEncoding:    attrs.ContentEncoding,
+		CacheControl:       attrs.CacheControl,
+		Metadata:           attrs.Metadata,
+		ContentDisposition: attrs.ContentDisposition,
+		CustomTime:         attrs.CustomTime,
+		EventBasedHold:     attrs.EventBasedHold,
+		StorageClass:       attrs.StorageClass,
+		Acl:                attrs.Acl,
+	}
+
+	if req.Name == "" {
+		req.Name = q.Get("name")
+	}
+
+	if req.Name == "" {
+		err = badRequest("missing object name")
+		return
+	}
+
+	if attrs.Crc32c != "" {
+		b, decodeErr := base64.StdEncoding.DecodeString(attrs.Crc32c)
+		if decodeErr != nil || len(b) != 4 {
+			err = badRequest("invalid crc32c %q", attrs.Crc32c)
+			return
+		}
+
+		crc := binary.BigEndian.Uint32(b)
+		req.CRC32C = &crc
+	}
+
+	if attrs.Md5Hash != "" {
+		b, decodeErr := base64.StdEncoding.DecodeString(attrs.Md5Hash)
+		if decodeErr != nil || len(b) != md5.Size {
+			err = badRequest("invalid md5Hash %q", attrs.Md5Hash)
+			return
+		}
+
+		req.MD5 = (*[md5.Size]byte)(b)
+	}
+
+	if req.GenerationPrecondition, err = int64Param(q, "ifGenerationMatch"); err != nil {
+		return
+	}
+
+	req.MetaGenerationPrecondition, err = int64Param(q, "ifMetagenerationMatch")
+	return
+}
+
+func decodeAttrs(r io.Reader) (attrs *storagev1.Object, err error) {
+	attrs = new(storagev1.Object)
+	if err = json.NewDecoder(r).Decode(attrs); err != nil && err != io.EOF {
+		err = badRequest("decoding object metadata: %v", err)
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (s *Server) create(
+	w http.ResponseWriter,
+	r *http.Request,
+	b gcs.Bucket,
+	req *gcs.CreateObjectRequest,
+	contents io.Reader) (err error) {
+	req.Contents = contents
+	o, err := b.CreateObject(r.Context(), req)
+	if err != nil {
+		return
+	}
+
+	writeJSON(w, toObject(r, b.Name(), o))
+	return
+}
+
+// Serve the start of an upload, which is the whole of it for uploads of type
+// media and multipart.
+func (s *Server) insertObject(w http.ResponseWriter, r *http.Request, bucketName string) (err error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	q := r.URL.Query()
+	switch q.Get("uploadType") {
+	case "media":
+		var req *gcs.CreateObjectRequest
+		if req, err = createRequest(q, &storagev1.Object{ContentType: r.Header.Get("Content-Type")}); err != nil {
+			return
+		}
+
+		return s.create(w, r, b, req, r.Body)
+
+	case "multipart":
+		return s.insertMultipart(w, r, b)
+
+	case "resumable":
+		return s.startUpload(w, r, b)
+	}
+
+	return badRequest("unsupported uploadType %q", q.Get("uploadType"))
+}
+
+// Serve a multipart upload, whose body holds the metadata then the contents.
+func (s *Server) insertMultipart(w http.ResponseWriter, r *http.Request, b gcs.Bucket) (err error) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return badRequest("multipart upload with content type %q", r.Header.Get("Content-Type"))
+	}
+
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	metadataPart, err := mr.NextPart()
+	if err != nil {
+		return badRequest("reading metadata part: %v", err)
+	}
+
+	attrs, err := decodeAttrs(metadataPart)
+	if err != nil {
+		return
+	}
+
+	mediaPart, err := mr.NextPart()
+	if err != nil {
+		return badRequest("reading media part: %v", err)
+	}
+
+	if attrs.ContentType == "" {
+		attrs.ContentType = mediaPart.Header.Get("Content-Type")
+	}
+
+	req, err := createRequest(r.URL.Query(), attrs)
+	if err != nil {
+		return
+	}
+
+	return s.create(w, r, b, req, mediaPart)
+}
+
+// Register a resumable upload and point the client at the URL to which it is
+// to send the contents.
+func (s *Server) startUpload(w http.ResponseWriter, r *http.Request, b gcs.Bucket) (err error) {
+	attrs, err := decodeAttrs(r.Body)
+	if err != nil {
+		return
+	}
+
+	req, err := createRequest(r.URL.Query(), attrs)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.nextUploadID++
+	id := strconv.Itoa(s.nextUploadID)
+	s.uploads[id] = &resumableUpload{bucketName: b.Name(), req: req}
+	s.mu.Unlock()
+
+	w.Header().Set("Location", fmt.Sprintf(
+		"%s/upload/storage/v1/b/%s/o?uploadType=resumable&upload_id=%s",
+		baseURL(r),
+		url.PathEscape(b.Name()),
+		id))
+
+	return
+}
+
+// Parse the Content-Range header of a chunk of a resumable upload, of the
+// form "bytes <first>-<last>/<total>" where either side may be "*". Start is
+// -1 for chunks without contents, and total is -1 while unknown.
+func parseContentRange(header string) (start, total int64, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	rangeSpec, totalSpec, hasSlash := strings.Cut(spec, "/")
+	if !ok || !hasSlash {
+		err = badRequest("invalid Content-Range %q", header)
+		return
+	}
+
+	start, total = -1, -1
+	if rangeSpec != "*" {
+		first, _, _ := strings.Cut(rangeSpec, "-")
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+			err = badRequest("invalid Content-Range %q", header)
+			return
+		}
+	}
+
+	if totalSpec != "*" {
+		if total, err = strconv.ParseInt(totalSpec, 10, 64); err != nil {
+			err = badRequest("invalid Content-Range %q", header)
+			return
+		}
+	}
+
+	return
+}
+
+// Serve a chunk of a resumable upload, or a query of its progress. Chunks
+// overlapping what was already received, as when the client retries, have
+// the overlap skipped.
+func (s *Server) continueUpload(w http.ResponseWriter, r *http.Request, bucketName string) (err error) {
+	id := r.URL.Query().Get("upload_id")
+
+	s.mu.Lock()
+	u, ok := s.uploads[id]
+	s.mu.Unlock()
+
+	if !ok || u.bucketName != bucketName {
+		return notFound("no upload with ID %q", id)
+	}
+
+	start, total, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		return
+	}
+
+	// Chunks of an upload come one at a time, so the buffer is touched by
+	// nobody else.
+	if start >= 0 {
+		received := int64(u.contents.Len())
+		if start > received {
+			return badRequest("chunk at %d leaves a gap after %d bytes", start, received)
+		}
+
+		if _, err = io.CopyN(io.Discard, r.Body, received-start); err != nil {
+			return badRequest("reading chunk: %v", err)
+		}
+
+		if _, err = u.contents.ReadFrom(r.Body); err != nil {
+			return badRequest("reading chunk: %v", err)
+		}
+	}
+
+	received := int64(u.contents.Len())
+	if total < 0 || received < total {
+		if received > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", received-1))
+		}
+
+		// Chunks short of the end get "Resume Incomplete", which clients can ask
+		// to receive as a header so that it isn't taken for a redirect.
+		if r.Header.Get("X-GUploader-No-308") == "yes" {
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			return
+		}
+
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+
+	if received > total {
+		return badRequest("received %d bytes of an upload of %d", received, total)
+	}
+
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return
+	}
+
+	if err = s.create(w, r, b, u.req, bytes.NewReader(u.contents.Bytes())); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.uploads, id)
+	s.mu.Unlock()
+
+	return
+}
@@ -350,6 +350,7 @@ type bucketTest struct {
 	clock                          timeutil.Clock
 	supportsCancellation           bool
 	buffersEntireContentsForCreate bool
+	limitInterestingNames          bool
 }
 
 var _ bucketTestSetUpInterface = &bucketTest{}
@@ -360,6 +361,32 @@ func (t *bucketTest) setUpBucketTest(deps BucketTestDeps) {
 	t.clock = deps.Clock
 	t.supportsCancellation = deps.SupportsCancellation
 	t.buffersEntireContentsForCreate = deps.BuffersEntireContentsForCreate
+	t.limitInterestingNames = deps.LimitInterestingNames
+}
+
+// Return the interesting names the bucket is to be tested with; see
+// BucketTestDeps.LimitInterestingNames.
+func (t *bucketTest) interestingNames() (names []string) {
+	all := interestingNames()
+	if !t.limitInterestingNames {
+		return all
+	}
+
+	for _, name := range all {
+		inBMP := true
+		for _, r := range name {
+			if r > 0xffff {
+				inBMP = false
+				break
+			}
+		}
+
+		if inBMP {
+			names = append(names, name)
+		}
+	}
+
+	return
 }
 
 func (t *bucketTest) createObject(name string, contents string) error {
@@ -434,12 +461,12 @@ func (t *bucketTest) assertOnObjectAttributes(expectedMinObj *gcs.MinObject, exp
 	ExpectThat(expectedMinObj.Updated, DeepEquals(o.Updated))
 	ExpectThat(expectedMinObj.Metadata, DeepEquals(o.Metadata))
 	ExpectThat(expectedMinObj.ContentEncoding, Equals(o.ContentEncoding))
-	ExpectThat(expectedMinObj.CRC32C, Equals(o.CRC32C))
+	ExpectThat(expectedMinObj.CRC32C, DeepEquals(o.CRC32C))
 	ExpectThat(expectedExtendedAttr.ContentType, Equals(o.ContentType))
 	ExpectThat(expectedExtendedAttr.ContentLanguage, Equals(o.ContentLanguage))
 	ExpectThat(expectedExtendedAttr.CacheControl, Equals(o.CacheControl))
 	ExpectThat(expectedExtendedAttr.Owner, Equals(o.Owner))
-	ExpectThat(expectedExtendedAttr.MD5, Equals(o.MD5))
+	ExpectThat(expectedExtendedAttr.MD5, DeepEquals(o.MD5))
 	ExpectThat(expectedExtendedAttr.MediaLink, Equals(o.MediaLink))
 	ExpectThat(expectedExtendedAttr.StorageClass, Equals(o.StorageClass))
 	ExpectThat(expectedExtendedAttr.Deleted, DeepEquals(o.Deleted))
@@ -664,7 +691,7 @@ func (t *createTest) InterestingNames() {
 	var err error
 
 	// Grab a list of interesting legal names.
-	names := interestingNames()
+	names := t.interestingNames()
 
 	// Make sure we can create each name.
 	err = forEachString(
@@ -709,16 +736,24 @@ func (t *createTest) InterestingNames() {
 
 	AssertEq(nil, err)
 
-	// Grab a listing and extract the names.
-	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{})
-	AssertEq(nil, err)
+	// Grab a listing and extract the names. There are more names than fit in
+	// one page.
+	req := &gcs.ListObjectsRequest{}
+	var listingNames []string
+	for {
+		listing, err := t.bucket.ListObjects(t.ctx, req)
+		AssertEq(nil, err)
 
-	AssertThat(listing.CollapsedRuns, ElementsAre())
-	AssertEq("", listing.ContinuationToken)
+		AssertThat(listing.CollapsedRuns, ElementsAre())
+		for _, o := range listing.MinObjects {
+			listingNames = append(listingNames, o.Name)
+		}
 
-	var listingNames []string
-	for _, o := range listing.MinObjects {
-		listingNames = append(listingNames, o.Name)
+		if listing.ContinuationToken == "" {
+			break
+		}
+
+		req.ContinuationToken = listing.ContinuationToken
 	}
 
 	// The names should have come back sorted by their UTF-8 encodings.
@@ -1474,7 +1509,7 @@ func (t *copyTest) InterestingNames() {
 	// Make sure we can use each interesting name as a copy destination.
 	err = forEachString(
 		t.ctx,
-		interestingNames(),
+		t.interestingNames(),
 		func(ctx context.Context, name string) (err error) {
 			_, err = t.bucket.CopyObject(
 				ctx,
@@ -1664,6 +1699,82 @@ func (t *copyTest) SrcMetaGenerationPrecondition_Satisfied() {
 	ExpectEq(nil, err)
 }
 
+func (t *copyTest) DstGenerationPrecondition_Unsatisfied() {
+	var err error
+
+	// Create a source and a destination object.
+	_, err = t.bucket.CreateObject(
+		t.ctx,
+		&gcs.CreateObjectRequest{
+			Name:     "foo",
+			Contents: strings.NewReader("taco"),
+		})
+
+	AssertEq(nil, err)
+
+	dst, err := t.bucket.CreateObject(
+		t.ctx,
+		&gcs.CreateObjectRequest{
+			Name:     "bar",
+			Contents: strings.NewReader("burrito"),
+		})
+
+	AssertEq(nil, err)
+
+	// Attempt to copy, requiring that the destination doesn't exist.
+	var precond int64
+	req := &gcs.CopyObjectRequest{
+		SrcName:                   "foo",
+		DstName:                   "bar",
+		DstGenerationPrecondition: &precond,
+	}
+
+	_, err = t.bucket.CopyObject(t.ctx, req)
+	AssertThat(err, HasSameTypeAs(&gcs.PreconditionError{}))
+
+	// The destination should not have been overwritten.
+	m, _, err := t.bucket.StatObject(
+		t.ctx,
+		&gcs.StatObjectRequest{Name: "bar"})
+
+	AssertEq(nil, err)
+	ExpectEq(dst.Generation, m.Generation)
+}
+
+func (t *copyTest) DstGenerationPrecondition_Satisfied() {
+	var err error
+
+	// Create a source and a destination object.
+	_, err = t.bucket.CreateObject(
+		t.ctx,
+		&gcs.CreateObjectRequest{
+			Name:     "foo",
+			Contents: strings.NewReader("taco"),
+		})
+
+	AssertEq(nil, err)
+
+	dst, err := t.bucket.CreateObject(
+		t.ctx,
+		&gcs.CreateObjectRequest{
+			Name:     "bar",
+			Contents: strings.NewReader("burrito"),
+		})
+
+	AssertEq(nil, err)
+
+	// Copy, with a precondition on the destination's current generation.
+	req := &gcs.CopyObjectRequest{
+		SrcName:                   "foo",
+		DstName:                   "bar",
+		DstGenerationPrecondition: &dst.Generation,
+	}
+
+	o, err := t.bucket.CopyObject(t.ctx, req)
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), o.Size)
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Compose
 ////////////////////////////////////////////////////////////////////////
@@ -2596,7 +2707,7 @@ func (t *composeTest) InterestingNames() {
 	// Make sure we can use each interesting name as a compose destination.
 	err = forEachString(
 		t.ctx,
-		interestingNames(),
+		t.interestingNames(),
 		func(ctx context.Context, name string) (err error) {
 			_, err = t.bucket.ComposeObjects(
 				ctx,
@@ -4055,6 +4166,53 @@ func (t *listTest) Prefix() {
 	ExpectEq("b타코", listing.MinObjects[3].Name)
 }
 
+func (t *listTest) Offsets() {
+	// Create several objects.
+	AssertEq(
+		nil,
+		createEmpty(
+			t.ctx,
+			t.bucket,
+			[]string{
+				"a",
+				"b",
+				"b\x00",
+				"b/c",
+				"ba",
+				"c",
+			}))
+
+	// List the names in [b, ba), collapsing runs.
+	req := &gcs.ListObjectsRequest{
+		Delimiter:   "/",
+		StartOffset: "b",
+		EndOffset:   "ba",
+	}
+
+	listing, err := t.bucket.ListObjects(t.ctx, req)
+	AssertEq(nil, err)
+	AssertNe(nil, listing)
+	AssertEq("", listing.ContinuationToken)
+	ExpectThat(listing.CollapsedRuns, ElementsAre("b/"))
+
+	AssertEq(2, len(listing.MinObjects))
+	ExpectEq("b", listing.MinObjects[0].Name)
+	ExpectEq("b\x00", listing.MinObjects[1].Name)
+
+	// An end offset just past a name bounds the listing to exactly that name.
+	req = &gcs.ListObjectsRequest{
+		Prefix:      "b",
+		StartOffset: "b",
+		EndOffset:   "b\x00",
+	}
+
+	listing, err = t.bucket.ListObjects(t.ctx, req)
+	AssertEq(nil, err)
+	AssertEq("", listing.ContinuationToken)
+	AssertEq(1, len(listing.MinObjects))
+	ExpectEq("b", listing.MinObjects[0].Name)
+}
+
 func (t *listTest) PrefixAndDelimiter_SingleRune() {
 	// Create several objects.
 	AssertEq(
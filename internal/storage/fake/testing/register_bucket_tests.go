@@ -45,6 +45,12 @@ type BucketTestDeps struct {
 
 	// Does the bucket buffer all contents before creating in GCS?
 	BuffersEntireContentsForCreate bool
+
+	// Is creating an object for each of the interesting names, one for each
+	// code point of some Unicode categories, too costly for the bucket, as for
+	// one backed by a file system? If so, only the names within the Basic
+	// Multilingual Plane are used.
+	LimitInterestingNames bool
 }
 
 // An interface that all bucket tests must implement.
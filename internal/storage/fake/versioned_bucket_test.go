@@ -0,0 +1,157 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newVersionedBucketForTest(t *testing.T) gcs.Bucket {
+	t.Helper()
+	clock := &timeutil.SimulatedClock{}
+	clock.SetTime(time.Date(2012, 8, 15, 22, 56, 0, 0, time.Local))
+	return NewFakeVersionedBucket(clock, "some_bucket", gcs.NonHierarchical)
+}
+
+func createForTest(t *testing.T, b gcs.Bucket, name, contents string) *gcs.Object {
+	t.Helper()
+	o, err := b.CreateObject(context.Background(), &gcs.CreateObjectRequest{
+		Name:     name,
+		Contents: strings.NewReader(contents),
+	})
+	require.NoError(t, err)
+	return o
+}
+
+func readForTest(t *testing.T, b gcs.Bucket, name string, generation int64) (string, error) {
+	t.Helper()
+	rc, err := b.NewReader(context.Background(), &gcs.ReadObjectRequest{
+		Name:       name,
+		Generation: generation,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	contents, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(contents), nil
+}
+
+func TestVersionedBucket_OverwrittenGenerationIsReadable(t *testing.T) {
+	b := newVersionedBucketForTest(t)
+	o1 := createForTest(t, b, "foo", "taco")
+	o2 := createForTest(t, b, "foo", "burrito")
+
+	old, err := readForTest(t, b, "foo", o1.Generation)
+	require.NoError(t, err)
+	live, err := readForTest(t, b, "foo", 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, "taco", old)
+	assert.Equal(t, "burrito", live)
+	assert.Less(t, o1.Generation, o2.Generation)
+}
+
+func TestVersionedBucket_ListVersions(t *testing.T) {
+	b := newVersionedBucketForTest(t)
+	o1 := createForTest(t, b, "dir/foo", "taco")
+	o2 := createForTest(t, b, "dir/foo", "burrito")
+	o3 := createForTest(t, b, "dir/bar", "enchilada")
+	createForTest(t, b, "dir/sub/baz", "queso")
+	require.NoError(t, b.DeleteObject(context.Background(), &gcs.DeleteObjectRequest{Name: "dir/bar"}))
+
+	listing, err := b.ListObjects(context.Background(), &gcs.ListObjectsRequest{
+		Prefix:    "dir/",
+		Delimiter: "/",
+		Versions:  true,
+	})
+
+	require.NoError(t, err)
+	require.Len(t, listing.MinObjects, 3)
+	assert.Equal(t, "dir/bar", listing.MinObjects[0].Name)
+	assert.Equal(t, o3.Generation, listing.MinObjects[0].Generation)
+	assert.Equal(t, o1.Generation, listing.MinObjects[1].Generation)
+	assert.Equal(t, o2.Generation, listing.MinObjects[2].Generation)
+	assert.Equal(t, []string{"dir/sub/"}, listing.CollapsedRuns)
+}
+
+func TestVersionedBucket_ListWithoutVersions(t *testing.T) {
+	b := newVersionedBucketForTest(t)
+	createForTest(t, b, "foo", "taco")
+	o2 := createForTest(t, b, "foo", "burrito")
+
+	listing, err := b.ListObjects(context.Background(), &gcs.ListObjectsRequest{})
+
+	require.NoError(t, err)
+	require.Len(t, listing.MinObjects, 1)
+	assert.Equal(t, o2.Generation, listing.MinObjects[0].Generation)
+}
+
+func TestVersionedBucket_CopyNoncurrentGeneration(t *testing.T) {
+	b := newVersionedBucketForTest(t)
+	o1 := createForTest(t, b, "foo", "taco")
+	require.NoError(t, b.DeleteObject(context.Background(), &gcs.DeleteObjectRequest{Name: "foo"}))
+
+	_, err := b.CopyObject(context.Background(), &gcs.CopyObjectRequest{
+		SrcName:       "foo",
+		SrcGeneration: o1.Generation,
+		DstName:       "foo",
+	})
+
+	require.NoError(t, err)
+	live, err := readForTest(t, b, "foo", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "taco", live)
+}
+
+func TestVersionedBucket_DeleteNoncurrentGeneration(t *testing.T) {
+	b := newVersionedBucketForTest(t)
+	o1 := createForTest(t, b, "foo", "taco")
+	createForTest(t, b, "foo", "burrito")
+
+	err := b.DeleteObject(context.Background(), &gcs.DeleteObjectRequest{
+		Name:       "foo",
+		Generation: o1.Generation,
+	})
+
+	require.NoError(t, err)
+	_, err = readForTest(t, b, "foo", o1.Generation)
+	assert.IsType(t, &gcs.NotFoundError{}, err)
+	live, err := readForTest(t, b, "foo", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "burrito", live)
+}
+
+func TestUnversionedBucket_DropsOverwrittenGeneration(t *testing.T) {
+	clock := &timeutil.SimulatedClock{}
+	b := NewFakeBucket(clock, "some_bucket", gcs.NonHierarchical)
+	o1 := createForTest(t, b, "foo", "taco")
+	createForTest(t, b, "foo", "burrito")
+
+	_, err := readForTest(t, b, "foo", o1.Generation)
+
+	assert.IsType(t, &gcs.NotFoundError{}, err)
+}
@@ -0,0 +1,347 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+// NewFaultInjectingBucket wraps the supplied bucket in a layer that injects
+// faults into the calls that the rules match. The rules are tried in order,
+// and every one that matches and fires is applied: latencies add up, and the
+// first error ends the call.
+func NewFaultInjectingBucket(wrapped gcs.Bucket, rules []Rule) (b gcs.Bucket) {
+	b = &faultInjectingBucket{
+		wrapped: wrapped,
+		rules:   rules,
+	}
+
+	return
+}
+
+type faultInjectingBucket struct {
+	wrapped gcs.Bucket
+	rules   []Rule
+}
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+// Wait for the duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Return the error injected for a fault of the given kind, or nil if it
+// doesn't fail calls.
+func injectedError(kind Kind) error {
+	switch kind {
+	case TooManyRequests:
+		return &googleapi.Error{Code: http.StatusTooManyRequests, Message: "injected fault"}
+	case Unavailable:
+		return &googleapi.Error{Code: http.StatusServiceUnavailable, Message: "injected fault"}
+	case Precondition:
+		return &gcs.PreconditionError{Err: errors.New("injected fault")}
+	}
+
+	return nil
+}
+
+// Apply the rules that fire for a call of the method on the named object
+// before it is made, returning the error to fail it with, if any, and the
+// rules that fired which apply to reading its contents.
+func (b *faultInjectingBucket) inject(ctx context.Context, method string, name string) (readRules []*Rule, err error) {
+	for i := range b.rules {
+		r := &b.rules[i]
+		if !r.Matches(method, name) || rand.Float64() >= r.Probability {
+			continue
+		}
+
+		switch r.Kind {
+		case Latency:
+			if err = sleep(ctx, r.Duration); err != nil {
+				return
+			}
+
+		case Stall, Truncate:
+			readRules = append(readRules, r)
+
+		default:
+			err = fmt.Errorf("%s(%q): %w", method, name, injectedError(r.Kind))
+			return
+		}
+	}
+
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Reader
+////////////////////////////////////////////////////////////////////////
+
+// A reader that stalls after its first read, or ends early, or both.
+type faultyReader struct {
+	ctx     context.Context
+	wrapped io.ReadCloser
+
+	// How long to stall for before the second read, if at all.
+	stall time.Duration
+
+	// If truncated, how many more bytes to return before failing, or -1 to
+	// fail every read after the first.
+	truncated bool
+	remaining int64
+
+	reads int
+}
+
+func (fr *faultyReader) Read(p []byte) (n int, err error) {
+	if fr.reads == 1 && fr.stall > 0 {
+		if err = sleep(fr.ctx, fr.stall); err != nil {
+			return
+		}
+	}
+
+	fr.reads++
+	if !fr.truncated {
+		return fr.wrapped.Read(p)
+	}
+
+	if fr.remaining < 0 {
+		if fr.reads > 1 {
+			err = io.ErrUnexpectedEOF
+			return
+		}
+
+		return fr.wrapped.Read(p)
+	}
+
+	if fr.remaining == 0 {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+
+	if int64(len(p)) > fr.remaining {
+		p = p[:fr.remaining]
+	}
+
+	n, err = fr.wrapped.Read(p)
+	fr.remaining -= int64(n)
+	return
+}
+
+func (fr *faultyReader) Close() error {
+	return fr.wrapped.Close()
+}
+
+////////////////////////////////////////////////////////////////////////
+// Bucket interface
+////////////////////////////////////////////////////////////////////////
+
+func (b *faultInjectingBucket) Name() string {
+	return b.wrapped.Name()
+}
+
+func (b *faultInjectingBucket) BucketType() gcs.BucketType {
+	return b.wrapped.BucketType()
+}
+
+func (b *faultInjectingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	readRules, err := b.inject(ctx, "NewReader", req.Name)
+	if err != nil {
+		return
+	}
+
+	rc, err = b.wrapped.NewReader(ctx, req)
+	if err != nil || len(readRules) == 0 {
+		return
+	}
+
+	fr := &faultyReader{ctx: ctx, wrapped: rc}
+	for _, r := range readRules {
+		switch r.Kind {
+		case Stall:
+			fr.stall += r.Duration
+
+		case Truncate:
+			limit := r.Bytes
+			if limit < 0 && req.Range != nil && req.Range.Limit > req.Range.Start && req.Range.Limit-req.Range.Start < 1<<62 {
+				limit = int64(req.Range.Limit-req.Range.Start) / 2
+			}
+
+			// Keep the earliest truncation, where failing after the first read
+			// counts as the latest.
+			if !fr.truncated || fr.remaining < 0 || (limit >= 0 && limit < fr.remaining) {
+				fr.remaining = limit
+			}
+
+			fr.truncated = true
+		}
+	}
+
+	rc = fr
+	return
+}
+
+func (b *faultInjectingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
+	if _, err = b.inject(ctx, "CreateObject", req.Name); err != nil {
+		return
+	}
+
+	o, err = b.wrapped.CreateObject(ctx, req)
+	return
+}
+
+func (b *faultInjectingBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (wc gcs.Writer, err error) {
+	if _, err = b.inject(ctx, "CreateObjectChunkWriter", req.Name); err != nil {
+		return
+	}
+
+	wc, err = b.wrapped.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+	return
+}
+
+func (b *faultInjectingBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (o *gcs.MinObject, err error) {
+	if _, err = b.inject(ctx, "FinalizeUpload", w.ObjectName()); err != nil {
+		return
+	}
+
+	o, err = b.wrapped.FinalizeUpload(ctx, w)
+	return
+}
+
+func (b *faultInjectingBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (o *gcs.Object, err error) {
+	if _, err = b.inject(ctx, "CopyObject", req.SrcName); err != nil {
+		return
+	}
+
+	o, err = b.wrapped.CopyObject(ctx, req)
+	return
+}
+
+func (b *faultInjectingBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
+	if _, err = b.inject(ctx, "ComposeObjects", req.DstName); err != nil {
+		return
+	}
+
+	o, err = b.wrapped.ComposeObjects(ctx, req)
+	return
+}
+
+func (b *faultInjectingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	if _, err = b.inject(ctx, "StatObject", req.Name); err != nil {
+		return
+	}
+
+	m, e, err = b.wrapped.StatObject(ctx, req)
+	return
+}
+
+func (b *faultInjectingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	if _, err = b.inject(ctx, "ListObjects", req.Prefix); err != nil {
+		return
+	}
+
+	listing, err = b.wrapped.ListObjects(ctx, req)
+	return
+}
+
+func (b *faultInjectingBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (o *gcs.Object, err error) {
+	if _, err = b.inject(ctx, "UpdateObject", req.Name); err != nil {
+		return
+	}
+
+	o, err = b.wrapped.UpdateObject(ctx, req)
+	return
+}
+
+func (b *faultInjectingBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) (err error) {
+	if _, err = b.inject(ctx, "DeleteObject", req.Name); err != nil {
+		return
+	}
+
+	err = b.wrapped.DeleteObject(ctx, req)
+	return
+}
+
+func (b *faultInjectingBucket) DeleteFolder(ctx context.Context, folderName string) (err error) {
+	if _, err = b.inject(ctx, "DeleteFolder", folderName); err != nil {
+		return
+	}
+
+	err = b.wrapped.DeleteFolder(ctx, folderName)
+	return
+}
+
+func (b *faultInjectingBucket) GetFolder(ctx context.Context, folderName string) (folder *gcs.Folder, err error) {
+	if _, err = b.inject(ctx, "GetFolder", folderName); err != nil {
+		return
+	}
+
+	folder, err = b.wrapped.GetFolder(ctx, folderName)
+	return
+}
+
+func (b *faultInjectingBucket) CreateFolder(ctx context.Context, folderName string) (folder *gcs.Folder, err error) {
+	if _, err = b.inject(ctx, "CreateFolder", folderName); err != nil {
+		return
+	}
+
+	folder, err = b.wrapped.CreateFolder(ctx, folderName)
+	return
+}
+
+func (b *faultInjectingBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (folder *gcs.Folder, err error) {
+	if _, err = b.inject(ctx, "RenameFolder", folderName); err != nil {
+		return
+	}
+
+	folder, err = b.wrapped.RenameFolder(ctx, folderName, destinationFolderId)
+	return
+}
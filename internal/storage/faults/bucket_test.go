@@ -0,0 +1,151 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/faults"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+// Return a bucket holding "foo" with ten bytes of contents, with faults
+// injected according to the rules.
+func newBucket(t *testing.T, specs ...string) gcs.Bucket {
+	t.Helper()
+	wrapped := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	_, err := wrapped.CreateObject(context.Background(), &gcs.CreateObjectRequest{Name: "foo", Contents: strings.NewReader("0123456789")})
+	require.NoError(t, err)
+	rules, err := faults.ParseRules(specs)
+	require.NoError(t, err)
+
+	return faults.NewFaultInjectingBucket(wrapped, rules)
+}
+
+func read(b gcs.Bucket, r *gcs.ByteRange) ([]byte, error) {
+	rc, err := b.NewReader(context.Background(), &gcs.ReadObjectRequest{Name: "foo", Range: r})
+	if err != nil {
+		return nil, err
+	}
+
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func TestInjectsHTTPErrors(t *testing.T) {
+	b := newBucket(t, "StatObject:f*:429", "NewReader:*:503")
+
+	_, _, err := b.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+	var apiErr *googleapi.Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.Code)
+	_, err = read(b, nil)
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.Code)
+}
+
+func TestInjectsPreconditionErrors(t *testing.T) {
+	b := newBucket(t, "DeleteObject:*:precondition")
+
+	err := b.DeleteObject(context.Background(), &gcs.DeleteObjectRequest{Name: "foo"})
+
+	var preconditionErr *gcs.PreconditionError
+	assert.True(t, errors.As(err, &preconditionErr))
+}
+
+func TestLeavesUnmatchedCallsAlone(t *testing.T) {
+	b := newBucket(t, "StatObject:bar:503", "DeleteObject:*:503")
+
+	m, _, err := b.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, m.Size)
+}
+
+func TestFiresWithProbability(t *testing.T) {
+	b := newBucket(t, "StatObject:*:503@0", "StatObject:*:precondition@1")
+
+	_, _, err := b.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+
+	var preconditionErr *gcs.PreconditionError
+	assert.True(t, errors.As(err, &preconditionErr))
+}
+
+func TestInjectsLatency(t *testing.T) {
+	b := newBucket(t, "StatObject:*:latency=50ms")
+
+	start := time.Now()
+	_, _, err := b.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestLatencyHonoursCancellation(t *testing.T) {
+	b := newBucket(t, "StatObject:*:latency=1h")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, _, err := b.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTruncatesReads(t *testing.T) {
+	b := newBucket(t, "NewReader:*:truncate=3")
+
+	contents, err := read(b, nil)
+
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "012", string(contents))
+}
+
+func TestTruncatesRangesByHalfByDefault(t *testing.T) {
+	b := newBucket(t, "NewReader:*:truncate")
+
+	contents, err := read(b, &gcs.ByteRange{Start: 2, Limit: 10})
+
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "2345", string(contents))
+}
+
+func TestStallsAfterFirstRead(t *testing.T) {
+	b := newBucket(t, "NewReader:*:stall=50ms")
+	rc, err := b.NewReader(context.Background(), &gcs.ReadObjectRequest{Name: "foo"})
+	require.NoError(t, err)
+	defer rc.Close()
+
+	start := time.Now()
+	buf := make([]byte, 4)
+	_, err = rc.Read(buf)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	rest, err := io.ReadAll(rc)
+
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, "456789", string(rest))
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package faults injects failures into calls made to a bucket, for testing
+// how the layers above it cope with a misbehaving GCS.
+//
+// Faults are described by rules of the form
+//
+//	<methods>:<glob>:<fault>[@<probability>]
+//
+// where methods is * or method names of gcs.Bucket separated by |, glob is
+// matched against the object name of the call, with * matching any run of
+// characters (slashes included) and ? any one character, and probability is
+// the chance, from 0 to 1, that a matching call is affected, 1 if absent.
+// The faults are:
+//
+//	latency=<duration>  delays the call
+//	stall=<duration>    stalls reads of NewReader after the first
+//	429, 503            fails the call with that HTTP status
+//	precondition        fails the call with a *gcs.PreconditionError
+//	truncate[=<bytes>]  ends reads of NewReader early with
+//	                    io.ErrUnexpectedEOF, by default after half the range
+//	                    read, or after the first read of unbounded ranges
+//
+// For example, "NewReader|StatObject:logs/*:503@0.1" fails a tenth of the
+// reads and stats of objects under logs/.
+package faults
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is a kind of fault.
+type Kind string
+
+const (
+	Latency         Kind = "latency"
+	Stall           Kind = "stall"
+	TooManyRequests Kind = "429"
+	Unavailable     Kind = "503"
+	Precondition    Kind = "precondition"
+	Truncate        Kind = "truncate"
+)
+
+// The methods whose calls can be affected by rules.
+var methods = map[string]bool{
+	"NewReader":               true,
+	"CreateObject":            true,
+	"CreateObjectChunkWriter": true,
+	"FinalizeUpload":          true,
+	"CopyObject":              true,
+	"ComposeObjects":          true,
+	"StatObject":              true,
+	"ListObjects":             true,
+	"UpdateObject":            true,
+	"DeleteObject":            true,
+	"DeleteFolder":            true,
+	"GetFolder":               true,
+	"CreateFolder":            true,
+	"RenameFolder":            true,
+}
+
+// Rule describes a fault and the calls it affects.
+type Rule struct {
+	// The methods affected, or nil for all of them.
+	Methods map[string]bool
+
+	// The pattern that the object names of affected calls match.
+	Glob string
+
+	Kind Kind
+
+	// How long to delay or stall for Latency and Stall.
+	Duration time.Duration
+
+	// How many bytes to return before failing for Truncate, or -1 for the
+	// default described in the package doc.
+	Bytes int64
+
+	// The chance that a matching call is affected, from 0 to 1.
+	Probability float64
+}
+
+// Matches returns whether calls of the method on the named object are
+// affected by the rule, leaving aside its probability.
+func (r *Rule) Matches(method string, name string) bool {
+	if r.Methods != nil && !r.Methods[method] {
+		return false
+	}
+
+	// Stalls and truncation only make sense for reads.
+	if (r.Kind == Stall || r.Kind == Truncate) && method != "NewReader" {
+		return false
+	}
+
+	return matchGlob(r.Glob, name)
+}
+
+// Report whether name matches the pattern, where * matches any run of
+// characters and ? any one character.
+func matchGlob(pattern string, name string) bool {
+	// Backtrack to just after the most recent star on a mismatch.
+	p, n := 0, 0
+	star, starN := -1, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, starN = p, n
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == name[n]):
+			p++
+			n++
+		case star >= 0:
+			starN++
+			p, n = star+1, starN
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// ParseRule parses a rule of the form described in the package doc.
+func ParseRule(s string) (r Rule, err error) {
+	spec := s
+	r.Probability = 1
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		if r.Probability, err = strconv.ParseFloat(spec[i+1:], 64); err != nil || r.Probability < 0 || r.Probability > 1 {
+			err = fmt.Errorf("fault rule %q: probability should be between 0 and 1", s)
+			return
+		}
+
+		spec = spec[:i]
+	}
+
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 {
+		err = fmt.Errorf("fault rule %q should be of the form <methods>:<glob>:<fault>[@<probability>]", s)
+		return
+	}
+
+	if parts[0] != "*" {
+		r.Methods = make(map[string]bool)
+		for _, m := range strings.Split(parts[0], "|") {
+			if !methods[m] {
+				err = fmt.Errorf("fault rule %q: unknown method %q", s, m)
+				return
+			}
+
+			r.Methods[m] = true
+		}
+	}
+
+	r.Glob = parts[1]
+
+	kind, arg, hasArg := strings.Cut(parts[2], "=")
+	r.Kind = Kind(kind)
+	switch r.Kind {
+	case Latency, Stall:
+		if r.Duration, err = time.ParseDuration(arg); err != nil || r.Duration <= 0 {
+			err = fmt.Errorf("fault rule %q: %s needs a positive duration", s, kind)
+			return
+		}
+
+	case Truncate:
+		r.Bytes = -1
+		if hasArg {
+			if r.Bytes, err = strconv.ParseInt(arg, 10, 64); err != nil || r.Bytes < 0 {
+				err = fmt.Errorf("fault rule %q: truncate needs a byte count", s)
+				return
+			}
+		}
+
+	case TooManyRequests, Unavailable, Precondition:
+		if hasArg {
+			err = fmt.Errorf("fault rule %q: %s takes no argument", s, kind)
+			return
+		}
+
+	default:
+		err = fmt.Errorf("fault rule %q: unknown fault %q; supported faults: latency, stall, 429, 503, precondition, truncate", s, kind)
+		return
+	}
+
+	if r.Kind == Stall || r.Kind == Truncate {
+		for m := range r.Methods {
+			if m != "NewReader" {
+				err = fmt.Errorf("fault rule %q: %s only applies to NewReader", s, kind)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// ParseRules parses each of the rules.
+func ParseRules(specs []string) (rules []Rule, err error) {
+	for _, s := range specs {
+		var r Rule
+		if r, err = ParseRule(s); err != nil {
+			return
+		}
+
+		rules = append(rules, r)
+	}
+
+	return
+}
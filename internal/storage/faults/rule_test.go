@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faults
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("NewReader|StatObject:logs/*:latency=250ms@0.25")
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"NewReader": true, "StatObject": true}, r.Methods)
+	assert.Equal(t, "logs/*", r.Glob)
+	assert.Equal(t, Latency, r.Kind)
+	assert.Equal(t, 250*time.Millisecond, r.Duration)
+	assert.Equal(t, 0.25, r.Probability)
+}
+
+func TestParseRuleDefaults(t *testing.T) {
+	r, err := ParseRule("*:*:truncate")
+
+	require.NoError(t, err)
+	assert.Nil(t, r.Methods)
+	assert.EqualValues(t, -1, r.Bytes)
+	assert.Equal(t, 1.0, r.Probability)
+}
+
+func TestParseRuleRejectsInvalidRules(t *testing.T) {
+	for _, s := range []string{
+		"NewReader:*",
+		"ReadObject:*:503",
+		"*:*:504",
+		"*:*:latency",
+		"*:*:latency=-1s",
+		"*:*:503=1",
+		"*:*:truncate=half",
+		"StatObject:*:stall=1s",
+		"*:*:503@1.5",
+		"*:*:503@often",
+	} {
+		_, err := ParseRule(s)
+
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	r, err := ParseRule("NewReader|StatObject:logs/*.txt:503")
+	require.NoError(t, err)
+
+	assert.True(t, r.Matches("StatObject", "logs/a.txt"))
+	assert.True(t, r.Matches("NewReader", "logs/2024/b.txt"))
+	assert.False(t, r.Matches("NewReader", "logs/a.bin"))
+	assert.False(t, r.Matches("DeleteObject", "logs/a.txt"))
+}
+
+func TestReadFaultsOnlyMatchNewReader(t *testing.T) {
+	r, err := ParseRule("*:*:stall=1s")
+	require.NoError(t, err)
+
+	assert.True(t, r.Matches("NewReader", "foo"))
+	assert.False(t, r.Matches("StatObject", "foo"))
+}
+
+func TestMatchGlob(t *testing.T) {
+	assert.True(t, matchGlob("*", ""))
+	assert.True(t, matchGlob("*", "a/b/c"))
+	assert.True(t, matchGlob("a?c", "abc"))
+	assert.True(t, matchGlob("*/c*", "a/b/cd"))
+	assert.True(t, matchGlob("a*b*c", "aXbYbZc"))
+	assert.False(t, matchGlob("a?c", "ac"))
+	assert.False(t, matchGlob("a*b", "a/c"))
+	assert.False(t, matchGlob("", "a"))
+}
@@ -44,6 +44,7 @@ type Object struct {
 	Generation      int64
 	MetaGeneration  int64
 	StorageClass    string
+	Created         time.Time
 	Deleted         time.Time
 	Updated         time.Time
 
@@ -89,6 +90,12 @@ type MinObject struct {
 	Metadata        map[string]string
 	ContentEncoding string
 	CRC32C          *uint32 // Missing for CMEK buckets
+
+	// Creation and deletion times of this generation. These are filled in by
+	// stats and by listings that request them (see
+	// ListObjectsRequest.Versions); Deleted is zero for the live generation.
+	Created time.Time
+	Deleted time.Time
 }
 
 // ExtendedObjectAttributes contains the missing attributes of Object which are not present in MinObject.
@@ -283,6 +283,12 @@ type ListObjectsRequest struct {
 	// is used.
 	MaxResults int
 
+	// If non-empty, list only objects whose names are lexicographically at or
+	// after StartOffset, and before EndOffset, respectively. Collapsed runs are
+	// formed from the objects that remain.
+	StartOffset string
+	EndOffset   string
+
 	// Set of properties to return. Acceptable values- full & noAcl.
 	//    1. full  - returns all properties
 	//    2. noAcl - omit owner, acl properties
@@ -291,6 +297,11 @@ type ListObjectsRequest struct {
 	// the current flow, default value will be full and callers can override it
 	// using this param.
 	ProjectionVal Projection
+
+	// Include noncurrent generations of objects in buckets with object
+	// versioning enabled. The listing then holds every generation of each
+	// name, in increasing order of generation.
+	Versions bool
 }
 
 // Listing contains a set of objects and delimter-based collapsed runs returned
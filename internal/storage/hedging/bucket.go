@@ -0,0 +1,316 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hedging cuts the tail latency of small requests by issuing a
+// duplicate when the original is slower than most, and taking whichever
+// returns first.
+package hedging
+
+import (
+	"io"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultMinDelay is the least time to wait for a request before hedging
+	// it, however fast recent requests have been.
+	DefaultMinDelay = 5 * time.Millisecond
+
+	// DefaultMaxReadSize is the largest range read that is hedged.
+	DefaultMaxReadSize = 1 << 20
+)
+
+// Config controls which requests are hedged, and when.
+type Config struct {
+	// The percentile, from 0 to 100, of the recent latencies of a method after
+	// which a request is hedged. Requests aren't hedged until enough
+	// latencies are known.
+	Percentile float64
+
+	// The number of hedges allowed, as a percentage of the requests that
+	// could be hedged.
+	BudgetPercent float64
+
+	// The least time to wait before hedging.
+	MinDelay time.Duration
+
+	// NewReader is hedged only for ranges of at most this many bytes.
+	MaxReadSize uint64
+}
+
+// NewHedgingBucket wraps the supplied bucket in a layer that hedges
+// StatObject and small range reads: if the request hasn't returned within
+// the configured percentile of recent latencies, and the budget allows, a
+// duplicate is issued and the first to succeed is returned, cancelling the
+// other. Hedges fired and won are counted by the metric handle.
+func NewHedgingBucket(wrapped gcs.Bucket, cfg Config, metricHandle common.MetricHandle) (b gcs.Bucket) {
+	b = &hedgingBucket{
+		wrapped:      wrapped,
+		cfg:          cfg,
+		metricHandle: metricHandle,
+		budget:       newBudget(cfg.BudgetPercent / 100),
+		stat:         newLatencies(),
+		read:         newLatencies(),
+	}
+
+	return
+}
+
+type hedgingBucket struct {
+	wrapped      gcs.Bucket
+	cfg          Config
+	metricHandle common.MetricHandle
+	budget       *budget
+
+	// Recent latencies of StatObject, and of NewReader returning a reader.
+	stat *latencies
+	read *latencies
+}
+
+// The outcome of one of the attempts at a hedged request.
+type attempt[T any] struct {
+	i     int
+	v     T
+	err   error
+	start time.Time
+}
+
+// Make the call, and again if it hasn't returned within the hedging delay of
+// its method and the budget allows, returning the result of the first to
+// succeed, or the error of the last to fail. The context of the call that
+// produced the result is cancelled by the returned function, which must be
+// called once the result is no longer needed; the other call is cancelled
+// straight away, and its result passed to discard if it succeeds anyway.
+func hedged[T any](
+	ctx context.Context,
+	b *hedgingBucket,
+	method string,
+	l *latencies,
+	call func(context.Context) (T, error),
+	discard func(T)) (v T, cancel context.CancelFunc, err error) {
+	results := make(chan attempt[T], 2)
+	var cancels []context.CancelFunc
+	launch := func() {
+		callCtx, cancel := context.WithCancel(ctx)
+		a := attempt[T]{i: len(cancels), start: time.Now()}
+		cancels = append(cancels, cancel)
+		go func() {
+			a.v, a.err = call(callCtx)
+			results <- a
+		}()
+	}
+
+	b.budget.earn()
+	launch()
+	outstanding := 1
+
+	var timer <-chan time.Time
+	if delay, ok := l.delay(b.cfg.Percentile); ok {
+		t := time.NewTimer(max(delay, b.cfg.MinDelay))
+		defer t.Stop()
+		timer = t.C
+	}
+
+	for {
+		select {
+		case <-timer:
+			timer = nil
+			if b.budget.spend() {
+				b.metricHandle.GCSHedgeCount(ctx, 1, []common.MetricAttr{{Key: common.GCSMethod, Value: method}})
+				launch()
+				outstanding++
+			}
+
+		case a := <-results:
+			outstanding--
+			if a.err != nil {
+				cancels[a.i]()
+				if outstanding == 0 {
+					err = a.err
+					return
+				}
+
+				// Wait for the other attempt, but don't hedge an attempt that
+				// has already failed.
+				timer = nil
+				continue
+			}
+
+			l.record(time.Since(a.start))
+			if a.i > 0 {
+				b.metricHandle.GCSHedgeWinCount(ctx, 1, []common.MetricAttr{{Key: common.GCSMethod, Value: method}})
+			}
+
+			// Cancel the loser, and clean up after it should it succeed anyway.
+			for i, c := range cancels {
+				if i != a.i {
+					c()
+				}
+			}
+
+			if outstanding > 0 {
+				go func() {
+					if loser := <-results; loser.err == nil {
+						discard(loser.v)
+					}
+				}()
+			}
+
+			v, cancel = a.v, cancels[a.i]
+			return
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Reader
+////////////////////////////////////////////////////////////////////////
+
+// Cancels the context of a hedged read once the reader is closed.
+type hedgedReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *hedgedReader) Close() (err error) {
+	err = r.ReadCloser.Close()
+	r.cancel()
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Bucket interface
+////////////////////////////////////////////////////////////////////////
+
+// Report whether the read is of a range small enough to hedge.
+func (b *hedgingBucket) smallRead(req *gcs.ReadObjectRequest) bool {
+	r := req.Range
+	return r != nil && r.Limit >= r.Start && r.Limit-r.Start <= b.cfg.MaxReadSize
+}
+
+func (b *hedgingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	if !b.smallRead(req) {
+		rc, err = b.wrapped.NewReader(ctx, req)
+		return
+	}
+
+	rc, cancel, err := hedged(
+		ctx, b, "NewReader", b.read,
+		func(ctx context.Context) (io.ReadCloser, error) { return b.wrapped.NewReader(ctx, req) },
+		func(rc io.ReadCloser) { rc.Close() })
+	if err != nil {
+		return
+	}
+
+	rc = &hedgedReader{ReadCloser: rc, cancel: cancel}
+	return
+}
+
+type statResult struct {
+	m *gcs.MinObject
+	e *gcs.ExtendedObjectAttributes
+}
+
+func (b *hedgingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	res, cancel, err := hedged(
+		ctx, b, "StatObject", b.stat,
+		func(ctx context.Context) (res statResult, err error) {
+			res.m, res.e, err = b.wrapped.StatObject(ctx, req)
+			return
+		},
+		func(statResult) {})
+	if err != nil {
+		return
+	}
+
+	cancel()
+	m, e = res.m, res.e
+	return
+}
+
+func (b *hedgingBucket) Name() string {
+	return b.wrapped.Name()
+}
+
+func (b *hedgingBucket) BucketType() gcs.BucketType {
+	return b.wrapped.BucketType()
+}
+
+func (b *hedgingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	return b.wrapped.CreateObject(ctx, req)
+}
+
+func (b *hedgingBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	return b.wrapped.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+}
+
+func (b *hedgingBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (*gcs.MinObject, error) {
+	return b.wrapped.FinalizeUpload(ctx, w)
+}
+
+func (b *hedgingBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	return b.wrapped.CopyObject(ctx, req)
+}
+
+func (b *hedgingBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	return b.wrapped.ComposeObjects(ctx, req)
+}
+
+func (b *hedgingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	return b.wrapped.ListObjects(ctx, req)
+}
+
+func (b *hedgingBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	return b.wrapped.UpdateObject(ctx, req)
+}
+
+func (b *hedgingBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) error {
+	return b.wrapped.DeleteObject(ctx, req)
+}
+
+func (b *hedgingBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	return b.wrapped.DeleteFolder(ctx, folderName)
+}
+
+func (b *hedgingBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return b.wrapped.GetFolder(ctx, folderName)
+}
+
+func (b *hedgingBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return b.wrapped.CreateFolder(ctx, folderName)
+}
+
+func (b *hedgingBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	return b.wrapped.RenameFolder(ctx, folderName, destinationFolderId)
+}
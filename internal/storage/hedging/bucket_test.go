@@ -0,0 +1,241 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hedging
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// A bucket whose StatObject and NewReader calls each take as long as slow
+// says, counting from zero, or until cancelled.
+type slowBucket struct {
+	gcs.Bucket
+	slow func(call int) time.Duration
+
+	mu        sync.Mutex
+	calls     int
+	cancelled int
+}
+
+func (b *slowBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	d := b.slow(b.calls)
+	b.calls++
+	b.mu.Unlock()
+
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.cancelled++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (b *slowBucket) StatObject(ctx context.Context, req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	return b.Bucket.StatObject(ctx, req)
+}
+
+func (b *slowBucket) NewReader(ctx context.Context, req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return b.Bucket.NewReader(ctx, req)
+}
+
+func (b *slowBucket) counts() (calls int, cancelled int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls, b.cancelled
+}
+
+type hedgeCounter struct {
+	common.MetricHandle
+	hedges atomic.Int64
+	wins   atomic.Int64
+}
+
+func (c *hedgeCounter) GCSHedgeCount(_ context.Context, inc int64, _ []common.MetricAttr) {
+	c.hedges.Add(inc)
+}
+
+func (c *hedgeCounter) GCSHedgeWinCount(_ context.Context, inc int64, _ []common.MetricAttr) {
+	c.wins.Add(inc)
+}
+
+type hedgingTest struct {
+	wrapped *slowBucket
+	metrics *hedgeCounter
+	bucket  gcs.Bucket
+}
+
+// Set up a hedging bucket holding "foo", whose first few stats and reads are
+// fast so that the delays are known, followed by the supplied delays.
+func setUp(t *testing.T, budgetPercent float64, delays ...time.Duration) *hedgingTest {
+	t.Helper()
+	ctx := context.Background()
+	fakeBucket := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	_, err := fakeBucket.CreateObject(ctx, &gcs.CreateObjectRequest{Name: "foo", Contents: strings.NewReader("0123456789")})
+	require.NoError(t, err)
+	ht := &hedgingTest{
+		wrapped: &slowBucket{
+			Bucket: fakeBucket,
+			slow: func(call int) time.Duration {
+				if i := call - 2*minSamples; i >= 0 && i < len(delays) {
+					return delays[i]
+				}
+				return 0
+			},
+		},
+		metrics: &hedgeCounter{MetricHandle: common.NewNoopMetrics()},
+	}
+	ht.bucket = NewHedgingBucket(ht.wrapped, Config{
+		Percentile:    95,
+		BudgetPercent: budgetPercent,
+		MinDelay:      DefaultMinDelay,
+		MaxReadSize:   DefaultMaxReadSize,
+	}, ht.metrics)
+
+	for range minSamples {
+		_, _, err = ht.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+		require.NoError(t, err)
+		rc, err := ht.bucket.NewReader(ctx, &gcs.ReadObjectRequest{Name: "foo", Range: &gcs.ByteRange{Start: 0, Limit: 1}})
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	}
+
+	return ht
+}
+
+func TestHedgesSlowStat(t *testing.T) {
+	ht := setUp(t, 100, 5*time.Second, 0)
+
+	start := time.Now()
+	m, _, err := ht.bucket.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, m.Size)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.EqualValues(t, 1, ht.metrics.hedges.Load())
+	assert.EqualValues(t, 1, ht.metrics.wins.Load())
+	// The slow original is cancelled.
+	assert.Eventually(t, func() bool {
+		_, cancelled := ht.wrapped.counts()
+		return cancelled == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestDoesntHedgeFastStat(t *testing.T) {
+	ht := setUp(t, 100)
+
+	_, _, err := ht.bucket.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, ht.metrics.hedges.Load())
+	calls, _ := ht.wrapped.counts()
+	assert.Equal(t, 2*minSamples+1, calls)
+}
+
+func TestDoesntHedgeUntilLatenciesAreKnown(t *testing.T) {
+	wrapped := &slowBucket{
+		Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical),
+		slow:   func(int) time.Duration { return 20 * time.Millisecond },
+	}
+	metrics := &hedgeCounter{MetricHandle: common.NewNoopMetrics()}
+	b := NewHedgingBucket(wrapped, Config{Percentile: 50, BudgetPercent: 100, MaxReadSize: DefaultMaxReadSize}, metrics)
+
+	_, _, err := b.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t, err, &notFoundErr)
+	assert.EqualValues(t, 0, metrics.hedges.Load())
+}
+
+func TestBudgetLimitsHedges(t *testing.T) {
+	ht := setUp(t, 0, 50*time.Millisecond)
+
+	start := time.Now()
+	_, _, err := ht.bucket.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.EqualValues(t, 0, ht.metrics.hedges.Load())
+}
+
+func TestHedgesSmallReads(t *testing.T) {
+	ht := setUp(t, 100, 5*time.Second, 0)
+
+	rc, err := ht.bucket.NewReader(context.Background(), &gcs.ReadObjectRequest{Name: "foo", Range: &gcs.ByteRange{Start: 2, Limit: 6}})
+	require.NoError(t, err)
+	contents, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+
+	assert.Equal(t, "2345", string(contents))
+	assert.EqualValues(t, 1, ht.metrics.hedges.Load())
+	assert.EqualValues(t, 1, ht.metrics.wins.Load())
+}
+
+func TestDoesntHedgeLargeReads(t *testing.T) {
+	ht := setUp(t, 100, 50*time.Millisecond)
+
+	rc, err := ht.bucket.NewReader(context.Background(), &gcs.ReadObjectRequest{Name: "foo"})
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+
+	assert.EqualValues(t, 0, ht.metrics.hedges.Load())
+}
+
+func TestLatenciesDelay(t *testing.T) {
+	l := newLatencies()
+	for i := 1; i <= 100; i++ {
+		l.record(time.Duration(i) * time.Millisecond)
+	}
+
+	d, ok := l.delay(90)
+
+	assert.True(t, ok)
+	assert.Equal(t, 91*time.Millisecond, d)
+}
+
+func TestBudget(t *testing.T) {
+	b := newBudget(0.5)
+
+	b.earn()
+	assert.False(t, b.spend())
+	b.earn()
+	assert.True(t, b.spend())
+	assert.False(t, b.spend())
+}
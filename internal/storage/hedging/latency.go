@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hedging
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// How many of the most recent latencies a percentile is taken over.
+	windowSize = 512
+
+	// How many latencies must be known before requests are hedged.
+	minSamples = 32
+
+	// How many latencies to record between recomputing the delay.
+	recomputeEvery = 16
+
+	// How many hedges the budget can save up.
+	maxBudget = 10
+)
+
+// The most recent latencies of a method, and the delay derived from them.
+type latencies struct {
+	mu sync.Mutex
+
+	// A ring of the most recent latencies, the next to be overwritten at
+	// count % windowSize.
+	//
+	// GUARDED_BY(mu)
+	window []time.Duration
+
+	// GUARDED_BY(mu)
+	count int
+
+	// The delay as of the last recomputation, and the percentile it was
+	// computed for.
+	//
+	// GUARDED_BY(mu)
+	cached     time.Duration
+	cachedFor  float64
+	cachedWhen int
+}
+
+func newLatencies() *latencies {
+	return &latencies{window: make([]time.Duration, windowSize), cachedWhen: -1}
+}
+
+func (l *latencies) record(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.window[l.count%windowSize] = d
+	l.count++
+}
+
+// Return the given percentile of the recent latencies, or false if too few
+// are known to say.
+func (l *latencies) delay(percentile float64) (d time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count < minSamples {
+		return
+	}
+
+	if l.cachedWhen < 0 || l.count-l.cachedWhen >= recomputeEvery || l.cachedFor != percentile {
+		sorted := slices.Clone(l.window[:min(l.count, windowSize)])
+		slices.Sort(sorted)
+		i := int(percentile / 100 * float64(len(sorted)))
+		l.cached = sorted[min(max(i, 0), len(sorted)-1)]
+		l.cachedFor = percentile
+		l.cachedWhen = l.count
+	}
+
+	d, ok = l.cached, true
+	return
+}
+
+// A budget of hedges, earned as a fraction of requests and spent one per
+// hedge, so that hedging adds at most that fraction of requests.
+type budget struct {
+	mu    sync.Mutex
+	ratio float64
+
+	// GUARDED_BY(mu)
+	tokens float64
+}
+
+func newBudget(ratio float64) *budget {
+	return &budget{ratio: ratio}
+}
+
+// Earn a share of a hedge for a request that could be hedged.
+func (b *budget) earn() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.tokens+b.ratio, maxBudget)
+}
+
+// Spend a hedge if the budget allows, returning whether it did.
+func (b *budget) spend() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
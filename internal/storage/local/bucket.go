@@ -0,0 +1,1414 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package local implements gcs.Bucket on top of a directory of the local
+// file system, for development and testing without access to GCS.
+//
+// Each object is stored in a file at the path given by its name, so that the
+// contents of the bucket outlive the process and existing trees of files can
+// be served as they are. Attributes that a file can't carry, like
+// generations and user metadata, are kept in sidecar files next to it; files
+// without one are given attributes derived from their size and modification
+// time. Only the live generation of each object is kept.
+//
+// Names that would need a path to be both a file and a directory, e.g. "a"
+// and "a/b", are held by moving the file into the directory under a reserved
+// name for as long as the directory has other contents.
+package local
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// NewBucket returns a bucket with the given name whose objects are stored
+// under the directory root, which must exist. In a hierarchical bucket every
+// directory is a folder; otherwise directories that hold no objects are
+// removed along with their last object.
+func NewBucket(clock timeutil.Clock, root string, name string, bucketType gcs.BucketType) gcs.Bucket {
+	return &bucket{
+		clock:      clock,
+		root:       root,
+		name:       name,
+		bucketType: bucketType,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Helper types
+////////////////////////////////////////////////////////////////////////
+
+// The attributes of an object, as kept in its sidecar file.
+type objectMeta struct {
+	// The original last component of the object's name, if its file is named
+	// after a hash of it.
+	LongName string `json:",omitempty"`
+
+	Generation         int64
+	MetaGeneration     int64
+	ContentType        string            `json:",omitempty"`
+	ContentLanguage    string            `json:",omitempty"`
+	ContentEncoding    string            `json:",omitempty"`
+	CacheControl       string            `json:",omitempty"`
+	ContentDisposition string            `json:",omitempty"`
+	CustomTime         string            `json:",omitempty"`
+	StorageClass       string            `json:",omitempty"`
+	EventBasedHold     bool              `json:",omitempty"`
+	Metadata           map[string]string `json:",omitempty"`
+	MD5                *[md5.Size]byte   `json:",omitempty"`
+	CRC32C             *uint32           `json:",omitempty"`
+	ComponentCount     int64
+	Created            time.Time
+	Updated            time.Time
+
+	// The size and modification time of the object's file when the attributes
+	// were written. If the file no longer matches, it was changed behind the
+	// bucket's back and the attributes no longer apply.
+	Size    int64
+	ModTime int64
+
+	// Whether the attributes were derived from the file alone.
+	derived bool
+}
+
+// Return the attributes of a file that has no usable sidecar.
+func derivedMeta(fi fs.FileInfo) *objectMeta {
+	mtime := fi.ModTime().UTC()
+	gen := mtime.UnixNano()
+	if gen <= 0 {
+		gen = 1
+	}
+
+	return &objectMeta{
+		Generation:     gen,
+		MetaGeneration: 1,
+		StorageClass:   "STANDARD",
+		ComponentCount: 1,
+		Created:        mtime,
+		Updated:        mtime,
+		Size:           fi.Size(),
+		ModTime:        mtime.UnixNano(),
+		derived:        true,
+	}
+}
+
+func (m *objectMeta) object(b *bucket, name string) *gcs.Object {
+	return &gcs.Object{
+		Name:               name,
+		ContentType:        m.ContentType,
+		ContentLanguage:    m.ContentLanguage,
+		CacheControl:       m.CacheControl,
+		Owner:              "user-local",
+		Size:               uint64(m.Size),
+		ContentEncoding:    m.ContentEncoding,
+		MD5:                m.MD5,
+		CRC32C:             m.CRC32C,
+		MediaLink:          "file://localhost/download/storage/" + b.name + "/" + name,
+		Metadata:           copyMetadata(m.Metadata),
+		Generation:         m.Generation,
+		MetaGeneration:     m.MetaGeneration,
+		StorageClass:       m.StorageClass,
+		Created:            m.Created,
+		Updated:            m.Updated,
+		ComponentCount:     m.ComponentCount,
+		ContentDisposition: m.ContentDisposition,
+		CustomTime:         m.CustomTime,
+		EventBasedHold:     m.EventBasedHold,
+	}
+}
+
+// Contents written to a temporary file, along with their checksums.
+type tempFile struct {
+	path   string
+	f      *os.File
+	size   int64
+	md5    hash.Hash
+	crc32c hash.Hash32
+}
+
+func (b *bucket) newTempFile() (t *tempFile, err error) {
+	f, err := os.CreateTemp(b.root, tmpPrefix+"*")
+	if err != nil {
+		err = fmt.Errorf("CreateTemp: %w", err)
+		return
+	}
+
+	t = &tempFile{
+		path:   f.Name(),
+		f:      f,
+		md5:    md5.New(),
+		crc32c: crc32.New(crc32cTable),
+	}
+
+	return
+}
+
+func (t *tempFile) Write(p []byte) (n int, err error) {
+	n, err = t.f.Write(p)
+	t.md5.Write(p[:n])
+	t.crc32c.Write(p[:n])
+	t.size += int64(n)
+	return
+}
+
+// Close the file, checking its contents against the checksums requested, if
+// any.
+func (t *tempFile) finish(wantCRC32C *uint32, wantMD5 *[md5.Size]byte) (err error) {
+	if err = t.f.Close(); err != nil {
+		err = fmt.Errorf("Close: %w", err)
+		return
+	}
+
+	if wantCRC32C != nil {
+		actual := t.crc32c.Sum32()
+		if actual != *wantCRC32C {
+			err = fmt.Errorf(
+				"CRC32C mismatch: got 0x%08x, expected 0x%08x",
+				actual,
+				*wantCRC32C)
+
+			return
+		}
+	}
+
+	if wantMD5 != nil {
+		actual := t.md5Sum()
+		if actual != *wantMD5 {
+			err = fmt.Errorf(
+				"MD5 mismatch: got %s, expected %s",
+				hex.EncodeToString(actual[:]),
+				hex.EncodeToString(wantMD5[:]))
+
+			return
+		}
+	}
+
+	return
+}
+
+func (t *tempFile) md5Sum() (sum [md5.Size]byte) {
+	copy(sum[:], t.md5.Sum(nil))
+	return
+}
+
+// Remove the file, if it is still around.
+func (t *tempFile) discard() {
+	t.f.Close()
+	os.Remove(t.path)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+type bucket struct {
+	clock      timeutil.Clock
+	root       string
+	name       string
+	bucketType gcs.BucketType
+
+	// Serializes changes to the tree, and lets readers see each object's file
+	// and attributes agree.
+	mu sync.Mutex
+
+	// The most recent generation number that was minted.
+	prevGeneration int64 // GUARDED_BY(mu)
+}
+
+// Return the current time, in UTC as GCS reports times, and as it reads back
+// from a sidecar.
+func (b *bucket) now() time.Time {
+	return b.clock.Now().UTC().Round(0)
+}
+
+func isNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+func copyMetadata(in map[string]string) (out map[string]string) {
+	if in == nil {
+		return
+	}
+
+	out = make(map[string]string)
+	for k, v := range in {
+		out[k] = v
+	}
+
+	return
+}
+
+// Return the path of the directory with the given components.
+func (b *bucket) dirPath(comps []string) string {
+	p := b.root
+	for _, c := range comps {
+		p = filepath.Join(p, encodeComponent(c))
+	}
+
+	return p
+}
+
+// Return the path of the object's file, which is a directory for placeholder
+// objects, and the path of its sidecar. A file that shares its name with a
+// directory lives inside it, under selfName.
+func (b *bucket) paths(name string) (p string, metaPath string) {
+	dir, leaf := splitName(name)
+	if leaf == "" {
+		p = b.dirPath(dir)
+		metaPath = filepath.Join(p, dirMetaName)
+		return
+	}
+
+	e := encodeComponent(leaf)
+	p = filepath.Join(b.dirPath(dir), e)
+	if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+		metaPath = filepath.Join(p, metaPrefix+selfName)
+		p = filepath.Join(p, selfName)
+		return
+	}
+
+	metaPath = filepath.Join(b.dirPath(dir), metaPrefix+e)
+	return
+}
+
+func readMeta(path string) (m *objectMeta, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	m = new(objectMeta)
+	if err = json.Unmarshal(data, m); err != nil {
+		err = fmt.Errorf("parsing %s: %w", path, err)
+		return
+	}
+
+	// Times are reported in UTC, whatever zone a sidecar was written in.
+	m.Created = m.Created.UTC()
+	m.Updated = m.Updated.UTC()
+	return
+}
+
+// Write a file atomically, by way of a temporary file in the root.
+func (b *bucket) writeFileAtomically(path string, data []byte) (err error) {
+	f, err := os.CreateTemp(b.root, tmpPrefix+"*")
+	if err != nil {
+		err = fmt.Errorf("CreateTemp: %w", err)
+		return
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		err = fmt.Errorf("Write: %w", err)
+		return
+	}
+
+	if err = f.Close(); err != nil {
+		err = fmt.Errorf("Close: %w", err)
+		return
+	}
+
+	if err = os.Rename(f.Name(), path); err != nil {
+		err = fmt.Errorf("Rename: %w", err)
+	}
+
+	return
+}
+
+func (b *bucket) writeMeta(path string, m *objectMeta) (err error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		err = fmt.Errorf("Marshal: %w", err)
+		return
+	}
+
+	return b.writeFileAtomically(path, data)
+}
+
+// Return the attributes of the live generation of the named object, or
+// *gcs.NotFoundError if there is none.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) statLocked(name string) (m *objectMeta, err error) {
+	p, metaPath := b.paths(name)
+	notFound := &gcs.NotFoundError{Err: fmt.Errorf("object %s not found", name)}
+
+	// A placeholder object exists exactly when its sidecar does.
+	if strings.HasSuffix(name, "/") {
+		m, err = readMeta(metaPath)
+		if isNotExist(err) {
+			err = notFound
+		}
+
+		return
+	}
+
+	fi, err := os.Stat(p)
+	if isNotExist(err) || (err == nil && !fi.Mode().IsRegular()) {
+		err = notFound
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("Stat: %w", err)
+		return
+	}
+
+	m, err = readMeta(metaPath)
+	switch {
+	case isNotExist(err):
+		m = derivedMeta(fi)
+		err = nil
+
+	case err != nil:
+		return
+
+	case m.Size != fi.Size() || m.ModTime != fi.ModTime().UnixNano():
+		m = derivedMeta(fi)
+	}
+
+	return
+}
+
+// Return a generation number for a new object replacing the given one, if
+// any.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) mintGeneration(existing *objectMeta) int64 {
+	gen := b.now().UnixNano()
+	if gen <= b.prevGeneration {
+		gen = b.prevGeneration + 1
+	}
+
+	if existing != nil && gen <= existing.Generation {
+		gen = existing.Generation + 1
+	}
+
+	b.prevGeneration = gen
+	return gen
+}
+
+// Create the directories with the given components, as needed. A file in
+// the way moves into the directory taking its place.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) makeDirs(comps []string) (err error) {
+	p := b.root
+	for _, c := range comps {
+		e := encodeComponent(c)
+		parent := p
+		p = filepath.Join(p, e)
+
+		var fi fs.FileInfo
+		fi, err = os.Stat(p)
+		switch {
+		case err == nil && fi.IsDir():
+			continue
+
+		case err == nil:
+			if err = b.nestFile(parent, e); err != nil {
+				return
+			}
+
+		case isNotExist(err):
+			if err = os.Mkdir(p, 0755); err != nil {
+				err = fmt.Errorf("Mkdir: %w", err)
+				return
+			}
+
+		default:
+			err = fmt.Errorf("Stat: %w", err)
+			return
+		}
+
+		if strings.HasPrefix(e, longPrefix) {
+			err = b.writeFileAtomically(filepath.Join(p, dirNameFile), []byte(c))
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// Replace the file with the given name in dir by a directory of the same
+// name holding it.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) nestFile(dir string, e string) (err error) {
+	p := filepath.Join(dir, e)
+	tmp := filepath.Join(b.root, tmpPrefix+"nest")
+	if err = os.Rename(p, tmp); err != nil {
+		err = fmt.Errorf("Rename: %w", err)
+		return
+	}
+
+	if err = os.Mkdir(p, 0755); err != nil {
+		os.Rename(tmp, p)
+		err = fmt.Errorf("Mkdir: %w", err)
+		return
+	}
+
+	if err = os.Rename(tmp, filepath.Join(p, selfName)); err != nil {
+		err = fmt.Errorf("Rename: %w", err)
+		return
+	}
+
+	err = os.Rename(filepath.Join(dir, metaPrefix+e), filepath.Join(p, metaPrefix+selfName))
+	if isNotExist(err) {
+		err = nil
+	}
+
+	return
+}
+
+// Move the file nested in the directory at p, if any, to the path "to",
+// which must be free.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) unnestFile(p string, to string) (err error) {
+	err = os.Rename(filepath.Join(p, selfName), to)
+	if isNotExist(err) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("Rename: %w", err)
+		return
+	}
+
+	metaPath := filepath.Join(filepath.Dir(to), metaPrefix+filepath.Base(to))
+	err = os.Rename(filepath.Join(p, metaPrefix+selfName), metaPath)
+	if isNotExist(err) {
+		err = nil
+	}
+
+	if err != nil || !strings.HasPrefix(filepath.Base(to), longPrefix) {
+		return
+	}
+
+	// A file with a long name needs it recorded with its attributes, or it
+	// would be lost along with the directory.
+	name, err := os.ReadFile(filepath.Join(p, dirNameFile))
+	if err != nil {
+		err = fmt.Errorf("ReadFile: %w", err)
+		return
+	}
+
+	fi, err := os.Stat(to)
+	if err != nil {
+		err = fmt.Errorf("Stat: %w", err)
+		return
+	}
+
+	m, err := readMeta(metaPath)
+	if isNotExist(err) || (err == nil && (m.Size != fi.Size() || m.ModTime != fi.ModTime().UnixNano())) {
+		m = derivedMeta(fi)
+		err = nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	m.LongName = string(name)
+	err = b.writeMeta(metaPath, m)
+	return
+}
+
+// Remove the directory, if it holds nothing but the bucket's own record of
+// its name, and then its parents in the same way, up to the root. A
+// directory left holding just a file named like it gives way to the file.
+// Does nothing in a hierarchical bucket, where directories are folders in
+// their own right.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) pruneDirs(dir string) {
+	if b.bucketType == gcs.Hierarchical {
+		return
+	}
+
+	for dir != b.root && strings.HasPrefix(dir, b.root) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+
+		var nested bool
+		for _, e := range entries {
+			switch e.Name() {
+			case dirNameFile, metaPrefix + selfName:
+			case selfName:
+				nested = true
+			default:
+				return
+			}
+		}
+
+		if nested {
+			b.unnestLastFile(dir)
+			return
+		}
+
+		os.Remove(filepath.Join(dir, dirNameFile))
+		if os.Remove(dir) != nil {
+			return
+		}
+
+		dir = filepath.Dir(dir)
+	}
+}
+
+// Put the file nested in an otherwise empty directory back in its place.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) unnestLastFile(dir string) {
+	tmp := filepath.Join(b.root, tmpPrefix+"unnest")
+	if os.Rename(dir, tmp) != nil {
+		return
+	}
+
+	if b.unnestFile(tmp, dir) != nil {
+		os.Rename(tmp, dir)
+		return
+	}
+
+	os.RemoveAll(tmp)
+}
+
+// Check the preconditions for replacing the given object, which may be nil.
+func checkPreconditions(
+	existing *objectMeta,
+	genPrecondition *int64,
+	metaGenPrecondition *int64) (err error) {
+	if genPrecondition != nil {
+		if *genPrecondition == 0 && existing != nil {
+			err = &gcs.PreconditionError{
+				Err: errors.New("precondition failed: object exists"),
+			}
+
+			return
+		}
+
+		if *genPrecondition > 0 {
+			if existing == nil {
+				err = &gcs.PreconditionError{
+					Err: errors.New("precondition failed: object doesn't exist"),
+				}
+
+				return
+			}
+
+			if existing.Generation != *genPrecondition {
+				err = &gcs.PreconditionError{
+					Err: fmt.Errorf(
+						"precondition failed: object has generation %v",
+						existing.Generation),
+				}
+
+				return
+			}
+		}
+	}
+
+	if metaGenPrecondition != nil {
+		if existing == nil {
+			err = &gcs.PreconditionError{
+				Err: errors.New("precondition failed: object doesn't exist"),
+			}
+
+			return
+		}
+
+		if existing.MetaGeneration != *metaGenPrecondition {
+			err = &gcs.PreconditionError{
+				Err: fmt.Errorf(
+					"precondition failed: object has meta-generation %v",
+					existing.MetaGeneration),
+			}
+
+			return
+		}
+	}
+
+	return
+}
+
+// Make the contents of t the live generation of the named object, with the
+// given attributes, if the preconditions hold.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) commitLocked(
+	name string,
+	t *tempFile,
+	m *objectMeta,
+	genPrecondition *int64,
+	metaGenPrecondition *int64) (o *gcs.Object, err error) {
+	existing, err := b.statLocked(name)
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		existing = nil
+		err = nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	if err = checkPreconditions(existing, genPrecondition, metaGenPrecondition); err != nil {
+		return
+	}
+
+	m.Generation = b.mintGeneration(existing)
+	m.MetaGeneration = 1
+	m.Size = t.size
+
+	dir, leaf := splitName(name)
+	p, metaPath := b.paths(name)
+
+	// Placeholder objects are directories, which can't hold contents.
+	if leaf == "" {
+		if t.size != 0 {
+			err = fmt.Errorf("object %q: objects named like directories must be empty here", name)
+			return
+		}
+
+		if err = b.makeDirs(dir); err != nil {
+			return
+		}
+
+		os.Remove(t.path)
+		err = b.writeMeta(metaPath, m)
+		o = m.object(b, name)
+		return
+	}
+
+	if err = b.makeDirs(dir); err != nil {
+		return
+	}
+
+	// The directories may have moved a file in the way of one, so look again.
+	p, metaPath = b.paths(name)
+	if err = os.Rename(t.path, p); err != nil {
+		err = fmt.Errorf("Rename: %w", err)
+		return
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		err = fmt.Errorf("Stat: %w", err)
+		return
+	}
+
+	m.ModTime = fi.ModTime().UnixNano()
+	m.LongName = ""
+	if strings.HasPrefix(filepath.Base(p), longPrefix) {
+		m.LongName = leaf
+	}
+
+	if err = b.writeMeta(metaPath, m); err != nil {
+		return
+	}
+
+	o = m.object(b, name)
+	return
+}
+
+// Write the contents of r to a new object, as CreateObject does. Composite
+// objects, like in GCS, don't export an MD5 hash.
+func (b *bucket) create(
+	req *gcs.CreateObjectRequest,
+	r io.Reader,
+	m *objectMeta,
+	composite bool) (o *gcs.Object, err error) {
+	t, err := b.newTempFile()
+	if err != nil {
+		return
+	}
+	defer t.discard()
+
+	if _, err = io.Copy(t, r); err != nil {
+		err = fmt.Errorf("copying contents: %w", err)
+		return
+	}
+
+	if err = t.finish(req.CRC32C, req.MD5); err != nil {
+		return
+	}
+
+	m.MD5 = nil
+	if !composite {
+		sum := t.md5Sum()
+		m.MD5 = &sum
+	}
+
+	crc := t.crc32c.Sum32()
+	m.CRC32C = &crc
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Copies arrive with their source's update time, which they keep.
+	m.Created = b.now()
+	if m.Updated.IsZero() {
+		m.Updated = m.Created
+	}
+
+	return b.commitLocked(
+		req.Name,
+		t,
+		m,
+		req.GenerationPrecondition,
+		req.MetaGenerationPrecondition)
+}
+
+func metaForCreate(req *gcs.CreateObjectRequest) *objectMeta {
+	storageClass := req.StorageClass
+	if storageClass == "" {
+		storageClass = "STANDARD"
+	}
+
+	return &objectMeta{
+		ContentType:        req.ContentType,
+		ContentLanguage:    req.ContentLanguage,
+		ContentEncoding:    req.ContentEncoding,
+		CacheControl:       req.CacheControl,
+		ContentDisposition: req.ContentDisposition,
+		CustomTime:         req.CustomTime,
+		StorageClass:       storageClass,
+		EventBasedHold:     req.EventBasedHold,
+		Metadata:           copyMetadata(req.Metadata),
+		ComponentCount:     1,
+	}
+}
+
+// Open the given generation of the named object, zero meaning the live one.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) openLocked(name string, generation int64) (f *os.File, m *objectMeta, err error) {
+	m, err = b.statLocked(name)
+	if err != nil {
+		return
+	}
+
+	if generation != 0 && m.Generation != generation {
+		err = &gcs.NotFoundError{
+			Err: fmt.Errorf("object %s generation %v not found", name, generation),
+		}
+
+		return
+	}
+
+	// Placeholder objects have no contents to open.
+	if strings.HasSuffix(name, "/") {
+		return
+	}
+
+	p, _ := b.paths(name)
+	if f, err = os.Open(p); err != nil {
+		err = fmt.Errorf("Open: %w", err)
+	}
+
+	return
+}
+
+// Return a reader for the contents of an opened object, which may be nil for
+// a placeholder.
+func contentsOf(f *os.File) io.Reader {
+	if f == nil {
+		return strings.NewReader("")
+	}
+
+	return f
+}
+
+////////////////////////////////////////////////////////////////////////
+// Public interface
+////////////////////////////////////////////////////////////////////////
+
+func (b *bucket) Name() string {
+	return b.name
+}
+
+func (b *bucket) BucketType() gcs.BucketType {
+	return b.bucketType
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	b.mu.Lock()
+	f, m, err := b.openLocked(req.Name, req.Generation)
+	b.mu.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	if f == nil {
+		rc = io.NopCloser(strings.NewReader(""))
+		return
+	}
+
+	// Extract the requested range.
+	var r io.Reader = f
+	if req.Range != nil {
+		start := req.Range.Start
+		limit := req.Range.Limit
+		l := uint64(m.Size)
+
+		if start > limit || start > l {
+			start = 0
+			limit = 0
+		}
+
+		if limit > l {
+			limit = l
+		}
+
+		r = io.NewSectionReader(f, int64(start), int64(limit-start))
+	}
+
+	rc = struct {
+		io.Reader
+		io.Closer
+	}{r, f}
+
+	return
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
+	if err = checkName(req.Name); err != nil {
+		return
+	}
+
+	return b.create(req, req.Contents, metaForCreate(req), false)
+}
+
+func (b *bucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, _ int, _ func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	return newObjectWriter(b, req)
+}
+
+func (b *bucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (*gcs.MinObject, error) {
+	err := w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	ow, ok := w.(*objectWriter)
+	if !ok {
+		return nil, fmt.Errorf("could not type assert gcs.Writer to objectWriter")
+	}
+	return ow.object, nil
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (o *gcs.Object, err error) {
+	// Check that the destination name is legal.
+	if err = checkName(req.DstName); err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	f, src, err := b.openLocked(req.SrcName, req.SrcGeneration)
+	b.mu.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	if f != nil {
+		defer f.Close()
+	}
+
+	// Does it have the correct meta-generation?
+	if req.SrcMetaGenerationPrecondition != nil {
+		p := *req.SrcMetaGenerationPrecondition
+		if src.MetaGeneration != p {
+			err = &gcs.PreconditionError{
+				Err: fmt.Errorf(
+					"object %q has meta-generation %d",
+					req.SrcName,
+					src.MetaGeneration),
+			}
+
+			return
+		}
+	}
+
+	// Copy the attributes, including the update time, leaving the rest to be
+	// filled in for the new generation.
+	m := *src
+	m.LongName = ""
+	m.Metadata = copyMetadata(src.Metadata)
+
+	return b.create(
+		&gcs.CreateObjectRequest{
+			Name:                   req.DstName,
+			GenerationPrecondition: req.DstGenerationPrecondition,
+		},
+		contentsOf(f),
+		&m,
+		src.MD5 == nil && !src.derived)
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
+	// GCS doesn't like too few or too many sources.
+	if len(req.Sources) < 1 {
+		err = errors.New("you must provide at least one source component")
+		return
+	}
+
+	if len(req.Sources) > gcs.MaxSourcesPerComposeRequest {
+		err = errors.New("you have provided too many source components")
+		return
+	}
+
+	if err = checkName(req.DstName); err != nil {
+		return
+	}
+
+	// Open all of the source objects, also computing the sum of their
+	// component counts.
+	var srcReaders []io.Reader
+	var dstComponentCount int64
+
+	b.mu.Lock()
+	for _, src := range req.Sources {
+		var f *os.File
+		var m *objectMeta
+		f, m, err = b.openLocked(src.Name, src.Generation)
+		if err != nil {
+			break
+		}
+
+		if f != nil {
+			defer f.Close()
+		}
+
+		srcReaders = append(srcReaders, contentsOf(f))
+		dstComponentCount += m.ComponentCount
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	// GCS doesn't like the component count to go too high.
+	if dstComponentCount > gcs.MaxComponentCount {
+		err = errors.New("result would have too many components")
+		return
+	}
+
+	storageClass := req.StorageClass
+	if storageClass == "" {
+		storageClass = "STANDARD"
+	}
+
+	return b.create(
+		&gcs.CreateObjectRequest{
+			Name:                       req.DstName,
+			GenerationPrecondition:     req.DstGenerationPrecondition,
+			MetaGenerationPrecondition: req.DstMetaGenerationPrecondition,
+		},
+		io.MultiReader(srcReaders...),
+		&objectMeta{
+			ContentType:        req.ContentType,
+			ContentLanguage:    req.ContentLanguage,
+			ContentEncoding:    req.ContentEncoding,
+			CacheControl:       req.CacheControl,
+			ContentDisposition: req.ContentDisposition,
+			CustomTime:         req.CustomTime,
+			StorageClass:       storageClass,
+			EventBasedHold:     req.EventBasedHold,
+			Metadata:           copyMetadata(req.Metadata),
+			ComponentCount:     dstComponentCount,
+		},
+		true)
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) StatObject(ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	meta, err := b.statLocked(req.Name)
+	if err != nil {
+		return
+	}
+
+	o := meta.object(b, req.Name)
+	m = storageutil.ConvertObjToMinObject(o)
+	if req.ReturnExtendedObjectAttributes {
+		e = storageutil.ConvertObjToExtendedObjectAttributes(o)
+	}
+
+	return
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.listLocked(req)
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (o *gcs.Object, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m, err := b.statLocked(req.Name)
+	if err != nil {
+		return
+	}
+
+	// Does the generation number match the request?
+	if req.Generation != 0 && m.Generation != req.Generation {
+		err = &gcs.NotFoundError{
+			Err: fmt.Errorf(
+				"object %q generation %d not found",
+				req.Name,
+				req.Generation),
+		}
+
+		return
+	}
+
+	// Does the meta-generation precondition check out?
+	if req.MetaGenerationPrecondition != nil &&
+		m.MetaGeneration != *req.MetaGenerationPrecondition {
+		err = &gcs.PreconditionError{
+			Err: fmt.Errorf(
+				"object %q has meta-generation %d",
+				req.Name,
+				m.MetaGeneration),
+		}
+
+		return
+	}
+
+	// Update the basic fields according to the request.
+	if req.ContentType != nil {
+		m.ContentType = *req.ContentType
+	}
+
+	if req.ContentEncoding != nil {
+		m.ContentEncoding = *req.ContentEncoding
+	}
+
+	if req.ContentLanguage != nil {
+		m.ContentLanguage = *req.ContentLanguage
+	}
+
+	if req.CacheControl != nil {
+		m.CacheControl = *req.CacheControl
+	}
+
+	// Update the user metadata if necessary.
+	if len(req.Metadata) > 0 {
+		if m.Metadata == nil {
+			m.Metadata = make(map[string]string)
+		}
+
+		for k, v := range req.Metadata {
+			if v == nil {
+				delete(m.Metadata, k)
+				continue
+			}
+
+			m.Metadata[k] = *v
+		}
+	}
+
+	// Bump up the meta-generation number and the update time.
+	m.MetaGeneration++
+	m.Updated = b.now()
+
+	p, metaPath := b.paths(req.Name)
+	if _, leaf := splitName(req.Name); strings.HasPrefix(filepath.Base(p), longPrefix) && leaf != "" {
+		m.LongName = leaf
+	}
+
+	if err = b.writeMeta(metaPath, m); err != nil {
+		return
+	}
+
+	o = m.object(b, req.Name)
+	return
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Do we possess the object with the given name and generation? If not,
+	// there is nothing to do.
+	m, err := b.statLocked(req.Name)
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	if req.Generation != 0 && m.Generation != req.Generation {
+		return
+	}
+
+	// Check the meta-generation if requested.
+	if req.MetaGenerationPrecondition != nil {
+		p := *req.MetaGenerationPrecondition
+		if m.MetaGeneration != p {
+			err = &gcs.PreconditionError{
+				Err: fmt.Errorf(
+					"object %q has meta-generation %d",
+					req.Name,
+					m.MetaGeneration),
+			}
+
+			return
+		}
+	}
+
+	// Remove the object. Its directory goes too, if that leaves it empty.
+	p, metaPath := b.paths(req.Name)
+	if strings.HasSuffix(req.Name, "/") {
+		if err = os.Remove(metaPath); err != nil && !isNotExist(err) {
+			err = fmt.Errorf("Remove: %w", err)
+			return
+		}
+
+		err = nil
+		b.pruneDirs(p)
+		return
+	}
+
+	if err = os.Remove(p); err != nil && !isNotExist(err) {
+		err = fmt.Errorf("Remove: %w", err)
+		return
+	}
+
+	err = nil
+	os.Remove(metaPath)
+	b.pruneDirs(filepath.Dir(p))
+	return
+}
+
+func (b *bucket) DeleteFolder(ctx context.Context, folderName string) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, metaPath := b.paths(folderName)
+	entries, err := os.ReadDir(p)
+	if isNotExist(err) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("ReadDir: %w", err)
+		return
+	}
+
+	// Like GCS, refuse to delete folders that aren't empty.
+	var nested bool
+	for _, e := range entries {
+		switch e.Name() {
+		case dirNameFile, dirMetaName, metaPrefix + selfName:
+		case selfName:
+			nested = true
+		default:
+			err = fmt.Errorf("folder %q is not empty", folderName)
+			return
+		}
+	}
+
+	// The placeholder object goes along with the folder, but a file named like
+	// it stays.
+	os.Remove(metaPath)
+	if nested {
+		b.unnestLastFile(p)
+	} else {
+		os.Remove(filepath.Join(p, dirNameFile))
+		if err = os.Remove(p); err != nil {
+			err = fmt.Errorf("Remove: %w", err)
+			return
+		}
+	}
+
+	b.pruneDirs(filepath.Dir(p))
+	return
+}
+
+func (b *bucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, _ := b.paths(folderName)
+	fi, err := os.Stat(p)
+	if isNotExist(err) || (err == nil && !fi.IsDir()) {
+		err = &gcs.NotFoundError{
+			Err: fmt.Errorf("object %s not found", folderName),
+		}
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Stat: %w", err)
+	}
+
+	return &gcs.Folder{Name: folderName, UpdateTime: fi.ModTime().UTC()}, nil
+}
+
+func (b *bucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Check that the name is legal.
+	err := checkName(folderName)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, _ := splitName(folderName)
+	if err = b.makeDirs(dir); err != nil {
+		return nil, err
+	}
+
+	// As with GCS, the folder comes with a placeholder object.
+	_, metaPath := b.paths(folderName)
+	if _, err = os.Stat(metaPath); isNotExist(err) {
+		now := b.now()
+		err = b.writeMeta(metaPath, &objectMeta{
+			Generation:     b.mintGeneration(nil),
+			MetaGeneration: 1,
+			StorageClass:   "STANDARD",
+			ComponentCount: 1,
+			Created:        now,
+			Updated:        now,
+		})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcs.Folder{Name: folderName, UpdateTime: b.now()}, nil
+}
+
+func (b *bucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Check that the destination name is legal.
+	err := checkName(destinationFolderId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if the source folder exists.
+	src, _ := b.paths(folderName)
+	if fi, err := os.Stat(src); err != nil || !fi.IsDir() {
+		err = &gcs.NotFoundError{
+			Err: fmt.Errorf("object %q not found", folderName),
+		}
+		return nil, err
+	}
+
+	dstDir, _ := splitName(destinationFolderId)
+	if len(dstDir) == 0 {
+		return nil, fmt.Errorf("invalid folder name %q", destinationFolderId)
+	}
+
+	if err = b.makeDirs(dstDir[:len(dstDir)-1]); err != nil {
+		return nil, err
+	}
+
+	// Everything below the folder moves with it in one go.
+	dst, _ := b.paths(destinationFolderId)
+	if _, err = os.Stat(dst); err == nil {
+		return nil, fmt.Errorf("folder %q already exists", destinationFolderId)
+	}
+
+	if err = os.Rename(src, dst); err != nil {
+		return nil, fmt.Errorf("Rename: %w", err)
+	}
+
+	// A file named like the folder stays behind.
+	if err = b.unnestFile(dst, src); err != nil {
+		return nil, err
+	}
+
+	// Keep the record of the folder's name in line with the new one.
+	nameFile := filepath.Join(dst, dirNameFile)
+	if c := dstDir[len(dstDir)-1]; strings.HasPrefix(filepath.Base(dst), longPrefix) {
+		err = b.writeFileAtomically(nameFile, []byte(c))
+	} else {
+		os.Remove(nameFile)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	b.pruneDirs(filepath.Dir(src))
+
+	return &gcs.Folder{Name: destinationFolderId, UpdateTime: b.now()}, nil
+}
@@ -0,0 +1,331 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBucketForTest(t *testing.T, bucketType gcs.BucketType) (gcs.Bucket, string) {
+	t.Helper()
+	root := t.TempDir()
+	return NewBucket(timeutil.RealClock(), root, "some_bucket", bucketType), root
+}
+
+func listNames(t *testing.T, b gcs.Bucket, req *gcs.ListObjectsRequest) (objects []string, runs []string) {
+	t.Helper()
+	listing, err := b.ListObjects(context.Background(), req)
+	require.NoError(t, err)
+	for _, o := range listing.MinObjects {
+		objects = append(objects, o.Name)
+	}
+	return objects, listing.CollapsedRuns
+}
+
+func TestEncodeComponentRoundTrips(t *testing.T) {
+	t.Parallel()
+	for _, c := range []string{"", ".", "..", "%", "%41", "a%", "100%.txt", "foo \x00 bar", reservedPrefix + "dir", strings.Repeat("a", 1024), "타코"} {
+		e := encodeComponent(c)
+
+		assert.NotContains(t, e, "/")
+		assert.NotContains(t, e, "\x00")
+		assert.LessOrEqual(t, len(e), maxEncodedLen)
+		if !strings.HasPrefix(e, longPrefix) {
+			decoded, ok := decodeComponent(e)
+			assert.True(t, ok)
+			assert.Equal(t, c, decoded)
+		}
+	}
+}
+
+func TestObjectsAreStoredAtTheirPaths(t *testing.T) {
+	t.Parallel()
+	b, root := newBucketForTest(t, gcs.NonHierarchical)
+
+	_, err := storageutil.CreateObject(context.Background(), b, "dir/file.txt", []byte("taco"))
+	require.NoError(t, err)
+
+	contents, err := os.ReadFile(filepath.Join(root, "dir", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "taco", string(contents))
+}
+
+func TestExistingFilesAreObjects(t *testing.T) {
+	t.Parallel()
+	b, root := newBucketForTest(t, gcs.NonHierarchical)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a", "b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a", "b", "c"), []byte("burrito"), 0644))
+
+	m, _, err := b.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "a/b/c"})
+	require.NoError(t, err)
+	assert.EqualValues(t, len("burrito"), m.Size)
+	assert.EqualValues(t, 1, m.MetaGeneration)
+	assert.Less(t, int64(0), m.Generation)
+
+	objects, runs := listNames(t, b, &gcs.ListObjectsRequest{Prefix: "a/", Delimiter: "/"})
+	assert.Empty(t, objects)
+	assert.Equal(t, []string{"a/b/"}, runs)
+}
+
+func TestChangingAFileBehindTheBucketsBackMakesANewGeneration(t *testing.T) {
+	t.Parallel()
+	b, root := newBucketForTest(t, gcs.NonHierarchical)
+	o, err := b.CreateObject(context.Background(), &gcs.CreateObjectRequest{
+		Name:        "foo",
+		ContentType: "text/plain",
+		Contents:    strings.NewReader("taco"),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foo"), []byte("enchilada"), 0644))
+
+	m, e, err := b.StatObject(context.Background(), &gcs.StatObjectRequest{
+		Name:                           "foo",
+		ForceFetchFromGcs:              true,
+		ReturnExtendedObjectAttributes: true,
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, o.Generation, m.Generation)
+	assert.EqualValues(t, len("enchilada"), m.Size)
+	assert.Equal(t, "", e.ContentType)
+}
+
+func TestObjectsOutliveTheBucket(t *testing.T) {
+	t.Parallel()
+	b, root := newBucketForTest(t, gcs.NonHierarchical)
+	o, err := b.CreateObject(context.Background(), &gcs.CreateObjectRequest{
+		Name:     "foo",
+		Metadata: map[string]string{"a": "b"},
+		Contents: strings.NewReader("taco"),
+	})
+	require.NoError(t, err)
+
+	b = NewBucket(timeutil.RealClock(), root, "some_bucket", gcs.NonHierarchical)
+	m, _, err := b.StatObject(context.Background(), &gcs.StatObjectRequest{Name: "foo"})
+
+	require.NoError(t, err)
+	assert.Equal(t, o.Generation, m.Generation)
+	assert.Equal(t, map[string]string{"a": "b"}, m.Metadata)
+}
+
+func TestBookkeepingFilesAreHidden(t *testing.T) {
+	t.Parallel()
+	b, _ := newBucketForTest(t, gcs.NonHierarchical)
+	for _, name := range []string{"dir/", "dir/foo", reservedPrefix + "dir", "dir/" + strings.Repeat("a", 300)} {
+		_, err := storageutil.CreateObject(context.Background(), b, name, nil)
+		require.NoError(t, err)
+	}
+
+	objects, runs := listNames(t, b, &gcs.ListObjectsRequest{})
+
+	assert.Equal(t, []string{reservedPrefix + "dir", "dir/", "dir/" + strings.Repeat("a", 300), "dir/foo"}, objects)
+	assert.Empty(t, runs)
+}
+
+func TestFileAndDirectoryOfTheSameNameCoexist(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b, _ := newBucketForTest(t, gcs.NonHierarchical)
+	_, err := storageutil.CreateObject(ctx, b, "a", []byte("taco"))
+	require.NoError(t, err)
+	_, err = storageutil.CreateObject(ctx, b, "a/b", []byte("burrito"))
+	require.NoError(t, err)
+
+	objects, _ := listNames(t, b, &gcs.ListObjectsRequest{})
+	assert.Equal(t, []string{"a", "a/b"}, objects)
+	contents, err := storageutil.ReadObject(ctx, b, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "taco", string(contents))
+
+	// Once the directory empties, the file moves back to its own path.
+	require.NoError(t, b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: "a/b"}))
+	contents, err = storageutil.ReadObject(ctx, b, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "taco", string(contents))
+	objects, _ = listNames(t, b, &gcs.ListObjectsRequest{})
+	assert.Equal(t, []string{"a"}, objects)
+}
+
+func TestPreconditions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b, _ := newBucketForTest(t, gcs.NonHierarchical)
+	o, err := storageutil.CreateObject(ctx, b, "foo", []byte("taco"))
+	require.NoError(t, err)
+	var zero int64
+
+	_, err = b.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:                   "foo",
+		Contents:               strings.NewReader("burrito"),
+		GenerationPrecondition: &zero,
+	})
+	assert.IsType(t, &gcs.PreconditionError{}, err)
+
+	wrong := o.Generation + 1
+	err = b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: "foo", Generation: wrong})
+	assert.NoError(t, err)
+	_, _, err = b.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+	assert.NoError(t, err)
+
+	wrongMeta := o.MetaGeneration + 1
+	_, err = b.UpdateObject(ctx, &gcs.UpdateObjectRequest{Name: "foo", MetaGenerationPrecondition: &wrongMeta})
+	assert.IsType(t, &gcs.PreconditionError{}, err)
+}
+
+func TestListingWithDelimiterPages(t *testing.T) {
+	t.Parallel()
+	b, _ := newBucketForTest(t, gcs.NonHierarchical)
+	for _, name := range []string{"a", "b/", "b/c", "d/e/f", "g"} {
+		_, err := storageutil.CreateObject(context.Background(), b, name, nil)
+		require.NoError(t, err)
+	}
+
+	var objects, runs []string
+	req := &gcs.ListObjectsRequest{Delimiter: "/", IncludeTrailingDelimiter: true, MaxResults: 2}
+	for {
+		listing, err := b.ListObjects(context.Background(), req)
+		require.NoError(t, err)
+		for _, o := range listing.MinObjects {
+			objects = append(objects, o.Name)
+		}
+		runs = append(runs, listing.CollapsedRuns...)
+		if listing.ContinuationToken == "" {
+			break
+		}
+		req.ContinuationToken = listing.ContinuationToken
+	}
+
+	assert.Equal(t, []string{"a", "b/", "g"}, objects)
+	assert.Equal(t, []string{"b/", "d/"}, runs)
+}
+
+func TestComposeAndCopy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b, _ := newBucketForTest(t, gcs.NonHierarchical)
+	for _, name := range []string{"x", "y"} {
+		_, err := storageutil.CreateObject(ctx, b, name, []byte(name+name))
+		require.NoError(t, err)
+	}
+
+	o, err := b.ComposeObjects(ctx, &gcs.ComposeObjectsRequest{
+		DstName: "z",
+		Sources: []gcs.ComposeSource{{Name: "x"}, {Name: "y"}},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, o.MD5)
+	assert.EqualValues(t, 2, o.ComponentCount)
+
+	c, err := b.CopyObject(ctx, &gcs.CopyObjectRequest{SrcName: "z", DstName: "w"})
+	require.NoError(t, err)
+	assert.Nil(t, c.MD5)
+	assert.EqualValues(t, 2, c.ComponentCount)
+	contents, err := storageutil.ReadObject(ctx, b, "w")
+	require.NoError(t, err)
+	assert.Equal(t, "xxyy", string(contents))
+}
+
+func TestDeletingTheLastObjectRemovesItsDirectories(t *testing.T) {
+	t.Parallel()
+	b, root := newBucketForTest(t, gcs.NonHierarchical)
+	_, err := storageutil.CreateObject(context.Background(), b, "a/b/c", nil)
+	require.NoError(t, err)
+
+	err = b.DeleteObject(context.Background(), &gcs.DeleteObjectRequest{Name: "a/b/c"})
+
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(root, "a"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFoldersAreDirectories(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b, root := newBucketForTest(t, gcs.Hierarchical)
+	_, err := b.CreateFolder(ctx, "a/b/")
+	require.NoError(t, err)
+	_, err = storageutil.CreateObject(ctx, b, "a/b/c", []byte("taco"))
+	require.NoError(t, err)
+
+	_, err = b.RenameFolder(ctx, "a/b/", "x/")
+	require.NoError(t, err)
+
+	_, err = b.GetFolder(ctx, "a/b/")
+	assert.IsType(t, &gcs.NotFoundError{}, err)
+	f, err := b.GetFolder(ctx, "x/")
+	require.NoError(t, err)
+	assert.Equal(t, "x/", f.Name)
+	contents, err := os.ReadFile(filepath.Join(root, "x", "c"))
+	require.NoError(t, err)
+	assert.Equal(t, "taco", string(contents))
+	// Folders stay put when emptied, and are listed as runs.
+	_, runs := listNames(t, b, &gcs.ListObjectsRequest{Delimiter: "/"})
+	assert.Equal(t, []string{"a/", "x/"}, runs)
+	assert.Error(t, b.DeleteFolder(ctx, "x/"))
+	require.NoError(t, b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: "x/c"}))
+	assert.NoError(t, b.DeleteFolder(ctx, "x/"))
+	_, err = os.Stat(filepath.Join(root, "x"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestChunkWriter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b, _ := newBucketForTest(t, gcs.NonHierarchical)
+	w, err := b.CreateObjectChunkWriter(ctx, &gcs.CreateObjectRequest{Name: "foo"}, 0, nil)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("taco"))
+	require.NoError(t, err)
+
+	o, err := b.FinalizeUpload(ctx, w)
+
+	require.NoError(t, err)
+	assert.Equal(t, "foo", o.Name)
+	assert.EqualValues(t, len("taco"), o.Size)
+	contents, err := storageutil.ReadObject(ctx, b, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "taco", string(contents))
+}
+
+func TestFileNamedLikeAFolderStaysBehind(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b, _ := newBucketForTest(t, gcs.Hierarchical)
+	_, err := b.CreateFolder(ctx, "a/")
+	require.NoError(t, err)
+	_, err = storageutil.CreateObject(ctx, b, "a", []byte("taco"))
+	require.NoError(t, err)
+
+	_, err = b.RenameFolder(ctx, "a/", "b/")
+	require.NoError(t, err)
+	require.NoError(t, b.DeleteFolder(ctx, "b/"))
+
+	contents, err := storageutil.ReadObject(ctx, b, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "taco", string(contents))
+	objects, runs := listNames(t, b, &gcs.ListObjectsRequest{Delimiter: "/"})
+	assert.Equal(t, []string{"a"}, objects)
+	assert.Empty(t, runs)
+}
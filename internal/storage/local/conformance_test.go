@@ -0,0 +1,66 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	gcstesting "github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake/testing"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+// The directory under which the conformance tests' buckets are rooted, and
+// the root of the latest bucket.
+var conformanceRoot string
+var lastBucketRoot string
+
+func TestConformance(t *testing.T) {
+	conformanceRoot = t.TempDir()
+	ogletest.RunTests(t)
+}
+
+func init() {
+	makeDeps := func(ctx context.Context) (deps gcstesting.BucketTestDeps) {
+		// Set up a fixed, non-zero time. The bucket reports times in UTC, as
+		// GCS does.
+		clock := &timeutil.SimulatedClock{}
+		clock.SetTime(time.Date(2012, 8, 15, 22, 56, 0, 0, time.UTC))
+		deps.Clock = clock
+
+		// Set up the bucket in a directory of its own, removing the previous
+		// test's, since there's no hook for tearing it down.
+		if err := os.RemoveAll(lastBucketRoot); err != nil {
+			panic(err)
+		}
+
+		root, err := os.MkdirTemp(conformanceRoot, "bucket")
+		if err != nil {
+			panic(err)
+		}
+		lastBucketRoot = root
+
+		deps.Bucket = NewBucket(clock, root, "some_bucket", gcs.NonHierarchical)
+		deps.LimitInterestingNames = true
+
+		return
+	}
+
+	gcstesting.RegisterBucketTests(makeDeps)
+}
@@ -0,0 +1,381 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+)
+
+// errStopWalk ends a walk early without error.
+var errStopWalk = errors.New("stop walk")
+
+// An entry of a directory in the tree, under the component of object names
+// it stands for.
+type dirEntry struct {
+	name   string
+	fsName string
+	isDir  bool
+}
+
+// Return the part of object names the entry accounts for. Sorting entries by
+// key orders the object names below them too, since every name below a
+// directory starts with its key.
+func (e dirEntry) key() string {
+	if e.isDir {
+		return e.name + "/"
+	}
+
+	return e.name
+}
+
+// Return the name behind an entry made with longPrefix, or false if it can't
+// be found.
+func longName(dir string, fsName string, isDir bool) (name string, ok bool) {
+	if isDir {
+		data, err := os.ReadFile(filepath.Join(dir, fsName, dirNameFile))
+		return string(data), err == nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, metaPrefix+fsName))
+	if err != nil {
+		return
+	}
+
+	var m objectMeta
+	if json.Unmarshal(data, &m) != nil || m.LongName == "" {
+		return
+	}
+
+	return m.LongName, true
+}
+
+// Return the entries of the directory that stand for objects or directories
+// of the bucket, sorted by key. Files the bucket keeps for itself, and names
+// it didn't produce, are left out.
+func readDir(dir string) (entries []dirEntry, err error) {
+	fsEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, fe := range fsEntries {
+		e := dirEntry{fsName: fe.Name(), isDir: fe.IsDir()}
+
+		// Follow symlinks, so that trees can be pieced together from elsewhere.
+		if fe.Type()&os.ModeSymlink != 0 {
+			fi, statErr := os.Stat(filepath.Join(dir, e.fsName))
+			if statErr != nil {
+				continue
+			}
+
+			e.isDir = fi.IsDir()
+		}
+
+		var ok bool
+		switch {
+		case strings.HasPrefix(e.fsName, longPrefix):
+			e.name, ok = longName(dir, e.fsName, e.isDir)
+		case strings.HasPrefix(e.fsName, reservedPrefix):
+			ok = false
+		default:
+			e.name, ok = decodeComponent(e.fsName)
+		}
+
+		if !ok {
+			continue
+		}
+
+		entries = append(entries, e)
+
+		// A directory may also hold the file named like it.
+		if e.isDir {
+			if _, statErr := os.Stat(filepath.Join(dir, e.fsName, selfName)); statErr == nil {
+				entries = append(entries, dirEntry{name: e.name, fsName: e.fsName})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key() < entries[j].key()
+	})
+
+	return
+}
+
+// Does the directory hold any object, however deep?
+func hasObjects(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, dirMetaName)); err == nil {
+		return true
+	}
+
+	entries, err := readDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, e := range entries {
+		if !e.isDir || hasObjects(filepath.Join(dir, e.fsName)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A single result of a listing: an object, a collapsed run, or both when the
+// object's name ends with the delimiter.
+type listItem struct {
+	name string
+	obj  *gcs.MinObject
+	run  bool
+}
+
+// A walk over the objects of the tree whose names start with prefix and are
+// no less than start, in increasing order.
+type walk struct {
+	b      *bucket
+	prefix string
+	start  string
+
+	// Collapse directories into runs, for listings with the delimiter "/".
+	collapse                 bool
+	includeTrailingDelimiter bool
+
+	visit func(item listItem) error
+}
+
+// LOCKS_REQUIRED(w.b.mu)
+func (w *walk) object(name string) (obj *gcs.MinObject, err error) {
+	m, err := w.b.statLocked(name)
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	obj = storageutil.ConvertObjToMinObject(m.object(w.b, name))
+	return
+}
+
+// Walk the directory standing for the given prefix of object names.
+//
+// LOCKS_REQUIRED(w.b.mu)
+func (w *walk) dir(dir string, base string) (err error) {
+	entries, err := readDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		full := base + e.key()
+
+		// Skip entries outside of the prefix, stopping once past it.
+		if !strings.HasPrefix(full, w.prefix) && !strings.HasPrefix(w.prefix, full) {
+			if full > w.prefix {
+				return
+			}
+
+			continue
+		}
+
+		if !e.isDir {
+			if full < w.start {
+				continue
+			}
+
+			var obj *gcs.MinObject
+			if obj, err = w.object(full); err != nil {
+				return
+			}
+
+			if obj != nil {
+				if err = w.visit(listItem{name: full, obj: obj}); err != nil {
+					return
+				}
+			}
+
+			continue
+		}
+
+		// Skip directories whose objects all come before the start.
+		if full < w.start && !strings.HasPrefix(w.start, full) {
+			continue
+		}
+
+		p := filepath.Join(dir, e.fsName)
+
+		// Directories below the prefix collapse into runs. In a hierarchical
+		// bucket, each is a folder and so is listed even if empty.
+		if w.collapse && len(full) > len(w.prefix) {
+			if full < w.start {
+				continue
+			}
+
+			if w.b.bucketType != gcs.Hierarchical && !hasObjects(p) {
+				continue
+			}
+
+			item := listItem{name: full, run: true}
+			if w.includeTrailingDelimiter && w.b.bucketType != gcs.Hierarchical {
+				if item.obj, err = w.object(full); err != nil {
+					return
+				}
+			}
+
+			if err = w.visit(item); err != nil {
+				return
+			}
+
+			continue
+		}
+
+		// Otherwise the directory's placeholder object, if any, comes first.
+		if strings.HasPrefix(full, w.prefix) && full >= w.start {
+			var obj *gcs.MinObject
+			if obj, err = w.object(full); err != nil {
+				return
+			}
+
+			if obj != nil {
+				if err = w.visit(listItem{name: full, obj: obj}); err != nil {
+					return
+				}
+			}
+		}
+
+		if err = w.dir(p, full); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Serve a listing. Listings always show the live generation of each object
+// only, since no others are kept.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) listLocked(req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	if _, err = os.Stat(b.root); err != nil {
+		err = fmt.Errorf("bucket %q doesn't exist: %w", b.name, err)
+		return
+	}
+
+	// Handle defaults.
+	maxResults := req.MaxResults
+	if maxResults == 0 {
+		maxResults = 1000
+	}
+
+	// Find where in the space of object names to start.
+	start := max(req.Prefix, req.StartOffset)
+	if req.ContinuationToken > start {
+		start = req.ContinuationToken
+	}
+
+	// Gather one more result than requested, to find the continuation token.
+	var items []listItem
+	var next string
+	add := func(item listItem) error {
+		// The walk visits names in order, so the first one past the end offset
+		// ends the listing.
+		if req.EndOffset != "" && item.name >= req.EndOffset {
+			return errStopWalk
+		}
+
+		if n := len(items); n > 0 && items[n-1].name == item.name {
+			if items[n-1].obj == nil {
+				items[n-1].obj = item.obj
+			}
+			return nil
+		}
+
+		if len(items) == maxResults {
+			next = item.name
+			return errStopWalk
+		}
+
+		items = append(items, item)
+		return nil
+	}
+
+	w := &walk{
+		b:                        b,
+		prefix:                   req.Prefix,
+		start:                    start,
+		collapse:                 req.Delimiter == "/",
+		includeTrailingDelimiter: req.IncludeTrailingDelimiter,
+		visit:                    add,
+	}
+
+	// Other delimiters are applied to the objects as they come, as in GCS.
+	if req.Delimiter != "" && req.Delimiter != "/" {
+		w.visit = func(item listItem) error {
+			rest := item.name[len(req.Prefix):]
+			delimiterIndex := strings.Index(rest, req.Delimiter)
+			if delimiterIndex < 0 {
+				return add(item)
+			}
+
+			run := listItem{
+				name: item.name[:len(req.Prefix)+delimiterIndex+len(req.Delimiter)],
+				run:  true,
+			}
+
+			isTrailingDelimiter := delimiterIndex == len(rest)-len(req.Delimiter)
+			if isTrailingDelimiter && req.IncludeTrailingDelimiter {
+				run.obj = item.obj
+			}
+
+			return add(run)
+		}
+	}
+
+	err = w.dir(b.root, "")
+	if errors.Is(err, errStopWalk) {
+		err = nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("listing %q: %w", b.name, err)
+		return
+	}
+
+	listing = &gcs.Listing{ContinuationToken: next}
+	for _, item := range items {
+		if item.run {
+			listing.CollapsedRuns = append(listing.CollapsedRuns, item.name)
+		}
+
+		if item.obj != nil {
+			listing.MinObjects = append(listing.MinObjects, item.obj)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Object names map onto paths under the bucket's root directory one
+// "/"-separated component at a time, so that a plain tree of files reads as
+// a bucket and vice versa. Everything the bucket keeps for itself lives in
+// entries whose names start with reservedPrefix:
+//
+//   - metaPrefix + <file>: the attributes of the object stored in <file>.
+//   - dirMetaName, inside a directory: the attributes of the placeholder
+//     object named after the directory, if there is one.
+//   - selfName, inside a directory: the file of the object named like the
+//     directory, less the trailing "/", since both can't have the same path.
+//   - longPrefix + <hash>: a file or directory whose name component is too
+//     long to be stored as is. A file's original name is kept in its
+//     attributes, a directory's in dirNameFile inside it.
+//   - tmpPrefix + <random>: contents being written, in the root.
+const (
+	reservedPrefix = ".gcsfuse-local."
+	metaPrefix     = reservedPrefix + "meta."
+	dirMetaName    = reservedPrefix + "dir"
+	dirNameFile    = reservedPrefix + "name"
+	selfName       = reservedPrefix + "self"
+	longPrefix     = reservedPrefix + "long."
+	tmpPrefix      = reservedPrefix + "tmp."
+
+	// The longest encoded component that is stored under its own name, leaving
+	// room for metaPrefix within the usual 255 byte limit on file names.
+	maxEncodedLen = 255 - len(metaPrefix)
+)
+
+func checkName(name string) (err error) {
+	if len(name) == 0 || len(name) > 1024 {
+		err = errors.New("invalid object name: length must be in [1, 1024]")
+		return
+	}
+
+	if !utf8.ValidString(name) {
+		err = errors.New("invalid object name: not valid UTF-8")
+		return
+	}
+
+	for _, r := range name {
+		if r == 0x0a || r == 0x0d {
+			err = errors.New("invalid object name: must not contain CR or LF")
+			return
+		}
+	}
+
+	return
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// Is there an escape sequence at s[i]?
+func isEscape(s string, i int) bool {
+	return s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2])
+}
+
+// Return the name under which the given component of an object name is
+// stored. Names that a file system can't hold as is are escaped with %XX
+// sequences: the empty component becomes "%", "." and ".." are escaped
+// entirely, and NUL bytes, a leading dot before reservedPrefix and any "%"
+// that would otherwise read as an escape are escaped individually. Components
+// that are still too long are replaced with a hash.
+func encodeComponent(c string) string {
+	switch c {
+	case "":
+		return "%"
+	case "%":
+		return "%25"
+	case ".", "..":
+		return strings.Repeat("%2E", len(c))
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(c); i++ {
+		switch {
+		case c[i] == 0,
+			isEscape(c, i),
+			i == 0 && strings.HasPrefix(c, reservedPrefix):
+			fmt.Fprintf(&b, "%%%02X", c[i])
+		default:
+			b.WriteByte(c[i])
+		}
+	}
+
+	e := b.String()
+	if len(e) > maxEncodedLen {
+		sum := sha256.Sum256([]byte(c))
+		e = longPrefix + hex.EncodeToString(sum[:])
+	}
+
+	return e
+}
+
+// Return the component of an object name stored under the given name, or
+// false if the name isn't one that encodeComponent produces. Names made with
+// longPrefix must be resolved by the caller.
+func decodeComponent(e string) (c string, ok bool) {
+	if e == "%" {
+		return "", true
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(e); i++ {
+		if isEscape(e, i) {
+			v, _ := hex.DecodeString(e[i+1 : i+3])
+			b.WriteByte(v[0])
+			i += 2
+			continue
+		}
+
+		b.WriteByte(e[i])
+	}
+
+	c = b.String()
+	ok = encodeComponent(c) == e
+	return
+}
+
+// Split an object name into the components of the directory holding it and
+// the component naming it within that directory. Placeholder objects, whose
+// names end in "/", are held by the directory they are named after and have
+// an empty leaf.
+func splitName(name string) (dir []string, leaf string) {
+	comps := strings.Split(name, "/")
+	return comps[:len(comps)-1], comps[len(comps)-1]
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"io"
+
+	"cloud.google.com/go/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+)
+
+// objectWriter streams the contents of a new object to the bucket's tree.
+// The object is created when the writer is closed.
+type objectWriter struct {
+	pw    *io.PipeWriter
+	done  chan struct{}
+	attrs storage.ObjectAttrs
+
+	// Set once done is closed.
+	object *gcs.MinObject
+	err    error
+}
+
+func newObjectWriter(b *bucket, req *gcs.CreateObjectRequest) (w gcs.Writer, err error) {
+	// Check that the name is legal.
+	if err = checkName(req.Name); err != nil {
+		return
+	}
+
+	pr, pw := io.Pipe()
+	ow := &objectWriter{
+		pw:   pw,
+		done: make(chan struct{}),
+		attrs: storage.ObjectAttrs{
+			Name:        req.Name,
+			ContentType: req.ContentType,
+		},
+	}
+
+	go func() {
+		defer close(ow.done)
+
+		o, err := b.create(req, pr, metaForCreate(req), false)
+		pr.CloseWithError(err)
+		if err != nil {
+			ow.err = err
+			return
+		}
+
+		ow.object = storageutil.ConvertObjToMinObject(o)
+		ow.attrs.Generation = o.Generation
+		ow.attrs.Metageneration = o.MetaGeneration
+		ow.attrs.Size = int64(o.Size)
+		ow.attrs.Updated = o.Updated
+	}()
+
+	w = ow
+	return
+}
+
+func (w *objectWriter) Write(p []byte) (n int, err error) {
+	return w.pw.Write(p)
+}
+
+func (w *objectWriter) Close() error {
+	w.pw.Close()
+	<-w.done
+	return w.err
+}
+
+func (w *objectWriter) ObjectName() string {
+	return w.attrs.Name
+}
+
+func (w *objectWriter) Attrs() *storage.ObjectAttrs {
+	return &w.attrs
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/local"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+// The scheme of custom endpoints naming a local directory instead of a
+// server. Each subdirectory of the directory is a bucket.
+const localEndpointScheme = "file"
+
+// localStorage serves buckets from subdirectories of a local directory,
+// for development and testing without access to GCS.
+type localStorage struct {
+	root       string
+	bucketType gcs.BucketType
+}
+
+// Return the directory named by the custom endpoint, or false if it names a
+// server.
+func localEndpointRoot(endpoint string) (root string, ok bool) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != localEndpointScheme {
+		return
+	}
+
+	return u.Path, true
+}
+
+func newLocalStorageHandle(root string, enableHNS bool) (sh StorageHandle, err error) {
+	fi, err := os.Stat(root)
+	if err != nil {
+		err = fmt.Errorf("local storage directory: %w", err)
+		return
+	}
+
+	if !fi.IsDir() {
+		err = fmt.Errorf("local storage directory %q is not a directory", root)
+		return
+	}
+
+	bucketType := gcs.NonHierarchical
+	if enableHNS {
+		bucketType = gcs.Hierarchical
+	}
+
+	sh = &localStorage{root: root, bucketType: bucketType}
+	return
+}
+
+// The billing project has no meaning for local buckets and is ignored.
+func (sh *localStorage) BucketHandle(ctx context.Context, bucketName string, billingProject string) gcs.Bucket {
+	return local.NewBucket(timeutil.RealClock(), filepath.Join(sh.root, bucketName), bucketName, sh.bucketType)
+}
+
+// The project has no meaning for local buckets; all of them are listed.
+func (sh *localStorage) ListBuckets(ctx context.Context, projectID string) (names []string, err error) {
+	entries, err := os.ReadDir(sh.root)
+	if err != nil {
+		err = fmt.Errorf("error in listing local buckets: %w", err)
+		return
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+
+	return
+}
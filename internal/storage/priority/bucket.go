@@ -0,0 +1,217 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// NewSchedulingBucket wraps the supplied bucket in a layer that lets at most
+// maxInFlight requests through at once, and when requests have to wait, lets
+// them through by the class they were made with (see WithClass), reads a user
+// is waiting on first. Requests of the background classes only ever get a
+// share of the slots.
+//
+// Readers of the background classes hold their slot until closed, so that a
+// large cache fill counts against the limit for as long as it downloads.
+// Other readers give it back once open, as they may sit idle on an open file.
+func NewSchedulingBucket(wrapped gcs.Bucket, maxInFlight int) (b gcs.Bucket) {
+	b = &schedulingBucket{
+		wrapped:   wrapped,
+		scheduler: newScheduler(maxInFlight),
+	}
+
+	return
+}
+
+type schedulingBucket struct {
+	wrapped   gcs.Bucket
+	scheduler *scheduler
+}
+
+// Make the call once the scheduler lets it through.
+func scheduled[T any](
+	ctx context.Context,
+	b *schedulingBucket,
+	method string,
+	call func() (T, error)) (v T, err error) {
+	c := classOf(ctx, method)
+	if err = b.scheduler.acquire(ctx, c); err != nil {
+		return
+	}
+
+	defer b.scheduler.release(c)
+	v, err = call()
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Reader
+////////////////////////////////////////////////////////////////////////
+
+// Gives back the slot of a background read once closed.
+type scheduledReader struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (r *scheduledReader) Close() (err error) {
+	err = r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Bucket interface
+////////////////////////////////////////////////////////////////////////
+
+func (b *schedulingBucket) Name() string {
+	return b.wrapped.Name()
+}
+
+func (b *schedulingBucket) BucketType() gcs.BucketType {
+	return b.wrapped.BucketType()
+}
+
+func (b *schedulingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	c := classOf(ctx, "NewReader")
+	if c < Background {
+		return scheduled(ctx, b, "NewReader", func() (io.ReadCloser, error) {
+			return b.wrapped.NewReader(ctx, req)
+		})
+	}
+
+	if err = b.scheduler.acquire(ctx, c); err != nil {
+		return
+	}
+
+	rc, err = b.wrapped.NewReader(ctx, req)
+	if err != nil {
+		b.scheduler.release(c)
+		return
+	}
+
+	rc = &scheduledReader{ReadCloser: rc, release: func() { b.scheduler.release(c) }}
+	return
+}
+
+func (b *schedulingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	return scheduled(ctx, b, "CreateObject", func() (*gcs.Object, error) {
+		return b.wrapped.CreateObject(ctx, req)
+	})
+}
+
+func (b *schedulingBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	return scheduled(ctx, b, "CreateObjectChunkWriter", func() (gcs.Writer, error) {
+		return b.wrapped.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+	})
+}
+
+func (b *schedulingBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (*gcs.MinObject, error) {
+	// Like throttledBucket, don't hold up the upload of data already written.
+	return b.wrapped.FinalizeUpload(ctx, w)
+}
+
+func (b *schedulingBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	return scheduled(ctx, b, "CopyObject", func() (*gcs.Object, error) {
+		return b.wrapped.CopyObject(ctx, req)
+	})
+}
+
+func (b *schedulingBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	return scheduled(ctx, b, "ComposeObjects", func() (*gcs.Object, error) {
+		return b.wrapped.ComposeObjects(ctx, req)
+	})
+}
+
+type statResult struct {
+	m *gcs.MinObject
+	e *gcs.ExtendedObjectAttributes
+}
+
+func (b *schedulingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	res, err := scheduled(ctx, b, "StatObject", func() (res statResult, err error) {
+		res.m, res.e, err = b.wrapped.StatObject(ctx, req)
+		return
+	})
+
+	m, e = res.m, res.e
+	return
+}
+
+func (b *schedulingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	return scheduled(ctx, b, "ListObjects", func() (*gcs.Listing, error) {
+		return b.wrapped.ListObjects(ctx, req)
+	})
+}
+
+func (b *schedulingBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	return scheduled(ctx, b, "UpdateObject", func() (*gcs.Object, error) {
+		return b.wrapped.UpdateObject(ctx, req)
+	})
+}
+
+func (b *schedulingBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) error {
+	_, err := scheduled(ctx, b, "DeleteObject", func() (struct{}, error) {
+		return struct{}{}, b.wrapped.DeleteObject(ctx, req)
+	})
+	return err
+}
+
+func (b *schedulingBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	_, err := scheduled(ctx, b, "DeleteFolder", func() (struct{}, error) {
+		return struct{}{}, b.wrapped.DeleteFolder(ctx, folderName)
+	})
+	return err
+}
+
+func (b *schedulingBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return scheduled(ctx, b, "GetFolder", func() (*gcs.Folder, error) {
+		return b.wrapped.GetFolder(ctx, folderName)
+	})
+}
+
+func (b *schedulingBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return scheduled(ctx, b, "CreateFolder", func() (*gcs.Folder, error) {
+		return b.wrapped.CreateFolder(ctx, folderName)
+	})
+}
+
+func (b *schedulingBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	return scheduled(ctx, b, "RenameFolder", func() (*gcs.Folder, error) {
+		return b.wrapped.RenameFolder(ctx, folderName, destinationFolderId)
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/priority"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Return a scheduling bucket allowing one request in flight, holding "foo".
+func newBucket(t *testing.T) gcs.Bucket {
+	t.Helper()
+	wrapped := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	_, err := wrapped.CreateObject(context.Background(), &gcs.CreateObjectRequest{Name: "foo", Contents: strings.NewReader("0123456789")})
+	require.NoError(t, err)
+
+	return priority.NewSchedulingBucket(wrapped, 1)
+}
+
+func stat(b gcs.Bucket, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, _, err := b.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+	return err
+}
+
+func TestInteractiveReaderGivesBackSlotOnceOpen(t *testing.T) {
+	b := newBucket(t)
+	rc, err := b.NewReader(context.Background(), &gcs.ReadObjectRequest{Name: "foo"})
+	require.NoError(t, err)
+	defer rc.Close()
+
+	assert.NoError(t, stat(b, time.Second))
+}
+
+func TestBackgroundReaderHoldsSlotUntilClosed(t *testing.T) {
+	b := newBucket(t)
+	ctx := priority.WithClass(context.Background(), priority.Background)
+	rc, err := b.NewReader(ctx, &gcs.ReadObjectRequest{Name: "foo"})
+	require.NoError(t, err)
+	contents, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(contents))
+
+	assert.ErrorIs(t, stat(b, 10*time.Millisecond), context.DeadlineExceeded)
+	require.NoError(t, rc.Close())
+	require.NoError(t, rc.Close())
+	assert.NoError(t, stat(b, time.Second))
+}
+
+func TestFailedBackgroundReadGivesBackSlot(t *testing.T) {
+	b := newBucket(t)
+	ctx := priority.WithClass(context.Background(), priority.Background)
+
+	_, err := b.NewReader(ctx, &gcs.ReadObjectRequest{Name: "bar"})
+
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t, err, &notFoundErr)
+	assert.NoError(t, stat(b, time.Second))
+}
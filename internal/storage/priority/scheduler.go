@@ -0,0 +1,196 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package priority schedules the requests made to a bucket by the class of
+// work they are for, so that background traffic such as file cache fills and
+// garbage collection doesn't starve the requests a user is waiting on.
+package priority
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Class is the class of work a request is for. Lower classes are scheduled
+// first.
+type Class int
+
+const (
+	// Reads a user is waiting on.
+	Interactive Class = iota
+
+	// Stats, listings and modifications a user is waiting on.
+	Metadata
+
+	// Downloads to the file cache.
+	Background
+
+	// Garbage collection of temporary objects and the trash.
+	GC
+
+	numClasses
+)
+
+func (c Class) String() string {
+	switch c {
+	case Interactive:
+		return "interactive"
+	case Metadata:
+		return "metadata"
+	case Background:
+		return "background"
+	case GC:
+		return "gc"
+	}
+
+	return "unknown"
+}
+
+type classKey struct{}
+
+// WithClass returns a context whose requests are scheduled as the given
+// class.
+func WithClass(ctx context.Context, c Class) context.Context {
+	return context.WithValue(ctx, classKey{}, c)
+}
+
+// Return the class of a request made with the context, defaulting to one a
+// user is waiting on.
+func classOf(ctx context.Context, method string) Class {
+	if c, ok := ctx.Value(classKey{}).(Class); ok {
+		return c
+	}
+
+	if method == "NewReader" {
+		return Interactive
+	}
+
+	return Metadata
+}
+
+// Return the most requests of each class allowed in flight at once, out of
+// max. Background classes get only a share, so that a user's requests always
+// find a free slot soon.
+func classLimits(max int) (limits [numClasses]int) {
+	limits[Interactive] = max
+	limits[Metadata] = max
+	limits[Background] = (max + 1) / 2
+	limits[GC] = (max + 3) / 4
+	return
+}
+
+// A limit on the requests in flight, which are admitted strictly by class
+// when they have to wait, and first come first served within a class.
+//
+// Safe for concurrent access.
+type scheduler struct {
+	max    int
+	limits [numClasses]int
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	inFlight int
+	byClass  [numClasses]int
+	queues   [numClasses][]*waiter
+}
+
+type waiter struct {
+	// Closed once admitted is set.
+	ready    chan struct{}
+	admitted bool
+}
+
+func newScheduler(max int) *scheduler {
+	return &scheduler{max: max, limits: classLimits(max)}
+}
+
+// Wait until a request of the class may be sent, or the context is
+// cancelled. If admitted, release must be called once the request is done.
+//
+// LOCKS_EXCLUDED(s.mu)
+func (s *scheduler) acquire(ctx context.Context, c Class) error {
+	w := &waiter{ready: make(chan struct{})}
+	s.mu.Lock()
+	s.queues[c] = append(s.queues[c], w)
+	s.dispatch()
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// Give back a slot handed over just as the request gave up.
+		if w.admitted {
+			s.releaseLocked(c)
+		} else {
+			s.queues[c] = slices.DeleteFunc(s.queues[c], func(q *waiter) bool { return q == w })
+		}
+
+		return ctx.Err()
+	}
+}
+
+// LOCKS_EXCLUDED(s.mu)
+func (s *scheduler) release(c Class) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releaseLocked(c)
+}
+
+// LOCKS_REQUIRED(s.mu)
+func (s *scheduler) releaseLocked(c Class) {
+	s.inFlight--
+	s.byClass[c]--
+	s.dispatch()
+}
+
+// Admit waiting requests while there are free slots, the lowest class first.
+//
+// LOCKS_REQUIRED(s.mu)
+func (s *scheduler) dispatch() {
+	for s.inFlight < s.max {
+		c, ok := s.next()
+		if !ok {
+			return
+		}
+
+		w := s.queues[c][0]
+		s.queues[c] = s.queues[c][1:]
+		w.admitted = true
+		s.inFlight++
+		s.byClass[c]++
+		close(w.ready)
+	}
+}
+
+// Return the lowest class with a request waiting that may be admitted.
+//
+// LOCKS_REQUIRED(s.mu)
+func (s *scheduler) next() (c Class, ok bool) {
+	for c = range numClasses {
+		if len(s.queues[c]) > 0 && s.byClass[c] < s.limits[c] {
+			ok = true
+			return
+		}
+	}
+
+	return
+}
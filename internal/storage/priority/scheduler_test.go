@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Acquire a slot of the class in the background, returning a channel that
+// receives the class once it's admitted.
+func acquireAsync(t *testing.T, s *scheduler, c Class, admitted chan Class) {
+	t.Helper()
+	go func() {
+		assert.NoError(t, s.acquire(context.Background(), c))
+		admitted <- c
+	}()
+
+	// Wait until it's queued, so that the order of arrival is known.
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.queues[c]) > 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestClassOf(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Equal(t, Interactive, classOf(ctx, "NewReader"))
+	assert.Equal(t, Metadata, classOf(ctx, "StatObject"))
+	assert.Equal(t, Background, classOf(WithClass(ctx, Background), "NewReader"))
+	assert.Equal(t, GC, classOf(WithClass(ctx, GC), "DeleteObject"))
+}
+
+func TestClassLimits(t *testing.T) {
+	assert.Equal(t, [numClasses]int{1, 1, 1, 1}, classLimits(1))
+	assert.Equal(t, [numClasses]int{16, 16, 8, 4}, classLimits(16))
+}
+
+func TestAdmitsWaitingRequestsByClass(t *testing.T) {
+	s := newScheduler(1)
+	require.NoError(t, s.acquire(context.Background(), Metadata))
+	admitted := make(chan Class)
+	for _, c := range []Class{GC, Background, Metadata, Interactive} {
+		acquireAsync(t, s, c, admitted)
+	}
+
+	var order []Class
+	held := Metadata
+	for range numClasses {
+		s.release(held)
+		held = <-admitted
+		order = append(order, held)
+	}
+
+	assert.Equal(t, []Class{Interactive, Metadata, Background, GC}, order)
+}
+
+func TestLimitsBackgroundClassesToAShare(t *testing.T) {
+	s := newScheduler(4)
+	for range 2 {
+		require.NoError(t, s.acquire(context.Background(), Background))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, s.acquire(ctx, Background), context.DeadlineExceeded)
+	assert.NoError(t, s.acquire(context.Background(), Interactive))
+	assert.NoError(t, s.acquire(context.Background(), GC))
+}
+
+func TestCancelledRequestLeavesTheQueue(t *testing.T) {
+	s := newScheduler(1)
+	require.NoError(t, s.acquire(context.Background(), Metadata))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, s.acquire(ctx, Interactive), context.DeadlineExceeded)
+
+	s.release(Metadata)
+	assert.Empty(t, s.queues[Interactive])
+	assert.NoError(t, s.acquire(context.Background(), GC))
+}
@@ -0,0 +1,1034 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3 implements gcs.Bucket on top of an S3-compatible object store,
+// such as MinIO.
+//
+// S3 has no generation numbers, so they are made up from what both listings
+// and HEAD requests return: the modification time, to the second, plus a hash
+// of the ETag below it. Generations therefore grow with each write and stay
+// put otherwise, as in GCS. Preconditions on them are checked against the
+// ETag of the object they name, which is then sent along as If-Match, so that
+// a write racing with another fails instead of clobbering it. Since S3
+// rewrites the object to change its metadata, an update makes a new
+// generation too, unless it comes within the same second as the last write.
+//
+// What S3 has no place for, the meta-generation and the component count of
+// composed objects, is kept in user metadata under keys of the bucket's own,
+// which are not reported. Listings carry no metadata at all, so they report
+// meta-generation 1. CRC32C checksums are S3's own, which cover the whole
+// object only when it was written in one request: objects uploaded or composed
+// in parts have none, and no MD5 either.
+//
+// Composition is emulated with a multipart upload copying the sources into
+// parts, and reading in the few bytes needed wherever a source is smaller than
+// the minimum part size. User metadata keys are lower cased, as S3 doesn't
+// keep their case. There are no folders; the calls for them fail with ENOSYS.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// User metadata keys under which the bucket keeps what S3 has no place for.
+const (
+	metaGenerationKey = "gcsfuse-metageneration"
+	componentCountKey = "gcsfuse-component-count"
+)
+
+// NewBucket returns a bucket serving the S3 bucket with the given name through
+// the client, which should use path-style addressing for stores other than
+// AWS, and leave paths uncleaned so that names like "a//b" are kept.
+func NewBucket(client s3iface.S3API, name string) gcs.Bucket {
+	return &bucket{
+		client:   client,
+		uploader: s3manager.NewUploaderWithClient(client),
+		name:     name,
+	}
+}
+
+type bucket struct {
+	client   s3iface.S3API
+	uploader *s3manager.Uploader
+	name     string
+}
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+// Return the generation standing for the given version of an object.
+func generation(lastModified time.Time, etag string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(etag))
+	return lastModified.Unix()*int64(time.Second) + int64(h.Sum32()%uint32(time.Second))
+}
+
+// Check that the name is one GCS would accept.
+func checkName(name string) (err error) {
+	if len(name) == 0 || len(name) > 1024 {
+		err = errors.New("invalid object name: length must be in [1, 1024]")
+		return
+	}
+
+	if !utf8.ValidString(name) {
+		err = errors.New("invalid object name: not valid UTF-8")
+		return
+	}
+
+	for _, r := range name {
+		if r == 0x0a || r == 0x0d {
+			err = errors.New("invalid object name: must not contain CR or LF")
+			return
+		}
+	}
+
+	return
+}
+
+// Convert the error of an S3 request to the errors of package gcs, where
+// there is one for it.
+func convertErr(err error) error {
+	for e := err; e != nil; {
+		// A canceled request may fail sending or receiving, with one code or
+		// another, but the context's error is at the bottom.
+		if errors.Is(e, context.Canceled) {
+			return fmt.Errorf("request canceled: %w", err)
+		}
+
+		if reqErr, ok := e.(awserr.RequestFailure); ok {
+			switch reqErr.StatusCode() {
+			case http.StatusNotFound:
+				return &gcs.NotFoundError{Err: err}
+			case http.StatusPreconditionFailed:
+				return &gcs.PreconditionError{Err: err}
+			}
+		}
+
+		awsErr, ok := e.(awserr.Error)
+		if !ok {
+			break
+		}
+
+		e = awsErr.OrigErr()
+	}
+
+	return err
+}
+
+// Convert the error of a write made subject to the given conditions.
+func convertWriteErr(op string, err error, headers map[string]string) error {
+	err = convertErr(err)
+	var preconditionErr *gcs.PreconditionError
+	if !errors.As(err, &preconditionErr) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if headers["If-None-Match"] == "*" {
+		preconditionErr.Err = fmt.Errorf("object exists: %w", preconditionErr.Err)
+	}
+
+	return err
+}
+
+// Is the error one of S3 for the given HTTP status?
+func hasStatus(err error, status int) bool {
+	var reqErr awserr.RequestFailure
+	return errors.As(err, &reqErr) && reqErr.StatusCode() == status
+}
+
+// Return a request option setting the given headers on requests for the
+// given operations.
+func withHeaders(headers map[string]string, operations ...string) request.Option {
+	return func(r *request.Request) {
+		for _, op := range operations {
+			if r.Operation.Name != op {
+				continue
+			}
+
+			for k, v := range headers {
+				r.HTTPRequest.Header.Set(k, v)
+			}
+		}
+	}
+}
+
+// Return the value of an x-amz-copy-source header naming the given object.
+func (b *bucket) copySource(name string) string {
+	return (&url.URL{Path: b.name + "/" + name}).EscapedPath()
+}
+
+// Return S3 user metadata with lower-cased keys, which is how it comes back
+// from the store.
+func metadataOf(m map[string]*string) (metadata map[string]string) {
+	for k, v := range m {
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+
+		metadata[strings.ToLower(k)] = aws.StringValue(v)
+	}
+
+	return
+}
+
+// Return the value of an x-amz-checksum-crc32c header for the contents.
+func checksumOf(data []byte) *string {
+	sum := binary.BigEndian.AppendUint32(nil, crc32.Checksum(data, crc32cTable))
+	return aws.String(base64.StdEncoding.EncodeToString(sum))
+}
+
+// Convert the result of a HEAD request for the named object.
+func (b *bucket) objectFromHead(name string, head *awss3.HeadObjectOutput) (o *gcs.Object) {
+	lastModified := aws.TimeValue(head.LastModified).Truncate(time.Second)
+	etag := aws.StringValue(head.ETag)
+	o = &gcs.Object{
+		Name:               name,
+		ContentType:        aws.StringValue(head.ContentType),
+		ContentLanguage:    aws.StringValue(head.ContentLanguage),
+		CacheControl:       aws.StringValue(head.CacheControl),
+		Owner:              "user-s3",
+		Size:               uint64(aws.Int64Value(head.ContentLength)),
+		ContentEncoding:    aws.StringValue(head.ContentEncoding),
+		MediaLink:          "s3://localhost/download/storage/" + b.name + "/" + name,
+		Metadata:           metadataOf(head.Metadata),
+		Generation:         generation(lastModified, etag),
+		MetaGeneration:     1,
+		StorageClass:       aws.StringValue(head.StorageClass),
+		Created:            lastModified,
+		Updated:            lastModified,
+		ComponentCount:     1,
+		ContentDisposition: aws.StringValue(head.ContentDisposition),
+	}
+
+	if o.StorageClass == "" {
+		o.StorageClass = "STANDARD"
+	}
+
+	// S3 keeps a CRC32C of the whole object only when it was written in one
+	// request. Otherwise it's one of the parts' checksums, followed by their
+	// count.
+	if sum, err := base64.StdEncoding.DecodeString(aws.StringValue(head.ChecksumCRC32C)); err == nil && len(sum) == 4 {
+		crc := binary.BigEndian.Uint32(sum)
+		o.CRC32C = &crc
+	}
+
+	// The ETag of an object uploaded in parts ends with their count. Otherwise
+	// it's the MD5 of the contents, except for encrypted objects.
+	unquoted := strings.Trim(etag, `"`)
+	if i := strings.LastIndex(unquoted, "-"); i >= 0 {
+		if parts, err := strconv.ParseInt(unquoted[i+1:], 10, 64); err == nil {
+			o.ComponentCount = parts
+		}
+	} else if aws.StringValue(head.ServerSideEncryption) != awss3.ServerSideEncryptionAwsKms {
+		if sum, err := hex.DecodeString(unquoted); err == nil && len(sum) == md5.Size {
+			o.MD5 = (*[md5.Size]byte)(sum)
+		}
+	}
+
+	// Composed objects have no MD5 in GCS, whatever their ETag.
+	if v, ok := o.Metadata[componentCountKey]; ok {
+		o.ComponentCount, _ = strconv.ParseInt(v, 10, 64)
+		o.MD5 = nil
+	}
+
+	if v, ok := o.Metadata[metaGenerationKey]; ok {
+		o.MetaGeneration, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	delete(o.Metadata, componentCountKey)
+	delete(o.Metadata, metaGenerationKey)
+	if len(o.Metadata) == 0 {
+		o.Metadata = nil
+	}
+
+	return
+}
+
+// Convert an entry of a listing for the named object.
+func minObjectFromListing(name string, o *awss3.Object) *gcs.MinObject {
+	lastModified := aws.TimeValue(o.LastModified).Truncate(time.Second)
+	return &gcs.MinObject{
+		Name:           name,
+		Size:           uint64(aws.Int64Value(o.Size)),
+		Generation:     generation(lastModified, aws.StringValue(o.ETag)),
+		MetaGeneration: 1,
+		Updated:        lastModified,
+		Created:        lastModified,
+	}
+}
+
+func (b *bucket) head(ctx context.Context, name string) (head *awss3.HeadObjectOutput, err error) {
+	head, err = b.client.HeadObjectWithContext(ctx, &awss3.HeadObjectInput{
+		Bucket:       aws.String(b.name),
+		Key:          aws.String(name),
+		ChecksumMode: aws.String(awss3.ChecksumModeEnabled),
+	})
+
+	if err != nil {
+		err = convertErr(err)
+		var notFoundErr *gcs.NotFoundError
+		if !errors.As(err, &notFoundErr) {
+			err = fmt.Errorf("HeadObject: %w", err)
+		}
+	}
+
+	return
+}
+
+// Look up the given generation of the object, with zero meaning the live one.
+func (b *bucket) headGeneration(ctx context.Context, name string, gen int64) (head *awss3.HeadObjectOutput, err error) {
+	if head, err = b.head(ctx, name); err != nil {
+		return
+	}
+
+	if gen != 0 && b.objectFromHead(name, head).Generation != gen {
+		err = &gcs.NotFoundError{
+			Err: fmt.Errorf("object %s generation %v not found", name, gen),
+		}
+	}
+
+	return
+}
+
+func (b *bucket) stat(ctx context.Context, name string) (o *gcs.Object, err error) {
+	head, err := b.head(ctx, name)
+	if err != nil {
+		return
+	}
+
+	o = b.objectFromHead(name, head)
+	return
+}
+
+// Check a meta-generation precondition, if any, against the object.
+func checkMetaGeneration(o *gcs.Object, precondition *int64) (err error) {
+	if precondition != nil && *precondition != o.MetaGeneration {
+		err = &gcs.PreconditionError{
+			Err: fmt.Errorf(
+				"precondition failed: object has meta-generation %v",
+				o.MetaGeneration),
+		}
+	}
+
+	return
+}
+
+// contextReader fails reads once its context is done, rather than returning
+// what the transport has already buffered.
+type contextReader struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r *contextReader) Read(p []byte) (n int, err error) {
+	if err = r.ctx.Err(); err != nil {
+		err = fmt.Errorf("request canceled: %w", err)
+		return
+	}
+
+	return r.ReadCloser.Read(p)
+}
+
+// Check the preconditions for replacing the given object, returning the
+// headers that make the write itself conditional on them.
+func (b *bucket) writeConditions(
+	ctx context.Context,
+	name string,
+	genPrecondition *int64,
+	metaGenPrecondition *int64) (headers map[string]string, err error) {
+	if genPrecondition == nil && metaGenPrecondition == nil {
+		return
+	}
+
+	if genPrecondition != nil && *genPrecondition == 0 {
+		headers = map[string]string{"If-None-Match": "*"}
+		return
+	}
+
+	head, err := b.head(ctx, name)
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		err = &gcs.PreconditionError{
+			Err: errors.New("precondition failed: object doesn't exist"),
+		}
+
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	existing := b.objectFromHead(name, head)
+	if genPrecondition != nil && existing.Generation != *genPrecondition {
+		err = &gcs.PreconditionError{
+			Err: fmt.Errorf(
+				"precondition failed: object has generation %v",
+				existing.Generation),
+		}
+
+		return
+	}
+
+	if err = checkMetaGeneration(existing, metaGenPrecondition); err != nil {
+		return
+	}
+
+	headers = map[string]string{"If-Match": aws.StringValue(head.ETag)}
+	return
+}
+
+// Check the contents of a new object against the checksums requested, if
+// any, buffering them to do so before they are sent.
+func checkContents(req *gcs.CreateObjectRequest) (r io.Reader, err error) {
+	r = req.Contents
+	if req.CRC32C == nil && req.MD5 == nil {
+		return
+	}
+
+	data, err := io.ReadAll(req.Contents)
+	if err != nil {
+		err = fmt.Errorf("reading contents: %w", err)
+		return
+	}
+
+	if req.CRC32C != nil {
+		actual := crc32.Checksum(data, crc32cTable)
+		if actual != *req.CRC32C {
+			err = fmt.Errorf(
+				"CRC32C mismatch: got 0x%08x, expected 0x%08x",
+				actual,
+				*req.CRC32C)
+
+			return
+		}
+	}
+
+	if req.MD5 != nil {
+		actual := md5.Sum(data)
+		if actual != *req.MD5 {
+			err = fmt.Errorf(
+				"MD5 mismatch: got %s, expected %s",
+				hex.EncodeToString(actual[:]),
+				hex.EncodeToString(req.MD5[:]))
+
+			return
+		}
+	}
+
+	r = bytes.NewReader(data)
+	return
+}
+
+func uploadInput(b *bucket, req *gcs.CreateObjectRequest, body io.Reader) *s3manager.UploadInput {
+	in := &s3manager.UploadInput{
+		Bucket:   aws.String(b.name),
+		Key:      aws.String(req.Name),
+		Body:     body,
+		Metadata: aws.StringMap(req.Metadata),
+	}
+
+	if req.ContentType != "" {
+		in.ContentType = aws.String(req.ContentType)
+	}
+
+	if req.ContentLanguage != "" {
+		in.ContentLanguage = aws.String(req.ContentLanguage)
+	}
+
+	if req.ContentEncoding != "" {
+		in.ContentEncoding = aws.String(req.ContentEncoding)
+	}
+
+	if req.CacheControl != "" {
+		in.CacheControl = aws.String(req.CacheControl)
+	}
+
+	if req.ContentDisposition != "" {
+		in.ContentDisposition = aws.String(req.ContentDisposition)
+	}
+
+	return in
+}
+
+// Upload the contents of a new object, subject to the given conditions.
+//
+// Contents that fit in one part are sent in one request along with their
+// CRC32C, which the uploader would not compute. Larger ones are uploaded in
+// parts, without.
+func (b *bucket) upload(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest,
+	body io.Reader,
+	headers map[string]string) (o *gcs.Object, err error) {
+	first, err := io.ReadAll(io.LimitReader(body, minPartSize+1))
+	if err != nil {
+		err = fmt.Errorf("reading contents: %w", err)
+		return
+	}
+
+	in := uploadInput(b, req, io.MultiReader(bytes.NewReader(first), body))
+	if len(first) <= minPartSize {
+		in.Body = bytes.NewReader(first)
+		in.ChecksumCRC32C = checksumOf(first)
+	}
+
+	_, err = b.uploader.UploadWithContext(
+		ctx,
+		in,
+		s3manager.WithUploaderRequestOptions(withHeaders(headers, "PutObject", "CompleteMultipartUpload")))
+
+	if err != nil {
+		err = convertWriteErr("Upload", err, headers)
+		return
+	}
+
+	o, err = b.stat(ctx, req.Name)
+	return
+}
+
+// Return the input for copying the source object, whose attributes are
+// given, to the named destination with the same attributes and the given user
+// metadata, which replaces the source's.
+func (b *bucket) copyInput(
+	dstName string,
+	src *awss3.HeadObjectOutput,
+	metadata map[string]string) *awss3.CopyObjectInput {
+	return &awss3.CopyObjectInput{
+		Bucket:             aws.String(b.name),
+		Key:                aws.String(dstName),
+		MetadataDirective:  aws.String(awss3.MetadataDirectiveReplace),
+		ContentType:        src.ContentType,
+		ContentEncoding:    src.ContentEncoding,
+		ContentLanguage:    src.ContentLanguage,
+		CacheControl:       src.CacheControl,
+		ContentDisposition: src.ContentDisposition,
+		Metadata:           aws.StringMap(metadata),
+	}
+}
+
+// Copy the source object, whose attributes are given, into the destination
+// described by the input, subject to the given conditions.
+func (b *bucket) copyObject(
+	ctx context.Context,
+	srcName string,
+	src *awss3.HeadObjectOutput,
+	in *awss3.CopyObjectInput,
+	headers map[string]string) (err error) {
+	// Objects too large for a single copy are copied in parts.
+	if aws.Int64Value(src.ContentLength) > maxCopyPartSize {
+		mpu := &awss3.CreateMultipartUploadInput{
+			Bucket:             in.Bucket,
+			Key:                in.Key,
+			ContentType:        in.ContentType,
+			ContentLanguage:    in.ContentLanguage,
+			ContentEncoding:    in.ContentEncoding,
+			CacheControl:       in.CacheControl,
+			ContentDisposition: in.ContentDisposition,
+			Metadata:           in.Metadata,
+		}
+
+		return b.composeInParts(ctx, mpu, []source{{name: srcName, head: src}}, headers)
+	}
+
+	// Have S3 compute the CRC32C of the copy, which it keeps for the whole
+	// object.
+	in.CopySource = aws.String(b.copySource(srcName))
+	in.CopySourceIfMatch = src.ETag
+	in.ChecksumAlgorithm = aws.String(awss3.ChecksumAlgorithmCrc32c)
+	_, err = b.client.CopyObjectWithContext(ctx, in, withHeaders(headers, "CopyObject"))
+	if err != nil {
+		err = convertWriteErr("CopyObject", err, headers)
+	}
+
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// gcs.Bucket interface
+////////////////////////////////////////////////////////////////////////
+
+func (b *bucket) Name() string {
+	return b.name
+}
+
+func (b *bucket) BucketType() gcs.BucketType {
+	return gcs.NonHierarchical
+}
+
+// S3 doesn't transcode, so ReadCompressed has no effect.
+func (b *bucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	in := &awss3.GetObjectInput{
+		Bucket: aws.String(b.name),
+		Key:    aws.String(req.Name),
+	}
+
+	// Pin the read to the requested generation.
+	if req.Generation != 0 {
+		var head *awss3.HeadObjectOutput
+		if head, err = b.headGeneration(ctx, req.Name, req.Generation); err != nil {
+			return
+		}
+
+		in.IfMatch = head.ETag
+		in.VersionId = head.VersionId
+	}
+
+	if req.Range != nil {
+		if req.Range.Limit <= req.Range.Start {
+			if req.Generation == 0 {
+				if _, err = b.head(ctx, req.Name); err != nil {
+					return
+				}
+			}
+
+			rc = io.NopCloser(strings.NewReader(""))
+			return
+		}
+
+		in.Range = aws.String(fmt.Sprintf("bytes=%d-%d", req.Range.Start, req.Range.Limit-1))
+	}
+
+	out, err := b.client.GetObjectWithContext(ctx, in)
+	switch {
+	case hasStatus(err, http.StatusRequestedRangeNotSatisfiable):
+		rc = io.NopCloser(strings.NewReader(""))
+		err = nil
+
+	case hasStatus(err, http.StatusPreconditionFailed):
+		err = &gcs.NotFoundError{
+			Err: fmt.Errorf("object %s generation %v not found", req.Name, req.Generation),
+		}
+
+	case err != nil:
+		err = convertErr(err)
+		var notFoundErr *gcs.NotFoundError
+		if !errors.As(err, &notFoundErr) {
+			err = fmt.Errorf("GetObject: %w", err)
+		}
+
+	default:
+		rc = &contextReader{ctx: ctx, ReadCloser: out.Body}
+	}
+
+	return
+}
+
+func (b *bucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
+	if err = checkName(req.Name); err != nil {
+		return
+	}
+
+	headers, err := b.writeConditions(ctx, req.Name, req.GenerationPrecondition, req.MetaGenerationPrecondition)
+	if err != nil {
+		return
+	}
+
+	body, err := checkContents(req)
+	if err != nil {
+		return
+	}
+
+	o, err = b.upload(ctx, req, body, headers)
+	return
+}
+
+func (b *bucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	return newObjectWriter(ctx, b, req, callBack)
+}
+
+func (b *bucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (o *gcs.MinObject, err error) {
+	ow, ok := w.(*objectWriter)
+	if !ok {
+		return nil, fmt.Errorf("could not type assert gcs.Writer to objectWriter")
+	}
+
+	if err = ow.Close(); err != nil {
+		return
+	}
+
+	o = ow.object
+	return
+}
+
+// The copy starts over at meta-generation 1.
+func (b *bucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (o *gcs.Object, err error) {
+	if err = checkName(req.DstName); err != nil {
+		return
+	}
+
+	src, err := b.headGeneration(ctx, req.SrcName, req.SrcGeneration)
+	if err != nil {
+		return
+	}
+
+	if err = checkMetaGeneration(b.objectFromHead(req.SrcName, src), req.SrcMetaGenerationPrecondition); err != nil {
+		return
+	}
+
+	headers, err := b.writeConditions(ctx, req.DstName, req.DstGenerationPrecondition, nil)
+	if err != nil {
+		return
+	}
+
+	metadata := metadataOf(src.Metadata)
+	delete(metadata, metaGenerationKey)
+	in := b.copyInput(req.DstName, src, metadata)
+	if err = b.copyObject(ctx, req.SrcName, src, in, headers); err != nil {
+		return
+	}
+
+	o, err = b.stat(ctx, req.DstName)
+	return
+}
+
+func (b *bucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
+	if len(req.Sources) == 0 {
+		err = errors.New("you must provide at least one source component")
+		return
+	}
+
+	if len(req.Sources) > gcs.MaxSourcesPerComposeRequest {
+		err = errors.New("you have provided too many source components")
+		return
+	}
+
+	if err = checkName(req.DstName); err != nil {
+		return
+	}
+
+	sources := make([]source, len(req.Sources))
+	var componentCount int64
+	for i, s := range req.Sources {
+		sources[i].name = s.Name
+		if sources[i].head, err = b.headGeneration(ctx, s.Name, s.Generation); err != nil {
+			return
+		}
+
+		componentCount += b.objectFromHead(s.Name, sources[i].head).ComponentCount
+	}
+
+	if componentCount > gcs.MaxComponentCount {
+		err = fmt.Errorf("too many components: %v", componentCount)
+		return
+	}
+
+	headers, err := b.writeConditions(ctx, req.DstName, req.DstGenerationPrecondition, req.DstMetaGenerationPrecondition)
+	if err != nil {
+		return
+	}
+
+	metadata := make(map[string]string)
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+
+	metadata[componentCountKey] = strconv.FormatInt(componentCount, 10)
+
+	mpu := &awss3.CreateMultipartUploadInput{
+		Bucket:   aws.String(b.name),
+		Key:      aws.String(req.DstName),
+		Metadata: aws.StringMap(metadata),
+	}
+
+	if req.ContentType != "" {
+		mpu.ContentType = aws.String(req.ContentType)
+	}
+
+	if req.ContentLanguage != "" {
+		mpu.ContentLanguage = aws.String(req.ContentLanguage)
+	}
+
+	if req.ContentEncoding != "" {
+		mpu.ContentEncoding = aws.String(req.ContentEncoding)
+	}
+
+	if req.CacheControl != "" {
+		mpu.CacheControl = aws.String(req.CacheControl)
+	}
+
+	if req.ContentDisposition != "" {
+		mpu.ContentDisposition = aws.String(req.ContentDisposition)
+	}
+
+	if err = b.composeInParts(ctx, mpu, sources, headers); err != nil {
+		return
+	}
+
+	o, err = b.stat(ctx, req.DstName)
+	return
+}
+
+func (b *bucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	o, err := b.stat(ctx, req.Name)
+	if err != nil {
+		return
+	}
+
+	m = storageutil.ConvertObjToMinObject(o)
+	if req.ReturnExtendedObjectAttributes {
+		e = storageutil.ConvertObjToExtendedObjectAttributes(o)
+	}
+
+	return
+}
+
+// Listings always show the live objects only, and carry no user metadata.
+// Names come back URL-encoded, as XML can't carry all of them.
+func (b *bucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	in := &awss3.ListObjectsV2Input{
+		Bucket:       aws.String(b.name),
+		Prefix:       aws.String(req.Prefix),
+		EncodingType: aws.String(awss3.EncodingTypeUrl),
+	}
+
+	if req.Delimiter != "" {
+		in.Delimiter = aws.String(req.Delimiter)
+	}
+
+	if req.ContinuationToken != "" {
+		in.ContinuationToken = aws.String(req.ContinuationToken)
+	}
+
+	if req.MaxResults != 0 {
+		in.MaxKeys = aws.Int64(int64(req.MaxResults))
+	}
+
+	out, err := b.client.ListObjectsV2WithContext(ctx, in)
+	if err != nil {
+		err = fmt.Errorf("ListObjectsV2: %w", convertErr(err))
+		return
+	}
+
+	listing = &gcs.Listing{
+		ContinuationToken: aws.StringValue(out.NextContinuationToken),
+	}
+
+	// S3 can't bound a listing by name, so the offsets are applied here. Names
+	// come back in order, so one past the end offset ends the listing.
+	inRange := func(name string) bool {
+		if req.EndOffset != "" && name >= req.EndOffset {
+			listing.ContinuationToken = ""
+			return false
+		}
+		return name >= req.StartOffset || strings.HasPrefix(req.StartOffset, name)
+	}
+
+	for _, o := range out.Contents {
+		var name string
+		if name, err = url.QueryUnescape(aws.StringValue(o.Key)); err != nil {
+			err = fmt.Errorf("decoding key %q: %w", aws.StringValue(o.Key), err)
+			return
+		}
+
+		if inRange(name) {
+			listing.MinObjects = append(listing.MinObjects, minObjectFromListing(name, o))
+		}
+	}
+
+	for _, p := range out.CommonPrefixes {
+		var run string
+		if run, err = url.QueryUnescape(aws.StringValue(p.Prefix)); err != nil {
+			err = fmt.Errorf("decoding prefix %q: %w", aws.StringValue(p.Prefix), err)
+			return
+		}
+
+		if !inRange(run) {
+			continue
+		}
+		listing.CollapsedRuns = append(listing.CollapsedRuns, run)
+
+		// S3 folds objects ending with the delimiter into the prefixes, so they
+		// have to be looked up one by one.
+		if !req.IncludeTrailingDelimiter {
+			continue
+		}
+
+		var head *awss3.HeadObjectOutput
+		head, err = b.head(ctx, run)
+		var notFoundErr *gcs.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			err = nil
+			continue
+		}
+
+		if err != nil {
+			return
+		}
+
+		listing.MinObjects = append(listing.MinObjects, storageutil.ConvertObjToMinObject(b.objectFromHead(run, head)))
+	}
+
+	return
+}
+
+func (b *bucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (o *gcs.Object, err error) {
+	head, err := b.headGeneration(ctx, req.Name, req.Generation)
+	if err != nil {
+		return
+	}
+
+	existing := b.objectFromHead(req.Name, head)
+	if err = checkMetaGeneration(existing, req.MetaGenerationPrecondition); err != nil {
+		return
+	}
+
+	// S3 only changes metadata by copying the object onto itself, replacing
+	// all of it.
+	in := b.copyInput(req.Name, head, nil)
+
+	for _, update := range []struct {
+		field **string
+		value *string
+	}{
+		{&in.ContentType, req.ContentType},
+		{&in.ContentEncoding, req.ContentEncoding},
+		{&in.ContentLanguage, req.ContentLanguage},
+		{&in.CacheControl, req.CacheControl},
+	} {
+		if update.value == nil {
+			continue
+		}
+
+		*update.field = update.value
+		if *update.value == "" {
+			*update.field = nil
+		}
+	}
+
+	for k, v := range metadataOf(head.Metadata) {
+		in.Metadata[k] = aws.String(v)
+	}
+
+	for k, v := range req.Metadata {
+		if v == nil {
+			delete(in.Metadata, strings.ToLower(k))
+			continue
+		}
+
+		in.Metadata[strings.ToLower(k)] = aws.String(*v)
+	}
+
+	in.Metadata[metaGenerationKey] = aws.String(strconv.FormatInt(existing.MetaGeneration+1, 10))
+	err = b.copyObject(ctx, req.Name, head, in, nil)
+	if err != nil {
+		return
+	}
+
+	o, err = b.stat(ctx, req.Name)
+	return
+}
+
+// Deleting an object or generation that doesn't exist succeeds, as in S3.
+func (b *bucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) (err error) {
+	var headers map[string]string
+	if req.Generation != 0 || req.MetaGenerationPrecondition != nil {
+		var head *awss3.HeadObjectOutput
+		head, err = b.headGeneration(ctx, req.Name, req.Generation)
+		var notFoundErr *gcs.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			err = nil
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		if err = checkMetaGeneration(b.objectFromHead(req.Name, head), req.MetaGenerationPrecondition); err != nil {
+			return
+		}
+
+		headers = map[string]string{"If-Match": aws.StringValue(head.ETag)}
+	}
+
+	_, err = b.client.DeleteObjectWithContext(
+		ctx,
+		&awss3.DeleteObjectInput{
+			Bucket: aws.String(b.name),
+			Key:    aws.String(req.Name),
+		},
+		withHeaders(headers, "DeleteObject"))
+
+	if err != nil {
+		err = convertErr(err)
+		var preconditionErr *gcs.PreconditionError
+		if !errors.As(err, &preconditionErr) {
+			err = fmt.Errorf("DeleteObject: %w", err)
+		}
+	}
+
+	return
+}
+
+func (b *bucket) DeleteFolder(ctx context.Context, folderName string) error {
+	return syscall.ENOSYS
+}
+
+func (b *bucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return nil, syscall.ENOSYS
+}
+
+func (b *bucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	return nil, syscall.ENOSYS
+}
+
+func (b *bucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return nil, syscall.ENOSYS
+}
@@ -0,0 +1,244 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Return a client of the store at the given URL, configured as for production.
+func newClientForTest(endpoint string) *awss3.S3 {
+	return awss3.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:                       aws.String(endpoint),
+		Region:                         aws.String("us-east-1"),
+		S3ForcePathStyle:               aws.Bool(true),
+		DisableRestProtocolURICleaning: aws.Bool(true),
+		Credentials:                    credentials.NewStaticCredentials("id", "secret", ""),
+	})))
+}
+
+func newBucketForTest(t *testing.T) gcs.Bucket {
+	t.Helper()
+	srv := httptest.NewServer(newFakeServer())
+	t.Cleanup(srv.Close)
+	return NewBucket(newClientForTest(srv.URL), "some_bucket")
+}
+
+func TestCreateStatAndRead(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t)
+
+	o, err := b.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:        "dir/foo",
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"gcsfuse_mtime": "now"},
+		Contents:    strings.NewReader("taco"),
+	})
+
+	require.NoError(t, err)
+	m, e, err := b.StatObject(ctx, &gcs.StatObjectRequest{Name: "dir/foo", ReturnExtendedObjectAttributes: true})
+	require.NoError(t, err)
+	assert.Equal(t, o.Generation, m.Generation)
+	assert.EqualValues(t, 1, m.MetaGeneration)
+	assert.EqualValues(t, len("taco"), m.Size)
+	assert.Equal(t, map[string]string{"gcsfuse_mtime": "now"}, m.Metadata)
+	assert.Equal(t, "text/plain", e.ContentType)
+	assert.NotNil(t, e.MD5)
+	rc, err := b.NewReader(ctx, &gcs.ReadObjectRequest{Name: "dir/foo", Generation: o.Generation, Range: &gcs.ByteRange{Start: 1, Limit: 3}})
+	require.NoError(t, err)
+	contents, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "ac", string(contents))
+}
+
+func TestListingAgreesWithStat(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t)
+	for _, name := range []string{"a", "b/", "b/c", "d/e"} {
+		_, err := storageutil.CreateObject(ctx, b, name, []byte(name))
+		require.NoError(t, err)
+	}
+
+	listing, err := b.ListObjects(ctx, &gcs.ListObjectsRequest{Delimiter: "/", IncludeTrailingDelimiter: true})
+
+	require.NoError(t, err)
+	var names []string
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+		m, _, err := b.StatObject(ctx, &gcs.StatObjectRequest{Name: o.Name})
+		require.NoError(t, err)
+		assert.Equal(t, m.Generation, o.Generation)
+	}
+	assert.Equal(t, []string{"a", "b/"}, names)
+	assert.Equal(t, []string{"b/", "d/"}, listing.CollapsedRuns)
+}
+
+func TestListingPages(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t)
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := storageutil.CreateObject(ctx, b, name, nil)
+		require.NoError(t, err)
+	}
+
+	first, err := b.ListObjects(ctx, &gcs.ListObjectsRequest{MaxResults: 2})
+	require.NoError(t, err)
+	second, err := b.ListObjects(ctx, &gcs.ListObjectsRequest{MaxResults: 2, ContinuationToken: first.ContinuationToken})
+	require.NoError(t, err)
+
+	assert.Len(t, first.MinObjects, 2)
+	require.Len(t, second.MinObjects, 1)
+	assert.Equal(t, "c", second.MinObjects[0].Name)
+	assert.Empty(t, second.ContinuationToken)
+}
+
+func TestGenerationPreconditions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t)
+	o, err := storageutil.CreateObject(ctx, b, "foo", []byte("taco"))
+	require.NoError(t, err)
+	var zero int64
+	wrong := o.Generation + 1
+
+	_, err = b.CreateObject(ctx, &gcs.CreateObjectRequest{Name: "foo", Contents: strings.NewReader("x"), GenerationPrecondition: &zero})
+	assert.IsType(t, &gcs.PreconditionError{}, err)
+	_, err = b.CreateObject(ctx, &gcs.CreateObjectRequest{Name: "foo", Contents: strings.NewReader("x"), GenerationPrecondition: &wrong})
+	assert.IsType(t, &gcs.PreconditionError{}, err)
+	_, err = b.NewReader(ctx, &gcs.ReadObjectRequest{Name: "foo", Generation: wrong})
+	assert.IsType(t, &gcs.NotFoundError{}, err)
+	_, err = b.CreateObject(ctx, &gcs.CreateObjectRequest{Name: "foo", Contents: strings.NewReader("burrito"), GenerationPrecondition: &o.Generation})
+	assert.NoError(t, err)
+	contents, err := storageutil.ReadObject(ctx, b, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "burrito", string(contents))
+}
+
+func TestComposeMixesCopiedAndUploadedParts(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t)
+	big := bytes.Repeat([]byte("a"), minPartSize+1)
+	small := []byte("taco")
+	_, err := storageutil.CreateObject(ctx, b, "small", small)
+	require.NoError(t, err)
+	_, err = storageutil.CreateObject(ctx, b, "big", big)
+	require.NoError(t, err)
+
+	o, err := b.ComposeObjects(ctx, &gcs.ComposeObjectsRequest{
+		DstName:     "dst",
+		ContentType: "text/plain",
+		Sources:     []gcs.ComposeSource{{Name: "small"}, {Name: "big"}, {Name: "small"}, {Name: "big"}},
+	})
+
+	require.NoError(t, err)
+	assert.Nil(t, o.MD5)
+	assert.Equal(t, "text/plain", o.ContentType)
+	contents, err := storageutil.ReadObject(ctx, b, "dst")
+	require.NoError(t, err)
+	want := append(append(append(append([]byte{}, small...), big...), small...), big...)
+	assert.Equal(t, want, contents)
+}
+
+func TestComposeSmallObjects(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t)
+	_, err := storageutil.CreateObject(ctx, b, "x", []byte("taco"))
+	require.NoError(t, err)
+
+	_, err = b.ComposeObjects(ctx, &gcs.ComposeObjectsRequest{DstName: "x", Sources: []gcs.ComposeSource{{Name: "x"}, {Name: "x"}}})
+
+	require.NoError(t, err)
+	contents, err := storageutil.ReadObject(ctx, b, "x")
+	require.NoError(t, err)
+	assert.Equal(t, "tacotaco", string(contents))
+}
+
+func TestCopyUpdateAndDelete(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t)
+	_, err := b.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:        "foo",
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"a": "1", "b": "2"},
+		Contents:    strings.NewReader("taco"),
+	})
+	require.NoError(t, err)
+
+	c, err := b.CopyObject(ctx, &gcs.CopyObjectRequest{SrcName: "foo", DstName: "bar"})
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", c.ContentType)
+	u, err := b.UpdateObject(ctx, &gcs.UpdateObjectRequest{
+		Name:        "bar",
+		ContentType: aws.String("text/html"),
+		Metadata:    map[string]*string{"a": nil, "c": aws.String("3")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", u.ContentType)
+	assert.Equal(t, map[string]string{"b": "2", "c": "3"}, u.Metadata)
+	require.NoError(t, b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: "bar", Generation: u.Generation}))
+	_, _, err = b.StatObject(ctx, &gcs.StatObjectRequest{Name: "bar"})
+	assert.IsType(t, &gcs.NotFoundError{}, err)
+}
+
+func TestChunkWriter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	b := newBucketForTest(t)
+	var reported int64
+	w, err := b.CreateObjectChunkWriter(ctx, &gcs.CreateObjectRequest{Name: "foo"}, 0, func(n int64) { reported = n })
+	require.NoError(t, err)
+	_, err = w.Write([]byte("taco"))
+	require.NoError(t, err)
+
+	o, err := b.FinalizeUpload(ctx, w)
+
+	require.NoError(t, err)
+	assert.EqualValues(t, len("taco"), o.Size)
+	assert.EqualValues(t, len("taco"), reported)
+	contents, err := storageutil.ReadObject(ctx, b, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "taco", string(contents))
+}
+
+func TestFoldersAreNotSupported(t *testing.T) {
+	t.Parallel()
+	b := newBucketForTest(t)
+
+	_, err := b.CreateFolder(context.Background(), "a/")
+
+	assert.Equal(t, gcs.NonHierarchical, b.BucketType())
+	assert.ErrorIs(t, err, syscall.ENOSYS)
+}
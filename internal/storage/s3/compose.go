@@ -0,0 +1,227 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// The smallest part S3 accepts in a multipart upload, but for the last.
+	minPartSize = 5 << 20
+
+	// The largest object, or part, S3 copies in one request.
+	maxCopyPartSize = 5 << 30
+)
+
+// A source object of a composition, as it was when looked up.
+type source struct {
+	name string
+	head *awss3.HeadObjectOutput
+}
+
+// Read the given range of the source into the buffer, failing if the source
+// has changed since it was looked up.
+func (b *bucket) readRange(ctx context.Context, s source, start int64, limit int64, buf *bytes.Buffer) (err error) {
+	if limit <= start {
+		return
+	}
+
+	out, err := b.client.GetObjectWithContext(ctx, &awss3.GetObjectInput{
+		Bucket:  aws.String(b.name),
+		Key:     aws.String(s.name),
+		IfMatch: s.head.ETag,
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", start, limit-1)),
+	})
+
+	if err != nil {
+		err = fmt.Errorf("GetObject: %w", convertErr(err))
+		return
+	}
+
+	defer out.Body.Close()
+	if _, err = io.Copy(buf, out.Body); err != nil {
+		err = fmt.Errorf("reading %s: %w", s.name, err)
+	}
+
+	return
+}
+
+// Write the concatenation of the sources to the object described by the
+// input, subject to the given conditions.
+//
+// Sources are copied on the server in parts as far as possible. Bytes that
+// can't make up a part on their own, because the source or what is left of
+// it is smaller than the minimum part size, are read in and uploaded together
+// with what follows them. Objects too small to need parts at all are read
+// in whole and uploaded in one request, along with their CRC32C.
+func (b *bucket) composeInParts(
+	ctx context.Context,
+	mpu *awss3.CreateMultipartUploadInput,
+	sources []source,
+	headers map[string]string) (err error) {
+	var total int64
+	for _, s := range sources {
+		total += aws.Int64Value(s.head.ContentLength)
+	}
+
+	var buf bytes.Buffer
+	if total < minPartSize {
+		for _, s := range sources {
+			if err = b.readRange(ctx, s, 0, aws.Int64Value(s.head.ContentLength), &buf); err != nil {
+				return
+			}
+		}
+
+		_, err = b.client.PutObjectWithContext(
+			ctx,
+			&awss3.PutObjectInput{
+				Bucket:             mpu.Bucket,
+				Key:                mpu.Key,
+				Body:               bytes.NewReader(buf.Bytes()),
+				ChecksumCRC32C:     checksumOf(buf.Bytes()),
+				ContentType:        mpu.ContentType,
+				ContentLanguage:    mpu.ContentLanguage,
+				ContentEncoding:    mpu.ContentEncoding,
+				CacheControl:       mpu.CacheControl,
+				ContentDisposition: mpu.ContentDisposition,
+				Metadata:           mpu.Metadata,
+			},
+			withHeaders(headers, "PutObject"))
+
+		if err != nil {
+			err = convertWriteErr("PutObject", err, headers)
+		}
+
+		return
+	}
+
+	created, err := b.client.CreateMultipartUploadWithContext(ctx, mpu)
+	if err != nil {
+		err = fmt.Errorf("CreateMultipartUpload: %w", convertErr(err))
+		return
+	}
+
+	uploadID := created.UploadId
+	defer func() {
+		if err != nil {
+			b.client.AbortMultipartUploadWithContext(ctx, &awss3.AbortMultipartUploadInput{
+				Bucket:   mpu.Bucket,
+				Key:      mpu.Key,
+				UploadId: uploadID,
+			})
+		}
+	}()
+
+	var parts []*awss3.CompletedPart
+	flush := func() (err error) {
+		if buf.Len() == 0 {
+			return
+		}
+
+		partNumber := aws.Int64(int64(len(parts) + 1))
+		out, err := b.client.UploadPartWithContext(ctx, &awss3.UploadPartInput{
+			Bucket:     mpu.Bucket,
+			Key:        mpu.Key,
+			UploadId:   uploadID,
+			PartNumber: partNumber,
+			Body:       bytes.NewReader(buf.Bytes()),
+		})
+
+		if err != nil {
+			err = fmt.Errorf("UploadPart: %w", convertErr(err))
+			return
+		}
+
+		parts = append(parts, &awss3.CompletedPart{ETag: out.ETag, PartNumber: partNumber})
+		buf.Reset()
+		return
+	}
+
+	for _, s := range sources {
+		size := aws.Int64Value(s.head.ContentLength)
+		var offset int64
+
+		// Top up bytes left over from before to a full part.
+		if buf.Len() > 0 {
+			offset = min(int64(minPartSize-buf.Len()), size)
+			if err = b.readRange(ctx, s, 0, offset, &buf); err != nil {
+				return
+			}
+
+			if buf.Len() >= minPartSize {
+				if err = flush(); err != nil {
+					return
+				}
+			}
+		}
+
+		// Copy what makes up full parts.
+		for size-offset >= minPartSize {
+			n := min(size-offset, maxCopyPartSize)
+			partNumber := aws.Int64(int64(len(parts) + 1))
+
+			var out *awss3.UploadPartCopyOutput
+			out, err = b.client.UploadPartCopyWithContext(ctx, &awss3.UploadPartCopyInput{
+				Bucket:            mpu.Bucket,
+				Key:               mpu.Key,
+				UploadId:          uploadID,
+				PartNumber:        partNumber,
+				CopySource:        aws.String(b.copySource(s.name)),
+				CopySourceIfMatch: s.head.ETag,
+				CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+n-1)),
+			})
+
+			if err != nil {
+				err = fmt.Errorf("UploadPartCopy: %w", convertErr(err))
+				return
+			}
+
+			parts = append(parts, &awss3.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: partNumber})
+			offset += n
+		}
+
+		// Keep the rest for the next part.
+		if err = b.readRange(ctx, s, offset, size, &buf); err != nil {
+			return
+		}
+	}
+
+	if err = flush(); err != nil {
+		return
+	}
+
+	_, err = b.client.CompleteMultipartUploadWithContext(
+		ctx,
+		&awss3.CompleteMultipartUploadInput{
+			Bucket:          mpu.Bucket,
+			Key:             mpu.Key,
+			UploadId:        uploadID,
+			MultipartUpload: &awss3.CompletedMultipartUpload{Parts: parts},
+		},
+		withHeaders(headers, "CompleteMultipartUpload"))
+
+	if err != nil {
+		err = convertWriteErr("CompleteMultipartUpload", err, headers)
+	}
+
+	return
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	gcstesting "github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake/testing"
+	"github.com/jacobsa/ogletest"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+// The server behind the latest bucket.
+var lastServer *httptest.Server
+
+func TestConformance(t *testing.T) {
+	ogletest.RunTests(t)
+	if lastServer != nil {
+		lastServer.Close()
+	}
+}
+
+func init() {
+	makeDeps := func(ctx context.Context) (deps gcstesting.BucketTestDeps) {
+		// Set up a fresh store, closing the previous test's, since there's no
+		// hook for tearing it down.
+		if lastServer != nil {
+			lastServer.Close()
+		}
+
+		// Generations are made from modification times to the second, so the
+		// store spaces writes apart as if the tests were paced, and stamps them
+		// with the time of day.
+		srv := newFakeServer()
+		srv.paced = true
+		lastServer = httptest.NewServer(srv)
+
+		deps.Bucket = NewBucket(newClientForTest(lastServer.URL), "some_bucket")
+		deps.Clock = timeutil.RealClock()
+		deps.SupportsCancellation = true
+		deps.LimitInterestingNames = true
+
+		return
+	}
+
+	gcstesting.RegisterBucketTests(makeDeps)
+}
@@ -0,0 +1,471 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeServer is an in-process stand-in for an S3-compatible store, speaking
+// just enough of the API for the bucket: objects with path-style addressing,
+// conditional requests, CRC32C checksums, ListObjectsV2, copies and multipart
+// uploads.
+type fakeServer struct {
+	mu      sync.Mutex
+	objects map[string]*fakeObject // keyed by "bucket/key"
+	uploads map[string]map[int]*fakeObject
+	nextID  int
+
+	// If set, objects are stored at least a second apart, so that each write
+	// makes a new generation.
+	paced     bool
+	lastWrite time.Time
+}
+
+type fakeObject struct {
+	data         []byte
+	etag         string
+	crc32c       string // for the whole object, if any
+	lastModified time.Time
+	header       http.Header
+}
+
+// The headers of an object that are kept along with it.
+var storedHeaders = []string{"Content-Type", "Content-Language", "Content-Encoding", "Cache-Control", "Content-Disposition"}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		objects: make(map[string]*fakeObject),
+		uploads: make(map[string]map[int]*fakeObject),
+	}
+}
+
+func newFakeObject(data []byte, header http.Header) *fakeObject {
+	sum := md5.Sum(data)
+	return &fakeObject{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		lastModified: time.Now().UTC().Round(time.Millisecond),
+		header:       header,
+	}
+}
+
+// Return the headers of a request that are stored with the object.
+func objectHeader(r *http.Request) http.Header {
+	h := make(http.Header)
+	for k, v := range r.Header {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+			h[k] = v
+		}
+	}
+
+	for _, k := range storedHeaders {
+		if v := r.Header.Get(k); v != "" {
+			h.Set(k, v)
+		}
+	}
+
+	return h
+}
+
+// Store the object under the given path.
+//
+// LOCKS_REQUIRED(s.mu)
+func (s *fakeServer) store(path string, o *fakeObject) {
+	if s.paced {
+		if next := s.lastWrite.Truncate(time.Second).Add(time.Second); o.lastModified.Before(next) {
+			o.lastModified = next
+		}
+
+		s.lastWrite = o.lastModified
+	}
+
+	s.objects[path] = o
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	data, _ := xml.Marshal(v)
+	w.Write(data)
+}
+
+// Check the conditions of a write replacing the object, which may be nil.
+func writeAllowed(r *http.Request, existing *fakeObject) bool {
+	if r.Header.Get("If-None-Match") == "*" && existing != nil {
+		return false
+	}
+
+	if m := r.Header.Get("If-Match"); m != "" && (existing == nil || existing.etag != m) {
+		return false
+	}
+
+	return true
+}
+
+// Return the object named by the x-amz-copy-source header, checking its
+// conditions.
+//
+// LOCKS_REQUIRED(s.mu)
+func (s *fakeServer) copySource(w http.ResponseWriter, r *http.Request) (o *fakeObject, ok bool) {
+	src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	o = s.objects[strings.TrimPrefix(src, "/")]
+	if o == nil {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	if m := r.Header.Get("X-Amz-Copy-Source-If-Match"); m != "" && m != o.etag {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	return o, true
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	if r.Method == http.MethodGet && query.Get("list-type") == "2" {
+		s.list(w, strings.TrimSuffix(path, "/"), query)
+		return
+	}
+
+	o := s.objects[path]
+	switch {
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		s.get(w, r, o)
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = map[int]*fakeObject{0: {header: objectHeader(r)}}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadID string   `xml:"UploadId"`
+		}{UploadID: id})
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.complete(w, r, path, o)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r, query)
+
+	case r.Method == http.MethodPut:
+		s.put(w, r, path, o)
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodDelete:
+		if m := r.Header.Get("If-Match"); m != "" && (o == nil || o.etag != m) {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+
+		delete(s.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// LOCKS_REQUIRED(s.mu)
+func (s *fakeServer) get(w http.ResponseWriter, r *http.Request, o *fakeObject) {
+	if o == nil {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	if m := r.Header.Get("If-Match"); m != "" && m != o.etag {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	data := o.data
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		var start, end uint64
+		fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+		if start >= uint64(len(data)) {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+
+		data = data[start:min(end+1, uint64(len(data)))]
+		status = http.StatusPartialContent
+	}
+
+	for k, v := range o.header {
+		w.Header()[k] = v
+	}
+
+	if r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED" && o.crc32c != "" {
+		w.Header().Set("X-Amz-Checksum-Crc32c", o.crc32c)
+	}
+
+	w.Header().Set("ETag", o.etag)
+	w.Header().Set("Last-Modified", o.lastModified.Format(http.TimeFormat))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// LOCKS_REQUIRED(s.mu)
+func (s *fakeServer) put(w http.ResponseWriter, r *http.Request, path string, existing *fakeObject) {
+	if !writeAllowed(r, existing) {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	var o *fakeObject
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		src, ok := s.copySource(w, r)
+		if !ok {
+			return
+		}
+
+		header := src.header
+		if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+			header = objectHeader(r)
+		}
+
+		o = newFakeObject(src.data, header)
+		o.etag = src.etag
+		o.crc32c = src.crc32c
+		if r.Header.Get("X-Amz-Checksum-Algorithm") == "CRC32C" {
+			o.crc32c = *checksumOf(o.data)
+		}
+
+		s.store(path, o)
+		writeXML(w, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			ETag         string
+			LastModified string
+		}{ETag: o.etag, LastModified: o.lastModified.Format(time.RFC3339Nano)})
+		return
+	}
+
+	data, _ := io.ReadAll(r.Body)
+	o = newFakeObject(data, objectHeader(r))
+	if sum := r.Header.Get("X-Amz-Checksum-Crc32c"); sum != "" {
+		if sum != *checksumOf(data) {
+			writeError(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+
+		o.crc32c = sum
+	}
+
+	s.store(path, o)
+	w.Header().Set("ETag", o.etag)
+}
+
+// LOCKS_REQUIRED(s.mu)
+func (s *fakeServer) uploadPart(w http.ResponseWriter, r *http.Request, query url.Values) {
+	parts := s.uploads[query.Get("uploadId")]
+	if parts == nil {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+	if r.Header.Get("X-Amz-Copy-Source") == "" {
+		data, _ := io.ReadAll(r.Body)
+		parts[partNumber] = newFakeObject(data, nil)
+		w.Header().Set("ETag", parts[partNumber].etag)
+		return
+	}
+
+	src, ok := s.copySource(w, r)
+	if !ok {
+		return
+	}
+
+	var start, end int
+	fmt.Sscanf(r.Header.Get("X-Amz-Copy-Source-Range"), "bytes=%d-%d", &start, &end)
+	parts[partNumber] = newFakeObject(src.data[start:end+1], nil)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CopyPartResult"`
+		ETag    string
+	}{ETag: parts[partNumber].etag})
+}
+
+// LOCKS_REQUIRED(s.mu)
+func (s *fakeServer) complete(w http.ResponseWriter, r *http.Request, path string, existing *fakeObject) {
+	id := r.URL.Query().Get("uploadId")
+	parts := s.uploads[id]
+	if parts == nil {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	if !writeAllowed(r, existing) {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	var req struct {
+		Parts []struct {
+			ETag       string
+			PartNumber int
+		} `xml:"Part"`
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	xml.Unmarshal(body, &req)
+
+	var data, sums []byte
+	for i, p := range req.Parts {
+		part := parts[p.PartNumber]
+		if part == nil || part.etag != p.ETag {
+			writeError(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+
+		if i < len(req.Parts)-1 && len(part.data) < minPartSize {
+			writeError(w, http.StatusBadRequest, "EntityTooSmall")
+			return
+		}
+
+		data = append(data, part.data...)
+		sum := md5.Sum(part.data)
+		sums = append(sums, sum[:]...)
+	}
+
+	o := newFakeObject(data, parts[0].header)
+	sum := md5.Sum(sums)
+	o.etag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(req.Parts))
+	s.store(path, o)
+	delete(s.uploads, id)
+
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		ETag    string
+	}{ETag: o.etag})
+}
+
+type fakeContents struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+}
+
+type fakePrefix struct {
+	Prefix string
+}
+
+// LOCKS_REQUIRED(s.mu)
+func (s *fakeServer) list(w http.ResponseWriter, bucket string, query url.Values) {
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	encode := func(s string) string { return s }
+	if query.Get("encoding-type") == "url" {
+		encode = url.QueryEscape
+	}
+
+	maxKeys := 1000
+	if v := query.Get("max-keys"); v != "" {
+		maxKeys, _ = strconv.Atoi(v)
+	}
+
+	// Continuation tokens are the last key or prefix returned.
+	token := query.Get("continuation-token")
+
+	var keys []string
+	for k := range s.objects {
+		if name, ok := strings.CutPrefix(k, bucket+"/"); ok && strings.HasPrefix(name, prefix) {
+			keys = append(keys, name)
+		}
+	}
+
+	sort.Strings(keys)
+
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []fakeContents
+		CommonPrefixes        []fakePrefix
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{}
+
+	count := 0
+	last := ""
+	for _, k := range keys {
+		if token != "" && (k <= token || strings.HasSuffix(token, delimiter) && delimiter != "" && strings.HasPrefix(k, token)) {
+			continue
+		}
+
+		item := k
+		isPrefix := false
+		if delimiter != "" {
+			if i := strings.Index(k[len(prefix):], delimiter); i >= 0 {
+				item = k[:len(prefix)+i+len(delimiter)]
+				isPrefix = true
+			}
+		}
+
+		if isPrefix && item == last {
+			continue
+		}
+
+		if count == maxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = last
+			break
+		}
+
+		if isPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, fakePrefix{encode(item)})
+		} else {
+			o := s.objects[bucket+"/"+k]
+			result.Contents = append(result.Contents, fakeContents{
+				Key:          encode(k),
+				LastModified: o.lastModified.Format("2006-01-02T15:04:05.000Z"),
+				ETag:         o.etag,
+				Size:         len(o.data),
+			})
+		}
+
+		count++
+		last = item
+	}
+
+	writeXML(w, result)
+}
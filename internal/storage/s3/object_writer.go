@@ -0,0 +1,106 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+)
+
+// objectWriter streams the contents of a new object to S3, which the uploader
+// splits into parts as they come. The object is created when the writer is
+// closed.
+type objectWriter struct {
+	pw       *io.PipeWriter
+	done     chan struct{}
+	attrs    storage.ObjectAttrs
+	callBack func(bytesUploadedSoFar int64)
+	written  int64
+
+	// Set once done is closed.
+	object *gcs.MinObject
+	err    error
+}
+
+func newObjectWriter(
+	ctx context.Context,
+	b *bucket,
+	req *gcs.CreateObjectRequest,
+	callBack func(bytesUploadedSoFar int64)) (w gcs.Writer, err error) {
+	headers, err := b.writeConditions(ctx, req.Name, req.GenerationPrecondition, req.MetaGenerationPrecondition)
+	if err != nil {
+		return
+	}
+
+	pr, pw := io.Pipe()
+	ow := &objectWriter{
+		pw:       pw,
+		done:     make(chan struct{}),
+		callBack: callBack,
+		attrs: storage.ObjectAttrs{
+			Name:        req.Name,
+			ContentType: req.ContentType,
+		},
+	}
+
+	go func() {
+		defer close(ow.done)
+
+		o, err := b.upload(ctx, req, pr, headers)
+		pr.CloseWithError(err)
+		if err != nil {
+			ow.err = err
+			return
+		}
+
+		ow.object = storageutil.ConvertObjToMinObject(o)
+		ow.attrs.Generation = o.Generation
+		ow.attrs.Metageneration = o.MetaGeneration
+		ow.attrs.Size = int64(o.Size)
+		ow.attrs.Updated = o.Updated
+	}()
+
+	w = ow
+	return
+}
+
+// The callback is told of bytes as the uploader takes them in.
+func (w *objectWriter) Write(p []byte) (n int, err error) {
+	n, err = w.pw.Write(p)
+	w.written += int64(n)
+	if n > 0 && w.callBack != nil {
+		w.callBack(w.written)
+	}
+
+	return
+}
+
+func (w *objectWriter) Close() error {
+	w.pw.Close()
+	<-w.done
+	return w.err
+}
+
+func (w *objectWriter) ObjectName() string {
+	return w.attrs.Name
+}
+
+func (w *objectWriter) Attrs() *storage.ObjectAttrs {
+	return &w.attrs
+}
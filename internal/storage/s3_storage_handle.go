@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/s3"
+	"golang.org/x/net/context"
+)
+
+// The schemes of custom endpoints naming an S3-compatible store, over HTTPS
+// and plain HTTP respectively.
+const (
+	s3EndpointScheme         = "s3"
+	s3InsecureEndpointScheme = "s3+http"
+)
+
+// Used when the AWS configuration names no region, as S3-compatible stores
+// like MinIO generally don't care.
+const defaultS3Region = "us-east-1"
+
+// s3Storage serves buckets of an S3-compatible store. Credentials and the
+// region come from the usual AWS environment variables and shared files.
+type s3Storage struct {
+	client *awss3.S3
+}
+
+// Return the URL of the S3 store named by the custom endpoint, or false if
+// it names something else.
+func s3EndpointURL(endpoint string) (u string, ok bool) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return
+	}
+
+	switch parsed.Scheme {
+	case s3EndpointScheme:
+		parsed.Scheme = "https"
+	case s3InsecureEndpointScheme:
+		parsed.Scheme = "http"
+	default:
+		return
+	}
+
+	return parsed.String(), true
+}
+
+func newS3StorageHandle(endpoint string) (sh StorageHandle, err error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+			Endpoint:                       aws.String(endpoint),
+			S3ForcePathStyle:               aws.Bool(true),
+			DisableRestProtocolURICleaning: aws.Bool(true),
+		},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+
+	if err != nil {
+		err = fmt.Errorf("creating S3 session: %w", err)
+		return
+	}
+
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String(defaultS3Region)
+	}
+
+	sh = &s3Storage{client: awss3.New(sess)}
+	return
+}
+
+// The billing project has no meaning for S3 buckets and is ignored.
+func (sh *s3Storage) BucketHandle(ctx context.Context, bucketName string, billingProject string) gcs.Bucket {
+	return s3.NewBucket(sh.client, bucketName)
+}
+
+// The project has no meaning for S3; all buckets of the credentials are
+// listed.
+func (sh *s3Storage) ListBuckets(ctx context.Context, projectID string) (names []string, err error) {
+	out, err := sh.client.ListBucketsWithContext(ctx, &awss3.ListBucketsInput{})
+	if err != nil {
+		err = fmt.Errorf("error in listing S3 buckets: %w", err)
+		return
+	}
+
+	for _, b := range out.Buckets {
+		names = append(names, aws.StringValue(b.Name))
+	}
+
+	return
+}
@@ -26,8 +26,10 @@ import (
 	"github.com/googleapis/gax-go/v2"
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
 	option "google.golang.org/api/option"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -50,7 +52,10 @@ type StorageHandle interface {
 	// to that project rather than to the bucket's owning project.
 	//
 	// A user-project is required for all operations on Requester Pays buckets.
-	BucketHandle(ctx context.Context, bucketName string, billingProject string) (bh *bucketHandle)
+	BucketHandle(ctx context.Context, bucketName string, billingProject string) (bh gcs.Bucket)
+
+	// ListBuckets returns the names of the buckets in the given project.
+	ListBuckets(ctx context.Context, projectID string) (names []string, err error)
 }
 
 type storageClient struct {
@@ -196,6 +201,17 @@ func createHTTPClientHandle(ctx context.Context, clientConfig *storageutil.Stora
 // Please check out the StorageClientConfig to know about the parameters used in
 // http and gRPC client.
 func NewStorageHandle(ctx context.Context, clientConfig storageutil.StorageClientConfig) (sh StorageHandle, err error) {
+	// A file:// custom endpoint serves buckets from a local directory.
+	if root, ok := localEndpointRoot(clientConfig.CustomEndpoint); ok {
+		return newLocalStorageHandle(root, clientConfig.EnableHNS)
+	}
+
+	// An s3:// or s3+http:// custom endpoint serves buckets from an
+	// S3-compatible store.
+	if endpoint, ok := s3EndpointURL(clientConfig.CustomEndpoint); ok {
+		return newS3StorageHandle(endpoint)
+	}
+
 	var sc *storage.Client
 	// The default protocol for the Go Storage control client's folders API is gRPC.
 	// gcsfuse will initially mirror this behavior due to the client's lack of HTTP support.
@@ -256,7 +272,7 @@ func NewStorageHandle(ctx context.Context, clientConfig storageutil.StorageClien
 	return
 }
 
-func (sh *storageClient) BucketHandle(ctx context.Context, bucketName string, billingProject string) (bh *bucketHandle) {
+func (sh *storageClient) BucketHandle(ctx context.Context, bucketName string, billingProject string) (bh gcs.Bucket) {
 	storageBucketHandle := sh.client.Bucket(bucketName)
 
 	if billingProject != "" {
@@ -275,3 +291,23 @@ func (sh *storageClient) BucketHandle(ctx context.Context, bucketName string, bi
 	}
 	return
 }
+
+// ListBuckets lists through the JSON API client: the storage control API has
+// no method for listing buckets.
+func (sh *storageClient) ListBuckets(ctx context.Context, projectID string) (names []string, err error) {
+	it := sh.client.Buckets(ctx, projectID)
+	for {
+		var attrs *storage.BucketAttrs
+		attrs, err = it.Next()
+		if err == iterator.Done {
+			err = nil
+			return
+		}
+		if err != nil {
+			err = fmt.Errorf("error in iterating through buckets: %w", err)
+			return
+		}
+
+		names = append(names, attrs.Name)
+	}
+}
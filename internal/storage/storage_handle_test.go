@@ -18,6 +18,8 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -53,23 +55,32 @@ func (testSuite *StorageHandleTest) TearDownTest() {
 
 func (testSuite *StorageHandleTest) TestBucketHandleWhenBucketExistsWithEmptyBillingProject() {
 	storageHandle := testSuite.fakeStorage.CreateStorageHandle()
-	bucketHandle := storageHandle.BucketHandle(testSuite.ctx, TestBucketName, "")
+	bucketHandle := storageHandle.BucketHandle(testSuite.ctx, TestBucketName, "").(*bucketHandle)
 
 	assert.NotNil(testSuite.T(), bucketHandle)
 	assert.Equal(testSuite.T(), TestBucketName, bucketHandle.bucketName)
 	assert.Equal(testSuite.T(), gcs.Nil, bucketHandle.bucketType)
 }
 
+func (testSuite *StorageHandleTest) TestListBuckets() {
+	storageHandle := testSuite.fakeStorage.CreateStorageHandle()
+
+	names, err := storageHandle.ListBuckets(testSuite.ctx, "some-project")
+
+	assert.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), []string{TestBucketName}, names)
+}
+
 func (testSuite *StorageHandleTest) TestBucketHandleWhenBucketDoesNotExistWithEmptyBillingProject() {
 	storageHandle := testSuite.fakeStorage.CreateStorageHandle()
-	bucketHandle := storageHandle.BucketHandle(testSuite.ctx, invalidBucketName, "")
+	bucketHandle := storageHandle.BucketHandle(testSuite.ctx, invalidBucketName, "").(*bucketHandle)
 
 	assert.Nil(testSuite.T(), bucketHandle.Bucket)
 }
 
 func (testSuite *StorageHandleTest) TestBucketHandleWhenBucketExistsWithNonEmptyBillingProject() {
 	storageHandle := testSuite.fakeStorage.CreateStorageHandle()
-	bucketHandle := storageHandle.BucketHandle(testSuite.ctx, TestBucketName, projectID)
+	bucketHandle := storageHandle.BucketHandle(testSuite.ctx, TestBucketName, projectID).(*bucketHandle)
 
 	assert.NotNil(testSuite.T(), bucketHandle)
 	assert.Equal(testSuite.T(), TestBucketName, bucketHandle.bucketName)
@@ -78,7 +89,7 @@ func (testSuite *StorageHandleTest) TestBucketHandleWhenBucketExistsWithNonEmpty
 
 func (testSuite *StorageHandleTest) TestBucketHandleWhenBucketDoesNotExistWithNonEmptyBillingProject() {
 	storageHandle := testSuite.fakeStorage.CreateStorageHandle()
-	bucketHandle := storageHandle.BucketHandle(testSuite.ctx, invalidBucketName, projectID)
+	bucketHandle := storageHandle.BucketHandle(testSuite.ctx, invalidBucketName, projectID).(*bucketHandle)
 
 	assert.Nil(testSuite.T(), bucketHandle.Bucket)
 }
@@ -547,3 +558,48 @@ func (testSuite *StorageHandleTest) TestNewStorageHandleWithMaxRetryAttemptsNotZ
 		assert.NotNil(testSuite.T(), handleCreated)
 	}
 }
+
+func (testSuite *StorageHandleTest) TestNewStorageHandleWithFileEndpointServesLocalDirectory() {
+	root := testSuite.T().TempDir()
+	require.NoError(testSuite.T(), os.Mkdir(filepath.Join(root, TestBucketName), 0755))
+	sc := storageutil.GetDefaultStorageClientConfig()
+	sc.CustomEndpoint = "file://" + root
+	sc.EnableHNS = true
+
+	handleCreated, err := NewStorageHandle(testSuite.ctx, sc)
+	require.NoError(testSuite.T(), err)
+	names, err := handleCreated.ListBuckets(testSuite.ctx, projectID)
+	require.NoError(testSuite.T(), err)
+	bucket := handleCreated.BucketHandle(testSuite.ctx, TestBucketName, "")
+	_, err = storageutil.CreateObject(testSuite.ctx, bucket, "foo", []byte("taco"))
+
+	require.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), []string{TestBucketName}, names)
+	assert.Equal(testSuite.T(), gcs.Hierarchical, bucket.BucketType())
+	contents, err := os.ReadFile(filepath.Join(root, TestBucketName, "foo"))
+	require.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), "taco", string(contents))
+}
+
+func (testSuite *StorageHandleTest) TestNewStorageHandleWithFileEndpointNotADirectory() {
+	sc := storageutil.GetDefaultStorageClientConfig()
+	sc.CustomEndpoint = "file://" + filepath.Join(testSuite.T().TempDir(), "missing")
+
+	_, err := NewStorageHandle(testSuite.ctx, sc)
+
+	assert.Error(testSuite.T(), err)
+}
+
+func (testSuite *StorageHandleTest) TestNewStorageHandleWithS3Endpoint() {
+	sc := storageutil.GetDefaultStorageClientConfig()
+	sc.CustomEndpoint = "s3+http://localhost:9000"
+	sc.EnableHNS = true
+
+	handleCreated, err := NewStorageHandle(testSuite.ctx, sc)
+
+	require.NoError(testSuite.T(), err)
+	bucket := handleCreated.BucketHandle(testSuite.ctx, TestBucketName, projectID)
+	assert.Equal(testSuite.T(), TestBucketName, bucket.Name())
+	assert.Equal(testSuite.T(), gcs.NonHierarchical, bucket.BucketType())
+	assert.Equal(testSuite.T(), "http://localhost:9000", handleCreated.(*s3Storage).client.Endpoint)
+}
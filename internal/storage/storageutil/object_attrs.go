@@ -94,6 +94,7 @@ func ObjectAttrsToBucketObject(attrs *storage.ObjectAttrs) *gcs.Object {
 		Generation:         attrs.Generation,
 		MetaGeneration:     attrs.Metageneration,
 		StorageClass:       attrs.StorageClass,
+		Created:            attrs.Created,
 		Deleted:            attrs.Deleted,
 		Updated:            attrs.Updated,
 		ComponentCount:     attrs.ComponentCount,
@@ -122,6 +123,8 @@ func ObjectAttrsToMinObject(attrs *storage.ObjectAttrs) *gcs.MinObject {
 		Generation:      attrs.Generation,
 		MetaGeneration:  attrs.Metageneration,
 		Updated:         attrs.Updated,
+		Created:         attrs.Created,
+		Deleted:         attrs.Deleted,
 	}
 }
 
@@ -172,6 +175,8 @@ func ConvertObjToMinObject(o *gcs.Object) *gcs.MinObject {
 		Metadata:        o.Metadata,
 		ContentEncoding: o.ContentEncoding,
 		CRC32C:          o.CRC32C,
+		Created:         o.Created,
+		Deleted:         o.Deleted,
 	}
 }
 
@@ -219,6 +224,7 @@ func ConvertMinObjectAndExtendedObjectAttributesToObject(m *gcs.MinObject,
 		CRC32C:             m.CRC32C,
 		MediaLink:          e.MediaLink,
 		StorageClass:       e.StorageClass,
+		Created:            m.Created,
 		Deleted:            e.Deleted,
 		ComponentCount:     e.ComponentCount,
 		ContentDisposition: e.ContentDisposition,
@@ -347,6 +347,7 @@ func (t objectAttrsTest) Test_ConvertObjToExtendedObjectAttributes_WithNonNilMin
 		Updated:         timeAttr,
 		Metadata:        map[string]string{"test_key": "test_value"},
 		ContentEncoding: "test_encoding",
+		Created:         timeAttr.Add(-time.Hour),
 	}
 	extendedObjAttr := &gcs.ExtendedObjectAttributes{
 		ContentType:        "ContentType",
@@ -374,6 +375,7 @@ func (t objectAttrsTest) Test_ConvertObjToExtendedObjectAttributes_WithNonNilMin
 	ExpectEq(0, gcsObject.Updated.Compare(minObject.Updated))
 	ExpectEq(gcsObject.Metadata, minObject.Metadata)
 	ExpectEq(gcsObject.ContentEncoding, minObject.ContentEncoding)
+	ExpectEq(0, gcsObject.Created.Compare(minObject.Created))
 	ExpectEq(gcsObject.ContentType, extendedObjAttr.ContentType)
 	ExpectEq(gcsObject.ContentLanguage, extendedObjAttr.ContentLanguage)
 	ExpectEq(gcsObject.CacheControl, extendedObjAttr.CacheControl)
@@ -0,0 +1,174 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trace records the calls made to buckets into trace files, and
+// replays such traces against other buckets to reproduce the request mix
+// that led to a performance problem.
+//
+// A trace holds one JSON object per line, each describing a call once it has
+// finished, so the lines are ordered by completion rather than by start.
+// Traces whose file names end in ".gz" are compressed.
+package trace
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// Call describes a call to a bucket. Field names are kept short so that
+// traces of busy mounts stay small.
+type Call struct {
+	Bucket string `json:"bk,omitempty"`
+	Method string `json:"m"`
+
+	// Unix time in nanoseconds at which the call started, and how long it took
+	// to return. For NewReader, ReadTime is how long it then took until the
+	// reader was closed.
+	Start    int64         `json:"ts"`
+	Latency  time.Duration `json:"l"`
+	ReadTime time.Duration `json:"rt,omitempty"`
+
+	// The object or folder the call is about, and the destination of copies
+	// and renames.
+	Name    string   `json:"n,omitempty"`
+	DstName string   `json:"dn,omitempty"`
+	Sources []string `json:"src,omitempty"`
+
+	Generation int64 `json:"g,omitempty"`
+
+	// The range requested by NewReader, as [start, limit).
+	Range *[2]uint64 `json:"r,omitempty"`
+
+	// The parameters of ListObjects, with the continuation token it was given
+	// and the one it returned.
+	Prefix            string `json:"p,omitempty"`
+	Delimiter         string `json:"dl,omitempty"`
+	MaxResults        int    `json:"mr,omitempty"`
+	ContinuationToken string `json:"ct,omitempty"`
+	NextToken         string `json:"nt,omitempty"`
+
+	// The chunk size of uploads through CreateObjectChunkWriter.
+	ChunkSize int `json:"cs,omitempty"`
+
+	// Bytes read or written, or for StatObject the size of the object.
+	Bytes int64 `json:"b,omitempty"`
+
+	// The error returned, if any, classified as in errorClass.
+	Err string `json:"e,omitempty"`
+}
+
+// Classify errors coarsely so that traces stay small and comparable.
+func errorClass(err error) string {
+	var notFoundErr *gcs.NotFoundError
+	var preconditionErr *gcs.PreconditionError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &notFoundErr):
+		return "NotFound"
+	case errors.As(err, &preconditionErr):
+		return "Precondition"
+	}
+
+	return err.Error()
+}
+
+// Recorder writes calls to a trace. It is safe for concurrent use.
+type Recorder struct {
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	enc    *json.Encoder
+	buf    *bufio.Writer
+	closer []io.Closer
+	err    error
+}
+
+// NewRecorder returns a recorder writing to w, which is not closed.
+func NewRecorder(w io.Writer) *Recorder {
+	buf := bufio.NewWriter(w)
+	return &Recorder{enc: json.NewEncoder(buf), buf: buf}
+}
+
+// CreateRecorder returns a recorder writing to a new file at the given path,
+// compressed if the path ends in ".gz".
+func CreateRecorder(path string) (r *Recorder, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		err = fmt.Errorf("creating trace file: %w", err)
+		return
+	}
+
+	if !strings.HasSuffix(path, ".gz") {
+		r = NewRecorder(f)
+		r.closer = []io.Closer{f}
+		return
+	}
+
+	zw := gzip.NewWriter(f)
+	r = NewRecorder(zw)
+	r.closer = []io.Closer{zw, f}
+	return
+}
+
+// Record writes the call. The first error writing is reported by Close, and
+// later calls are dropped.
+func (r *Recorder) Record(c *Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	r.err = r.enc.Encode(c)
+}
+
+// Close flushes the calls recorded and closes the file, if any.
+func (r *Recorder) Close() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.err
+	if flushErr := r.buf.Flush(); err == nil {
+		err = flushErr
+	}
+
+	for _, c := range r.closer {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	r.closer = nil
+	if err != nil {
+		err = fmt.Errorf("writing trace: %w", err)
+	}
+
+	if r.err == nil {
+		r.err = errors.New("recorder closed")
+	}
+
+	return
+}
@@ -0,0 +1,326 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// NewRecordingBucket wraps the supplied bucket in a layer that records every
+// call made to it.
+func NewRecordingBucket(wrapped gcs.Bucket, recorder *Recorder) (b gcs.Bucket) {
+	b = &recordingBucket{
+		wrapped:  wrapped,
+		recorder: recorder,
+	}
+
+	return
+}
+
+type recordingBucket struct {
+	wrapped  gcs.Bucket
+	recorder *Recorder
+}
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+func (b *recordingBucket) startCall(method string, name string) (c *Call, start time.Time) {
+	start = time.Now()
+	c = &Call{
+		Bucket: b.wrapped.Name(),
+		Method: method,
+		Start:  start.UnixNano(),
+		Name:   name,
+	}
+
+	return
+}
+
+func (b *recordingBucket) finishCall(c *Call, start time.Time, err *error) {
+	c.Latency = time.Since(start)
+	c.Err = errorClass(*err)
+	b.recorder.Record(c)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Reader
+////////////////////////////////////////////////////////////////////////
+
+// The call of a reader is recorded once it is closed, with the bytes read.
+type recordingReader struct {
+	bucket  *recordingBucket
+	call    *Call
+	opened  time.Time
+	wrapped io.ReadCloser
+	readErr error
+	once    sync.Once
+}
+
+func (rr *recordingReader) Read(p []byte) (n int, err error) {
+	n, err = rr.wrapped.Read(p)
+	rr.call.Bytes += int64(n)
+	if err != nil && err != io.EOF {
+		rr.readErr = err
+	}
+
+	return
+}
+
+func (rr *recordingReader) Close() (err error) {
+	err = rr.wrapped.Close()
+	rr.once.Do(func() {
+		rr.call.ReadTime = time.Since(rr.opened)
+		rr.call.Err = errorClass(rr.readErr)
+		rr.bucket.recorder.Record(rr.call)
+	})
+
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Writer
+////////////////////////////////////////////////////////////////////////
+
+// Counts the bytes written to a chunk writer, for FinalizeUpload to record.
+type recordingWriter struct {
+	gcs.Writer
+	chunkSize int
+	written   int64
+}
+
+func (w *recordingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.Writer.Write(p)
+	w.written += int64(n)
+	return
+}
+
+// Counts the bytes read from the contents of CreateObject.
+type countingReader struct {
+	wrapped io.Reader
+	n       int64
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.wrapped.Read(p)
+	r.n += int64(n)
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Bucket interface
+////////////////////////////////////////////////////////////////////////
+
+func (b *recordingBucket) Name() string {
+	return b.wrapped.Name()
+}
+
+func (b *recordingBucket) BucketType() gcs.BucketType {
+	return b.wrapped.BucketType()
+}
+
+func (b *recordingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	c, start := b.startCall("NewReader", req.Name)
+	c.Generation = req.Generation
+	if req.Range != nil {
+		c.Range = &[2]uint64{req.Range.Start, req.Range.Limit}
+	}
+
+	rc, err = b.wrapped.NewReader(ctx, req)
+	if err != nil {
+		b.finishCall(c, start, &err)
+		return
+	}
+
+	c.Latency = time.Since(start)
+	rc = &recordingReader{
+		bucket:  b,
+		call:    c,
+		opened:  time.Now(),
+		wrapped: rc,
+	}
+
+	return
+}
+
+func (b *recordingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
+	c, start := b.startCall("CreateObject", req.Name)
+	defer b.finishCall(c, start, &err)
+
+	// Count the contents on a copy of the request, leaving the caller's alone.
+	counted := *req
+	contents := &countingReader{wrapped: req.Contents}
+	if req.Contents != nil {
+		counted.Contents = contents
+	}
+
+	o, err = b.wrapped.CreateObject(ctx, &counted)
+	c.Bytes = contents.n
+	return
+}
+
+func (b *recordingBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (wc gcs.Writer, err error) {
+	c, start := b.startCall("CreateObjectChunkWriter", req.Name)
+	c.ChunkSize = chunkSize
+	defer b.finishCall(c, start, &err)
+
+	wc, err = b.wrapped.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+	if err == nil {
+		wc = &recordingWriter{Writer: wc, chunkSize: chunkSize}
+	}
+
+	return
+}
+
+func (b *recordingBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (o *gcs.MinObject, err error) {
+	c, start := b.startCall("FinalizeUpload", w.ObjectName())
+	defer b.finishCall(c, start, &err)
+
+	if rw, ok := w.(*recordingWriter); ok {
+		w = rw.Writer
+		c.ChunkSize = rw.chunkSize
+		c.Bytes = rw.written
+	}
+
+	o, err = b.wrapped.FinalizeUpload(ctx, w)
+	return
+}
+
+func (b *recordingBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (o *gcs.Object, err error) {
+	c, start := b.startCall("CopyObject", req.SrcName)
+	c.DstName = req.DstName
+	c.Generation = req.SrcGeneration
+	defer b.finishCall(c, start, &err)
+
+	o, err = b.wrapped.CopyObject(ctx, req)
+	return
+}
+
+func (b *recordingBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
+	c, start := b.startCall("ComposeObjects", req.DstName)
+	for _, src := range req.Sources {
+		c.Sources = append(c.Sources, src.Name)
+	}
+
+	defer b.finishCall(c, start, &err)
+
+	o, err = b.wrapped.ComposeObjects(ctx, req)
+	if err == nil {
+		c.Bytes = int64(o.Size)
+	}
+
+	return
+}
+
+func (b *recordingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	c, start := b.startCall("StatObject", req.Name)
+	defer b.finishCall(c, start, &err)
+
+	m, e, err = b.wrapped.StatObject(ctx, req)
+	if err == nil {
+		c.Bytes = int64(m.Size)
+	}
+
+	return
+}
+
+func (b *recordingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	c, start := b.startCall("ListObjects", "")
+	c.Prefix = req.Prefix
+	c.Delimiter = req.Delimiter
+	c.MaxResults = req.MaxResults
+	c.ContinuationToken = req.ContinuationToken
+	defer b.finishCall(c, start, &err)
+
+	listing, err = b.wrapped.ListObjects(ctx, req)
+	if err == nil {
+		c.NextToken = listing.ContinuationToken
+	}
+
+	return
+}
+
+func (b *recordingBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (o *gcs.Object, err error) {
+	c, start := b.startCall("UpdateObject", req.Name)
+	c.Generation = req.Generation
+	defer b.finishCall(c, start, &err)
+
+	o, err = b.wrapped.UpdateObject(ctx, req)
+	return
+}
+
+func (b *recordingBucket) DeleteObject(
+	ctx context.Context,
+	req *gcs.DeleteObjectRequest) (err error) {
+	c, start := b.startCall("DeleteObject", req.Name)
+	c.Generation = req.Generation
+	defer b.finishCall(c, start, &err)
+
+	err = b.wrapped.DeleteObject(ctx, req)
+	return
+}
+
+func (b *recordingBucket) DeleteFolder(ctx context.Context, folderName string) (err error) {
+	c, start := b.startCall("DeleteFolder", folderName)
+	defer b.finishCall(c, start, &err)
+
+	err = b.wrapped.DeleteFolder(ctx, folderName)
+	return
+}
+
+func (b *recordingBucket) GetFolder(ctx context.Context, folderName string) (folder *gcs.Folder, err error) {
+	c, start := b.startCall("GetFolder", folderName)
+	defer b.finishCall(c, start, &err)
+
+	folder, err = b.wrapped.GetFolder(ctx, folderName)
+	return
+}
+
+func (b *recordingBucket) CreateFolder(ctx context.Context, folderName string) (folder *gcs.Folder, err error) {
+	c, start := b.startCall("CreateFolder", folderName)
+	defer b.finishCall(c, start, &err)
+
+	folder, err = b.wrapped.CreateFolder(ctx, folderName)
+	return
+}
+
+func (b *recordingBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (folder *gcs.Folder, err error) {
+	c, start := b.startCall("RenameFolder", folderName)
+	c.DstName = destinationFolderId
+	defer b.finishCall(c, start, &err)
+
+	folder, err = b.wrapped.RenameFolder(ctx, folderName, destinationFolderId)
+	return
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Make calls of most kinds against the bucket.
+func exercise(t *testing.T, b gcs.Bucket) {
+	t.Helper()
+	ctx := context.Background()
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := storageutil.CreateObject(ctx, b, name, []byte("taco"))
+		require.NoError(t, err)
+	}
+
+	_, _, err := b.StatObject(ctx, &gcs.StatObjectRequest{Name: "a"})
+	require.NoError(t, err)
+	_, _, err = b.StatObject(ctx, &gcs.StatObjectRequest{Name: "missing"})
+	require.Error(t, err)
+	rc, err := b.NewReader(ctx, &gcs.ReadObjectRequest{Name: "b", Range: &gcs.ByteRange{Start: 1, Limit: 3}})
+	require.NoError(t, err)
+	_, err = io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	listing, err := b.ListObjects(ctx, &gcs.ListObjectsRequest{MaxResults: 2})
+	require.NoError(t, err)
+	_, err = b.ListObjects(ctx, &gcs.ListObjectsRequest{MaxResults: 2, ContinuationToken: listing.ContinuationToken})
+	require.NoError(t, err)
+	w, err := b.CreateObjectChunkWriter(ctx, &gcs.CreateObjectRequest{Name: "d"}, 1024, nil)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("burrito"))
+	require.NoError(t, err)
+	_, err = b.FinalizeUpload(ctx, w)
+	require.NoError(t, err)
+	_, err = b.ComposeObjects(ctx, &gcs.ComposeObjectsRequest{DstName: "e", Sources: []gcs.ComposeSource{{Name: "a"}, {Name: "d"}}})
+	require.NoError(t, err)
+	require.NoError(t, b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: "c"}))
+}
+
+func callsByMethod(calls []Call) map[string][]Call {
+	m := make(map[string][]Call)
+	for _, c := range calls {
+		m[c.Method] = append(m[c.Method], c)
+	}
+	return m
+}
+
+func TestRecordingBucketRecordsCalls(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	b := NewRecordingBucket(fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical), rec)
+
+	exercise(t, b)
+
+	require.NoError(t, rec.Close())
+	calls, err := ReadCalls(&buf)
+	require.NoError(t, err)
+	require.Len(t, calls, 12)
+	for i := 1; i < len(calls); i++ {
+		assert.LessOrEqual(t, calls[i-1].Start, calls[i].Start)
+	}
+	byMethod := callsByMethod(calls)
+	assert.Len(t, byMethod["CreateObject"], 3)
+	assert.EqualValues(t, len("taco"), byMethod["CreateObject"][0].Bytes)
+	assert.Equal(t, "some_bucket", byMethod["CreateObject"][0].Bucket)
+	stats := byMethod["StatObject"]
+	require.Len(t, stats, 2)
+	assert.EqualValues(t, len("taco"), stats[0].Bytes)
+	assert.Equal(t, "NotFound", stats[1].Err)
+	read := byMethod["NewReader"][0]
+	assert.Equal(t, &[2]uint64{1, 3}, read.Range)
+	assert.EqualValues(t, 2, read.Bytes)
+	lists := byMethod["ListObjects"]
+	require.Len(t, lists, 2)
+	assert.NotEmpty(t, lists[0].NextToken)
+	assert.Equal(t, lists[0].NextToken, lists[1].ContinuationToken)
+	finalize := byMethod["FinalizeUpload"][0]
+	assert.EqualValues(t, len("burrito"), finalize.Bytes)
+	assert.Equal(t, 1024, finalize.ChunkSize)
+	assert.Equal(t, []string{"a", "d"}, byMethod["ComposeObjects"][0].Sources)
+	assert.Equal(t, "c", byMethod["DeleteObject"][0].Name)
+}
+
+func TestCreateRecorderCompressesGzTraces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl.gz")
+	rec, err := CreateRecorder(path)
+	require.NoError(t, err)
+	rec.Record(&Call{Method: "StatObject", Name: "foo"})
+	require.NoError(t, rec.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	calls, err := ReadCalls(f)
+
+	require.NoError(t, err)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "foo", calls[0].Name)
+}
@@ -0,0 +1,405 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// ReadCalls reads a trace, compressed or not, returning its calls in the
+// order in which they started.
+func ReadCalls(r io.Reader) (calls []Call, err error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(br); err != nil {
+			err = fmt.Errorf("opening compressed trace: %w", err)
+			return
+		}
+
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+
+	dec := json.NewDecoder(br)
+	for {
+		var c Call
+		err = dec.Decode(&c)
+		if err == io.EOF {
+			err = nil
+			break
+		}
+
+		if err != nil {
+			err = fmt.Errorf("reading call %d of trace: %w", len(calls)+1, err)
+			return
+		}
+
+		calls = append(calls, c)
+	}
+
+	sort.SliceStable(calls, func(i, j int) bool { return calls[i].Start < calls[j].Start })
+	return
+}
+
+// A source of zeroes, for the contents of objects written by replays.
+type zeroes struct{}
+
+func (zeroes) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func zeroContents(n int64) io.Reader {
+	return io.LimitReader(zeroes{}, n)
+}
+
+// Seed creates the objects that the trace reads without having created them,
+// filled with zeroes and as large as the trace shows them to be, so that a
+// trace can be replayed against an empty bucket. Objects seen only in
+// listings are not known to the trace, and so aren't created.
+func Seed(ctx context.Context, b gcs.Bucket, calls []Call) (err error) {
+	sizes := make(map[string]int64)
+	created := make(map[string]bool)
+	need := func(name string, size int64) {
+		if name == "" || created[name] {
+			return
+		}
+
+		sizes[name] = max(sizes[name], size)
+	}
+
+	for _, c := range calls {
+		if c.Err != "" {
+			continue
+		}
+
+		switch c.Method {
+		case "NewReader":
+			size := c.Bytes
+			if c.Range != nil && c.Range[1] < 1<<62 {
+				size = max(size, int64(c.Range[1]))
+			}
+
+			need(c.Name, size)
+
+		case "StatObject":
+			need(c.Name, c.Bytes)
+
+		case "UpdateObject", "DeleteObject":
+			need(c.Name, 0)
+
+		case "CopyObject":
+			need(c.Name, 0)
+			created[c.DstName] = true
+
+		case "ComposeObjects":
+			for _, src := range c.Sources {
+				need(src, 0)
+			}
+
+			created[c.Name] = true
+
+		case "CreateObject", "FinalizeUpload":
+			created[c.Name] = true
+		}
+	}
+
+	for name, size := range sizes {
+		if _, err = b.CreateObject(ctx, &gcs.CreateObjectRequest{Name: name, Contents: zeroContents(size)}); err != nil {
+			err = fmt.Errorf("seeding %q: %w", name, err)
+			return
+		}
+	}
+
+	return
+}
+
+// ReplayOptions control the timing of a replay.
+type ReplayOptions struct {
+	// How much faster than recorded to issue the calls, so that 2 halves the
+	// gaps between them. Zero issues every call at once.
+	Speed float64
+}
+
+// A replay in progress. Continuation tokens of the trace are mapped to those
+// returned by the replayed listings, so that paging is followed.
+type replay struct {
+	bucket gcs.Bucket
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	tokens map[string]string
+}
+
+// Replay issues the calls against the bucket with the recorded gaps between
+// their starts, scaled according to the options, and returns the calls as
+// replayed. Calls overlap as they did when recorded. Object generations and
+// the contents of writes aren't reproduced: replays read and modify the live
+// generations and write zeroes. Calls not issued before the context is
+// cancelled are left zero in the result.
+func Replay(ctx context.Context, b gcs.Bucket, calls []Call, opts ReplayOptions) (replayed []Call) {
+	r := &replay{bucket: b, tokens: make(map[string]string)}
+	replayed = make([]Call, len(calls))
+	if len(calls) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	start := time.Now()
+	for i := range calls {
+		if opts.Speed > 0 {
+			offset := time.Duration(float64(calls[i].Start-calls[0].Start) / opts.Speed)
+			select {
+			case <-ctx.Done():
+				// Calls not issued are left zero.
+				return
+			case <-time.After(time.Until(start.Add(offset))):
+			}
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			replayed[i] = r.call(ctx, calls[i])
+		}(i)
+	}
+
+	return
+}
+
+// Issue the call, returning how it went.
+func (r *replay) call(ctx context.Context, c Call) (out Call) {
+	out = c
+	out.Bytes = 0
+	out.ReadTime = 0
+	out.NextToken = ""
+
+	start := time.Now()
+	out.Start = start.UnixNano()
+
+	var err error
+	switch c.Method {
+	case "NewReader":
+		req := &gcs.ReadObjectRequest{Name: c.Name}
+		if c.Range != nil {
+			req.Range = &gcs.ByteRange{Start: c.Range[0], Limit: c.Range[1]}
+		}
+
+		var rc io.ReadCloser
+		if rc, err = r.bucket.NewReader(ctx, req); err != nil {
+			break
+		}
+
+		out.Latency = time.Since(start)
+		out.Bytes, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		out.ReadTime = time.Since(start) - out.Latency
+		out.Err = errorClass(err)
+		return
+
+	case "StatObject":
+		var m *gcs.MinObject
+		if m, _, err = r.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: c.Name, ForceFetchFromGcs: true}); err == nil {
+			out.Bytes = int64(m.Size)
+		}
+
+	case "ListObjects":
+		req := &gcs.ListObjectsRequest{
+			Prefix:     c.Prefix,
+			Delimiter:  c.Delimiter,
+			MaxResults: c.MaxResults,
+		}
+
+		if c.ContinuationToken != "" {
+			r.mu.Lock()
+			req.ContinuationToken = r.tokens[c.ContinuationToken]
+			r.mu.Unlock()
+		}
+
+		var listing *gcs.Listing
+		if listing, err = r.bucket.ListObjects(ctx, req); err == nil && c.NextToken != "" {
+			out.NextToken = listing.ContinuationToken
+			r.mu.Lock()
+			r.tokens[c.NextToken] = listing.ContinuationToken
+			r.mu.Unlock()
+		}
+
+	case "CreateObject":
+		_, err = r.bucket.CreateObject(ctx, &gcs.CreateObjectRequest{Name: c.Name, Contents: zeroContents(c.Bytes)})
+		out.Bytes = c.Bytes
+
+	case "CreateObjectChunkWriter":
+		// Replayed as part of FinalizeUpload, as the writes in between aren't
+		// calls of their own.
+		return
+
+	case "FinalizeUpload":
+		var w gcs.Writer
+		if w, err = r.bucket.CreateObjectChunkWriter(ctx, &gcs.CreateObjectRequest{Name: c.Name}, c.ChunkSize, nil); err != nil {
+			break
+		}
+
+		if out.Bytes, err = io.Copy(w, zeroContents(c.Bytes)); err != nil {
+			break
+		}
+
+		_, err = r.bucket.FinalizeUpload(ctx, w)
+
+	case "CopyObject":
+		_, err = r.bucket.CopyObject(ctx, &gcs.CopyObjectRequest{SrcName: c.Name, DstName: c.DstName})
+
+	case "ComposeObjects":
+		req := &gcs.ComposeObjectsRequest{DstName: c.Name}
+		for _, src := range c.Sources {
+			req.Sources = append(req.Sources, gcs.ComposeSource{Name: src})
+		}
+
+		var o *gcs.Object
+		if o, err = r.bucket.ComposeObjects(ctx, req); err == nil {
+			out.Bytes = int64(o.Size)
+		}
+
+	case "UpdateObject":
+		_, err = r.bucket.UpdateObject(ctx, &gcs.UpdateObjectRequest{Name: c.Name})
+
+	case "DeleteObject":
+		err = r.bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: c.Name})
+
+	case "DeleteFolder":
+		err = r.bucket.DeleteFolder(ctx, c.Name)
+
+	case "GetFolder":
+		_, err = r.bucket.GetFolder(ctx, c.Name)
+
+	case "CreateFolder":
+		_, err = r.bucket.CreateFolder(ctx, c.Name)
+
+	case "RenameFolder":
+		_, err = r.bucket.RenameFolder(ctx, c.Name, c.DstName)
+
+	default:
+		err = fmt.Errorf("unknown method %q", c.Method)
+	}
+
+	out.Latency = time.Since(start)
+	out.Err = errorClass(err)
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Reports
+////////////////////////////////////////////////////////////////////////
+
+// Stats summarizes the calls of one method.
+type Stats struct {
+	Count  int
+	Errors int
+	Bytes  int64
+
+	// Percentiles of the latencies of the calls, which for NewReader include
+	// reading until the reader was closed.
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// Report summarizes calls by method.
+type Report map[string]*Stats
+
+// Return the given percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(p / 100 * float64(len(sorted)))
+	return sorted[min(i, len(sorted)-1)]
+}
+
+// Summarize returns the latency distributions of the calls by method.
+func Summarize(calls []Call) (r Report) {
+	r = make(Report)
+	latencies := make(map[string][]time.Duration)
+	for _, c := range calls {
+		// Chunk writers are accounted for in FinalizeUpload.
+		if c.Method == "" || c.Method == "CreateObjectChunkWriter" {
+			continue
+		}
+
+		s, ok := r[c.Method]
+		if !ok {
+			s = new(Stats)
+			r[c.Method] = s
+		}
+
+		s.Count++
+		s.Bytes += c.Bytes
+		if c.Err != "" {
+			s.Errors++
+		}
+
+		latencies[c.Method] = append(latencies[c.Method], c.Latency+c.ReadTime)
+	}
+
+	for method, l := range latencies {
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		s := r[method]
+		s.P50 = percentile(l, 50)
+		s.P90 = percentile(l, 90)
+		s.P99 = percentile(l, 99)
+		s.Max = l[len(l)-1]
+	}
+
+	return
+}
+
+// String formats the report as a table, one method per row.
+func (r Report) String() string {
+	var methods []string
+	for m := range r {
+		methods = append(methods, m)
+	}
+
+	sort.Strings(methods)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-24s %8s %8s %12s %12s %12s %12s %12s\n", "METHOD", "COUNT", "ERRORS", "BYTES", "P50", "P90", "P99", "MAX")
+	for _, m := range methods {
+		s := r[m]
+		fmt.Fprintf(
+			&sb,
+			"%-24s %8d %8d %12d %12v %12v %12v %12v\n",
+			m, s.Count, s.Errors, s.Bytes,
+			s.P50.Round(time.Microsecond),
+			s.P90.Round(time.Microsecond),
+			s.P99.Round(time.Microsecond),
+			s.Max.Round(time.Microsecond))
+	}
+
+	return sb.String()
+}
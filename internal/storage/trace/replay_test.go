@@ -0,0 +1,102 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeBucket() gcs.Bucket {
+	return fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+}
+
+func TestReplayAgainstSeededBucket(t *testing.T) {
+	ctx := context.Background()
+	// Record against a bucket, and keep only the calls that don't create the
+	// objects read, as though they had been made before recording began.
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	exercise(t, NewRecordingBucket(newFakeBucket(), rec))
+	require.NoError(t, rec.Close())
+	recorded, err := ReadCalls(&buf)
+	require.NoError(t, err)
+	calls := recorded[3:]
+	// Space the calls out so that they don't overlap when replayed.
+	for i := range calls {
+		calls[i].Start = int64(i) * int64(10*time.Millisecond)
+	}
+	b := newFakeBucket()
+
+	require.NoError(t, Seed(ctx, b, calls))
+	replayed := Replay(ctx, b, calls, ReplayOptions{Speed: 1})
+
+	require.Len(t, replayed, len(calls))
+	for i, c := range replayed {
+		assert.Equal(t, calls[i].Method, c.Method)
+		assert.Equal(t, calls[i].Err, c.Err, "call %d: %s(%q)", i, c.Method, c.Name)
+	}
+	byMethod := callsByMethod(replayed)
+	assert.EqualValues(t, 2, byMethod["NewReader"][0].Bytes)
+	lists := byMethod["ListObjects"]
+	require.Len(t, lists, 2)
+	assert.NotEmpty(t, lists[0].NextToken)
+	report := Summarize(replayed)
+	assert.Equal(t, 2, report["StatObject"].Count)
+	assert.Equal(t, 1, report["StatObject"].Errors)
+	assert.NotContains(t, report, "CreateObjectChunkWriter")
+	assert.Contains(t, report.String(), "FinalizeUpload")
+}
+
+func TestReplayScalesTiming(t *testing.T) {
+	start := time.Now().UnixNano()
+	calls := []Call{
+		{Method: "StatObject", Name: "foo", Start: start},
+		{Method: "StatObject", Name: "foo", Start: start + int64(200*time.Millisecond)},
+	}
+
+	before := time.Now()
+	replayed := Replay(context.Background(), newFakeBucket(), calls, ReplayOptions{Speed: 2})
+
+	elapsed := time.Since(before)
+	assert.GreaterOrEqual(t, elapsed, 100*time.Millisecond)
+	assert.Less(t, elapsed, 200*time.Millisecond)
+	assert.GreaterOrEqual(t, replayed[1].Start-replayed[0].Start, int64(100*time.Millisecond))
+	assert.Equal(t, "NotFound", replayed[0].Err)
+}
+
+func TestSummarizePercentiles(t *testing.T) {
+	var calls []Call
+	for i := 1; i <= 100; i++ {
+		calls = append(calls, Call{Method: "StatObject", Latency: time.Duration(i) * time.Millisecond})
+	}
+
+	report := Summarize(calls)
+
+	s := report["StatObject"]
+	assert.Equal(t, 100, s.Count)
+	assert.Equal(t, 51*time.Millisecond, s.P50)
+	assert.Equal(t, 91*time.Millisecond, s.P90)
+	assert.Equal(t, 100*time.Millisecond, s.P99)
+	assert.Equal(t, 100*time.Millisecond, s.Max)
+}
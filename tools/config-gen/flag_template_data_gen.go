@@ -30,6 +30,9 @@ type flagTemplateData struct {
 func computeFlagTemplateData(paramsConfig []Param) ([]flagTemplateData, error) {
 	var flgTemplate []flagTemplateData
 	for _, p := range paramsConfig {
+		if isConfigFileOnly(p.Type) {
+			continue
+		}
 		td, err := computeFlagTemplateDataForParam(p)
 		if err != nil {
 			return nil, err
@@ -64,9 +64,8 @@ func validateParam(param Param) error {
 		return fmt.Errorf("config-path is empty for flag-name: %s", param.FlagName)
 	}
 	for k, v := range map[string]string{
-		"flag-name": param.FlagName,
-		"usage":     param.Usage,
-		"type":      param.Type,
+		"usage": param.Usage,
+		"type":  param.Type,
 	} {
 		if v == "" {
 			return fmt.Errorf("%s is empty for flag-name: %s", k, param.FlagName)
@@ -76,7 +75,7 @@ func validateParam(param Param) error {
 	// Validate the data type.
 	idx := slices.IndexFunc(
 		[]string{"int", "float64", "bool", "string", "duration", "octal", "[]int",
-			"[]string", "logSeverity", "protocol", "resolvedPath"},
+			"[]string", "logSeverity", "protocol", "resolvedPath", "bucketOverrides"},
 		func(dt string) bool {
 			return dt == param.Type
 		},
@@ -85,9 +84,23 @@ func validateParam(param Param) error {
 		return fmt.Errorf("unsupported datatype: %s", param.Type)
 	}
 
+	// Params of config-file-only types have no flag; all others must.
+	if isConfigFileOnly(param.Type) {
+		if param.FlagName != "" {
+			return fmt.Errorf("param %s of type %s can't have a flag-name", param.ConfigPath, param.Type)
+		}
+	} else if param.FlagName == "" {
+		return fmt.Errorf("flag-name is empty for config-path: %s", param.ConfigPath)
+	}
+
 	return nil
 }
 
+// Whether params of the given type can only be set in the config file.
+func isConfigFileOnly(dt string) bool {
+	return dt == "bucketOverrides"
+}
+
 func isSorted(params []Param) error {
 	if len(params) == 0 {
 		return nil
@@ -76,6 +76,8 @@ func getGoDataType(dt string) string {
 		return "int64"
 	case "[]int":
 		return "[]int64"
+	case "bucketOverrides":
+		return "map[string]BucketOverrideConfig"
 	default:
 		return dt
 	}
@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A tool that serves the GCS JSON API over in-memory fake buckets, so that
+// gcsfuse and its storage client can run end-to-end without network access.
+//
+// Usage:
+//
+//	gcsfuse-fake-server [--addr localhost:8080] [--buckets a,b] [--hns]
+//
+// then point gcsfuse at it with
+//
+//	--custom-endpoint http://localhost:8080/storage/v1/
+//
+// The contents of the buckets are lost when the server exits.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake/server"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+)
+
+var (
+	addr    = flag.String("addr", "localhost:8080", "Address on which to serve.")
+	buckets = flag.String("buckets", "fake-bucket", "Comma-separated names of the buckets to serve.")
+	hns     = flag.Bool("hns", false, "Whether the buckets have a hierarchical namespace.")
+)
+
+func main() {
+	flag.Parse()
+
+	bucketType := gcs.NonHierarchical
+	if *hns {
+		bucketType = gcs.Hierarchical
+	}
+
+	var bs []gcs.Bucket
+	for _, name := range strings.Split(*buckets, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			bs = append(bs, fake.NewFakeBucket(timeutil.RealClock(), name, bucketType))
+		}
+	}
+
+	if len(bs) == 0 {
+		log.Fatal("--buckets names no bucket")
+	}
+
+	log.Printf("Serving %d bucket(s) on http://%s", len(bs), *addr)
+	log.Fatal(http.ListenAndServe(*addr, server.NewServer(bs...)))
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A tool that replays a trace recorded with --experimental-gcs-trace-file
+// against in-memory fake buckets, and prints the latencies of the calls as
+// recorded and as replayed.
+//
+// Usage:
+//
+//	gcsfuse-replay --trace trace.jsonl.gz [--speed 1] [--hns]
+//
+// The objects that the trace reads without having created them are created
+// before the replay, filled with zeroes, so that the replay doesn't depend on
+// the contents of the recorded bucket.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/trace"
+	"github.com/jacobsa/timeutil"
+)
+
+var (
+	tracePath = flag.String("trace", "", "Path of the trace to replay.")
+	speed     = flag.Float64("speed", 1, "How much faster than recorded to issue the calls; 0 issues them all at once.")
+	hns       = flag.Bool("hns", false, "Whether the buckets have a hierarchical namespace.")
+)
+
+func main() {
+	flag.Parse()
+	if *tracePath == "" {
+		log.Fatal("--trace is required")
+	}
+
+	f, err := os.Open(*tracePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	calls, err := trace.ReadCalls(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bucketType := gcs.NonHierarchical
+	if *hns {
+		bucketType = gcs.Hierarchical
+	}
+
+	// Replay the calls of each bucket against a fake bucket of its own, all at
+	// the same time so that they overlap as recorded.
+	byBucket := make(map[string][]trace.Call)
+	for _, c := range calls {
+		byBucket[c.Bucket] = append(byBucket[c.Bucket], c)
+	}
+
+	ctx := context.Background()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		replayed []trace.Call
+	)
+
+	for name, bucketCalls := range byBucket {
+		b := fake.NewFakeBucket(timeutil.RealClock(), name, bucketType)
+		if err = trace.Seed(ctx, b, bucketCalls); err != nil {
+			log.Fatalf("seeding bucket %q: %v", name, err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := trace.Replay(ctx, b, bucketCalls, trace.ReplayOptions{Speed: *speed})
+			mu.Lock()
+			replayed = append(replayed, r...)
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	fmt.Printf("Recorded:\n%v\nReplayed:\n%v", trace.Summarize(calls), trace.Summarize(replayed))
+}